@@ -0,0 +1,66 @@
+package main
+
+import (
+	"embed"
+	"errors"
+	"io/fs"
+	"os"
+	"sort"
+)
+
+// embeddedAssets are the built-in pages and static files, so the binary
+// runs on its own from any directory.
+//
+//go:embed templates static
+var embeddedAssets embed.FS
+
+// assetsFS returns the built-in assets, overlaid by the files in dir when
+// it is set.
+func assetsFS(dir string) fs.FS {
+	if dir == "" {
+		return embeddedAssets
+	}
+	return overlayFS{top: os.DirFS(dir), bottom: embeddedAssets}
+}
+
+// overlayFS serves a file from top when it exists there and from bottom
+// otherwise. Directory listings are merged.
+type overlayFS struct {
+	top, bottom fs.FS
+}
+
+func (o overlayFS) Open(name string) (fs.File, error) {
+	f, err := o.top.Open(name)
+	if err == nil {
+		// A directory in top must not hide the files only bottom has
+		if info, statErr := f.Stat(); statErr != nil || !info.IsDir() {
+			return f, nil
+		}
+		f.Close()
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return nil, err
+	}
+	return o.bottom.Open(name)
+}
+
+func (o overlayFS) ReadDir(name string) ([]fs.DirEntry, error) {
+	topEntries, topErr := fs.ReadDir(o.top, name)
+	bottomEntries, bottomErr := fs.ReadDir(o.bottom, name)
+	if topErr != nil && bottomErr != nil {
+		return nil, bottomErr
+	}
+
+	merged := map[string]fs.DirEntry{}
+	for _, e := range bottomEntries {
+		merged[e.Name()] = e
+	}
+	for _, e := range topEntries {
+		merged[e.Name()] = e
+	}
+	entries := make([]fs.DirEntry, 0, len(merged))
+	for _, e := range merged {
+		entries = append(entries, e)
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+	return entries, nil
+}
@@ -33,10 +33,5 @@ else {
     exit 1
 }
 
-# Copy assets
-Write-Host ">>> Copying assets..."
-Copy-Item -Path "templates", "static" -Destination "build" -Recurse -Force
-Write-Host "[OK] Assets copied."
-
 Write-Host "-----------------------------------"
 Write-Host "Build complete. Artifacts are in build/ directory."
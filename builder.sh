@@ -27,10 +27,5 @@ else
     exit 1
 fi
 
-# Copy assets
-echo "📂 Copying assets..."
-cp -r templates static build/
-echo "[OK] Assets copied."
-
 echo "-----------------------------------"
 echo "✨ Build complete! Artifacts are in 'build/' directory."
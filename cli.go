@@ -0,0 +1,776 @@
+package main
+
+import (
+	"bufio"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/user"
+	"path/filepath"
+	"runtime"
+	"runtime/debug"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"netcontrol-containers/config"
+	"netcontrol-containers/database"
+	"netcontrol-containers/logging"
+	"netcontrol-containers/models"
+	"netcontrol-containers/services"
+
+	"golang.org/x/term"
+	"gorm.io/gorm"
+)
+
+// version is set at build time with -ldflags "-X main.version=1.2.3".
+var version = "dev"
+
+// cliCommand is an administrative subcommand. Commands work on the
+// configured database directly, so they also help when nobody can log in.
+type cliCommand struct {
+	name string
+	args string
+	help string
+	run  func(c *cliContext, args []string) error
+}
+
+var cliCommands = []cliCommand{
+	{"user list", "", "List users", cliUserList},
+	{"user add", "USERNAME", "Create a user; the password is read from the terminal or stdin", cliUserAdd},
+	{"user delete", "USERNAME", "Delete a user with their sessions and API tokens", cliUserDelete},
+	{"user reset-password", "USERNAME", "Set a new password, unlock the account and log it out everywhere", cliUserResetPassword},
+	{"sessions revoke", "[USERNAME]", "Log a user out everywhere, or everybody with -all", cliSessionsRevoke},
+	{"settings get", "[KEY]", "Show one setting or all of them", cliSettingsGet},
+	{"settings set", "KEY [VALUE]", "Change a setting; VALUE - reads it from stdin", cliSettingsSet},
+	{"db backup", "[FILE]", "Copy the database, by default into the backups directory of the data directory", cliDBBackup},
+	{"db restore", "FILE", "Replace the database with a backup; the panel must be stopped", cliDBRestore},
+	{"config check", "", "Validate the configuration", cliConfigCheck},
+	{"version", "", "Print the version", cliVersion},
+}
+
+var (
+	// errReported ends a command that has already printed why it failed.
+	errReported = errors.New("reported")
+	// errUsage ends a command called with the wrong arguments.
+	errUsage = errors.New("usage")
+)
+
+// cliContext is the state of one command run.
+type cliContext struct {
+	cmd    *cliCommand
+	flags  *flag.FlagSet
+	json   bool
+	out    io.Writer
+	dbOpen bool
+}
+
+// isCLICommand reports whether arg starts an administrative subcommand
+// rather than a service verb.
+func isCLICommand(arg string) bool {
+	if arg == "help" {
+		return true
+	}
+	for _, cmd := range cliCommands {
+		if strings.SplitN(cmd.name, " ", 2)[0] == arg {
+			return true
+		}
+	}
+	return false
+}
+
+// runCLI runs the subcommand named by args and returns the exit code.
+func runCLI(args []string) int {
+	var cmd *cliCommand
+	for i := range cliCommands {
+		words := strings.Fields(cliCommands[i].name)
+		if len(args) >= len(words) && strings.Join(args[:len(words)], " ") == cliCommands[i].name {
+			cmd = &cliCommands[i]
+			args = args[len(words):]
+			break
+		}
+	}
+	if cmd == nil {
+		cliUsage(os.Stderr)
+		if args[0] == "help" {
+			return 0
+		}
+		return 2
+	}
+
+	c := &cliContext{cmd: cmd, out: os.Stdout}
+	c.flags = flag.NewFlagSet(cmd.name, flag.ContinueOnError)
+	c.flags.BoolVar(&c.json, "json", false, "Print JSON instead of text")
+	config.RegisterFlags(c.flags)
+	c.flags.Usage = func() {
+		fmt.Fprintf(c.flags.Output(), "Usage: %s\n\n%s.\n\nFlags:\n", strings.TrimSpace(programName()+" "+cmd.name+" [flags] "+cmd.args), cmd.help)
+		c.flags.PrintDefaults()
+	}
+
+	err := cmd.run(c, args)
+	if c.dbOpen {
+		services.GetAuditLogger().Flush()
+		database.Close()
+	}
+	switch {
+	case err == nil:
+		return 0
+	case errors.Is(err, flag.ErrHelp):
+		return 0
+	case errors.Is(err, errReported):
+		return 1
+	case errors.Is(err, errUsage):
+		return 2
+	}
+	if c.json {
+		c.print(map[string]string{"error": err.Error()}, nil)
+	} else {
+		fmt.Fprintln(os.Stderr, "Error:", err)
+	}
+	return 1
+}
+
+func cliUsage(w io.Writer) {
+	fmt.Fprintf(w, "Usage: %s [flags] [command]\n\nWithout a command the panel runs in the foreground or as a service.\n\nService commands:\n  install, uninstall, start, stop, restart\n\nAdministrative commands:\n", programName())
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	for _, cmd := range cliCommands {
+		fmt.Fprintf(tw, "  %s %s\t%s\n", cmd.name, cmd.args, cmd.help)
+	}
+	tw.Flush()
+	fmt.Fprintf(w, "\nEvery administrative command accepts -json and the config flags; run %s COMMAND -h for details.\n", programName())
+}
+
+func programName() string {
+	return filepath.Base(os.Args[0])
+}
+
+// parse parses flags, which may come before or after the positional
+// arguments, and checks the number of positional arguments.
+func (c *cliContext) parse(args []string, min, max int) ([]string, error) {
+	var positional []string
+	for {
+		if err := c.flags.Parse(args); err != nil {
+			if errors.Is(err, flag.ErrHelp) {
+				return nil, err
+			}
+			return nil, errUsage
+		}
+		if c.flags.NArg() == 0 {
+			break
+		}
+		positional = append(positional, c.flags.Arg(0))
+		args = c.flags.Args()[1:]
+	}
+	if len(positional) < min || len(positional) > max {
+		c.flags.Usage()
+		return nil, errUsage
+	}
+	return positional, nil
+}
+
+// print writes v as JSON with -json, and otherwise calls text.
+func (c *cliContext) print(v any, text func(w io.Writer)) {
+	if c.json || text == nil {
+		enc := json.NewEncoder(c.out)
+		enc.SetIndent("", "  ")
+		enc.Encode(v)
+		return
+	}
+	tw := tabwriter.NewWriter(c.out, 0, 0, 2, ' ', 0)
+	text(tw)
+	tw.Flush()
+}
+
+// loadConfig loads the configuration the panel would use.
+func (c *cliContext) loadConfig() error {
+	if err := config.Init(); err != nil {
+		return err
+	}
+	logging.Setup(config.Get().LogLevel, config.Get().LogFormat)
+	return nil
+}
+
+// openDB opens the panel's database. Unless create is set, a missing
+// database is an error rather than silently created empty.
+func (c *cliContext) openDB(create bool) error {
+	if err := c.loadConfig(); err != nil {
+		return err
+	}
+
+	path := config.Get().DBPath
+	if _, err := os.Stat(path); err != nil && !create {
+		return fmt.Errorf("no database at %s; pass -config, -data-dir or -db, or start the panel once to create it", path)
+	}
+	if err := database.Init(); err != nil {
+		return fmt.Errorf("open database %s: %w", path, err)
+	}
+	c.dbOpen = true
+	return nil
+}
+
+// audit records a change made from the command line in the audit log.
+func (c *cliContext) audit(target string, err error) {
+	name := "unknown"
+	if u, uerr := user.Current(); uerr == nil {
+		name = u.Username
+	}
+	entry := &models.AuditLog{
+		Username: "cli:" + name,
+		IP:       "local",
+		Action:   "cli." + strings.ReplaceAll(c.cmd.name, " ", "."),
+		Target:   target,
+		Success:  err == nil,
+	}
+	if err != nil {
+		entry.Error = err.Error()
+	}
+	services.GetAuditLogger().Record(entry)
+}
+
+func findUser(username string) (*models.User, error) {
+	var u models.User
+	if err := database.Get().Where("username = ?", username).First(&u).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, fmt.Errorf("no user named %q", username)
+		}
+		return nil, err
+	}
+	return &u, nil
+}
+
+// readPassword reads a new password for username from the terminal, or
+// the first line of stdin when it is not a terminal. With generate a
+// random password is returned instead.
+func readPassword(username string, generate bool) (string, error) {
+	if generate {
+		for {
+			b := make([]byte, 15)
+			rand.Read(b)
+			password := base64.RawURLEncoding.EncodeToString(b)
+			if models.ValidatePassword(password, username) == nil {
+				return password, nil
+			}
+		}
+	}
+
+	var password string
+	if fd := int(os.Stdin.Fd()); term.IsTerminal(fd) {
+		fmt.Fprint(os.Stderr, "New password: ")
+		first, err := term.ReadPassword(fd)
+		fmt.Fprintln(os.Stderr)
+		if err != nil {
+			return "", err
+		}
+		fmt.Fprint(os.Stderr, "Repeat password: ")
+		second, err := term.ReadPassword(fd)
+		fmt.Fprintln(os.Stderr)
+		if err != nil {
+			return "", err
+		}
+		if string(first) != string(second) {
+			return "", errors.New("passwords do not match")
+		}
+		password = string(first)
+	} else {
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && !errors.Is(err, io.EOF) {
+			return "", err
+		}
+		password = strings.TrimRight(line, "\r\n")
+	}
+	return password, models.ValidatePassword(password, username)
+}
+
+func cliUserList(c *cliContext, args []string) error {
+	if _, err := c.parse(args, 0, 0); err != nil {
+		return err
+	}
+	if err := c.openDB(false); err != nil {
+		return err
+	}
+
+	var users []models.User
+	if err := database.Get().Order("id").Find(&users).Error; err != nil {
+		return err
+	}
+	c.print(users, func(w io.Writer) {
+		fmt.Fprintln(w, "ID\tUSERNAME\tROLE\tSOURCE\t2FA\tLOCKED\tCREATED")
+		for _, u := range users {
+			locked := ""
+			if u.Locked() {
+				locked = "until " + u.LockedUntil.Format(time.DateTime)
+			}
+			fmt.Fprintf(w, "%d\t%s\t%s\t%s\t%s\t%s\t%s\n", u.ID, u.Username, u.Role, u.AuthSource, yesNo(u.TOTPEnabled), locked, u.CreatedAt.Format(time.DateOnly))
+		}
+	})
+	return nil
+}
+
+func yesNo(b bool) string {
+	if b {
+		return "yes"
+	}
+	return "no"
+}
+
+func cliUserAdd(c *cliContext, args []string) error {
+	role := c.flags.String("role", models.RoleAdmin, "Role: viewer, operator or admin")
+	generate := c.flags.Bool("generate", false, "Generate a random password and print it")
+	args, err := c.parse(args, 1, 1)
+	if err != nil {
+		return err
+	}
+	username := args[0]
+	if !models.ValidRole(*role) {
+		return fmt.Errorf("invalid role %q", *role)
+	}
+	if len(username) > 50 {
+		return errors.New("username must be at most 50 characters")
+	}
+	if err := c.openDB(true); err != nil {
+		return err
+	}
+	if _, err := findUser(username); err == nil {
+		return fmt.Errorf("user %q already exists; use user reset-password", username)
+	}
+
+	password, err := readPassword(username, *generate)
+	if err != nil {
+		return err
+	}
+	u := models.User{Username: username, Role: *role, AuthSource: models.AuthSourceLocal}
+	if err := u.SetPassword(password); err != nil {
+		return err
+	}
+	err = database.Get().Create(&u).Error
+	c.audit("user="+username, err)
+	if err != nil {
+		return err
+	}
+	// An admin created here makes the setup wizard unnecessary
+	if u.Role == models.RoleAdmin && services.SetupRequired() {
+		if err := services.MarkSetupComplete(); err != nil {
+			return err
+		}
+	}
+
+	result := map[string]any{"user": u}
+	if *generate {
+		result["password"] = password
+	}
+	c.print(result, func(w io.Writer) {
+		fmt.Fprintf(w, "Created %s %q (id %d)\n", u.Role, u.Username, u.ID)
+		if *generate {
+			fmt.Fprintf(w, "Password: %s\n", password)
+		}
+	})
+	return nil
+}
+
+func cliUserDelete(c *cliContext, args []string) error {
+	args, err := c.parse(args, 1, 1)
+	if err != nil {
+		return err
+	}
+	if err := c.openDB(false); err != nil {
+		return err
+	}
+	u, err := findUser(args[0])
+	if err != nil {
+		return err
+	}
+	if u.Role == models.RoleAdmin && isLastAdmin(u.ID) {
+		return errors.New("cannot delete the last admin")
+	}
+
+	err = database.Get().Transaction(func(tx *gorm.DB) error {
+		// Hard delete so the username can be reused
+		if err := tx.Unscoped().Delete(u).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ?", u.ID).Delete(&models.APIToken{}).Error; err != nil {
+			return err
+		}
+		return tx.Where("user_id = ?", u.ID).Delete(&models.Session{}).Error
+	})
+	c.audit("user="+u.Username, err)
+	if err != nil {
+		return err
+	}
+	c.print(map[string]string{"message": "User deleted"}, func(w io.Writer) {
+		fmt.Fprintf(w, "Deleted %q with their sessions and API tokens\n", u.Username)
+	})
+	return nil
+}
+
+func isLastAdmin(userID uint) bool {
+	var count int64
+	database.Get().Model(&models.User{}).
+		Where("role = ? AND id <> ?", models.RoleAdmin, userID).
+		Count(&count)
+	return count == 0
+}
+
+func cliUserResetPassword(c *cliContext, args []string) error {
+	generate := c.flags.Bool("generate", false, "Generate a random password and print it")
+	reset2FA := c.flags.Bool("reset-2fa", false, "Also turn off two-factor authentication")
+	args, err := c.parse(args, 1, 1)
+	if err != nil {
+		return err
+	}
+	if err := c.openDB(false); err != nil {
+		return err
+	}
+	u, err := findUser(args[0])
+	if err != nil {
+		return err
+	}
+	if u.External() {
+		return fmt.Errorf("the password of %q is managed by %s", u.Username, u.AuthSource)
+	}
+
+	password, err := readPassword(u.Username, *generate)
+	if err != nil {
+		return err
+	}
+	if err := u.SetPassword(password); err != nil {
+		return err
+	}
+	u.FailedLogins = 0
+	u.LockedUntil = nil
+	if *reset2FA {
+		u.ResetTwoFactor()
+	}
+	err = database.Get().Save(u).Error
+	if err == nil {
+		err = models.RevokeUserSessions(database.Get(), u.ID, "")
+	}
+	c.audit("user="+u.Username, err)
+	if err != nil {
+		return err
+	}
+
+	result := map[string]any{"message": "Password reset"}
+	if *generate {
+		result["password"] = password
+	}
+	c.print(result, func(w io.Writer) {
+		fmt.Fprintf(w, "Reset the password of %q, unlocked the account and revoked its sessions\n", u.Username)
+		if *reset2FA {
+			fmt.Fprintln(w, "Two-factor authentication is off")
+		}
+		if *generate {
+			fmt.Fprintf(w, "Password: %s\n", password)
+		}
+	})
+	return nil
+}
+
+func cliSessionsRevoke(c *cliContext, args []string) error {
+	all := c.flags.Bool("all", false, "Revoke the sessions of every user")
+	tokens := c.flags.Bool("tokens", false, "Also delete API tokens")
+	args, err := c.parse(args, 0, 1)
+	if err != nil {
+		return err
+	}
+	if len(args) == 0 && !*all {
+		c.flags.Usage()
+		return errUsage
+	}
+	if len(args) > 0 && *all {
+		return errors.New("pass a username or -all, not both")
+	}
+	if err := c.openDB(false); err != nil {
+		return err
+	}
+
+	target := "all"
+	sessions := database.Get().Model(&models.Session{}).Where("revoked_at IS NULL")
+	apiTokens := database.Get().Where("1 = 1")
+	if !*all {
+		u, err := findUser(args[0])
+		if err != nil {
+			return err
+		}
+		target = "user=" + u.Username
+		sessions = sessions.Where("user_id = ?", u.ID)
+		apiTokens = apiTokens.Where("user_id = ?", u.ID)
+	}
+
+	result := sessions.Update("revoked_at", time.Now())
+	err = result.Error
+	revoked, deleted := result.RowsAffected, int64(0)
+	if err == nil && *tokens {
+		result = apiTokens.Delete(&models.APIToken{})
+		err, deleted = result.Error, result.RowsAffected
+	}
+	c.audit(target, err)
+	if err != nil {
+		return err
+	}
+
+	c.print(map[string]int64{"revoked_sessions": revoked, "deleted_tokens": deleted}, func(w io.Writer) {
+		fmt.Fprintf(w, "Revoked %d sessions\n", revoked)
+		if *tokens {
+			fmt.Fprintf(w, "Deleted %d API tokens\n", deleted)
+		}
+	})
+	return nil
+}
+
+func cliSettingsGet(c *cliContext, args []string) error {
+	args, err := c.parse(args, 0, 1)
+	if err != nil {
+		return err
+	}
+	if err := c.openDB(false); err != nil {
+		return err
+	}
+
+	values := services.ListSettings()
+	if len(args) == 1 {
+		for _, v := range values {
+			if v.Key == args[0] {
+				c.print(v, func(w io.Writer) { fmt.Fprintln(w, settingText(v)) })
+				return nil
+			}
+		}
+		return fmt.Errorf("%s: unknown setting", args[0])
+	}
+	c.print(values, func(w io.Writer) {
+		fmt.Fprintln(w, "KEY\tVALUE\tDESCRIPTION")
+		for _, v := range values {
+			fmt.Fprintf(w, "%s\t%s\t%s\n", v.Key, settingText(v), v.Description)
+		}
+	})
+	return nil
+}
+
+// settingText shows a setting's value; secrets only show whether they
+// are set.
+func settingText(v services.SettingValue) string {
+	if v.Secret {
+		if v.IsSet {
+			return "(set)"
+		}
+		return "(not set)"
+	}
+	return v.Value
+}
+
+func cliSettingsSet(c *cliContext, args []string) error {
+	reset := c.flags.Bool("reset", false, "Restore the default instead of setting a value")
+	args, err := c.parse(args, 1, 2)
+	if err != nil {
+		return err
+	}
+	if *reset != (len(args) == 1) {
+		c.flags.Usage()
+		return errUsage
+	}
+	key := args[0]
+
+	var value *string
+	if !*reset {
+		v := args[1]
+		// Secrets don't have to appear in the shell history
+		if v == "-" {
+			line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+			if err != nil && !errors.Is(err, io.EOF) {
+				return err
+			}
+			v = strings.TrimRight(line, "\r\n")
+		}
+		value = &v
+	}
+	if err := c.openDB(false); err != nil {
+		return err
+	}
+	// Changing the algorithm rotates the signing key, which has to start
+	// from the stored keys
+	if err := services.GetJWTKeyManager().Load(); err != nil {
+		return err
+	}
+
+	err = services.UpdateSettings(map[string]*string{key: value})
+	c.audit("key="+key, err)
+	if err != nil {
+		return err
+	}
+	for _, v := range services.ListSettings() {
+		if v.Key == key {
+			c.print(v, func(w io.Writer) { fmt.Fprintf(w, "%s = %s\n", key, settingText(v)) })
+		}
+	}
+	return nil
+}
+
+func cliDBBackup(c *cliContext, args []string) error {
+	args, err := c.parse(args, 0, 1)
+	if err != nil {
+		return err
+	}
+	var path string
+	if len(args) == 1 {
+		if path, err = filepath.Abs(args[0]); err != nil {
+			return err
+		}
+	}
+	if err := c.openDB(false); err != nil {
+		return err
+	}
+	if path == "" {
+		path = filepath.Join(config.Get().DataDir, "backups", "netcontrol-"+time.Now().Format("20060102-150405")+".db")
+	}
+
+	err = database.Backup(path)
+	c.audit("path="+path, err)
+	if err != nil {
+		return err
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+	c.print(map[string]any{"path": path, "size": info.Size()}, func(w io.Writer) {
+		fmt.Fprintf(w, "Backed up to %s (%s)\n", path, formatBytes(uint64(info.Size())))
+	})
+	return nil
+}
+
+func cliDBRestore(c *cliContext, args []string) error {
+	force := c.flags.Bool("force", false, "Restore even though the panel seems to be running")
+	args, err := c.parse(args, 1, 1)
+	if err != nil {
+		return err
+	}
+	src, err := filepath.Abs(args[0])
+	if err != nil {
+		return err
+	}
+	if err := c.loadConfig(); err != nil {
+		return err
+	}
+	if addr := panelAddress(); addr != "" && !*force {
+		return fmt.Errorf("the panel is running on %s; stop it first so it doesn't overwrite the restored database", addr)
+	}
+	dst := config.Get().DBPath
+	previous, err := database.Restore(src, dst)
+	if err != nil {
+		return err
+	}
+
+	// Record the restore in the restored database
+	if err := database.Init(); err == nil {
+		c.dbOpen = true
+		c.audit("path="+src, nil)
+	}
+	result := map[string]string{"path": dst, "previous": previous}
+	c.print(result, func(w io.Writer) {
+		fmt.Fprintf(w, "Restored %s from %s\n", dst, src)
+		if previous != "" {
+			fmt.Fprintf(w, "The replaced database was moved to %s\n", previous)
+		}
+	})
+	return nil
+}
+
+// panelAddress returns the address a running panel answers on, or "" when
+// none does.
+func panelAddress() string {
+	cfg := config.Get()
+	network, addr := "tcp", cfg.Addr()
+	if cfg.Socket != "" {
+		network, addr = "unix", cfg.Socket
+	} else if host, port, err := net.SplitHostPort(addr); err == nil && (host == "" || host == "0.0.0.0" || host == "::") {
+		addr = net.JoinHostPort("localhost", port)
+	}
+	conn, err := net.DialTimeout(network, addr, time.Second)
+	if err != nil {
+		return ""
+	}
+	conn.Close()
+	return addr
+}
+
+func cliConfigCheck(c *cliContext, args []string) error {
+	if _, err := c.parse(args, 0, 0); err != nil {
+		return err
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		var problems []string
+		if joined, ok := errors.Unwrap(err).(interface{ Unwrap() []error }); ok {
+			for _, e := range joined.Unwrap() {
+				problems = append(problems, e.Error())
+			}
+		} else {
+			problems = []string{err.Error()}
+		}
+		c.print(map[string]any{"valid": false, "errors": problems}, func(w io.Writer) {
+			fmt.Fprintln(w, strings.SplitN(err.Error(), "\n", 2)[0])
+			for _, p := range problems {
+				fmt.Fprintf(w, "  - %s\n", p)
+			}
+		})
+		return errReported
+	}
+
+	file := cfg.File
+	if file == "" {
+		file = "(none, defaults and environment)"
+	}
+	c.print(map[string]any{"valid": true, "file": cfg.File, "listen": cfg.Addr(), "data_dir": cfg.DataDir, "db_path": cfg.DBPath, "assets_dir": cfg.AssetsDir, "demo": cfg.Demo}, func(w io.Writer) {
+		fmt.Fprintln(w, "Configuration is valid")
+		fmt.Fprintf(w, "File:\t%s\n", file)
+		fmt.Fprintf(w, "Listen:\t%s\n", cfg.Addr())
+		fmt.Fprintf(w, "Data directory:\t%s\n", cfg.DataDir)
+		fmt.Fprintf(w, "Database:\t%s\n", cfg.DBPath)
+		if cfg.AssetsDir != "" {
+			fmt.Fprintf(w, "Assets override:\t%s\n", cfg.AssetsDir)
+		}
+		if cfg.Demo {
+			fmt.Fprintln(w, "Demo mode:\tbackends are simulated")
+		}
+	})
+	return nil
+}
+
+func cliVersion(c *cliContext, args []string) error {
+	if _, err := c.parse(args, 0, 0); err != nil {
+		return err
+	}
+
+	commit := ""
+	if info, ok := debug.ReadBuildInfo(); ok {
+		modified := false
+		for _, s := range info.Settings {
+			switch s.Key {
+			case "vcs.revision":
+				commit = s.Value[:min(12, len(s.Value))]
+			case "vcs.modified":
+				modified = s.Value == "true"
+			}
+		}
+		if commit != "" && modified {
+			commit += "-dirty"
+		}
+	}
+
+	result := map[string]string{"version": version, "commit": commit, "go": runtime.Version(), "platform": runtime.GOOS + "/" + runtime.GOARCH}
+	c.print(result, func(w io.Writer) {
+		fmt.Fprintf(w, "NetControl Containers %s", version)
+		if commit != "" {
+			fmt.Fprintf(w, " (%s)", commit)
+		}
+		fmt.Fprintf(w, " %s %s\n", runtime.Version(), result["platform"])
+	})
+	return nil
+}
@@ -1,63 +1,651 @@
 package config
 
 import (
+	"bytes"
+	"crypto/tls"
+	"errors"
 	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
 	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"sort"
 	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gopkg.in/yaml.v3"
 )
 
+// Config is the process configuration. It is loaded from the config file,
+// then environment variables, then command line flags, each overriding the
+// previous. A loaded Config is never modified; Reload swaps in a new one.
 type Config struct {
-	Port      int
-	JWTSecret string
-	DBPath    string
-	DebugMode bool
+	// Host is the address to listen on; empty listens on all interfaces.
+	Host string `yaml:"host"`
+	Port int    `yaml:"port"`
+	// Socket, when set, listens on this unix socket instead of Host:Port.
+	Socket string `yaml:"socket"`
+	TLS    TLS    `yaml:"tls"`
+
+	// BasePath is the URL prefix the panel is served under, e.g. /panel
+	// behind a reverse proxy. Empty serves from the root.
+	BasePath string `yaml:"base_path"`
+	// TrustedProxies lists the addresses or CIDR ranges whose
+	// X-Forwarded-For and X-Forwarded-Proto headers are believed.
+	TrustedProxies []string `yaml:"trusted_proxies"`
+
+	// JWTSecret replaces the rotating signing keys stored in the database
+	// with a single static HS256 secret.
+	JWTSecret string `yaml:"jwt_secret"`
+	// DataDir holds the database, generated certificates and the WireGuard
+	// config. Empty picks the platform's location, see defaultDataDir.
+	DataDir string `yaml:"data_dir"`
+	// DBPath is the SQLite database; relative paths are inside DataDir.
+	DBPath string `yaml:"db_path"`
+
+	// AssetsDir overrides the embedded templates and static files: a file
+	// at AssetsDir/templates/x.html or AssetsDir/static/... wins over the
+	// built-in one.
+	AssetsDir string `yaml:"assets_dir"`
+
+	// LogLevel is one of debug, info, warn or error.
+	LogLevel string `yaml:"log_level"`
+	// LogFormat is text or json.
+	LogFormat string `yaml:"log_format"`
+	DebugMode bool   `yaml:"-"`
+
+	// AllowedOrigins lists extra origins (scheme://host[:port]) that may open
+	// WebSocket connections. The panel's own origin is always allowed.
+	AllowedOrigins []string `yaml:"allowed_origins"`
+
+	// FileRoots confines the file manager to these directories. Empty
+	// allows the whole file system.
+	FileRoots []string `yaml:"file_roots"`
+
+	// DockerHost is the Docker daemon address, e.g. unix:///var/run/docker.sock.
+	DockerHost string `yaml:"docker_host"`
+	// Kubeconfig is the kubeconfig file, or a list like KUBECONFIG; empty
+	// tries in-cluster config and then ~/.kube/config.
+	Kubeconfig string `yaml:"kubeconfig"`
+
+	Shutdown Shutdown `yaml:"shutdown"`
+
+	// Demo simulates Docker, Kubernetes, WireGuard, the installer and the
+	// host stats in memory, for demos and frontend development.
+	Demo bool `yaml:"demo"`
+
+	// File is the config file this was loaded from, if any.
+	File string `yaml:"-"`
+}
+
+// Shutdown controls how the server stops on SIGTERM or a service stop.
+type Shutdown struct {
+	// Timeout bounds the whole shutdown, e.g. 30s.
+	Timeout time.Duration `yaml:"timeout"`
+	// Installer is "wait" to let a running installer job finish within the
+	// timeout, or "cancel" to kill it right away.
+	Installer string `yaml:"installer"`
+}
+
+// Installer policies on shutdown.
+const (
+	ShutdownInstallerWait   = "wait"
+	ShutdownInstallerCancel = "cancel"
+)
+
+// TLS configures HTTPS. Without certificate files, the files chosen during
+// first-run setup are used, or else a generated self-signed certificate.
+// Certificate files are reloaded when they change on disk.
+type TLS struct {
+	// Disabled serves plain HTTP, e.g. behind a TLS-terminating proxy.
+	Disabled bool   `yaml:"disabled"`
+	CertFile string `yaml:"cert_file"`
+	KeyFile  string `yaml:"key_file"`
+	// MinVersion is the oldest accepted TLS version: 1.0 to 1.3.
+	MinVersion string `yaml:"min_version"`
+	// RedirectPort, when set, serves a plain HTTP listener that redirects
+	// to HTTPS.
+	RedirectPort int `yaml:"redirect_port"`
+}
+
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// TLSMinVersion returns MinVersion as a crypto/tls constant.
+func (t TLS) TLSMinVersion() uint16 {
+	return tlsVersions[t.MinVersion]
+}
+
+// Addr is the address to listen on.
+func (c *Config) Addr() string {
+	return net.JoinHostPort(c.Host, strconv.Itoa(c.Port))
+}
+
+// IsTrustedProxy reports whether ip is one of the trusted proxies.
+func (c *Config) IsTrustedProxy(ip net.IP) bool {
+	for _, proxy := range c.TrustedProxies {
+		if trusted := net.ParseIP(proxy); trusted != nil {
+			if trusted.Equal(ip) {
+				return true
+			}
+		} else if _, ipNet, err := net.ParseCIDR(proxy); err == nil && ipNet.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+var logLevels = []string{"debug", "info", "warn", "error"}
+
+var (
+	AppConfig *Config
+	basePath  string
+	mu        sync.RWMutex
+	listeners []func(old, new *Config)
+	flags     flagValues
+)
+
+type flagValues struct {
+	configFile pathFlag
+	host       string
+	port       int
+	socket     pathFlag
+	basePath   string
+	logLevel   string
+	logFormat  string
+	dataDir    pathFlag
+	dbPath     pathFlag
+	assetsDir  pathFlag
+	tlsCert    pathFlag
+	tlsKey     pathFlag
+	demo       bool
+}
+
+// pathFlag makes paths absolute as they are parsed, so they still point at
+// the same file when passed on to the installed service, which the service
+// manager starts in a different working directory.
+type pathFlag string
+
+func (p *pathFlag) String() string { return string(*p) }
+
+func (p *pathFlag) Set(value string) error {
+	abs, err := filepath.Abs(value)
+	if err != nil {
+		return err
+	}
+	*p = pathFlag(abs)
+	return nil
+}
+
+// RegisterFlags defines the configuration flags on fs. It must be called
+// before fs is parsed.
+func RegisterFlags(fs *flag.FlagSet) {
+	fs.Var(&flags.configFile, "config", "Path to a YAML config file")
+	fs.StringVar(&flags.host, "host", "", "Address to listen on")
+	fs.IntVar(&flags.port, "port", 0, "Port to run the server on")
+	fs.Var(&flags.socket, "socket", "Unix socket to listen on instead of host and port")
+	fs.StringVar(&flags.basePath, "base-path", "", "URL prefix to serve the panel under, e.g. /panel")
+	fs.StringVar(&flags.logLevel, "log-level", "", "Log level: debug, info, warn or error")
+	fs.StringVar(&flags.logFormat, "log-format", "", "Log format: text or json")
+	fs.Var(&flags.dataDir, "data-dir", "Directory for the database and generated files")
+	fs.Var(&flags.dbPath, "db", "Path to the SQLite database")
+	fs.Var(&flags.assetsDir, "assets-dir", "Directory whose templates and static files override the built-in ones")
+	fs.Var(&flags.tlsCert, "tls-cert", "TLS certificate file")
+	fs.Var(&flags.tlsKey, "tls-key", "TLS private key file")
+	fs.BoolVar(&flags.demo, "demo", false, "Simulate Docker, Kubernetes, WireGuard and host stats instead of using this host")
+}
+
+// ServiceArguments returns the flags the installed service has to be started
+// with to find the same config file.
+func ServiceArguments() []string {
+	if flags.configFile == "" {
+		return nil
+	}
+	return []string{"-config", string(flags.configFile)}
+}
+
+// Init loads the configuration. It returns every validation error at once.
+func Init() error {
+	cfg, err := Load()
+	if err != nil {
+		return err
+	}
+	mu.Lock()
+	AppConfig = cfg
+	basePath = cfg.BasePath
+	mu.Unlock()
+	return nil
+}
+
+// BasePath returns the URL prefix the routes were registered under. Unlike
+// Get().BasePath it does not change on reload.
+func BasePath() string {
+	mu.RLock()
+	defer mu.RUnlock()
+	return basePath
+}
+
+// Load reads the configuration without installing it.
+func Load() (*Config, error) {
+	cfg := &Config{
+		Port:           7002,
+		TLS:            TLS{MinVersion: "1.2"},
+		Shutdown:       Shutdown{Timeout: 30 * time.Second, Installer: ShutdownInstallerWait},
+		TrustedProxies: []string{"127.0.0.1", "::1"},
+		DBPath:         "netcontrol.db",
+		LogLevel:       "info",
+		LogFormat:      "text",
+	}
+
+	if flags.configFile == "" {
+		if env := os.Getenv("CONFIG_FILE"); env != "" {
+			// Absolute like the flag, so ServiceArguments hands the same
+			// file to the installed service
+			if err := flags.configFile.Set(env); err != nil {
+				return nil, err
+			}
+		}
+	}
+	if path := string(flags.configFile); path != "" {
+		if err := cfg.loadFile(path); err != nil {
+			return nil, err
+		}
+	}
+	cfg.loadEnv()
+	cfg.loadFlags()
+	cfg.resolveDataDir()
+
+	cfg.LogLevel = strings.ToLower(cfg.LogLevel)
+	cfg.LogFormat = strings.ToLower(cfg.LogFormat)
+	cfg.BasePath = strings.TrimSuffix(cfg.BasePath, "/")
+	cfg.DebugMode = cfg.LogLevel == "debug"
+	for i, origin := range cfg.AllowedOrigins {
+		cfg.AllowedOrigins[i] = strings.TrimSuffix(origin, "/")
+	}
+	for i, root := range cfg.FileRoots {
+		cfg.FileRoots[i] = filepath.Clean(root)
+	}
+
+	if err := cfg.Validate(); err != nil {
+		if cfg.File != "" {
+			return nil, fmt.Errorf("invalid configuration (%s):\n%w", cfg.File, err)
+		}
+		return nil, fmt.Errorf("invalid configuration:\n%w", err)
+	}
+	return cfg, nil
 }
 
-var AppConfig *Config
+func (c *Config) loadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("read config file: %w", err)
+	}
+
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(c); err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("parse config file %s: %w", path, err)
+	}
+	c.File = path
 
-func Init() {
-	// dedicated flag set to avoid interference if tested
-	var portFlag int
+	// Paths in the file are relative to the file
+	dir := filepath.Dir(path)
+	for _, p := range []*string{&c.DataDir, &c.AssetsDir, &c.TLS.CertFile, &c.TLS.KeyFile} {
+		if *p != "" && !filepath.IsAbs(*p) {
+			*p = filepath.Join(dir, *p)
+		}
+	}
+	return nil
+}
 
-	// Only define and parse if not already parsed (safeguard)
-	if !flag.Parsed() {
-		flag.IntVar(&portFlag, "port", 0, "Port to run the server on")
-		flag.Parse()
+// resolveDataDir makes DataDir and DBPath absolute. Installs from before
+// the data directory keep their database next to the executable.
+func (c *Config) resolveDataDir() {
+	if c.DataDir == "" {
+		if exe, err := os.Executable(); err == nil && !filepath.IsAbs(c.DBPath) {
+			for _, legacy := range []string{filepath.Join(filepath.Dir(exe), c.DBPath), filepath.Join(filepath.Dir(exe), "data", "netcontrol.db")} {
+				if _, err := os.Stat(legacy); err == nil {
+					c.DataDir, c.DBPath = filepath.Dir(legacy), legacy
+					return
+				}
+			}
+		}
+		c.DataDir = defaultDataDir()
+	}
+	if abs, err := filepath.Abs(c.DataDir); err == nil {
+		c.DataDir = abs
+	}
+	if c.DBPath != "" && !filepath.IsAbs(c.DBPath) {
+		c.DBPath = filepath.Join(c.DataDir, c.DBPath)
+	}
+}
+
+// defaultDataDir is the systemd state directory when set, otherwise the
+// system location when running as root or a service, else a per-user one.
+func defaultDataDir() string {
+	if dir := os.Getenv("STATE_DIRECTORY"); dir != "" {
+		// systemd passes a colon separated list for several directories
+		return strings.Split(dir, ":")[0]
+	}
+	switch runtime.GOOS {
+	case "windows":
+		if dir := os.Getenv("ProgramData"); dir != "" {
+			return filepath.Join(dir, "NetControlContainers")
+		}
+	case "darwin":
+		if os.Geteuid() == 0 {
+			return "/Library/Application Support/NetControlContainers"
+		}
+		if home, err := os.UserHomeDir(); err == nil {
+			return filepath.Join(home, "Library", "Application Support", "NetControlContainers")
+		}
+	default:
+		if os.Geteuid() == 0 {
+			return "/var/lib/netcontrol-containers"
+		}
+		if dir := os.Getenv("XDG_DATA_HOME"); dir != "" {
+			return filepath.Join(dir, "netcontrol-containers")
+		}
+		if home, err := os.UserHomeDir(); err == nil {
+			return filepath.Join(home, ".local", "share", "netcontrol-containers")
+		}
 	}
+	return "data"
+}
 
-	port := 7002
+func (c *Config) loadEnv() {
+	envString("LISTEN_HOST", &c.Host)
+	envString("LISTEN_SOCKET", &c.Socket)
+	envString("BASE_PATH", &c.BasePath)
+	envList("TRUSTED_PROXIES", &c.TrustedProxies)
 	if p := os.Getenv("PORT"); p != "" {
 		if parsed, err := strconv.Atoi(p); err == nil {
-			port = parsed
+			c.Port = parsed
+		} else {
+			c.Port = -1 // reported by Validate
 		}
 	}
+	envString("TLS_CERT_FILE", &c.TLS.CertFile)
+	envString("TLS_KEY_FILE", &c.TLS.KeyFile)
+	envString("TLS_MIN_VERSION", &c.TLS.MinVersion)
+	if v := os.Getenv("TLS_DISABLED"); v != "" {
+		c.TLS.Disabled = v == "true"
+	}
+	if p := os.Getenv("TLS_REDIRECT_PORT"); p != "" {
+		if parsed, err := strconv.Atoi(p); err == nil {
+			c.TLS.RedirectPort = parsed
+		} else {
+			c.TLS.RedirectPort = -1 // reported by Validate
+		}
+	}
+	envString("JWT_SECRET", &c.JWTSecret)
+	envString("DATA_DIR", &c.DataDir)
+	envString("DB_PATH", &c.DBPath)
+	envString("ASSETS_DIR", &c.AssetsDir)
+	if os.Getenv("DEBUG") == "true" {
+		c.LogLevel = "debug"
+	}
+	envString("LOG_LEVEL", &c.LogLevel)
+	envString("LOG_FORMAT", &c.LogFormat)
+	envList("ALLOWED_ORIGINS", &c.AllowedOrigins)
+	envList("FILE_ROOTS", &c.FileRoots)
+	envString("DOCKER_HOST", &c.DockerHost)
+	envString("KUBECONFIG", &c.Kubeconfig)
+	if v := os.Getenv("SHUTDOWN_TIMEOUT"); v != "" {
+		if parsed, err := time.ParseDuration(v); err == nil {
+			c.Shutdown.Timeout = parsed
+		} else {
+			c.Shutdown.Timeout = -1 // reported by Validate
+		}
+	}
+	envString("SHUTDOWN_INSTALLER", &c.Shutdown.Installer)
+	if v := os.Getenv("DEMO"); v != "" {
+		c.Demo = v == "true"
+	}
+}
 
+func (c *Config) loadFlags() {
+	if flags.host != "" {
+		c.Host = flags.host
+	}
+	if flags.socket != "" {
+		c.Socket = string(flags.socket)
+	}
+	if flags.basePath != "" {
+		c.BasePath = flags.basePath
+	}
 	// Flag overrides env and default if provided (non-zero)
-	if portFlag != 0 {
-		port = portFlag
+	if flags.port != 0 {
+		c.Port = flags.port
+	}
+	if flags.logLevel != "" {
+		c.LogLevel = flags.logLevel
+	}
+	if flags.logFormat != "" {
+		c.LogFormat = flags.logFormat
+	}
+	if flags.dataDir != "" {
+		c.DataDir = string(flags.dataDir)
+	}
+	if flags.dbPath != "" {
+		c.DBPath = string(flags.dbPath)
+	}
+	if flags.assetsDir != "" {
+		c.AssetsDir = string(flags.assetsDir)
+	}
+	if flags.tlsCert != "" {
+		c.TLS.CertFile = string(flags.tlsCert)
+	}
+	if flags.tlsKey != "" {
+		c.TLS.KeyFile = string(flags.tlsKey)
+	}
+	if flags.demo {
+		c.Demo = true
+	}
+}
+
+func envString(name string, target *string) {
+	if value := os.Getenv(name); value != "" {
+		*target = value
+	}
+}
+
+// envList reads a comma separated list.
+func envList(name string, target *[]string) {
+	value := os.Getenv(name)
+	if value == "" {
+		return
+	}
+	var list []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	*target = list
+}
+
+// Validate reports every problem with the configuration.
+func (c *Config) Validate() error {
+	var errs []error
+	if c.Port < 1 || c.Port > 65535 {
+		errs = append(errs, fmt.Errorf("port must be between 1 and 65535"))
+	}
+	if c.Host != "" && net.ParseIP(c.Host) == nil && !validHostname(c.Host) {
+		errs = append(errs, fmt.Errorf("host %q is not an IP address or host name", c.Host))
+	}
+	if c.BasePath != "" && (!strings.HasPrefix(c.BasePath, "/") || strings.ContainsAny(c.BasePath, "?#*:") || path.Clean(c.BasePath) != c.BasePath) {
+		errs = append(errs, fmt.Errorf("base_path %q must be a clean absolute URL path such as /panel", c.BasePath))
 	}
+	for _, proxy := range c.TrustedProxies {
+		if net.ParseIP(proxy) == nil {
+			if _, _, err := net.ParseCIDR(proxy); err != nil {
+				errs = append(errs, fmt.Errorf("trusted proxy %q is not an IP address or CIDR range", proxy))
+			}
+		}
+	}
+	if (c.TLS.CertFile == "") != (c.TLS.KeyFile == "") {
+		errs = append(errs, fmt.Errorf("tls needs both cert_file and key_file"))
+	}
+	if c.Shutdown.Timeout <= 0 {
+		errs = append(errs, fmt.Errorf("shutdown.timeout must be a positive duration such as 30s"))
+	}
+	if c.Shutdown.Installer != ShutdownInstallerWait && c.Shutdown.Installer != ShutdownInstallerCancel {
+		errs = append(errs, fmt.Errorf("shutdown.installer %q must be wait or cancel", c.Shutdown.Installer))
+	}
+	if _, ok := tlsVersions[c.TLS.MinVersion]; !ok {
+		errs = append(errs, fmt.Errorf("tls.min_version must be 1.0, 1.1, 1.2 or 1.3"))
+	}
+	if c.TLS.RedirectPort < 0 || c.TLS.RedirectPort > 65535 || (c.TLS.RedirectPort != 0 && c.TLS.RedirectPort == c.Port) {
+		errs = append(errs, fmt.Errorf("tls.redirect_port must be a free port other than port"))
+	}
+	files := []string{c.TLS.CertFile, c.TLS.KeyFile, c.AssetsDir}
+	if !strings.ContainsRune(c.Kubeconfig, os.PathListSeparator) {
+		files = append(files, c.Kubeconfig)
+	}
+	for _, file := range files {
+		if file == "" {
+			continue
+		}
+		if _, err := os.Stat(file); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if c.DBPath == "" {
+		errs = append(errs, fmt.Errorf("db_path must not be empty"))
+	}
+	if !validLogLevel(c.LogLevel) {
+		errs = append(errs, fmt.Errorf("log_level must be one of %s", strings.Join(logLevels, ", ")))
+	}
+	if c.LogFormat != "text" && c.LogFormat != "json" {
+		errs = append(errs, fmt.Errorf("log_format must be text or json"))
+	}
+	for _, origin := range c.AllowedOrigins {
+		u, err := url.Parse(origin)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" || (u.Path != "" && u.Path != "/") {
+			errs = append(errs, fmt.Errorf("allowed origin %q must look like https://host[:port]", origin))
+		}
+	}
+	for _, root := range c.FileRoots {
+		if !filepath.IsAbs(root) {
+			errs = append(errs, fmt.Errorf("file root %q must be an absolute path", root))
+		}
+	}
+	if c.DockerHost != "" {
+		if u, err := url.Parse(c.DockerHost); err != nil || u.Scheme == "" {
+			errs = append(errs, fmt.Errorf("docker_host %q must be a URL such as unix:///var/run/docker.sock or tcp://host:2376", c.DockerHost))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func validLogLevel(level string) bool {
+	for _, l := range logLevels {
+		if level == l {
+			return true
+		}
+	}
+	return false
+}
 
-	jwtSecret := os.Getenv("JWT_SECRET")
-	if jwtSecret == "" {
-		jwtSecret = "netcontrol-secret-key-change-in-production"
+func validHostname(host string) bool {
+	for _, label := range strings.Split(host, ".") {
+		if label == "" || len(label) > 63 {
+			return false
+		}
+		for _, r := range label {
+			if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '-') {
+				return false
+			}
+		}
 	}
+	return true
+}
 
-	dbPath := os.Getenv("DB_PATH")
-	if dbPath == "" {
-		dbPath = "./data/netcontrol.db"
+// Reload reads the configuration again and installs it if it is valid. It
+// notifies OnReload listeners and returns the names of changed settings
+// that only take effect after a restart.
+func Reload() ([]string, error) {
+	cfg, err := Load()
+	if err != nil {
+		return nil, err
 	}
 
-	AppConfig = &Config{
-		Port:      port,
-		JWTSecret: jwtSecret,
-		DBPath:    dbPath,
-		DebugMode: os.Getenv("DEBUG") == "true",
+	mu.Lock()
+	old := AppConfig
+	AppConfig = cfg
+	callbacks := append([]func(old, new *Config){}, listeners...)
+	mu.Unlock()
+
+	var pending []string
+	if old != nil {
+		pending = restartChanges(old, cfg)
 	}
+	for _, fn := range callbacks {
+		fn(old, cfg)
+	}
+	return pending, nil
+}
+
+// restartChanges lists the changed settings that are only read at startup.
+func restartChanges(old, new *Config) []string {
+	var changed []string
+	for name, differs := range map[string]bool{
+		"host":              old.Host != new.Host,
+		"port":              old.Port != new.Port,
+		"socket":            old.Socket != new.Socket,
+		"base_path":         old.BasePath != new.BasePath,
+		"trusted_proxies":   !slices.Equal(old.TrustedProxies, new.TrustedProxies),
+		"tls.disabled":      old.TLS.Disabled != new.TLS.Disabled,
+		"tls.min_version":   old.TLS.MinVersion != new.TLS.MinVersion,
+		"tls.redirect_port": old.TLS.RedirectPort != new.TLS.RedirectPort,
+		"jwt_secret":        old.JWTSecret != new.JWTSecret,
+		"data_dir":          old.DataDir != new.DataDir,
+		"db_path":           old.DBPath != new.DBPath,
+		"assets_dir":        old.AssetsDir != new.AssetsDir,
+		"demo":              old.Demo != new.Demo,
+	} {
+		if differs {
+			changed = append(changed, name)
+		}
+	}
+	sort.Strings(changed)
+	return changed
+}
+
+// OnReload registers fn to be called after every successful Reload.
+func OnReload(fn func(old, new *Config)) {
+	mu.Lock()
+	defer mu.Unlock()
+	listeners = append(listeners, fn)
 }
 
 func Get() *Config {
-	if AppConfig == nil {
-		Init()
+	mu.RLock()
+	cfg := AppConfig
+	mu.RUnlock()
+	if cfg != nil {
+		return cfg
+	}
+
+	if err := Init(); err != nil {
+		// Only reached when Init was skipped, e.g. by tooling
+		mu.Lock()
+		AppConfig = &Config{Port: 7002, DataDir: "data", DBPath: filepath.Join("data", "netcontrol.db"), LogLevel: "info", LogFormat: "text"}
+		mu.Unlock()
 	}
+	mu.RLock()
+	defer mu.RUnlock()
 	return AppConfig
 }
@@ -0,0 +1,113 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/glebarez/sqlite"
+	"gorm.io/gorm"
+)
+
+// Backup writes a consistent copy of the open database to path. It is safe
+// while the panel is serving requests.
+func Backup(path string) error {
+	if DB == nil {
+		return errors.New("database is not open")
+	}
+	if _, err := os.Stat(path); err == nil {
+		return fmt.Errorf("%s already exists", path)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	if err := DB.Exec("VACUUM INTO ?", path).Error; err != nil {
+		return err
+	}
+	// The copy holds password hashes and signing keys
+	return os.Chmod(path, 0600)
+}
+
+// Verify checks that path is an intact panel database.
+func Verify(path string) error {
+	if _, err := os.Stat(path); err != nil {
+		return err
+	}
+	db, err := gorm.Open(sqlite.Open("file:"+path+"?mode=ro"), &gorm.Config{Logger: quietLogger})
+	if err != nil {
+		return err
+	}
+	if sqlDB, err := db.DB(); err == nil {
+		defer sqlDB.Close()
+	}
+
+	var result string
+	if err := db.Raw("PRAGMA integrity_check").Scan(&result).Error; err != nil {
+		return fmt.Errorf("%s is not a SQLite database: %w", path, err)
+	}
+	if result != "ok" {
+		return fmt.Errorf("%s is corrupt: %s", path, result)
+	}
+	for _, table := range []string{"users", "settings"} {
+		if !db.Migrator().HasTable(table) {
+			return fmt.Errorf("%s is not a panel database: no %s table", path, table)
+		}
+	}
+	return nil
+}
+
+// Restore replaces the database file at dst with the backup at src. The
+// file it replaces is kept next to it and its path returned. The database
+// must not be open, in this process or any other.
+func Restore(src, dst string) (previous string, err error) {
+	if err := Verify(src); err != nil {
+		return "", err
+	}
+
+	in, err := os.Open(src)
+	if err != nil {
+		return "", err
+	}
+	defer in.Close()
+
+	// Copy next to the target so the final rename is atomic
+	tmp, err := os.CreateTemp(filepath.Dir(dst), filepath.Base(dst)+".restore-*")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := io.Copy(tmp, in); err != nil {
+		tmp.Close()
+		return "", err
+	}
+	if err := tmp.Chmod(0600); err != nil {
+		tmp.Close()
+		return "", err
+	}
+	if err := tmp.Close(); err != nil {
+		return "", err
+	}
+
+	// Move the old file aside together with its journal, which would
+	// otherwise be applied to the restored file
+	if _, err := os.Stat(dst); err == nil {
+		previous = dst + ".before-restore-" + time.Now().Format("20060102-150405")
+	}
+	for _, suffix := range []string{"", "-wal", "-shm", "-journal"} {
+		if _, err := os.Stat(dst + suffix); err != nil {
+			continue
+		}
+		if previous == "" {
+			err = os.Remove(dst + suffix)
+		} else {
+			err = os.Rename(dst+suffix, previous+suffix)
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+	return previous, os.Rename(tmp.Name(), dst)
+}
@@ -1,9 +1,12 @@
 package database
 
 import (
-	"log"
+	"context"
+	"log/slog"
 	"os"
 	"path/filepath"
+	"sync/atomic"
+	"time"
 
 	"netcontrol-containers/config"
 	"netcontrol-containers/models"
@@ -25,42 +28,115 @@ func Init() error {
 	}
 
 	// Configure logger
-	logLevel := logger.Silent
-	if cfg.DebugMode {
-		logLevel = logger.Info
-	}
+	SetDebug(cfg.DebugMode)
 
 	// Open database
 	db, err := gorm.Open(sqlite.Open(cfg.DBPath), &gorm.Config{
-		Logger: logger.Default.LogMode(logLevel),
+		Logger: queryLogger,
 	})
 	if err != nil {
 		return err
 	}
 
 	// Auto migrate
-	if err := db.AutoMigrate(&models.User{}, &models.Settings{}); err != nil {
+	if err := db.AutoMigrate(
+		&models.User{},
+		&models.Settings{},
+		&models.APIToken{},
+		&models.Session{},
+		&models.LoginAttempt{},
+		&models.AuditLog{},
+	); err != nil {
 		return err
 	}
 
-	// Seed default admin user
+	if err := migrateRoles(db); err != nil {
+		return err
+	}
+
+	// Installs that predate the setup wizard are already set up
 	var count int64
 	db.Model(&models.User{}).Count(&count)
-	if count == 0 {
-		admin := &models.User{Username: "admin"}
-		if err := admin.SetPassword("admin123"); err != nil {
+	if count > 0 && models.GetSetting(db, models.SettingSetupCompleted) == "" {
+		if err := models.SetSetting(db, models.SettingSetupCompleted, "true"); err != nil {
 			return err
 		}
-		if err := db.Create(admin).Error; err != nil {
-			return err
-		}
-		log.Println("Default admin user created (admin:admin123)")
 	}
 
 	DB = db
 	return nil
 }
 
+// migrateRoles gives users created before roles existed full access. It
+// runs once, so a user stored without a role later is not made an admin.
+func migrateRoles(db *gorm.DB) error {
+	if models.GetSetting(db, models.SettingMigratedRoles) != "" {
+		return nil
+	}
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.User{}).Where("role = ? OR role IS NULL", "").Update("role", models.RoleAdmin).Error; err != nil {
+			return err
+		}
+		return models.SetSetting(tx, models.SettingMigratedRoles, "true")
+	})
+}
+
+// switchLogger logs SQL statements only while debug logging is on, so the
+// log level can change without reopening the database.
+type switchLogger struct {
+	debug atomic.Bool
+}
+
+var queryLogger = &switchLogger{}
+
+var quietLogger = logger.Default.LogMode(logger.Silent)
+
+// SetDebug turns SQL statement logging on or off.
+func SetDebug(debug bool) {
+	queryLogger.debug.Store(debug)
+}
+
+func (l *switchLogger) current() logger.Interface {
+	if l.debug.Load() {
+		// Built on each call so it follows the current default logger
+		return logger.NewSlogLogger(slog.Default(), logger.Config{
+			LogLevel:      logger.Info,
+			SlowThreshold: 200 * time.Millisecond,
+		})
+	}
+	return quietLogger
+}
+
+func (l *switchLogger) LogMode(logger.LogLevel) logger.Interface { return l }
+
+func (l *switchLogger) Info(ctx context.Context, msg string, args ...interface{}) {
+	l.current().Info(ctx, msg, args...)
+}
+
+func (l *switchLogger) Warn(ctx context.Context, msg string, args ...interface{}) {
+	l.current().Warn(ctx, msg, args...)
+}
+
+func (l *switchLogger) Error(ctx context.Context, msg string, args ...interface{}) {
+	l.current().Error(ctx, msg, args...)
+}
+
+func (l *switchLogger) Trace(ctx context.Context, begin time.Time, fc func() (string, int64), err error) {
+	l.current().Trace(ctx, begin, fc, err)
+}
+
+// Close closes the database connection.
+func Close() error {
+	if DB == nil {
+		return nil
+	}
+	sqlDB, err := DB.DB()
+	if err != nil {
+		return err
+	}
+	return sqlDB.Close()
+}
+
 func Get() *gorm.DB {
 	return DB
 }
@@ -0,0 +1,172 @@
+package handlers
+
+import (
+	"encoding/csv"
+	"net/http"
+	"strconv"
+	"time"
+
+	"netcontrol-containers/database"
+	"netcontrol-containers/middleware"
+	"netcontrol-containers/models"
+	"netcontrol-containers/services"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+const auditCSVLimit = 100000
+
+// recordAudit writes an audit entry for actions that do not pass through the
+// Audit middleware, i.e. the WebSocket endpoints.
+func recordAudit(c *gin.Context, action, target string, err error) {
+	entry := middleware.NewAuditEntry(c, action, target)
+	entry.Success = err == nil
+	if err != nil {
+		entry.Error = err.Error()
+	}
+	services.GetAuditLogger().Record(entry)
+}
+
+// ListAuditLogs returns audit entries, newest first. Supported filters are
+// user, action, target, success, from and to; results are paginated with
+// page and per_page, or exported in full with format=csv.
+func ListAuditLogs(c *gin.Context) {
+	query, err := auditQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if c.Query("format") == "csv" {
+		exportAuditCSV(c, query)
+		return
+	}
+
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	if page < 1 {
+		page = 1
+	}
+	perPage, _ := strconv.Atoi(c.DefaultQuery("per_page", "50"))
+	if perPage < 1 || perPage > 500 {
+		perPage = 50
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	var entries []models.AuditLog
+	if err := query.Order("id DESC").Offset((page - 1) * perPage).Limit(perPage).Find(&entries).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"entries":  entries,
+		"total":    total,
+		"page":     page,
+		"per_page": perPage,
+	})
+}
+
+func auditQuery(c *gin.Context) (*gorm.DB, error) {
+	query := database.Get().Model(&models.AuditLog{})
+
+	if user := c.Query("user"); user != "" {
+		query = query.Where("username = ?", user)
+	}
+	if action := c.Query("action"); action != "" {
+		query = query.Where("action LIKE ?", "%"+action+"%")
+	}
+	if target := c.Query("target"); target != "" {
+		query = query.Where("target LIKE ?", "%"+target+"%")
+	}
+	if requestID := c.Query("request_id"); requestID != "" {
+		query = query.Where("request_id = ?", requestID)
+	}
+	if success := c.Query("success"); success != "" {
+		query = query.Where("success = ?", success == "true")
+	}
+	if from := c.Query("from"); from != "" {
+		t, err := parseAuditTime(from)
+		if err != nil {
+			return nil, err
+		}
+		query = query.Where("created_at >= ?", t)
+	}
+	if to := c.Query("to"); to != "" {
+		t, err := parseAuditTime(to)
+		if err != nil {
+			return nil, err
+		}
+		query = query.Where("created_at <= ?", t)
+	}
+	return query, nil
+}
+
+// parseAuditTime accepts RFC 3339 timestamps or plain dates.
+func parseAuditTime(value string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return t, nil
+	}
+	return time.ParseInLocation("2006-01-02", value, time.Local)
+}
+
+func exportAuditCSV(c *gin.Context, query *gorm.DB) {
+	var entries []models.AuditLog
+	if err := query.Order("id DESC").Limit(auditCSVLimit).Find(&entries).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	filename := "audit-" + time.Now().Format("20060102-150405") + ".csv"
+	c.Header("Content-Type", "text/csv")
+	c.Header("Content-Disposition", "attachment; filename="+filename)
+
+	w := csv.NewWriter(c.Writer)
+	w.Write([]string{"id", "time", "user_id", "username", "ip", "action", "target", "params", "status", "success", "error", "duration_ms", "request_id"})
+	for _, e := range entries {
+		w.Write([]string{
+			strconv.FormatUint(uint64(e.ID), 10),
+			e.CreatedAt.Format(time.RFC3339),
+			strconv.FormatUint(uint64(e.UserID), 10),
+			e.Username,
+			e.IP,
+			e.Action,
+			e.Target,
+			e.Params,
+			strconv.Itoa(e.Status),
+			strconv.FormatBool(e.Success),
+			e.Error,
+			strconv.FormatInt(e.DurationMs, 10),
+			e.RequestID,
+		})
+	}
+	w.Flush()
+}
+
+func GetAuditRetention(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"retention_days": services.AuditRetentionDays()})
+}
+
+func SetAuditRetention(c *gin.Context) {
+	var req struct {
+		RetentionDays *int `json:"retention_days" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "retention_days is required"})
+		return
+	}
+
+	// Lowering the retention prunes right away through the settings listener
+	value := strconv.Itoa(*req.RetentionDays)
+	if err := services.UpdateSettings(map[string]*string{services.SettingAuditRetentionDays: &value}); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Audit retention updated", "retention_days": *req.RetentionDays})
+}
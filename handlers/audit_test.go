@@ -0,0 +1,60 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"netcontrol-containers/models"
+)
+
+func TestAuditRetentionNeedsSettingsWrite(t *testing.T) {
+	r := newPanelRouter()
+	reader := apiToken(t, models.RoleAdmin, models.ScopeAuditRead)
+	settings := apiToken(t, models.RoleAdmin, models.ScopeSettingsWrite)
+
+	call(t, r, reader, "GET", "/api/audit", "", http.StatusOK)
+	call(t, r, reader, "GET", "/api/audit/retention", "", http.StatusOK)
+	// Shortening the retention would prune the trail the token can only read
+	call(t, r, reader, "POST", "/api/audit/retention", `{"retention_days": 1}`, http.StatusForbidden)
+
+	call(t, r, settings, "GET", "/api/audit", "", http.StatusForbidden)
+	call(t, r, settings, "POST", "/api/audit/retention", `{"retention_days": 365}`, http.StatusOK)
+}
+
+func TestAuditRecordsWritesWithoutSecrets(t *testing.T) {
+	r := newPanelRouter()
+	admin := signIn(t, models.RoleAdmin, nil)
+	for name, token := range map[string]string{
+		"operator":         signIn(t, models.RoleOperator, nil),
+		"restricted admin": signIn(t, models.RoleAdmin, func(u *models.User) { u.Namespaces = "shop" }),
+	} {
+		t.Run(name, func(t *testing.T) {
+			call(t, r, token, "GET", "/api/audit", "", http.StatusForbidden)
+			call(t, r, token, "POST", "/api/audit/retention", `{"retention_days": 1}`, http.StatusForbidden)
+		})
+	}
+
+	username := decode[map[string]interface{}](t, call(t, r, admin, "GET", "/api/user", "", http.StatusOK))["username"].(string)
+	call(t, r, admin, "POST", "/api/user/password", `{"old_password": "not-mine", "new_password": "Not-Mine-Either-1"}`, http.StatusUnauthorized)
+
+	// Entries are written in the background
+	type auditPage struct {
+		Entries []models.AuditLog `json:"entries"`
+	}
+	var page auditPage
+	for deadline := time.Now().Add(5 * time.Second); len(page.Entries) == 0 && time.Now().Before(deadline); time.Sleep(20 * time.Millisecond) {
+		page = decode[auditPage](t, call(t, r, admin, "GET", "/api/audit?user="+username, "", http.StatusOK))
+	}
+	if len(page.Entries) != 1 {
+		t.Fatalf("audit entries of %s = %+v, want one", username, page.Entries)
+	}
+	entry := page.Entries[0]
+	if entry.Success || entry.Status != http.StatusUnauthorized || entry.Action != "POST /api/user/password" || entry.Error != "Invalid old password" {
+		t.Fatalf("audit entry = %+v, want the failed request of the admin", entry)
+	}
+	if strings.Contains(entry.Params, "not-mine") || strings.Contains(entry.Params, "Not-Mine-Either-1") {
+		t.Fatalf("audit entry keeps the passwords: %s", entry.Params)
+	}
+}
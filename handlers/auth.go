@@ -1,16 +1,27 @@
 package handlers
 
 import (
+	"errors"
+	"math"
 	"net/http"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
-	"netcontrol-containers/config"
 	"netcontrol-containers/database"
 	"netcontrol-containers/middleware"
 	"netcontrol-containers/models"
+	"netcontrol-containers/services"
 
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+const (
+	maxFailedLogins     = 10
+	accountLockDuration = 15 * time.Minute
 )
 
 type LoginRequest struct {
@@ -31,39 +42,128 @@ func Login(c *gin.Context) {
 		return
 	}
 
-	// Find user
+	guardKeys := loginGuardKeys(c.ClientIP(), req.Username)
+	if wait := services.GetLoginGuard().RetryAfter(guardKeys...); wait > 0 {
+		recordLoginAttempt(c, req.Username, false, "throttled")
+		tooManyAttempts(c, wait)
+		return
+	}
+
+	// Find user. Local accounts always authenticate locally so they keep
+	// working when the directory is unreachable.
 	var user models.User
-	if err := database.Get().Where("username = ?", req.Username).First(&user).Error; err != nil {
+	err := database.Get().Where("username = ?", req.Username).First(&user).Error
+	if ldapCfg := services.LoadLDAPConfig(database.Get()); ldapCfg.Enabled && (err != nil || user.AuthSource == models.AuthSourceLDAP) {
+		ldapLogin(c, ldapCfg, &req, guardKeys)
+		return
+	}
+	if err != nil {
+		// Spend as long as a wrong password takes, so timing doesn't tell
+		// which usernames exist
+		dummyUser().CheckPassword(req.Password)
+		services.GetLoginGuard().Failure(guardKeys...)
+		recordLoginAttempt(c, req.Username, false, "unknown_user")
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
 		return
 	}
 
-	// Check password
+	// Check password. A locked account only says so once the password is
+	// right, so the lock tells nobody else that the account exists.
 	if !user.CheckPassword(req.Password) {
+		services.GetLoginGuard().Failure(guardKeys...)
+		if !user.Locked() {
+			registerFailedLogin(&user)
+		}
+		recordLoginAttempt(c, req.Username, false, "bad_password")
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
 		return
 	}
+	if user.Locked() {
+		recordLoginAttempt(c, req.Username, false, "locked")
+		c.JSON(http.StatusForbidden, gin.H{"error": "Account is temporarily locked. Try again later or contact an administrator."})
+		return
+	}
 
-	// Generate JWT token
-	claims := &middleware.Claims{
-		UserID:   user.ID,
-		Username: user.Username,
-		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(24 * time.Hour)),
-			IssuedAt:  jwt.NewNumericDate(time.Now()),
-		},
+	// Second step required before a session is issued
+	if user.TOTPEnabled {
+		c.JSON(http.StatusOK, gin.H{
+			"two_factor_required": true,
+			"challenge":           newLoginChallenge(user.ID),
+		})
+		return
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	tokenString, err := token.SignedString([]byte(config.Get().JWTSecret))
+	completeLogin(c, &user)
+}
+
+// completeLogin clears failure state after all factors passed and issues
+// the session. The backoff of the client address is left alone, or a valid
+// account of one's own would reset the throttle for guessing others.
+func completeLogin(c *gin.Context, user *models.User) {
+	services.GetLoginGuard().Success("user:" + strings.ToLower(user.Username))
+	if user.FailedLogins > 0 || user.LockedUntil != nil {
+		database.Get().Model(user).Updates(map[string]interface{}{
+			"failed_logins": 0,
+			"locked_until":  nil,
+		})
+	}
+	recordLoginAttempt(c, user.Username, true, "")
+
+	issueToken(c, user)
+}
+
+// dummyUser has a password hash to check against when the username is
+// unknown.
+var dummyUser = sync.OnceValue(func() *models.User {
+	user := &models.User{}
+	user.SetPassword(uuid.New().String())
+	return user
+})
+
+func loginGuardKeys(ip, username string) []string {
+	return []string{"ip:" + ip, "user:" + strings.ToLower(username)}
+}
+
+func tooManyAttempts(c *gin.Context, wait time.Duration) {
+	seconds := int(math.Ceil(wait.Seconds()))
+	c.Header("Retry-After", strconv.Itoa(seconds))
+	c.JSON(http.StatusTooManyRequests, gin.H{
+		"error":       "Too many login attempts. Please wait before trying again.",
+		"retry_after": seconds,
+	})
+}
+
+// registerFailedLogin counts a failed password or second factor against the
+// account and locks it once the limit is reached.
+func registerFailedLogin(user *models.User) {
+	user.FailedLogins++
+	updates := map[string]interface{}{"failed_logins": user.FailedLogins}
+	if user.FailedLogins >= maxFailedLogins {
+		until := time.Now().Add(accountLockDuration)
+		user.LockedUntil = &until
+		updates["locked_until"] = until
+	}
+	database.Get().Model(user).Updates(updates)
+}
+
+func recordLoginAttempt(c *gin.Context, username string, success bool, reason string) {
+	database.Get().Create(&models.LoginAttempt{
+		Username:  truncate(username, 50),
+		IP:        c.ClientIP(),
+		UserAgent: truncate(c.Request.UserAgent(), 255),
+		Success:   success,
+		Reason:    reason,
+	})
+}
+
+// issueToken starts a session for user and writes the login response.
+func issueToken(c *gin.Context, user *models.User) {
+	tokenString, err := startSession(c, user)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	// Set cookie
-	c.SetCookie("token", tokenString, 86400, "/", "", false, true)
-
 	c.JSON(http.StatusOK, LoginResponse{
 		Token:    tokenString,
 		Username: user.Username,
@@ -71,18 +171,80 @@ func Login(c *gin.Context) {
 	})
 }
 
+// startSession records a server-side session for user, signs its JWT and
+// sets it as the token cookie.
+func startSession(c *gin.Context, user *models.User) (string, error) {
+	csrfToken, err := middleware.NewCSRFToken()
+	if err != nil {
+		return "", errors.New("Failed to create session")
+	}
+
+	now := time.Now()
+	session := models.Session{
+		ID:         uuid.New().String(),
+		UserID:     user.ID,
+		IP:         c.ClientIP(),
+		UserAgent:  truncate(c.Request.UserAgent(), 255),
+		LastSeenAt: now,
+		ExpiresAt:  now.Add(24 * time.Hour),
+		CSRFToken:  csrfToken,
+	}
+	if err := database.Get().Create(&session).Error; err != nil {
+		return "", errors.New("Failed to create session")
+	}
+
+	// Forget sessions that expired a while ago
+	database.Get().Where("expires_at < ?", now.AddDate(0, 0, -7)).Delete(&models.Session{})
+
+	claims := &middleware.Claims{
+		UserID:   user.ID,
+		Username: user.Username,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        session.ID,
+			ExpiresAt: jwt.NewNumericDate(session.ExpiresAt),
+			IssuedAt:  jwt.NewNumericDate(now),
+		},
+	}
+
+	tokenString, err := services.GetJWTKeyManager().Sign(claims)
+	if err != nil {
+		return "", errors.New("Failed to generate token")
+	}
+
+	// Set cookies
+	middleware.SetCookie(c, "token", tokenString, 86400, true)
+	middleware.SetCookie(c, middleware.CSRFCookie, csrfToken, 86400, false)
+	return tokenString, nil
+}
+
 func Logout(c *gin.Context) {
-	c.SetCookie("token", "", -1, "/", "", false, true)
+	// Revoke the server-side session so the JWT stops working everywhere.
+	// Like other cookie-authenticated writes this needs the CSRF token.
+	if tokenString, err := c.Cookie("token"); err == nil {
+		if token, err := middleware.ValidateToken(tokenString); err == nil && token.Valid {
+			claims, _ := token.Claims.(*middleware.Claims)
+			var session models.Session
+			if database.Get().First(&session, "id = ?", claims.ID).Error == nil &&
+				middleware.ValidCSRFToken(c.GetHeader(middleware.CSRFHeader), session.CSRFToken) {
+				database.Get().Model(&session).Update("revoked_at", time.Now())
+			}
+		}
+	}
+
+	middleware.SetCookie(c, "token", "", -1, true)
+	middleware.SetCookie(c, middleware.CSRFCookie, "", -1, false)
 	c.JSON(http.StatusOK, gin.H{"message": "Logged out successfully"})
 }
 
 func GetCurrentUser(c *gin.Context) {
 	username, _ := c.Get("username")
 	userID, _ := c.Get("user_id")
+	role, _ := c.Get("role")
 
 	c.JSON(http.StatusOK, gin.H{
 		"user_id":  userID,
 		"username": username,
+		"role":     role,
 	})
 }
 
@@ -105,11 +267,21 @@ func ChangePassword(c *gin.Context) {
 		return
 	}
 
+	if user.External() {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Your password is managed by your identity provider"})
+		return
+	}
+
 	if !user.CheckPassword(req.OldPassword) {
 		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid old password"})
 		return
 	}
 
+	if err := models.ValidatePassword(req.NewPassword, user.Username); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
 	if err := user.SetPassword(req.NewPassword); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to set password"})
 		return
@@ -120,5 +292,15 @@ func ChangePassword(c *gin.Context) {
 		return
 	}
 
+	// Anyone holding the old password loses access; this session stays
+	models.RevokeUserSessions(database.Get(), user.ID, c.GetString("session_id"))
+
 	c.JSON(http.StatusOK, gin.H{"message": "Password changed successfully"})
 }
+
+func truncate(s string, max int) string {
+	if len(s) > max {
+		return s[:max]
+	}
+	return s
+}
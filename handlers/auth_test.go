@@ -0,0 +1,181 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"netcontrol-containers/database"
+	"netcontrol-containers/models"
+	"netcontrol-containers/services"
+
+	"github.com/google/uuid"
+)
+
+// passwordUser creates a local user with the given password.
+func passwordUser(t *testing.T, password string, locked bool) *models.User {
+	t.Helper()
+	user := &models.User{Username: "login-" + uuid.NewString()[:8], Role: models.RoleViewer}
+	if err := user.SetPassword(password); err != nil {
+		t.Fatal(err)
+	}
+	if locked {
+		until := time.Now().Add(time.Hour)
+		user.LockedUntil = &until
+	}
+	if err := database.Get().Create(user).Error; err != nil {
+		t.Fatal(err)
+	}
+	return user
+}
+
+// postLogin sends a login from ip, which keeps the per-address backoff of
+// one test from throttling another.
+func postLogin(r http.Handler, ip, username, password string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodPost, "/api/login", strings.NewReader(`{"username":"`+username+`","password":"`+password+`"}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.RemoteAddr = ip + ":40000"
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestLoginHidesLockUntilPasswordIsRight(t *testing.T) {
+	r := newPanelRouter()
+	user := passwordUser(t, "correct horse", true)
+
+	unknown := postLogin(r, "198.51.100.1", "nobody-"+uuid.NewString()[:8], "wrong")
+	wrong := postLogin(r, "198.51.100.1", user.Username, "wrong")
+	if wrong.Code != http.StatusUnauthorized || wrong.Body.String() != unknown.Body.String() {
+		t.Fatalf("locked account with a wrong password: %d %s, want the unknown user's %d %s", wrong.Code, wrong.Body, unknown.Code, unknown.Body)
+	}
+
+	// A wrong password doesn't push the lock further out either
+	var stored models.User
+	database.Get().First(&stored, user.ID)
+	if stored.FailedLogins != 0 || !stored.LockedUntil.Equal(*user.LockedUntil) {
+		t.Fatalf("failed logins %d, locked until %v, want 0 and %v", stored.FailedLogins, stored.LockedUntil, user.LockedUntil)
+	}
+
+	if w := postLogin(r, "198.51.100.2", user.Username, "correct horse"); w.Code != http.StatusForbidden {
+		t.Fatalf("locked account with its password: %d %s, want 403", w.Code, w.Body)
+	}
+}
+
+func TestLoginKeepsAddressBackoffAfterSuccess(t *testing.T) {
+	r := newPanelRouter()
+	const ip = "198.51.100.3"
+	services.GetLoginGuard().Success("ip:" + ip)
+	own := passwordUser(t, "my own password", false)
+
+	for range 3 {
+		if w := postLogin(r, ip, "victim-"+uuid.NewString()[:8], "guess"); w.Code != http.StatusUnauthorized {
+			t.Fatalf("guess: %d %s", w.Code, w.Body)
+		}
+	}
+	// Logging into an account of one's own doesn't buy more guesses
+	if w := postLogin(r, ip, own.Username, "my own password"); w.Code != http.StatusOK {
+		t.Fatalf("own login: %d %s", w.Code, w.Body)
+	}
+	postLogin(r, ip, "victim-"+uuid.NewString()[:8], "guess")
+	if w := postLogin(r, ip, "victim-"+uuid.NewString()[:8], "guess"); w.Code != http.StatusTooManyRequests {
+		t.Fatalf("guess after own login: %d %s, want 429", w.Code, w.Body)
+	}
+	if services.GetLoginGuard().RetryAfter("user:"+strings.ToLower(own.Username)) != 0 {
+		t.Fatal("own account throttled after logging in")
+	}
+}
+
+func TestLoginChecksPasswordOfUnknownUser(t *testing.T) {
+	if hash := dummyUser().Password; !strings.HasPrefix(hash, "$2") {
+		t.Fatalf("dummy password hash %q is not a bcrypt hash", hash)
+	}
+
+	// An unknown username costs about as much as a wrong password
+	r := newPanelRouter()
+	user := passwordUser(t, "correct horse", false)
+	elapsed := func(username string) time.Duration {
+		start := time.Now()
+		postLogin(r, "198.51.100.4", username, "wrong")
+		services.GetLoginGuard().Success("ip:198.51.100.4", "user:"+strings.ToLower(username))
+		return time.Since(start)
+	}
+	known, unknown := elapsed(user.Username), elapsed("nobody-"+uuid.NewString()[:8])
+	if unknown < known/4 {
+		t.Fatalf("unknown user answered in %v, a wrong password in %v", unknown, known)
+	}
+}
+
+func TestLoginLocksAccountUntilAdminUnlocks(t *testing.T) {
+	r := newPanelRouter()
+	user := passwordUser(t, "correct horse", false)
+	key := "user:" + strings.ToLower(user.Username)
+
+	for i := range maxFailedLogins {
+		// Clear the backoff, which would answer 429 long before the lock
+		services.GetLoginGuard().Success(key)
+		if w := postLogin(r, "198.51.100.5", user.Username, "wrong"); w.Code != http.StatusUnauthorized {
+			t.Fatalf("failure %d: %d %s, want 401", i+1, w.Code, w.Body)
+		}
+		services.GetLoginGuard().Success("ip:198.51.100.5")
+	}
+	services.GetLoginGuard().Success(key)
+	if w := postLogin(r, "198.51.100.5", user.Username, "correct horse"); w.Code != http.StatusForbidden {
+		t.Fatalf("login after %d failures: %d %s, want 403", maxFailedLogins, w.Code, w.Body)
+	}
+
+	admin := signIn(t, models.RoleAdmin, nil)
+	operator := signIn(t, models.RoleOperator, nil)
+	unlock := "/api/users/" + strconv.Itoa(int(user.ID)) + "/unlock"
+	call(t, r, operator, "POST", unlock, "", http.StatusForbidden)
+	call(t, r, admin, "POST", unlock, "", http.StatusOK)
+	if w := postLogin(r, "198.51.100.5", user.Username, "correct horse"); w.Code != http.StatusOK {
+		t.Fatalf("login after unlock: %d %s, want 200", w.Code, w.Body)
+	}
+
+	// Every attempt is on record for admins
+	call(t, r, operator, "GET", "/api/users/login-attempts", "", http.StatusForbidden)
+	attempts := decode[[]models.LoginAttempt](t, call(t, r, admin, "GET", "/api/users/login-attempts?username="+user.Username, "", http.StatusOK))
+	if len(attempts) != maxFailedLogins+2 || !attempts[0].Success || attempts[1].Success || attempts[0].IP != "198.51.100.5" {
+		t.Fatalf("attempts = %+v, want %d failures and a success", attempts, maxFailedLogins+1)
+	}
+}
+
+// logIn logs user in from ip and returns the session token and the
+// cookies set with it.
+func logIn(t *testing.T, r http.Handler, ip string, user *models.User, password string) (string, []*http.Cookie) {
+	t.Helper()
+	w := postLogin(r, ip, user.Username, password)
+	if w.Code != http.StatusOK {
+		t.Fatalf("login: %d %s", w.Code, w.Body)
+	}
+	return decode[LoginResponse](t, w).Token, w.Result().Cookies()
+}
+
+// newCookieRequest builds a request that authenticates like a browser,
+// with cookies instead of a bearer token.
+func newCookieRequest(method, path string, cookies []*http.Cookie) *http.Request {
+	req := httptest.NewRequest(method, path, nil)
+	for _, cookie := range cookies {
+		req.AddCookie(cookie)
+	}
+	return req
+}
+
+func cookieValue(cookies []*http.Cookie, name string) string {
+	for _, cookie := range cookies {
+		if cookie.Name == name {
+			return cookie.Value
+		}
+	}
+	return ""
+}
+
+func serve(r http.Handler, req *http.Request) *httptest.ResponseRecorder {
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
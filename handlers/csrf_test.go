@@ -0,0 +1,76 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"netcontrol-containers/middleware"
+)
+
+func TestCookieWritesNeedCSRFToken(t *testing.T) {
+	r := newPanelRouter()
+	user := passwordUser(t, "correct horse", false)
+	token, cookies := logIn(t, r, "198.51.100.20", user, "correct horse")
+	csrf := cookieValue(cookies, middleware.CSRFCookie)
+	if csrf == "" {
+		t.Fatal("login set no CSRF cookie")
+	}
+
+	write := func(header string) int {
+		req := newCookieRequest("POST", "/api/user/sessions/revoke-others", cookies)
+		if header != "" {
+			req.Header.Set(middleware.CSRFHeader, header)
+		}
+		return serve(r, req).Code
+	}
+	if code := write(""); code != http.StatusForbidden {
+		t.Fatalf("write without CSRF token: %d, want 403", code)
+	}
+	if code := write(csrf[:len(csrf)-1] + "x"); code != http.StatusForbidden {
+		t.Fatalf("write with a wrong CSRF token: %d, want 403", code)
+	}
+	if code := write(csrf); code != http.StatusOK {
+		t.Fatalf("write with the CSRF token: %d, want 200", code)
+	}
+
+	// Reads and bearer requests, which browsers don't send on their own,
+	// need no token
+	if w := serve(r, newCookieRequest("GET", "/api/user/sessions", cookies)); w.Code != http.StatusOK {
+		t.Fatalf("cookie read: %d %s", w.Code, w.Body)
+	}
+	call(t, r, token, "POST", "/api/user/sessions/revoke-others", "", http.StatusOK)
+}
+
+func TestSessionCookieAttributes(t *testing.T) {
+	r := newPanelRouter()
+	user := passwordUser(t, "correct horse", false)
+
+	for _, tc := range []struct {
+		ip, proto string
+		secure    bool
+	}{
+		{"198.51.100.21", "", false},
+		// Only a trusted proxy can vouch for HTTPS
+		{"198.51.100.21", "https", false},
+		{"127.0.0.1", "https", true},
+	} {
+		req := httptest.NewRequest("POST", "/api/login", strings.NewReader(`{"username":"`+user.Username+`","password":"correct horse"}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Forwarded-Proto", tc.proto)
+		req.RemoteAddr = tc.ip + ":40000"
+		w := serve(r, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("login: %d %s", w.Code, w.Body)
+		}
+		for _, cookie := range w.Result().Cookies() {
+			if cookie.SameSite != http.SameSiteLaxMode || cookie.Secure != tc.secure {
+				t.Errorf("from %s over %q: cookie %s has SameSite=%v Secure=%v, want Lax and %v", tc.ip, tc.proto, cookie.Name, cookie.SameSite, cookie.Secure, tc.secure)
+			}
+			if cookie.HttpOnly != (cookie.Name == "token") {
+				t.Errorf("cookie %s HttpOnly=%v", cookie.Name, cookie.HttpOnly)
+			}
+		}
+	}
+}
@@ -0,0 +1,33 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"netcontrol-containers/models"
+	"netcontrol-containers/services"
+)
+
+func TestSystemStats(t *testing.T) {
+	r := newPanelRouter()
+	viewer := signIn(t, models.RoleViewer, nil)
+
+	info := decode[services.SystemInfo](t, call(t, r, viewer, "GET", "/api/system/info", "", http.StatusOK))
+	if info.Hostname == "" || info.Uptime == 0 {
+		t.Fatalf("system info = %+v", info)
+	}
+	stats := decode[map[string]float64](t, call(t, r, viewer, "GET", "/api/system/stats", "", http.StatusOK))
+	for _, key := range []string{"cpu_percent", "memory_percent", "disk_percent"} {
+		if v, ok := stats[key]; !ok || v <= 0 || v > 100 {
+			t.Errorf("%s = %v, want a percentage", key, v)
+		}
+	}
+
+	// Without a session nothing is served
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest("GET", "/api/system/stats", nil))
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("anonymous stats: status %d, want 401", w.Code)
+	}
+}
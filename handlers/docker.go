@@ -2,7 +2,10 @@ package handlers
 
 import (
 	"bufio"
+	"context"
 	"net/http"
+	"slices"
+	"strings"
 	"sync"
 	"time"
 
@@ -23,12 +26,16 @@ func DockerStatus(c *gin.Context) {
 	}
 
 	c.JSON(http.StatusOK, gin.H{
-		"available": docker.IsAvailable(),
+		"available": docker.IsAvailable(c.Request.Context()),
 	})
 }
 
 func ListContainers(c *gin.Context) {
 	all := c.Query("all") == "true"
+	labels, ok := containerLabels(c)
+	if !ok {
+		return
+	}
 
 	docker, err := services.GetDockerService()
 	if err != nil {
@@ -36,7 +43,7 @@ func ListContainers(c *gin.Context) {
 		return
 	}
 
-	containers, err := docker.ListContainers(all)
+	containers, err := docker.ListContainers(c.Request.Context(), all, labels)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -54,7 +61,11 @@ func GetContainerStats(c *gin.Context) {
 		return
 	}
 
-	stats, err := docker.GetContainerStats(containerID)
+	if !authorizeContainer(c, docker, containerID) {
+		return
+	}
+
+	stats, err := docker.GetContainerStats(c.Request.Context(), containerID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -70,7 +81,10 @@ func InspectContainer(c *gin.Context) {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
-	info, err := data.InspectContainer(id)
+	if !authorizeContainer(c, data, id) {
+		return
+	}
+	info, err := data.InspectContainer(c.Request.Context(), id)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -84,6 +98,10 @@ func CreateContainer(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request: " + err.Error()})
 		return
 	}
+	labels, ok := containerLabels(c)
+	if !ok {
+		return
+	}
 
 	d, err := services.GetDockerService()
 	if err != nil {
@@ -91,7 +109,18 @@ func CreateContainer(c *gin.Context) {
 		return
 	}
 
-	id, err := d.CreateContainer(req)
+	// New containers of restricted users carry their labels so they stay
+	// visible to them
+	if len(labels) > 0 {
+		if req.Labels == nil {
+			req.Labels = make(map[string]string)
+		}
+		for k, v := range labels {
+			req.Labels[k] = v
+		}
+	}
+
+	id, err := d.CreateContainer(c.Request.Context(), req)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -109,7 +138,11 @@ func StartContainer(c *gin.Context) {
 		return
 	}
 
-	if err := docker.StartContainer(containerID); err != nil {
+	if !authorizeContainer(c, docker, containerID) {
+		return
+	}
+
+	if err := docker.StartContainer(c.Request.Context(), containerID); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -126,7 +159,11 @@ func StopContainer(c *gin.Context) {
 		return
 	}
 
-	if err := docker.StopContainer(containerID); err != nil {
+	if !authorizeContainer(c, docker, containerID) {
+		return
+	}
+
+	if err := docker.StopContainer(c.Request.Context(), containerID); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -143,7 +180,11 @@ func RestartContainer(c *gin.Context) {
 		return
 	}
 
-	if err := docker.RestartContainer(containerID); err != nil {
+	if !authorizeContainer(c, docker, containerID) {
+		return
+	}
+
+	if err := docker.RestartContainer(c.Request.Context(), containerID); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -161,7 +202,11 @@ func RemoveContainer(c *gin.Context) {
 		return
 	}
 
-	if err := docker.RemoveContainer(containerID, force); err != nil {
+	if !authorizeContainer(c, docker, containerID) {
+		return
+	}
+
+	if err := docker.RemoveContainer(c.Request.Context(), containerID, force); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -179,7 +224,11 @@ func GetContainerLogs(c *gin.Context) {
 		return
 	}
 
-	logs, err := docker.GetContainerLogs(containerID, tail)
+	if !authorizeContainer(c, docker, containerID) {
+		return
+	}
+
+	logs, err := docker.GetContainerLogs(c.Request.Context(), containerID, tail)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -189,18 +238,45 @@ func GetContainerLogs(c *gin.Context) {
 }
 
 func ListImages(c *gin.Context) {
+	labels, ok := containerLabels(c)
+	if !ok {
+		return
+	}
+
 	docker, err := services.GetDockerService()
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	images, err := docker.ListImages()
+	images, err := docker.ListImages(c.Request.Context())
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
+	// Images are shared between all tenants of the host, so restricted
+	// users only see the ones their own containers run
+	if len(labels) > 0 {
+		containers, err := docker.ListContainers(c.Request.Context(), true, labels)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		used := make(map[string]bool)
+		for _, container := range containers {
+			ref := container.Image
+			used[ref] = true
+			// "docker run nginx" runs nginx:latest
+			if name := ref[strings.LastIndex(ref, "/")+1:]; !strings.ContainsAny(name, ":@") {
+				used[ref+":latest"] = true
+			}
+		}
+		images = slices.DeleteFunc(images, func(image services.ImageInfo) bool {
+			return !used[image.ID] && !slices.ContainsFunc(image.RepoTags, func(tag string) bool { return used[tag] })
+		})
+	}
+
 	c.JSON(http.StatusOK, images)
 }
 
@@ -213,6 +289,9 @@ func PullImage(c *gin.Context) {
 		c.JSON(http.StatusBadRequest, gin.H{"error": "Image name is required"})
 		return
 	}
+	if _, ok := containerLabels(c); !ok {
+		return
+	}
 
 	docker, err := services.GetDockerService()
 	if err != nil {
@@ -220,7 +299,13 @@ func PullImage(c *gin.Context) {
 		return
 	}
 
-	reader, err := docker.PullImage(req.Image)
+	// The pull is aborted when the client goes away or the server shuts down
+	ctx, cancel := context.WithCancel(c.Request.Context())
+	defer cancel()
+	stop := context.AfterFunc(services.GetShutdownManager().Context(), cancel)
+	defer stop()
+
+	reader, err := docker.PullImage(ctx, req.Image)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -238,18 +323,33 @@ func PullImage(c *gin.Context) {
 		c.Writer.Flush()
 	}
 
+	if services.GetShutdownManager().ShuttingDown() {
+		c.Writer.Write([]byte("data: {\"status\":\"error\",\"error\":\"Server is shutting down\"}\n\n"))
+		c.Writer.Flush()
+		return
+	}
 	c.Writer.Write([]byte("data: {\"status\":\"complete\"}\n\n"))
 	c.Writer.Flush()
 }
 
 func GetSystemUsage(c *gin.Context) {
+	// The totals cover every tenant of the host
+	scope, ok := resourceScope(c)
+	if !ok {
+		return
+	}
+	if scope.Restricted() {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Restricted accounts cannot view host-wide Docker usage"})
+		return
+	}
+
 	docker, err := services.GetDockerService()
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	usage, err := docker.GetSystemUsage()
+	usage, err := docker.GetSystemUsage(c.Request.Context())
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -262,13 +362,23 @@ func RemoveImage(c *gin.Context) {
 	imageID := c.Param("id")
 	force := c.Query("force") == "true"
 
+	// Images are shared between all tenants of the host
+	scope, ok := resourceScope(c)
+	if !ok {
+		return
+	}
+	if scope.Restricted() {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Restricted accounts cannot remove images"})
+		return
+	}
+
 	docker, err := services.GetDockerService()
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	if err := docker.RemoveImage(imageID, force); err != nil {
+	if err := docker.RemoveImage(c.Request.Context(), imageID, force); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -277,12 +387,15 @@ func RemoveImage(c *gin.Context) {
 }
 
 var upgrader = websocket.Upgrader{
-	CheckOrigin: func(r *http.Request) bool {
-		return true
-	},
+	CheckOrigin: checkOrigin,
 }
 
 func StreamDockerStats(c *gin.Context) {
+	labels, ok := containerLabels(c)
+	if !ok {
+		return
+	}
+
 	ws, err := upgrader.Upgrade(c.Writer, c.Request, nil)
 	if err != nil {
 		return
@@ -298,7 +411,7 @@ func StreamDockerStats(c *gin.Context) {
 
 	for {
 		// Get all running containers
-		containers, err := d.ListContainers(false)
+		containers, err := d.ListContainers(c.Request.Context(), false, labels)
 		if err != nil {
 			break
 		}
@@ -315,7 +428,7 @@ func StreamDockerStats(c *gin.Context) {
 			wg.Add(1)
 			go func(id string) {
 				defer wg.Done()
-				s, err := d.GetContainerStats(id)
+				s, err := d.GetContainerStats(c.Request.Context(), id)
 				if err == nil {
 					mu.Lock()
 					statsMap[id] = s
@@ -343,6 +456,11 @@ func StreamDockerStats(c *gin.Context) {
 			break
 		}
 
-		time.Sleep(2 * time.Second)
+		select {
+		case <-services.GetShutdownManager().Context().Done():
+			closeGoingAway(ws)
+			return
+		case <-time.After(2 * time.Second):
+		}
 	}
 }
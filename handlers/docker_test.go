@@ -0,0 +1,114 @@
+package handlers
+
+import (
+	"net/http"
+	"slices"
+	"testing"
+
+	"netcontrol-containers/models"
+	"netcontrol-containers/services"
+)
+
+// containerByName lists every container as the holder of token and returns
+// the one named name.
+func containerByName(t *testing.T, r http.Handler, token, name string) services.ContainerInfo {
+	t.Helper()
+	containers := decode[[]services.ContainerInfo](t, call(t, r, token, "GET", "/api/docker/containers?all=true", "", http.StatusOK))
+	i := slices.IndexFunc(containers, func(c services.ContainerInfo) bool { return c.Name == name })
+	if i < 0 {
+		t.Fatalf("no container %q in %+v", name, containers)
+	}
+	return containers[i]
+}
+
+func TestDockerStartStopContainer(t *testing.T) {
+	r := newPanelRouter()
+	operator := signIn(t, models.RoleOperator, nil)
+	viewer := signIn(t, models.RoleViewer, nil)
+
+	prometheus := containerByName(t, r, operator, "prometheus")
+	if prometheus.State != "exited" {
+		t.Fatalf("prometheus is %s, want exited", prometheus.State)
+	}
+	call(t, r, viewer, "POST", "/api/docker/containers/"+prometheus.ID+"/start", "", http.StatusForbidden)
+
+	call(t, r, operator, "POST", "/api/docker/containers/"+prometheus.ID+"/start", "", http.StatusOK)
+	if state := containerByName(t, r, viewer, "prometheus").State; state != "running" {
+		t.Fatalf("after start prometheus is %s, want running", state)
+	}
+	call(t, r, operator, "POST", "/api/docker/containers/"+prometheus.ID+"/stop", "", http.StatusOK)
+	if state := containerByName(t, r, viewer, "prometheus").State; state != "exited" {
+		t.Fatalf("after stop prometheus is %s, want exited", state)
+	}
+}
+
+func TestDockerHidesContainersOutsideScope(t *testing.T) {
+	r := newPanelRouter()
+	admin := signIn(t, models.RoleAdmin, nil)
+	shop := signIn(t, models.RoleOperator, func(u *models.User) { u.ContainerLabels = "com.docker.compose.project=shop" })
+	other := signIn(t, models.RoleOperator, func(u *models.User) { u.ContainerLabels = "com.docker.compose.project=other" })
+
+	web := containerByName(t, r, shop, "web")
+
+	// Containers without the labels don't exist for the user
+	if body := call(t, r, other, "GET", "/api/docker/containers?all=true", "", http.StatusOK).Body.String(); body != "[]" {
+		t.Fatalf("containers of another project = %s, want []", body)
+	}
+	call(t, r, other, "POST", "/api/docker/containers/"+web.ID+"/stop", "", http.StatusNotFound)
+	call(t, r, other, "GET", "/api/docker/containers/"+web.ID+"/inspect", "", http.StatusNotFound)
+	if state := containerByName(t, r, admin, "web").State; state != "running" {
+		t.Fatalf("web is %s after a hidden stop, want running", state)
+	}
+
+	// Totals of the whole host are for unrestricted users only
+	call(t, r, shop, "GET", "/api/docker/system/usage", "", http.StatusForbidden)
+	call(t, r, admin, "GET", "/api/docker/system/usage", "", http.StatusOK)
+}
+
+func TestDockerImagesOfRestrictedUser(t *testing.T) {
+	r := newPanelRouter()
+	admin := signIn(t, models.RoleAdmin, nil)
+	team := signIn(t, models.RoleOperator, func(u *models.User) { u.ContainerLabels = "team=images-test" })
+
+	if body := call(t, r, team, "GET", "/api/docker/images", "", http.StatusOK).Body.String(); body != "[]" {
+		t.Fatalf("images without containers = %s, want []", body)
+	}
+
+	// A new container carries the team's labels, and its image shows up
+	created := decode[map[string]string](t, call(t, r, team, "POST", "/api/docker/containers", `{"name": "images-test-cache", "image": "redis:7-alpine"}`, http.StatusOK))
+	t.Cleanup(func() {
+		call(t, r, admin, "DELETE", "/api/docker/containers/"+created["id"]+"?force=true", "", http.StatusOK)
+	})
+	images := decode[[]services.ImageInfo](t, call(t, r, team, "GET", "/api/docker/images", "", http.StatusOK))
+	if len(images) != 1 || !slices.Contains(images[0].RepoTags, "redis:7-alpine") {
+		t.Fatalf("images = %+v, want only redis:7-alpine", images)
+	}
+	if all := decode[[]services.ImageInfo](t, call(t, r, admin, "GET", "/api/docker/images", "", http.StatusOK)); len(all) <= 1 {
+		t.Fatalf("admin sees images %+v, want all of them", all)
+	}
+
+	// Removing an image would break other tenants' containers
+	call(t, r, team, "DELETE", "/api/docker/images/"+images[0].ID, "", http.StatusForbidden)
+}
+
+func TestDockerClosedToUsersScopedElsewhere(t *testing.T) {
+	r := newPanelRouter()
+	admin := signIn(t, models.RoleAdmin, nil)
+	namespaced := signIn(t, models.RoleOperator, func(u *models.User) { u.Namespaces = "shop" })
+
+	web := containerByName(t, r, admin, "web")
+	for _, req := range []struct {
+		method, path, body string
+		status             int
+	}{
+		{"GET", "/api/docker/containers", "", http.StatusForbidden},
+		{"GET", "/api/docker/images", "", http.StatusForbidden},
+		{"GET", "/api/docker/system/usage", "", http.StatusForbidden},
+		{"POST", "/api/docker/containers", `{"image": "redis:7-alpine"}`, http.StatusForbidden},
+		{"POST", "/api/docker/images/pull", `{"image": "redis:7-alpine"}`, http.StatusForbidden},
+		{"GET", "/api/docker/containers/" + web.ID + "/logs", "", http.StatusNotFound},
+		{"POST", "/api/docker/containers/" + web.ID + "/stop", "", http.StatusNotFound},
+	} {
+		call(t, r, namespaced, req.method, req.path, req.body, req.status)
+	}
+}
@@ -6,6 +6,7 @@ import (
 	"net/http"
 	"os"
 	"path/filepath"
+	"slices"
 	"sort"
 	"strings"
 
@@ -23,10 +24,23 @@ type FileInfo struct {
 }
 
 func ListFiles(c *gin.Context) {
-	path := c.DefaultQuery("path", "/")
+	roots, ok := fileRoots(c)
+	if !ok {
+		return
+	}
+	path := c.Query("path")
+	if path == "" {
+		path = "/"
+		if len(roots) > 0 {
+			path = roots[0]
+		}
+	}
 
-	// Sanitize path
-	path = filepath.Clean(path)
+	// Sanitize path and confine it to the user's file root
+	path, ok = scopedPath(c, path)
+	if !ok {
+		return
+	}
 
 	entries, err := os.ReadDir(path)
 	if err != nil {
@@ -78,7 +92,10 @@ func GetFileContent(c *gin.Context) {
 		return
 	}
 
-	path = filepath.Clean(path)
+	path, ok := scopedPath(c, path)
+	if !ok {
+		return
+	}
 
 	info, err := os.Stat(path)
 	if err != nil {
@@ -121,7 +138,11 @@ func SaveFile(c *gin.Context) {
 		return
 	}
 
-	req.Path = filepath.Clean(req.Path)
+	path, ok := scopedPath(c, req.Path)
+	if !ok {
+		return
+	}
+	req.Path = path
 
 	if err := os.WriteFile(req.Path, []byte(req.Content), 0644); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
@@ -142,7 +163,11 @@ func CreateFile(c *gin.Context) {
 		return
 	}
 
-	req.Path = filepath.Clean(req.Path)
+	path, ok := scopedPath(c, req.Path)
+	if !ok {
+		return
+	}
+	req.Path = path
 
 	if req.IsDir {
 		if err := os.MkdirAll(req.Path, 0755); err != nil {
@@ -175,7 +200,18 @@ func DeleteFile(c *gin.Context) {
 		return
 	}
 
-	path = filepath.Clean(path)
+	roots, ok := fileRoots(c)
+	if !ok {
+		return
+	}
+	path, ok = scopedPath(c, path)
+	if !ok {
+		return
+	}
+	if slices.Contains(roots, path) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Cannot delete a file root"})
+		return
+	}
 
 	if err := os.RemoveAll(path); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
@@ -196,8 +232,13 @@ func RenameFile(c *gin.Context) {
 		return
 	}
 
-	req.OldPath = filepath.Clean(req.OldPath)
-	req.NewPath = filepath.Clean(req.NewPath)
+	var ok bool
+	if req.OldPath, ok = scopedPath(c, req.OldPath); !ok {
+		return
+	}
+	if req.NewPath, ok = scopedPath(c, req.NewPath); !ok {
+		return
+	}
 
 	if err := os.Rename(req.OldPath, req.NewPath); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
@@ -218,7 +259,11 @@ func ChmodFile(c *gin.Context) {
 		return
 	}
 
-	req.Path = filepath.Clean(req.Path)
+	path, ok := scopedPath(c, req.Path)
+	if !ok {
+		return
+	}
+	req.Path = path
 
 	// Parse octal mode
 	var mode os.FileMode
@@ -246,8 +291,13 @@ func CopyFile(c *gin.Context) {
 		return
 	}
 
-	req.Source = filepath.Clean(req.Source)
-	req.Dest = filepath.Clean(req.Dest)
+	var ok bool
+	if req.Source, ok = scopedPath(c, req.Source); !ok {
+		return
+	}
+	if req.Dest, ok = scopedPath(c, req.Dest); !ok {
+		return
+	}
 
 	sourceInfo, err := os.Stat(req.Source)
 	if err != nil {
@@ -275,7 +325,10 @@ func UploadFile(c *gin.Context) {
 	if path == "" {
 		path = "/"
 	}
-	path = filepath.Clean(path)
+	path, ok := scopedPath(c, path)
+	if !ok {
+		return
+	}
 
 	file, header, err := c.Request.FormFile("file")
 	if err != nil {
@@ -284,7 +337,7 @@ func UploadFile(c *gin.Context) {
 	}
 	defer file.Close()
 
-	destPath := filepath.Join(path, header.Filename)
+	destPath := filepath.Join(path, filepath.Base(header.Filename))
 
 	out, err := os.Create(destPath)
 	if err != nil {
@@ -311,7 +364,10 @@ func DownloadFile(c *gin.Context) {
 		return
 	}
 
-	path = filepath.Clean(path)
+	path, ok := scopedPath(c, path)
+	if !ok {
+		return
+	}
 
 	info, err := os.Stat(path)
 	if err != nil {
@@ -378,6 +434,15 @@ func copyDir(src, dst string) error {
 }
 
 func GetDrives(c *gin.Context) {
+	roots, ok := fileRoots(c)
+	if !ok {
+		return
+	}
+	if len(roots) > 0 {
+		c.JSON(http.StatusOK, gin.H{"drives": roots})
+		return
+	}
+
 	// For Windows, list available drives
 	var drives []string
 	for _, drive := range "ABCDEFGHIJKLMNOPQRSTUVWXYZ" {
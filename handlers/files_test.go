@@ -0,0 +1,112 @@
+package handlers
+
+import (
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"netcontrol-containers/models"
+)
+
+func TestFilesAreAdminOnly(t *testing.T) {
+	r := newPanelRouter()
+	viewer := signIn(t, models.RoleViewer, nil)
+	operator := signIn(t, models.RoleOperator, nil)
+	admin := signIn(t, models.RoleAdmin, nil)
+
+	file := filepath.Join(t.TempDir(), "notes.txt")
+	if err := os.WriteFile(file, []byte("hello"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	query := "?path=" + url.QueryEscape(file)
+
+	// Reading a file can be as bad as writing one: the panel's own
+	// database holds the keys that sign sessions
+	for _, path := range []string{"/api/files?path=/", "/api/files/drives", "/api/files/content" + query, "/api/files/download" + query} {
+		call(t, r, viewer, "GET", path, "", http.StatusForbidden)
+		call(t, r, operator, "GET", path, "", http.StatusForbidden)
+	}
+	call(t, r, admin, "GET", "/api/files/content"+query, "", http.StatusOK)
+}
+
+func TestFilesConfinedToFileRoot(t *testing.T) {
+	r := newPanelRouter()
+	root := t.TempDir()
+	if err := os.WriteFile(filepath.Join(root, "mine.txt"), []byte("mine"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	rooted := signIn(t, models.RoleAdmin, func(u *models.User) { u.FileRoot = root })
+	// Restricted to containers, so no file root means no files at all
+	labelled := signIn(t, models.RoleAdmin, func(u *models.User) { u.ContainerLabels = "team=a" })
+
+	call(t, r, rooted, "GET", "/api/files/content?path="+url.QueryEscape(filepath.Join(root, "mine.txt")), "", http.StatusOK)
+	call(t, r, rooted, "GET", "/api/files/content?path=/etc/hostname", "", http.StatusForbidden)
+	call(t, r, rooted, "GET", "/api/files?path="+url.QueryEscape(root+"/.."), "", http.StatusForbidden)
+
+	for _, path := range []string{"/api/files?path=/", "/api/files/drives", "/api/files/content?path=/etc/hostname"} {
+		call(t, r, labelled, "GET", path, "", http.StatusForbidden)
+	}
+}
+
+func TestFileWrites(t *testing.T) {
+	r := newPanelRouter()
+	root := t.TempDir()
+	outside := t.TempDir()
+	admin := signIn(t, models.RoleAdmin, nil)
+	rooted := signIn(t, models.RoleAdmin, func(u *models.User) { u.FileRoot = root })
+	operator := signIn(t, models.RoleOperator, nil)
+	reader := apiToken(t, models.RoleAdmin, models.ScopeFilesRead)
+
+	notes := filepath.Join(root, "notes.txt")
+	save := `{"path": "` + notes + `", "content": "hello"}`
+	call(t, r, operator, "POST", "/api/files/content", save, http.StatusForbidden)
+	call(t, r, reader, "POST", "/api/files/content", save, http.StatusForbidden)
+	call(t, r, rooted, "POST", "/api/files/content", save, http.StatusOK)
+	if got, err := os.ReadFile(notes); err != nil || string(got) != "hello" {
+		t.Fatalf("saved file = %q, %v", got, err)
+	}
+	call(t, r, reader, "GET", "/api/files/content?path="+url.QueryEscape(notes), "", http.StatusOK)
+
+	// Nothing leaves the file root, whichever way it is written
+	escaped := filepath.Join(outside, "escaped.txt")
+	for _, req := range []struct{ method, path, body string }{
+		{"POST", "/api/files/content", `{"path": "` + escaped + `", "content": "x"}`},
+		{"POST", "/api/files/content", `{"path": "` + root + `/../` + filepath.Base(outside) + `/escaped.txt", "content": "x"}`},
+		{"POST", "/api/files/create", `{"path": "` + escaped + `"}`},
+		{"POST", "/api/files/rename", `{"old_path": "` + notes + `", "new_path": "` + escaped + `"}`},
+		{"POST", "/api/files/copy", `{"source": "` + notes + `", "dest": "` + escaped + `"}`},
+		{"POST", "/api/files/chmod", `{"path": "` + outside + `", "mode": "0777"}`},
+		{"DELETE", "/api/files?path=" + url.QueryEscape(outside), ""},
+	} {
+		call(t, r, rooted, req.method, req.path, req.body, http.StatusForbidden)
+	}
+	if _, err := os.Stat(escaped); !os.IsNotExist(err) {
+		t.Fatalf("file written outside the root: %v", err)
+	}
+
+	renamed := filepath.Join(root, "renamed.txt")
+	call(t, r, rooted, "POST", "/api/files/rename", `{"old_path": "`+notes+`", "new_path": "`+renamed+`"}`, http.StatusOK)
+	call(t, r, rooted, "DELETE", "/api/files?path="+url.QueryEscape(renamed), "", http.StatusOK)
+	call(t, r, admin, "POST", "/api/files/create", `{"path": "`+escaped+`"}`, http.StatusOK)
+	if _, err := os.Stat(renamed); !os.IsNotExist(err) {
+		t.Fatalf("deleted file still there: %v", err)
+	}
+}
+
+func TestAdminPagesRedirectOtherRoles(t *testing.T) {
+	r := newPanelRouter()
+	for _, role := range []string{models.RoleViewer, models.RoleOperator} {
+		cookies := []*http.Cookie{{Name: "token", Value: signIn(t, role, nil)}}
+		for _, page := range []string{"/files", "/terminal"} {
+			w := serve(r, newCookieRequest("GET", page, cookies))
+			if w.Code != http.StatusFound || w.Header().Get("Location") != "/" {
+				t.Errorf("%s opening %s: %d to %q, want a redirect to /", role, page, w.Code, w.Header().Get("Location"))
+			}
+		}
+	}
+	if w := serve(r, newCookieRequest("GET", "/files", nil)); w.Code != http.StatusFound || w.Header().Get("Location") != "/login" {
+		t.Errorf("anonymous /files: %d to %q, want a redirect to /login", w.Code, w.Header().Get("Location"))
+	}
+}
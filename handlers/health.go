@@ -0,0 +1,44 @@
+package handlers
+
+import (
+	"net/http"
+
+	"netcontrol-containers/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Healthz reports that the process is alive.
+func Healthz(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
+
+// Readyz reports whether the panel can serve requests, with the state of
+// each dependency but without error details. Only the database is
+// required; Docker, Kubernetes and WireGuard are reported but optional.
+func Readyz(c *gin.Context) {
+	if services.GetShutdownManager().ShuttingDown() {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"status": "shutting_down"})
+		return
+	}
+
+	ready, results := services.CheckHealth(c.Request.Context(), false)
+	checks := gin.H{}
+	for _, r := range results {
+		checks[r.Name] = r.Status
+	}
+
+	status, code := "ready", http.StatusOK
+	if !ready {
+		status, code = "not_ready", http.StatusServiceUnavailable
+	}
+	c.JSON(code, gin.H{"status": status, "checks": checks})
+}
+
+// GetHealth returns the dependency checks with the errors and a hint on
+// how to fix them. refresh=true runs the checks again instead of using the
+// cached results.
+func GetHealth(c *gin.Context) {
+	ready, results := services.CheckHealth(c.Request.Context(), c.Query("refresh") == "true")
+	c.JSON(http.StatusOK, gin.H{"ready": ready, "checks": results})
+}
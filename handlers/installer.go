@@ -4,6 +4,7 @@ import (
 	"net/http"
 	"sync"
 
+	"netcontrol-containers/config"
 	"netcontrol-containers/services"
 
 	"github.com/gin-gonic/gin"
@@ -11,9 +12,7 @@ import (
 )
 
 var installerUpgrader = websocket.Upgrader{
-	CheckOrigin: func(r *http.Request) bool {
-		return true
-	},
+	CheckOrigin: checkOrigin,
 }
 
 func GetSoftwareStatus(c *gin.Context) {
@@ -47,39 +46,7 @@ func InstallDocker(c *gin.Context) {
 }
 
 func InstallDockerWS(c *gin.Context) {
-	conn, err := installerUpgrader.Upgrade(c.Writer, c.Request, nil)
-	if err != nil {
-		return
-	}
-	defer conn.Close()
-
-	var mu sync.Mutex
-	writeJSON := func(v interface{}) error {
-		mu.Lock()
-		defer mu.Unlock()
-		return conn.WriteJSON(v)
-	}
-
-	installer := services.GetInstallerService()
-	progressChan := make(chan string, 100)
-
-	go func() {
-		for msg := range progressChan {
-			writeJSON(gin.H{"message": msg})
-		}
-	}()
-
-	err = installer.InstallDocker(progressChan)
-	close(progressChan)
-
-	// Wait a tiny bit for the channel to drain (optional, but good practice if not using WaitGroup)
-	// proper way is WaitGroup but here we just need to ensure thread safety on the socket
-
-	if err != nil {
-		writeJSON(gin.H{"error": err.Error(), "complete": true})
-	} else {
-		writeJSON(gin.H{"message": "Installation complete", "complete": true, "success": true})
-	}
+	streamInstallerJob(c, "installer.docker.install", "Installation complete", services.GetInstallerService().InstallDocker)
 }
 
 func InstallKubernetes(c *gin.Context) {
@@ -99,102 +66,15 @@ func InstallKubernetes(c *gin.Context) {
 }
 
 func InstallKubernetesWS(c *gin.Context) {
-	conn, err := installerUpgrader.Upgrade(c.Writer, c.Request, nil)
-	if err != nil {
-		return
-	}
-	defer conn.Close()
-
-	var mu sync.Mutex
-	writeJSON := func(v interface{}) error {
-		mu.Lock()
-		defer mu.Unlock()
-		return conn.WriteJSON(v)
-	}
-
-	installer := services.GetInstallerService()
-	progressChan := make(chan string, 100)
-
-	go func() {
-		for msg := range progressChan {
-			writeJSON(gin.H{"message": msg})
-		}
-	}()
-
-	err = installer.InstallKubernetes(progressChan)
-	close(progressChan)
-
-	if err != nil {
-		writeJSON(gin.H{"error": err.Error(), "complete": true})
-	} else {
-		writeJSON(gin.H{"message": "Installation complete", "complete": true, "success": true})
-	}
+	streamInstallerJob(c, "installer.kubernetes.install", "Installation complete", services.GetInstallerService().InstallKubernetes)
 }
 
 func UninstallDockerWS(c *gin.Context) {
-	conn, err := installerUpgrader.Upgrade(c.Writer, c.Request, nil)
-	if err != nil {
-		return
-	}
-	defer conn.Close()
-
-	var mu sync.Mutex
-	writeJSON := func(v interface{}) error {
-		mu.Lock()
-		defer mu.Unlock()
-		return conn.WriteJSON(v)
-	}
-
-	installer := services.GetInstallerService()
-	progressChan := make(chan string, 100)
-
-	go func() {
-		for msg := range progressChan {
-			writeJSON(gin.H{"message": msg})
-		}
-	}()
-
-	err = installer.UninstallDocker(progressChan)
-	close(progressChan)
-
-	if err != nil {
-		writeJSON(gin.H{"error": err.Error(), "complete": true})
-	} else {
-		writeJSON(gin.H{"message": "Uninstallation complete", "complete": true, "success": true})
-	}
+	streamInstallerJob(c, "installer.docker.uninstall", "Uninstallation complete", services.GetInstallerService().UninstallDocker)
 }
 
 func UninstallKubernetesWS(c *gin.Context) {
-	conn, err := installerUpgrader.Upgrade(c.Writer, c.Request, nil)
-	if err != nil {
-		return
-	}
-	defer conn.Close()
-
-	var mu sync.Mutex
-	writeJSON := func(v interface{}) error {
-		mu.Lock()
-		defer mu.Unlock()
-		return conn.WriteJSON(v)
-	}
-
-	installer := services.GetInstallerService()
-	progressChan := make(chan string, 100)
-
-	go func() {
-		for msg := range progressChan {
-			writeJSON(gin.H{"message": msg})
-		}
-	}()
-
-	err = installer.UninstallKubernetes(progressChan)
-	close(progressChan)
-
-	if err != nil {
-		writeJSON(gin.H{"error": err.Error(), "complete": true})
-	} else {
-		writeJSON(gin.H{"message": "Uninstallation complete", "complete": true, "success": true})
-	}
+	streamInstallerJob(c, "installer.kubernetes.uninstall", "Uninstallation complete", services.GetInstallerService().UninstallKubernetes)
 }
 
 func RestartSoftware(c *gin.Context) {
@@ -221,6 +101,13 @@ func ForceUnlock(c *gin.Context) {
 }
 
 func SetupKubernetesWS(c *gin.Context) {
+	streamInstallerJob(c, "installer.kubernetes.setup", "Setup complete", services.GetInstallerService().SetupKubernetes)
+}
+
+// streamInstallerJob runs an installer job and streams its progress over a
+// WebSocket. If the server shuts down meanwhile, the client is told whether
+// the job is allowed to finish or is being cancelled.
+func streamInstallerJob(c *gin.Context, action, doneMsg string, run func(chan<- string) error) {
 	conn, err := installerUpgrader.Upgrade(c.Writer, c.Request, nil)
 	if err != nil {
 		return
@@ -234,21 +121,33 @@ func SetupKubernetesWS(c *gin.Context) {
 		return conn.WriteJSON(v)
 	}
 
-	installer := services.GetInstallerService()
 	progressChan := make(chan string, 100)
-
+	done := make(chan struct{})
 	go func() {
 		for msg := range progressChan {
 			writeJSON(gin.H{"message": msg})
 		}
 	}()
+	go func() {
+		select {
+		case <-services.GetShutdownManager().Context().Done():
+			msg := "Server is shutting down, the installation is allowed to finish"
+			if config.Get().Shutdown.Installer == config.ShutdownInstallerCancel {
+				msg = "Server is shutting down, cancelling the installation"
+			}
+			writeJSON(gin.H{"message": msg, "shutdown": true})
+		case <-done:
+		}
+	}()
 
-	err = installer.SetupKubernetes(progressChan)
+	err = run(progressChan)
 	close(progressChan)
+	close(done)
+	recordAudit(c, action, "", err)
 
 	if err != nil {
 		writeJSON(gin.H{"error": err.Error(), "complete": true})
 	} else {
-		writeJSON(gin.H{"message": "Setup complete", "complete": true, "success": true})
+		writeJSON(gin.H{"message": doneMsg, "complete": true, "success": true})
 	}
 }
@@ -0,0 +1,37 @@
+package handlers
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+
+	"netcontrol-containers/models"
+	"netcontrol-containers/services"
+)
+
+func TestInstallerStatus(t *testing.T) {
+	r := newPanelRouter()
+	viewer := signIn(t, models.RoleViewer, nil)
+	operator := signIn(t, models.RoleOperator, nil)
+	admin := signIn(t, models.RoleAdmin, nil)
+	restricted := signIn(t, models.RoleAdmin, func(u *models.User) { u.FileRoot = t.TempDir() })
+
+	software := decode[services.SoftwareStatus](t, call(t, r, viewer, "GET", "/api/installer/status", "", http.StatusOK))
+	if !software.Docker.Installed || !software.Docker.Running || !software.Kubernetes.Installed {
+		t.Fatalf("software status = docker %+v, kubernetes %+v", software.Docker, software.Kubernetes)
+	}
+
+	// Installing and unlocking act on the whole host
+	for _, token := range []string{operator, restricted} {
+		call(t, r, token, "POST", "/api/installer/unlock", "", http.StatusForbidden)
+		call(t, r, token, "POST", "/api/installer/restart/docker", "", http.StatusForbidden)
+	}
+	call(t, r, admin, "POST", "/api/installer/restart/sshd", "", http.StatusBadRequest)
+	call(t, r, admin, "POST", "/api/installer/unlock", "", http.StatusOK)
+
+	progress := decode[services.InstallStatus](t, call(t, r, viewer, "GET", "/api/installer/progress", "", http.StatusOK))
+	if progress.IsInstalling || !slices.ContainsFunc(progress.Logs, func(l string) bool { return strings.Contains(l, "force-cleared") }) {
+		t.Fatalf("progress after unlock = %+v", progress)
+	}
+}
@@ -0,0 +1,80 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"netcontrol-containers/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ListJWTKeys returns the signing keys that still validate tokens and the
+// rotation settings. Secrets are never returned.
+func ListJWTKeys(c *gin.Context) {
+	keys := services.GetJWTKeyManager()
+	c.JSON(http.StatusOK, gin.H{
+		"keys":          keys.Keys(),
+		"algorithm":     services.JWTAlgorithm(),
+		"rotation_days": services.JWTRotationDays(),
+		"grace_hours":   int(services.JWTGracePeriod().Hours()),
+		"static":        keys.Static(),
+	})
+}
+
+// UpdateJWTKeySettings changes the rotation schedule, grace period and
+// algorithm. Switching the algorithm rotates the key right away.
+func UpdateJWTKeySettings(c *gin.Context) {
+	var req struct {
+		Algorithm    string `json:"algorithm"`
+		RotationDays *int   `json:"rotation_days"`
+		GraceHours   *int   `json:"grace_hours"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	// A changed algorithm rotates the key through the settings listener
+	values := map[string]*string{}
+	if req.Algorithm != "" {
+		values[services.SettingJWTAlgorithm] = &req.Algorithm
+	}
+	if req.RotationDays != nil {
+		days := strconv.Itoa(*req.RotationDays)
+		values[services.SettingJWTRotationDays] = &days
+	}
+	if req.GraceHours != nil {
+		hours := strconv.Itoa(*req.GraceHours)
+		values[services.SettingJWTGraceHours] = &hours
+	}
+	if err := services.UpdateSettings(values); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	ListJWTKeys(c)
+}
+
+// RotateJWTKey replaces the signing key now. Tokens signed with the old key
+// stay valid for the grace period.
+func RotateJWTKey(c *gin.Context) {
+	key, err := services.GetJWTKeyManager().Rotate()
+	if errors.Is(err, services.ErrJWTKeysStatic) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"message": "Signing key rotated", "key": key})
+}
+
+// JWKS publishes the Ed25519 public keys so other services can verify panel
+// tokens. It is empty while HS256 is used.
+func JWKS(c *gin.Context) {
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, services.GetJWTKeyManager().JWKS())
+}
@@ -25,23 +25,45 @@ func KubernetesStatus(c *gin.Context) {
 }
 
 func ListNamespaces(c *gin.Context) {
+	scope, ok := resourceScope(c)
+	if !ok {
+		return
+	}
+	if !scope.AllowsKubernetes() {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Kubernetes is not available to your account"})
+		return
+	}
+
 	k8s, err := services.GetKubernetesService()
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
-	namespaces, err := k8s.ListNamespaces()
+	namespaces, err := k8s.ListNamespaces(c.Request.Context())
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
 
+	if scope.Restricted() {
+		allowed := make([]services.NamespaceInfo, 0, len(scope.Namespaces))
+		for _, ns := range namespaces {
+			if scope.AllowsNamespace(ns.Name) {
+				allowed = append(allowed, ns)
+			}
+		}
+		namespaces = allowed
+	}
+
 	c.JSON(http.StatusOK, namespaces)
 }
 
 func ListPods(c *gin.Context) {
-	namespace := c.DefaultQuery("namespace", "default")
+	namespace, ok := scopedNamespace(c)
+	if !ok {
+		return
+	}
 
 	k8s, err := services.GetKubernetesService()
 	if err != nil {
@@ -49,7 +71,7 @@ func ListPods(c *gin.Context) {
 		return
 	}
 
-	pods, err := k8s.ListPods(namespace)
+	pods, err := k8s.ListPods(c.Request.Context(), namespace)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -59,7 +81,10 @@ func ListPods(c *gin.Context) {
 }
 
 func ListDeployments(c *gin.Context) {
-	namespace := c.DefaultQuery("namespace", "default")
+	namespace, ok := scopedNamespace(c)
+	if !ok {
+		return
+	}
 
 	k8s, err := services.GetKubernetesService()
 	if err != nil {
@@ -67,7 +92,7 @@ func ListDeployments(c *gin.Context) {
 		return
 	}
 
-	deployments, err := k8s.ListDeployments(namespace)
+	deployments, err := k8s.ListDeployments(c.Request.Context(), namespace)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -77,7 +102,10 @@ func ListDeployments(c *gin.Context) {
 }
 
 func ListK8sServices(c *gin.Context) {
-	namespace := c.DefaultQuery("namespace", "default")
+	namespace, ok := scopedNamespace(c)
+	if !ok {
+		return
+	}
 
 	k8s, err := services.GetKubernetesService()
 	if err != nil {
@@ -85,7 +113,7 @@ func ListK8sServices(c *gin.Context) {
 		return
 	}
 
-	svcs, err := k8s.ListServices(namespace)
+	svcs, err := k8s.ListServices(c.Request.Context(), namespace)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -95,7 +123,10 @@ func ListK8sServices(c *gin.Context) {
 }
 
 func GetPodLogs(c *gin.Context) {
-	namespace := c.DefaultQuery("namespace", "default")
+	namespace, ok := scopedNamespace(c)
+	if !ok {
+		return
+	}
 	podName := c.Param("name")
 	container := c.Query("container")
 	tailLines := c.DefaultQuery("tail", "100")
@@ -111,7 +142,7 @@ func GetPodLogs(c *gin.Context) {
 		return
 	}
 
-	logs, err := k8s.GetPodLogs(namespace, podName, container, lines)
+	logs, err := k8s.GetPodLogs(c.Request.Context(), namespace, podName, container, lines)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -121,7 +152,10 @@ func GetPodLogs(c *gin.Context) {
 }
 
 func ScaleDeployment(c *gin.Context) {
-	namespace := c.DefaultQuery("namespace", "default")
+	namespace, ok := scopedNamespace(c)
+	if !ok {
+		return
+	}
 	deploymentName := c.Param("name")
 
 	var req struct {
@@ -139,7 +173,7 @@ func ScaleDeployment(c *gin.Context) {
 		return
 	}
 
-	if err := k8s.ScaleDeployment(namespace, deploymentName, req.Replicas); err != nil {
+	if err := k8s.ScaleDeployment(c.Request.Context(), namespace, deploymentName, req.Replicas); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -148,7 +182,10 @@ func ScaleDeployment(c *gin.Context) {
 }
 
 func RestartDeployment(c *gin.Context) {
-	namespace := c.DefaultQuery("namespace", "default")
+	namespace, ok := scopedNamespace(c)
+	if !ok {
+		return
+	}
 	deploymentName := c.Param("name")
 
 	k8s, err := services.GetKubernetesService()
@@ -157,7 +194,7 @@ func RestartDeployment(c *gin.Context) {
 		return
 	}
 
-	if err := k8s.RestartDeployment(namespace, deploymentName); err != nil {
+	if err := k8s.RestartDeployment(c.Request.Context(), namespace, deploymentName); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -166,7 +203,10 @@ func RestartDeployment(c *gin.Context) {
 }
 
 func DeletePod(c *gin.Context) {
-	namespace := c.DefaultQuery("namespace", "default")
+	namespace, ok := scopedNamespace(c)
+	if !ok {
+		return
+	}
 	podName := c.Param("name")
 
 	k8s, err := services.GetKubernetesService()
@@ -175,7 +215,7 @@ func DeletePod(c *gin.Context) {
 		return
 	}
 
-	if err := k8s.DeletePod(namespace, podName); err != nil {
+	if err := k8s.DeletePod(c.Request.Context(), namespace, podName); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
 	}
@@ -184,7 +224,10 @@ func DeletePod(c *gin.Context) {
 }
 
 func GetClusterOverview(c *gin.Context) {
-	namespace := c.DefaultQuery("namespace", "default")
+	namespace, ok := scopedNamespace(c)
+	if !ok {
+		return
+	}
 
 	k8s, err := services.GetKubernetesService()
 	if err != nil {
@@ -192,7 +235,7 @@ func GetClusterOverview(c *gin.Context) {
 		return
 	}
 
-	stats, err := k8s.GetClusterStats(namespace)
+	stats, err := k8s.GetClusterStats(c.Request.Context(), namespace)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
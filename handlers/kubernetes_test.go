@@ -0,0 +1,88 @@
+package handlers
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+	"testing"
+
+	"netcontrol-containers/models"
+	"netcontrol-containers/services"
+)
+
+// podsOf returns the names of the pods of a deployment.
+func podsOf(t *testing.T, r http.Handler, token, namespace, deployment string) []string {
+	t.Helper()
+	pods := decode[[]services.PodInfo](t, call(t, r, token, "GET", "/api/kubernetes/pods?namespace="+namespace, "", http.StatusOK))
+	var names []string
+	for _, p := range pods {
+		if strings.HasPrefix(p.Name, deployment+"-") {
+			names = append(names, p.Name)
+		}
+	}
+	return names
+}
+
+func TestKubernetesRestartDeploymentAndDeletePod(t *testing.T) {
+	r := newPanelRouter()
+	operator := signIn(t, models.RoleOperator, nil)
+	viewer := signIn(t, models.RoleViewer, nil)
+
+	// The simulated cluster lives as long as the test binary, so earlier
+	// runs may have left pods of a previous rollout behind
+	before := podsOf(t, r, operator, "shop", "frontend")
+	call(t, r, viewer, "POST", "/api/kubernetes/deployments/frontend/restart?namespace=shop", "", http.StatusForbidden)
+	call(t, r, operator, "POST", "/api/kubernetes/deployments/frontend/restart?namespace=shop", "", http.StatusOK)
+	after := podsOf(t, r, operator, "shop", "frontend")
+	started := slices.DeleteFunc(slices.Clone(after), func(name string) bool { return slices.Contains(before, name) })
+	if len(started) != 3 {
+		t.Fatalf("pods after restart = %v, want 3 new ones besides %v", after, before)
+	}
+
+	pod := started[0]
+	call(t, r, viewer, "DELETE", "/api/kubernetes/pods/"+pod+"?namespace=shop", "", http.StatusForbidden)
+	call(t, r, operator, "DELETE", "/api/kubernetes/pods/"+pod+"?namespace=shop", "", http.StatusOK)
+	if slices.Contains(podsOf(t, r, operator, "shop", "frontend"), pod) {
+		t.Fatalf("pod %s still listed after deleting it", pod)
+	}
+	call(t, r, operator, "DELETE", "/api/kubernetes/pods/"+pod+"?namespace=shop", "", http.StatusInternalServerError)
+}
+
+func TestKubernetesConfinesUserToNamespaces(t *testing.T) {
+	r := newPanelRouter()
+	operator := signIn(t, models.RoleOperator, func(u *models.User) { u.Namespaces = "shop" })
+
+	namespaces := decode[[]services.NamespaceInfo](t, call(t, r, operator, "GET", "/api/kubernetes/namespaces", "", http.StatusOK))
+	if len(namespaces) != 1 || namespaces[0].Name != "shop" {
+		t.Fatalf("namespaces = %+v, want only shop", namespaces)
+	}
+	// Without a namespace the user's first one is used
+	if pods := podsOf(t, r, operator, "", "api"); len(pods) != 2 {
+		t.Fatalf("api pods = %v, want 2", pods)
+	}
+
+	for _, req := range []struct{ method, path string }{
+		{"GET", "/api/kubernetes/pods?namespace=monitoring"},
+		{"GET", "/api/kubernetes/pods?namespace=all"},
+		{"GET", "/api/kubernetes/deployments?namespace=kube-system"},
+		{"POST", "/api/kubernetes/deployments/grafana/restart?namespace=monitoring"},
+		{"DELETE", "/api/kubernetes/pods/etcd-node-1?namespace=kube-system"},
+	} {
+		call(t, r, operator, req.method, req.path, "", http.StatusForbidden)
+	}
+}
+
+func TestKubernetesClosedToUsersScopedElsewhere(t *testing.T) {
+	r := newPanelRouter()
+	labelled := signIn(t, models.RoleOperator, func(u *models.User) { u.ContainerLabels = "com.docker.compose.project=shop" })
+
+	for _, req := range []struct{ method, path string }{
+		{"GET", "/api/kubernetes/namespaces"},
+		{"GET", "/api/kubernetes/pods"},
+		{"GET", "/api/kubernetes/pods?namespace=default"},
+		{"GET", "/api/kubernetes/overview"},
+		{"POST", "/api/kubernetes/deployments/hello/restart?namespace=default"},
+	} {
+		call(t, r, labelled, req.method, req.path, "", http.StatusForbidden)
+	}
+}
@@ -0,0 +1,136 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"netcontrol-containers/database"
+	"netcontrol-containers/models"
+	"netcontrol-containers/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ldapLogin authenticates req against the directory and continues with the
+// usual second factor and session handling.
+func ldapLogin(c *gin.Context, cfg *services.LDAPConfig, req *LoginRequest, guardKeys []string) {
+	username := strings.ToLower(req.Username)
+
+	var existing models.User
+	found := database.Get().Where("auth_source = ? AND username = ?", models.AuthSourceLDAP, username).First(&existing).Error == nil
+
+	identity, err := cfg.Authenticate(username, req.Password)
+	if errors.Is(err, services.ErrLDAPInvalidCredentials) {
+		services.GetLoginGuard().Failure(guardKeys...)
+		if found && !existing.Locked() {
+			registerFailedLogin(&existing)
+		}
+		recordLoginAttempt(c, req.Username, false, "ldap_bad_credentials")
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
+		return
+	}
+	if err != nil {
+		recordLoginAttempt(c, req.Username, false, "ldap_error")
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Directory unavailable, please try again later"})
+		return
+	}
+
+	role := cfg.MapRole(identity.Groups)
+	if role == "" {
+		recordLoginAttempt(c, req.Username, false, "ldap_no_role")
+		c.JSON(http.StatusForbidden, gin.H{"error": "Your account is not allowed to access this panel"})
+		return
+	}
+
+	user, err := provisionExternalUser(models.AuthSourceLDAP, identity.DN, username, role)
+	if err != nil {
+		recordLoginAttempt(c, req.Username, false, "ldap_provision")
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	if user.Locked() {
+		recordLoginAttempt(c, req.Username, false, "locked")
+		c.JSON(http.StatusForbidden, gin.H{"error": "Account is temporarily locked. Try again later or contact an administrator."})
+		return
+	}
+
+	if user.TOTPEnabled {
+		c.JSON(http.StatusOK, gin.H{
+			"two_factor_required": true,
+			"challenge":           newLoginChallenge(user.ID),
+		})
+		return
+	}
+
+	completeLogin(c, user)
+}
+
+func GetLDAPConfig(c *gin.Context) {
+	cfg := services.LoadLDAPConfig(database.Get())
+	hasPassword := cfg.BindPassword != ""
+	cfg.BindPassword = ""
+	c.JSON(http.StatusOK, gin.H{"config": cfg, "bind_password_set": hasPassword})
+}
+
+func SaveLDAPConfig(c *gin.Context) {
+	var cfg services.LDAPConfig
+	if err := c.ShouldBindJSON(&cfg); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request: " + err.Error()})
+		return
+	}
+
+	if cfg.UserFilter == "" {
+		cfg.UserFilter = "(uid={username})"
+	}
+	if cfg.Enabled {
+		if err := cfg.Validate(); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	if err := services.SaveLDAPConfig(database.Get(), &cfg); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Directory settings saved"})
+}
+
+// TestLDAPConfig checks the stored settings: it connects, binds with the
+// service account and optionally looks up a user and the role they would
+// get.
+func TestLDAPConfig(c *gin.Context) {
+	var req struct {
+		Username string `json:"username"`
+	}
+	c.ShouldBindJSON(&req)
+
+	cfg := services.LoadLDAPConfig(database.Get())
+	if err := cfg.Validate(); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	identity, err := cfg.Test(req.Username)
+	if errors.Is(err, services.ErrLDAPInvalidCredentials) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found in directory"})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+		return
+	}
+
+	if identity == nil {
+		c.JSON(http.StatusOK, gin.H{"message": "Connection successful"})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{
+		"message": "Connection successful",
+		"dn":      identity.DN,
+		"groups":  identity.Groups,
+		"role":    cfg.MapRole(identity.Groups),
+	})
+}
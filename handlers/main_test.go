@@ -0,0 +1,152 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+
+	"netcontrol-containers/config"
+	"netcontrol-containers/database"
+	"netcontrol-containers/middleware"
+	"netcontrol-containers/models"
+	"netcontrol-containers/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+// TestMain runs the handlers against a throwaway database, with Docker,
+// Kubernetes, WireGuard, the installer and the host stats simulated.
+func TestMain(m *testing.M) {
+	gin.SetMode(gin.TestMode)
+
+	dir, err := os.MkdirTemp("", "netcontrol-handlers-test")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	os.Setenv("DATA_DIR", dir)
+	os.Setenv("LOG_LEVEL", "error")
+
+	code, err := runTests(m)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		code = 1
+	}
+	database.Close()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+func runTests(m *testing.M) (int, error) {
+	services.EnableDemo()
+	if err := config.Init(); err != nil {
+		return 0, err
+	}
+	if err := database.Init(); err != nil {
+		return 0, err
+	}
+	if err := services.GetJWTKeyManager().Load(); err != nil {
+		return 0, err
+	}
+	return m.Run(), nil
+}
+
+// newPanelRouter builds the routes the panel serves, on top of the
+// simulated backends enabled in TestMain.
+func newPanelRouter() *gin.Engine {
+	r := gin.New()
+	RegisterRoutes(r.Group(""), fstest.MapFS{})
+	return r
+}
+
+// newUser creates a user with the given role. restrict, when not nil, sets
+// the user's resource scope.
+func newUser(t *testing.T, role string, restrict func(*models.User)) *models.User {
+	t.Helper()
+	user := &models.User{
+		Username: strings.ToLower(t.Name()) + "-" + role + "-" + uuid.NewString()[:8],
+		Role:     role,
+	}
+	if restrict != nil {
+		restrict(user)
+	}
+	if err := database.Get().Create(user).Error; err != nil {
+		t.Fatal(err)
+	}
+	return user
+}
+
+// signIn creates a user like newUser and a session for them, and returns
+// the session token to send as a bearer token.
+func signIn(t *testing.T, role string, restrict func(*models.User)) string {
+	t.Helper()
+	user := newUser(t, role, restrict)
+
+	now := time.Now()
+	session := models.Session{ID: uuid.NewString(), UserID: user.ID, LastSeenAt: now, ExpiresAt: now.Add(time.Hour)}
+	if err := database.Get().Create(&session).Error; err != nil {
+		t.Fatal(err)
+	}
+	token, err := services.GetJWTKeyManager().Sign(&middleware.Claims{
+		UserID:   user.ID,
+		Username: user.Username,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        session.ID,
+			ExpiresAt: jwt.NewNumericDate(session.ExpiresAt),
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return token
+}
+
+// apiToken creates a user with the given role and an API token of theirs
+// limited to scopes, and returns the plain token.
+func apiToken(t *testing.T, role string, scopes ...string) string {
+	t.Helper()
+	user := newUser(t, role, nil)
+	plain, err := models.GenerateAPIToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	token := models.APIToken{UserID: user.ID, Name: "test", Prefix: plain[:len(models.APITokenPrefix)+8], TokenHash: models.HashAPIToken(plain)}
+	token.SetScopes(scopes)
+	if err := database.Get().Create(&token).Error; err != nil {
+		t.Fatal(err)
+	}
+	return plain
+}
+
+// call sends a request as the holder of token and checks the status.
+func call(t *testing.T, r http.Handler, token, method, path, body string, status int) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set("Authorization", "Bearer "+token)
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	if w.Code != status {
+		t.Fatalf("%s %s: status %d: %s, want %d", method, path, w.Code, w.Body, status)
+	}
+	return w
+}
+
+func decode[T any](t *testing.T, w *httptest.ResponseRecorder) T {
+	t.Helper()
+	var v T
+	if err := json.Unmarshal(w.Body.Bytes(), &v); err != nil {
+		t.Fatalf("decoding %s: %v", w.Body, err)
+	}
+	return v
+}
@@ -0,0 +1,33 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"netcontrol-containers/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Metrics serves the Prometheus metrics. The scraper authenticates with the
+// metrics.token setting as a bearer token; the endpoint is off while the
+// token is unset.
+func Metrics(c *gin.Context) {
+	token := services.Setting(services.SettingMetricsToken)
+	if token == "" {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Metrics are disabled"})
+		return
+	}
+
+	sent, ok := strings.CutPrefix(c.GetHeader("Authorization"), "Bearer ")
+	if !ok || subtle.ConstantTimeCompare([]byte(sent), []byte(token)) != 1 {
+		c.Header("WWW-Authenticate", `Bearer realm="metrics"`)
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid scrape token"})
+		return
+	}
+
+	c.Header("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	c.Status(http.StatusOK)
+	services.WriteMetrics(c.Request.Context(), c.Writer)
+}
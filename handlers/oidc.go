@@ -0,0 +1,262 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"netcontrol-containers/database"
+	"netcontrol-containers/middleware"
+	"netcontrol-containers/models"
+	"netcontrol-containers/services"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/oauth2"
+)
+
+const (
+	oidcStateCookie = "oidc_state"
+	oidcFlowTTL     = 10 * time.Minute
+)
+
+// oidcFlow is an authorization request waiting for the IdP to redirect back.
+type oidcFlow struct {
+	verifier string
+	nonce    string
+	expires  time.Time
+}
+
+var (
+	oidcFlows   = make(map[string]*oidcFlow)
+	oidcFlowsMu sync.Mutex
+)
+
+// OIDCLogin redirects the browser to the identity provider.
+func OIDCLogin(c *gin.Context) {
+	provider, err := services.GetOIDCProvider(database.Get())
+	if err != nil {
+		renderLoginError(c, http.StatusServiceUnavailable, err.Error())
+		return
+	}
+
+	state, nonce := randomToken(), randomToken()
+	verifier := oauth2.GenerateVerifier()
+
+	oidcFlowsMu.Lock()
+	now := time.Now()
+	for id, flow := range oidcFlows {
+		if now.After(flow.expires) {
+			delete(oidcFlows, id)
+		}
+	}
+	oidcFlows[state] = &oidcFlow{verifier: verifier, nonce: nonce, expires: now.Add(oidcFlowTTL)}
+	oidcFlowsMu.Unlock()
+
+	// Binds the flow to this browser so a callback URL cannot be replayed
+	// into someone else's session.
+	middleware.SetCookie(c, oidcStateCookie, state, int(oidcFlowTTL.Seconds()), true)
+
+	url := provider.OAuth2Config(oidcRedirectURL(c)).AuthCodeURL(state,
+		oauth2.S256ChallengeOption(verifier),
+		oauth2.SetAuthURLParam("nonce", nonce),
+	)
+	c.Redirect(http.StatusFound, url)
+}
+
+// OIDCCallback completes the authorization code flow, provisions or
+// updates the local account and starts a session.
+func OIDCCallback(c *gin.Context) {
+	state := c.Query("state")
+	cookieState, _ := c.Cookie(oidcStateCookie)
+	middleware.SetCookie(c, oidcStateCookie, "", -1, true)
+
+	oidcFlowsMu.Lock()
+	flow, ok := oidcFlows[state]
+	delete(oidcFlows, state)
+	oidcFlowsMu.Unlock()
+
+	if !ok || state == "" || state != cookieState || time.Now().After(flow.expires) {
+		renderLoginError(c, http.StatusBadRequest, "Single sign-on expired, please try again")
+		return
+	}
+
+	if errCode := c.Query("error"); errCode != "" {
+		msg := c.Query("error_description")
+		if msg == "" {
+			msg = errCode
+		}
+		renderLoginError(c, http.StatusUnauthorized, "Single sign-on failed: "+msg)
+		return
+	}
+
+	provider, err := services.GetOIDCProvider(database.Get())
+	if err != nil {
+		renderLoginError(c, http.StatusServiceUnavailable, err.Error())
+		return
+	}
+
+	token, err := provider.Exchange(c.Request.Context(), oidcRedirectURL(c), c.Query("code"), flow.verifier)
+	if err != nil {
+		renderLoginError(c, http.StatusBadGateway, "Single sign-on failed: could not redeem authorization code")
+		return
+	}
+
+	rawIDToken, _ := token.Extra("id_token").(string)
+	if rawIDToken == "" {
+		renderLoginError(c, http.StatusBadGateway, "Single sign-on failed: no id token in response")
+		return
+	}
+
+	identity, err := provider.VerifyIDToken(rawIDToken, flow.nonce)
+	if err != nil {
+		renderLoginError(c, http.StatusUnauthorized, "Single sign-on failed: "+err.Error())
+		return
+	}
+
+	role := provider.Config.MapRole(identity.Groups)
+	if role == "" {
+		recordLoginAttempt(c, identity.Username, false, "oidc_no_role")
+		renderLoginError(c, http.StatusForbidden, "Your account is not allowed to access this panel")
+		return
+	}
+
+	user, err := provisionExternalUser(models.AuthSourceOIDC, identity.Subject, identity.Username, role)
+	if err != nil {
+		recordLoginAttempt(c, identity.Username, false, "oidc_provision")
+		renderLoginError(c, http.StatusConflict, err.Error())
+		return
+	}
+	if user.Locked() {
+		recordLoginAttempt(c, user.Username, false, "locked")
+		renderLoginError(c, http.StatusForbidden, "Account is temporarily locked. Try again later or contact an administrator.")
+		return
+	}
+
+	recordLoginAttempt(c, user.Username, true, "oidc")
+	if _, err := startSession(c, user); err != nil {
+		renderLoginError(c, http.StatusInternalServerError, err.Error())
+		return
+	}
+	c.Redirect(http.StatusFound, middleware.URL("/"))
+}
+
+// provisionExternalUser finds the account linked to an external identity,
+// creating it on first login. The role always follows the identity
+// provider, except that the last admin is never demoted. Existing local
+// accounts are never taken over.
+func provisionExternalUser(source, externalID, username, role string) (*models.User, error) {
+	username = truncate(username, 50)
+
+	var user models.User
+	err := database.Get().Where("auth_source = ? AND external_id = ?", source, externalID).First(&user).Error
+	if err == nil {
+		updates := map[string]interface{}{}
+		if user.Role != role {
+			if user.Role == models.RoleAdmin && isLastAdmin(user.ID) {
+				return nil, errLastAdmin
+			}
+			updates["role"] = role
+		}
+		if user.Username != username && !usernameTaken(username, user.ID) {
+			updates["username"] = username
+		}
+		if len(updates) > 0 {
+			if err := database.Get().Model(&user).Updates(updates).Error; err != nil {
+				return nil, err
+			}
+		}
+		return &user, nil
+	}
+
+	if usernameTaken(username, 0) {
+		return nil, errUsernameTaken
+	}
+
+	user = models.User{
+		Username:   username,
+		Role:       role,
+		AuthSource: source,
+		ExternalID: externalID,
+	}
+	if err := database.Get().Create(&user).Error; err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+var (
+	errUsernameTaken = errors.New("An account with this username already exists. Ask an administrator to resolve the conflict.")
+	errLastAdmin     = errors.New("Your groups no longer grant admin, but this is the last admin account. Make another account an admin first.")
+)
+
+func usernameTaken(username string, exceptID uint) bool {
+	var count int64
+	database.Get().Unscoped().Model(&models.User{}).
+		Where("username = ? AND id <> ?", username, exceptID).
+		Count(&count)
+	return count > 0
+}
+
+// oidcRedirectURL derives the callback URL from the request when none is
+// configured.
+func oidcRedirectURL(c *gin.Context) string {
+	scheme := "http"
+	if middleware.IsSecureRequest(c) {
+		scheme = "https"
+	}
+	return scheme + "://" + c.Request.Host + middleware.URL("/auth/oidc/callback")
+}
+
+func renderLoginError(c *gin.Context, status int, msg string) {
+	c.HTML(status, "login.html", gin.H{
+		"OIDCEnabled": services.LoadOIDCConfig(database.Get()).Enabled,
+		"Error":       msg,
+	})
+}
+
+func randomToken() string {
+	b := make([]byte, 32)
+	rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func GetOIDCConfig(c *gin.Context) {
+	cfg := services.LoadOIDCConfig(database.Get())
+	hasSecret := cfg.ClientSecret != ""
+	cfg.ClientSecret = ""
+	c.JSON(http.StatusOK, gin.H{"config": cfg, "client_secret_set": hasSecret})
+}
+
+func SaveOIDCConfig(c *gin.Context) {
+	var cfg services.OIDCConfig
+	if err := c.ShouldBindJSON(&cfg); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request: " + err.Error()})
+		return
+	}
+
+	if cfg.Enabled {
+		if err := cfg.Validate(); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+	if cfg.Issuer != "" && !strings.HasPrefix(cfg.Issuer, "https://") && !strings.HasPrefix(cfg.Issuer, "http://") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "issuer must be an http(s) URL"})
+		return
+	}
+	if cfg.DefaultRole != "" && !models.ValidRole(cfg.DefaultRole) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid default_role"})
+		return
+	}
+
+	if err := services.SaveOIDCConfig(database.Get(), &cfg); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Single sign-on settings saved"})
+}
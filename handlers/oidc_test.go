@@ -0,0 +1,389 @@
+package handlers
+
+import (
+	"cmp"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"html/template"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"testing"
+	"time"
+
+	"netcontrol-containers/database"
+	"netcontrol-containers/models"
+	"netcontrol-containers/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	testOIDCClientID     = "panel"
+	testOIDCClientSecret = "panel-secret"
+)
+
+// testIdP is a minimal OpenID provider serving discovery, JWKS and the
+// token endpoint. Codes are issued directly by the test instead of through
+// a login page.
+type testIdP struct {
+	t   *testing.T
+	srv *httptest.Server
+	key *rsa.PrivateKey
+
+	mu    sync.Mutex
+	codes map[string]testAuthCode
+}
+
+type testAuthCode struct {
+	challenge string
+	claims    jwt.MapClaims
+	// key signs the ID token instead of the published key when set
+	key *rsa.PrivateKey
+}
+
+func newTestIdP(t *testing.T) *testIdP {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+	idp := &testIdP{t: t, key: key, codes: map[string]testAuthCode{}}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 idp.srv.URL,
+			"authorization_endpoint": idp.srv.URL + "/authorize",
+			"token_endpoint":         idp.srv.URL + "/token",
+			"jwks_uri":               idp.srv.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("GET /jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]any{"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": "test",
+			"use": "sig",
+			"alg": "RS256",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+	mux.HandleFunc("POST /token", idp.token)
+	idp.srv = httptest.NewServer(mux)
+	t.Cleanup(idp.srv.Close)
+
+	if err := services.SaveOIDCConfig(database.Get(), &services.OIDCConfig{
+		Enabled:      true,
+		Issuer:       idp.srv.URL,
+		ClientID:     testOIDCClientID,
+		ClientSecret: testOIDCClientSecret,
+		RedirectURL:  "http://panel.test/auth/oidc/callback",
+		RoleMapping:  "panel-admins=admin,panel-ops=operator",
+	}); err != nil {
+		t.Fatal(err)
+	}
+	return idp
+}
+
+// token redeems a code, checking the client secret and the PKCE verifier.
+func (idp *testIdP) token(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	r.ParseForm()
+	clientID, secret, ok := r.BasicAuth()
+	if !ok {
+		clientID, secret = r.PostForm.Get("client_id"), r.PostForm.Get("client_secret")
+	}
+	if clientID != testOIDCClientID || secret != testOIDCClientSecret {
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(map[string]string{"error": "invalid_client"})
+		return
+	}
+
+	idp.mu.Lock()
+	code, ok := idp.codes[r.PostForm.Get("code")]
+	delete(idp.codes, r.PostForm.Get("code"))
+	idp.mu.Unlock()
+
+	sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+	if !ok || r.PostForm.Get("grant_type") != "authorization_code" || base64.RawURLEncoding.EncodeToString(sum[:]) != code.challenge {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	json.NewEncoder(w).Encode(map[string]any{
+		"access_token": "access",
+		"token_type":   "Bearer",
+		"expires_in":   300,
+		"id_token":     idp.sign(cmp.Or(code.key, idp.key), code.claims),
+	})
+}
+
+func (idp *testIdP) sign(key *rsa.PrivateKey, claims jwt.MapClaims) string {
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = "test"
+	signed, err := token.SignedString(key)
+	if err != nil {
+		idp.t.Fatal(err)
+	}
+	return signed
+}
+
+// issue returns a code for an authorization request, redeemable with the
+// verifier matching challenge.
+func (idp *testIdP) issue(challenge string, claims jwt.MapClaims) string {
+	return idp.issueSigned(challenge, claims, nil)
+}
+
+func (idp *testIdP) issueSigned(challenge string, claims jwt.MapClaims, key *rsa.PrivateKey) string {
+	code := randomToken()
+	idp.mu.Lock()
+	idp.codes[code] = testAuthCode{challenge: challenge, claims: claims, key: key}
+	idp.mu.Unlock()
+	return code
+}
+
+// claims returns valid ID token claims for subject and the flow's nonce.
+func (idp *testIdP) claims(subject, nonce string, groups ...string) jwt.MapClaims {
+	now := time.Now()
+	return jwt.MapClaims{
+		"iss":                idp.srv.URL,
+		"aud":                testOIDCClientID,
+		"sub":                subject,
+		"preferred_username": subject,
+		"nonce":              nonce,
+		"groups":             groups,
+		"iat":                now.Unix(),
+		"exp":                now.Add(5 * time.Minute).Unix(),
+	}
+}
+
+// testOIDCFlow is a login started at the panel and waiting for a code.
+type testOIDCFlow struct {
+	state     string
+	nonce     string
+	challenge string
+	cookie    *http.Cookie
+}
+
+func newOIDCRouter() *gin.Engine {
+	r := gin.New()
+	r.SetHTMLTemplate(template.Must(template.New("login.html").Parse(`{{.Error}}`)))
+	r.GET("/auth/oidc/login", OIDCLogin)
+	r.GET("/auth/oidc/callback", OIDCCallback)
+	return r
+}
+
+func startOIDCFlow(t *testing.T, r *gin.Engine, idp *testIdP) testOIDCFlow {
+	t.Helper()
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/auth/oidc/login", nil))
+	if w.Code != http.StatusFound {
+		t.Fatalf("login: status %d: %s", w.Code, w.Body)
+	}
+
+	location, err := url.Parse(w.Header().Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := location.Scheme + "://" + location.Host + location.Path; got != idp.srv.URL+"/authorize" {
+		t.Fatalf("login redirected to %s", got)
+	}
+	query := location.Query()
+	if query.Get("code_challenge_method") != "S256" || query.Get("code_challenge") == "" {
+		t.Fatalf("login did not send a PKCE challenge: %s", location.RawQuery)
+	}
+	if query.Get("nonce") == "" || query.Get("state") == "" {
+		t.Fatalf("login did not send a nonce and state: %s", location.RawQuery)
+	}
+
+	flow := testOIDCFlow{state: query.Get("state"), nonce: query.Get("nonce"), challenge: query.Get("code_challenge")}
+	for _, cookie := range w.Result().Cookies() {
+		if cookie.Name == oidcStateCookie {
+			flow.cookie = cookie
+		}
+	}
+	if flow.cookie == nil || flow.cookie.Value != flow.state {
+		t.Fatal("login did not bind the state to the browser")
+	}
+	return flow
+}
+
+func finishOIDCFlow(r *gin.Engine, flow testOIDCFlow, code string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, "/auth/oidc/callback?"+url.Values{"state": {flow.state}, "code": {code}}.Encode(), nil)
+	req.AddCookie(flow.cookie)
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestOIDCLoginMapsGroupsToRole(t *testing.T) {
+	idp := newTestIdP(t)
+	r := newOIDCRouter()
+	subject := "oidc-mapped"
+
+	flow := startOIDCFlow(t, r, idp)
+	w := finishOIDCFlow(r, flow, idp.issue(flow.challenge, idp.claims(subject, flow.nonce, "Panel-Ops", "unrelated")))
+	if w.Code != http.StatusFound || w.Header().Get("Location") != "/" {
+		t.Fatalf("callback: status %d, location %q: %s", w.Code, w.Header().Get("Location"), w.Body)
+	}
+	var session bool
+	for _, cookie := range w.Result().Cookies() {
+		session = session || cookie.Name == "token" && cookie.Value != ""
+	}
+	if !session {
+		t.Fatal("callback did not start a session")
+	}
+
+	var user models.User
+	if err := database.Get().Where("auth_source = ? AND external_id = ?", models.AuthSourceOIDC, subject).First(&user).Error; err != nil {
+		t.Fatal(err)
+	}
+	if user.Role != models.RoleOperator {
+		t.Fatalf("role = %q, want %q", user.Role, models.RoleOperator)
+	}
+
+	// The role follows the groups on every login, the highest one winning
+	flow = startOIDCFlow(t, r, idp)
+	w = finishOIDCFlow(r, flow, idp.issue(flow.challenge, idp.claims(subject, flow.nonce, "panel-ops", "panel-admins")))
+	if w.Code != http.StatusFound {
+		t.Fatalf("second callback: status %d: %s", w.Code, w.Body)
+	}
+	database.Get().First(&user, user.ID)
+	if user.Role != models.RoleAdmin {
+		t.Fatalf("role after second login = %q, want %q", user.Role, models.RoleAdmin)
+	}
+}
+
+func TestOIDCLoginKeepsLastAdmin(t *testing.T) {
+	idp := newTestIdP(t)
+	r := newOIDCRouter()
+	subject := "oidc-last-admin"
+
+	flow := startOIDCFlow(t, r, idp)
+	if w := finishOIDCFlow(r, flow, idp.issue(flow.challenge, idp.claims(subject, flow.nonce, "panel-admins"))); w.Code != http.StatusFound {
+		t.Fatalf("admin login: status %d: %s", w.Code, w.Body)
+	}
+	var user models.User
+	if err := database.Get().Where("auth_source = ? AND external_id = ?", models.AuthSourceOIDC, subject).First(&user).Error; err != nil {
+		t.Fatal(err)
+	}
+
+	// Leave the account as the only admin for the rest of the test
+	var others []uint
+	database.Get().Model(&models.User{}).Where("role = ? AND id <> ?", models.RoleAdmin, user.ID).Pluck("id", &others)
+	database.Get().Model(&models.User{}).Where("id IN ?", others).Update("role", models.RoleOperator)
+	t.Cleanup(func() {
+		database.Get().Model(&models.User{}).Where("id IN ?", others).Update("role", models.RoleAdmin)
+	})
+
+	flow = startOIDCFlow(t, r, idp)
+	if w := finishOIDCFlow(r, flow, idp.issue(flow.challenge, idp.claims(subject, flow.nonce, "panel-ops"))); w.Code != http.StatusConflict {
+		t.Fatalf("demoting login: status %d, want %d: %s", w.Code, http.StatusConflict, w.Body)
+	}
+	database.Get().First(&user, user.ID)
+	if user.Role != models.RoleAdmin {
+		t.Fatalf("role of the last admin = %q, want %q", user.Role, models.RoleAdmin)
+	}
+}
+
+func TestOIDCLoginDeniesUnmappedGroups(t *testing.T) {
+	idp := newTestIdP(t)
+	r := newOIDCRouter()
+
+	flow := startOIDCFlow(t, r, idp)
+	w := finishOIDCFlow(r, flow, idp.issue(flow.challenge, idp.claims("oidc-unmapped", flow.nonce, "staff")))
+	if w.Code != http.StatusForbidden {
+		t.Fatalf("status %d, want %d: %s", w.Code, http.StatusForbidden, w.Body)
+	}
+	var count int64
+	database.Get().Model(&models.User{}).Where("external_id = ?", "oidc-unmapped").Count(&count)
+	if count != 0 {
+		t.Fatal("a user without a role was provisioned")
+	}
+}
+
+func TestOIDCCallbackRejectsStateMismatch(t *testing.T) {
+	idp := newTestIdP(t)
+	r := newOIDCRouter()
+
+	victim := startOIDCFlow(t, r, idp)
+	attacker := startOIDCFlow(t, r, idp)
+	code := idp.issue(attacker.challenge, idp.claims("oidc-state", attacker.nonce, "panel-admins"))
+
+	// The attacker's callback URL opened in the victim's browser
+	attacker.cookie = victim.cookie
+	if w := finishOIDCFlow(r, attacker, code); w.Code != http.StatusBadRequest {
+		t.Fatalf("status %d, want %d: %s", w.Code, http.StatusBadRequest, w.Body)
+	}
+
+	// A flow can only be completed once
+	flow := startOIDCFlow(t, r, idp)
+	finishOIDCFlow(r, flow, "unknown")
+	if w := finishOIDCFlow(r, flow, idp.issue(flow.challenge, idp.claims("oidc-state", flow.nonce, "panel-admins"))); w.Code != http.StatusBadRequest {
+		t.Fatalf("replayed state: status %d, want %d", w.Code, http.StatusBadRequest)
+	}
+}
+
+func TestOIDCCallbackRequiresPKCEVerifier(t *testing.T) {
+	idp := newTestIdP(t)
+	r := newOIDCRouter()
+
+	// A code issued for another authorization request is only redeemable
+	// with that request's verifier
+	other := startOIDCFlow(t, r, idp)
+	flow := startOIDCFlow(t, r, idp)
+	code := idp.issue(other.challenge, idp.claims("oidc-pkce", flow.nonce, "panel-admins"))
+	if w := finishOIDCFlow(r, flow, code); w.Code != http.StatusBadGateway {
+		t.Fatalf("status %d, want %d: %s", w.Code, http.StatusBadGateway, w.Body)
+	}
+}
+
+func TestOIDCCallbackRejectsInvalidIDToken(t *testing.T) {
+	idp := newTestIdP(t)
+	r := newOIDCRouter()
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		modify func(claims jwt.MapClaims)
+		key    *rsa.PrivateKey
+	}{
+		{name: "nonce mismatch", modify: func(claims jwt.MapClaims) { claims["nonce"] = "other" }},
+		{name: "missing nonce", modify: func(claims jwt.MapClaims) { delete(claims, "nonce") }},
+		{name: "wrong audience", modify: func(claims jwt.MapClaims) { claims["aud"] = "another-client" }},
+		{name: "wrong issuer", modify: func(claims jwt.MapClaims) { claims["iss"] = "https://evil.example" }},
+		{name: "expired", modify: func(claims jwt.MapClaims) { claims["exp"] = time.Now().Add(-2 * time.Minute).Unix() }},
+		{name: "missing expiry", modify: func(claims jwt.MapClaims) { delete(claims, "exp") }},
+		// Signed with a key the IdP never published
+		{name: "unknown key", modify: func(jwt.MapClaims) {}, key: otherKey},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			flow := startOIDCFlow(t, r, idp)
+			claims := idp.claims("oidc-invalid", flow.nonce, "panel-admins")
+			tt.modify(claims)
+
+			code := idp.issueSigned(flow.challenge, claims, tt.key)
+			if w := finishOIDCFlow(r, flow, code); w.Code != http.StatusUnauthorized {
+				t.Fatalf("status %d, want %d: %s", w.Code, http.StatusUnauthorized, w.Body)
+			}
+		})
+	}
+
+	var count int64
+	database.Get().Model(&models.User{}).Where("external_id = ?", "oidc-invalid").Count(&count)
+	if count != 0 {
+		t.Fatal("a user was provisioned from an invalid token")
+	}
+}
@@ -0,0 +1,452 @@
+package handlers
+
+import (
+	"net/http"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"netcontrol-containers/config"
+	"netcontrol-containers/models"
+	"netcontrol-containers/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// apiDoc documents one route. Body and Response are either a Go value whose
+// type is described by reflection, e.g. services.ContainerInfo{}, or a
+// schema built with object, arrayOf or oneOf.
+type apiDoc struct {
+	Method  string
+	Path    string
+	Tag     string
+	Summary string
+	Params  []apiParam
+	Body    any
+	// Form documents a multipart/form-data body instead of JSON.
+	Form     []apiParam
+	Response any
+	// Produces replaces the JSON response, e.g. text/csv.
+	Produces string
+	Public   bool
+}
+
+type apiParam struct {
+	Name        string
+	Description string
+	// Type is string unless set; "binary" marks a file upload.
+	Type string
+}
+
+// schema is a literal OpenAPI schema object.
+type schema map[string]any
+
+var message = object("message", "")
+
+func object(pairs ...any) schema {
+	return schema{"x-fields": pairs}
+}
+
+func arrayOf(item any) schema {
+	return schema{"x-array": item}
+}
+
+func oneOf(items ...any) schema {
+	return schema{"x-oneOf": items}
+}
+
+func query(name, description string) apiParam {
+	return apiParam{Name: name, Description: description}
+}
+
+var namespaceParam = query("namespace", "Namespace, default or the user's first allowed namespace when empty")
+
+// apiDocs lists every API route. BuildOpenAPI reports routes missing here.
+var apiDocs = []apiDoc{
+	// Probes and machine endpoints
+	{Method: "GET", Path: "/healthz", Tag: "Health", Summary: "Report that the process is alive", Response: object("status", ""), Public: true},
+	{Method: "GET", Path: "/readyz", Tag: "Health", Summary: "Report readiness with the state of each dependency", Response: object("status", "", "checks", map[string]string{}), Public: true},
+	{Method: "GET", Path: "/api/health", Tag: "Health", Summary: "Explain the state of each dependency", Params: []apiParam{query("refresh", "true runs the checks again instead of using cached results")}, Response: object("ready", true, "checks", []services.HealthResult{})},
+	{Method: "GET", Path: "/metrics", Tag: "Health", Summary: "Prometheus metrics, authenticated with the metrics.token setting as bearer token", Produces: "text/plain", Public: true},
+	{Method: "GET", Path: "/.well-known/jwks.json", Tag: "Authentication", Summary: "Public keys of EdDSA signing keys", Response: object("keys", []map[string]string{}), Public: true},
+	{Method: "GET", Path: "/api/openapi.json", Tag: "Documentation", Summary: "This OpenAPI document", Response: schema{"type": "object"}},
+
+	// First-run setup
+	{Method: "GET", Path: "/api/setup", Tag: "Setup", Summary: "Whether the first-run setup is pending", Response: object("setup_required", true, "min_password_length", 0), Public: true},
+	{Method: "POST", Path: "/api/setup", Tag: "Setup", Summary: "Create the initial admin with the setup code from the server log", Body: SetupRequest{}, Response: message, Public: true},
+
+	// Authentication
+	{Method: "POST", Path: "/api/login", Tag: "Authentication", Summary: "Log in with a password; returns a 2FA challenge when enabled", Body: LoginRequest{}, Response: oneOf(LoginResponse{}, object("two_factor_required", true, "challenge", "")), Public: true},
+	{Method: "POST", Path: "/api/login/2fa", Tag: "Authentication", Summary: "Complete a login with a TOTP or recovery code", Body: object("challenge", "", "code", ""), Response: LoginResponse{}, Public: true},
+	{Method: "POST", Path: "/api/logout", Tag: "Authentication", Summary: "End the current session", Response: message, Public: true},
+
+	// Own account
+	{Method: "GET", Path: "/api/user", Tag: "Account", Summary: "The authenticated user", Response: object("user_id", 0, "username", "", "role", "")},
+	{Method: "POST", Path: "/api/user/password", Tag: "Account", Summary: "Change the password", Body: object("old_password", "", "new_password", ""), Response: message},
+	{Method: "GET", Path: "/api/user/2fa", Tag: "Account", Summary: "Two-factor authentication status", Response: object("enabled", true, "recovery_codes_remaining", 0)},
+	{Method: "POST", Path: "/api/user/2fa/setup", Tag: "Account", Summary: "Start TOTP enrollment", Response: object("secret", "", "provisioning_uri", "")},
+	{Method: "POST", Path: "/api/user/2fa/enable", Tag: "Account", Summary: "Confirm enrollment with a first code", Body: object("code", ""), Response: object("message", "", "recovery_codes", []string{})},
+	{Method: "POST", Path: "/api/user/2fa/disable", Tag: "Account", Summary: "Disable two-factor authentication", Body: object("password", ""), Response: message},
+	{Method: "POST", Path: "/api/user/2fa/recovery-codes", Tag: "Account", Summary: "Replace the recovery codes", Body: object("password", ""), Response: object("recovery_codes", []string{})},
+	{Method: "GET", Path: "/api/user/sessions", Tag: "Account", Summary: "List active sessions", Response: []SessionResponse{}},
+	{Method: "DELETE", Path: "/api/user/sessions/:id", Tag: "Account", Summary: "Revoke a session", Response: message},
+	{Method: "POST", Path: "/api/user/sessions/revoke-others", Tag: "Account", Summary: "Revoke every session but the current one", Response: message},
+	{Method: "GET", Path: "/api/user/tokens", Tag: "Account", Summary: "List API tokens", Response: []APITokenResponse{}},
+	{Method: "GET", Path: "/api/user/tokens/scopes", Tag: "Account", Summary: "List the scopes a token can be given", Response: object("scopes", []string{})},
+	{Method: "POST", Path: "/api/user/tokens", Tag: "Account", Summary: "Create an API token; the secret is only returned here", Body: CreateAPITokenRequest{}, Response: APITokenResponse{}},
+	{Method: "DELETE", Path: "/api/user/tokens/:id", Tag: "Account", Summary: "Revoke an API token", Response: message},
+
+	// System
+	{Method: "GET", Path: "/api/system/info", Tag: "System", Summary: "Host information", Response: services.SystemInfo{}},
+	{Method: "GET", Path: "/api/system/stats", Tag: "System", Summary: "CPU, memory and disk usage", Response: object("cpu_percent", 0.0, "memory_percent", 0.0, "memory_used", uint64(0), "memory_total", uint64(0), "disk_percent", 0.0, "disk_used", uint64(0), "disk_total", uint64(0))},
+	{Method: "GET", Path: "/api/system/cpu", Tag: "System", Summary: "CPU model and usage per core", Response: services.CPUInfo{}},
+	{Method: "GET", Path: "/api/system/memory", Tag: "System", Summary: "Memory usage", Response: services.MemoryInfo{}},
+	{Method: "GET", Path: "/api/system/disk", Tag: "System", Summary: "Usage of each file system", Response: []services.DiskInfo{}},
+
+	// Docker
+	{Method: "GET", Path: "/api/docker/status", Tag: "Docker", Summary: "Whether the Docker daemon is reachable", Response: object("available", true, "error", "")},
+	{Method: "GET", Path: "/api/docker/system/usage", Tag: "Docker", Summary: "Disk usage of containers, images and volumes", Response: services.SystemUsage{}},
+	{Method: "GET", Path: "/api/docker/system/ws", Tag: "Docker", Summary: "WebSocket streaming a map of container ID to stats every few seconds", Response: map[string]services.ContainerStats{}},
+	{Method: "GET", Path: "/api/docker/containers", Tag: "Docker", Summary: "List containers", Params: []apiParam{query("all", "true includes stopped containers")}, Response: []services.ContainerInfo{}},
+	{Method: "POST", Path: "/api/docker/containers", Tag: "Docker", Summary: "Create and start a container", Body: services.CreateContainerRequest{}, Response: object("message", "", "id", "")},
+	{Method: "GET", Path: "/api/docker/containers/:id/stats", Tag: "Docker", Summary: "Resource usage of a container", Response: services.ContainerStats{}},
+	{Method: "GET", Path: "/api/docker/containers/:id/logs", Tag: "Docker", Summary: "Recent log lines of a container", Params: []apiParam{query("tail", "Number of lines, default 100")}, Response: object("logs", "")},
+	{Method: "GET", Path: "/api/docker/containers/:id/inspect", Tag: "Docker", Summary: "Low-level container details as returned by the Docker API", Response: schema{"type": "object"}},
+	{Method: "POST", Path: "/api/docker/containers/:id/start", Tag: "Docker", Summary: "Start a container", Response: message},
+	{Method: "POST", Path: "/api/docker/containers/:id/stop", Tag: "Docker", Summary: "Stop a container", Response: message},
+	{Method: "POST", Path: "/api/docker/containers/:id/restart", Tag: "Docker", Summary: "Restart a container", Response: message},
+	{Method: "DELETE", Path: "/api/docker/containers/:id", Tag: "Docker", Summary: "Remove a container", Params: []apiParam{query("force", "true removes a running container")}, Response: message},
+	{Method: "GET", Path: "/api/docker/images", Tag: "Docker", Summary: "List images", Response: []services.ImageInfo{}},
+	{Method: "POST", Path: "/api/docker/images/pull", Tag: "Docker", Summary: "Pull an image, streaming Docker's progress as server-sent events", Body: object("image", ""), Produces: "text/event-stream"},
+	{Method: "DELETE", Path: "/api/docker/images/:id", Tag: "Docker", Summary: "Remove an image", Params: []apiParam{query("force", "true removes an image in use")}, Response: message},
+
+	// Kubernetes
+	{Method: "GET", Path: "/api/kubernetes/status", Tag: "Kubernetes", Summary: "Whether the Kubernetes API is reachable", Response: object("available", true, "error", "")},
+	{Method: "GET", Path: "/api/kubernetes/overview", Tag: "Kubernetes", Summary: "Node, pod, deployment and service counts", Params: []apiParam{namespaceParam}, Response: services.ClusterStats{}},
+	{Method: "GET", Path: "/api/kubernetes/namespaces", Tag: "Kubernetes", Summary: "List namespaces", Response: []services.NamespaceInfo{}},
+	{Method: "GET", Path: "/api/kubernetes/pods", Tag: "Kubernetes", Summary: "List pods", Params: []apiParam{namespaceParam}, Response: []services.PodInfo{}},
+	{Method: "GET", Path: "/api/kubernetes/pods/:name/logs", Tag: "Kubernetes", Summary: "Recent log lines of a pod", Params: []apiParam{namespaceParam, query("container", "Container, required for pods with several"), query("tail", "Number of lines, default 100")}, Response: object("logs", "")},
+	{Method: "DELETE", Path: "/api/kubernetes/pods/:name", Tag: "Kubernetes", Summary: "Delete a pod", Params: []apiParam{namespaceParam}, Response: message},
+	{Method: "GET", Path: "/api/kubernetes/deployments", Tag: "Kubernetes", Summary: "List deployments", Params: []apiParam{namespaceParam}, Response: []services.DeploymentInfo{}},
+	{Method: "POST", Path: "/api/kubernetes/deployments/:name/scale", Tag: "Kubernetes", Summary: "Scale a deployment", Params: []apiParam{namespaceParam}, Body: object("replicas", int32(0)), Response: message},
+	{Method: "POST", Path: "/api/kubernetes/deployments/:name/restart", Tag: "Kubernetes", Summary: "Restart the pods of a deployment", Params: []apiParam{namespaceParam}, Response: message},
+	{Method: "GET", Path: "/api/kubernetes/services", Tag: "Kubernetes", Summary: "List services", Params: []apiParam{namespaceParam}, Response: []services.ServiceInfo{}},
+
+	// Installer
+	{Method: "GET", Path: "/api/installer/status", Tag: "Installer", Summary: "Installed versions of Docker and Kubernetes", Response: services.SoftwareStatus{}},
+	{Method: "GET", Path: "/api/installer/progress", Tag: "Installer", Summary: "Progress of the running installation", Response: services.InstallStatus{}},
+	{Method: "POST", Path: "/api/installer/unlock", Tag: "Installer", Summary: "Clear a stale installation lock", Response: message},
+	{Method: "POST", Path: "/api/installer/docker", Tag: "Installer", Summary: "Install Docker in the background", Response: message},
+	{Method: "POST", Path: "/api/installer/kubernetes", Tag: "Installer", Summary: "Install Kubernetes in the background", Response: message},
+	{Method: "POST", Path: "/api/installer/restart/:service", Tag: "Installer", Summary: "Restart docker, kubelet or containerd", Response: message},
+
+	// WireGuard
+	{Method: "GET", Path: "/api/wireguard/status", Tag: "WireGuard", Summary: "State of the VPN interface", Response: services.WireGuardStatus{}},
+	{Method: "POST", Path: "/api/wireguard/connect", Tag: "WireGuard", Summary: "Bring the interface up", Response: message},
+	{Method: "POST", Path: "/api/wireguard/disconnect", Tag: "WireGuard", Summary: "Take the interface down", Response: message},
+	{Method: "GET", Path: "/api/wireguard/config", Tag: "WireGuard", Summary: "The wg-quick config, including the private key", Response: object("config", "")},
+	{Method: "POST", Path: "/api/wireguard/config", Tag: "WireGuard", Summary: "Replace the wg-quick config", Body: object("config", ""), Response: message},
+
+	// Files
+	{Method: "GET", Path: "/api/files", Tag: "Files", Summary: "List a directory", Params: []apiParam{query("path", "Directory, the file root when empty")}, Response: object("path", "", "files", []FileInfo{})},
+	{Method: "GET", Path: "/api/files/drives", Tag: "Files", Summary: "Roots the file manager can browse", Response: object("drives", []string{})},
+	{Method: "GET", Path: "/api/files/content", Tag: "Files", Summary: "Read a text file", Params: []apiParam{query("path", "File")}, Response: object("path", "", "content", "", "size", int64(0))},
+	{Method: "POST", Path: "/api/files/content", Tag: "Files", Summary: "Write a text file", Body: object("path", "", "content", ""), Response: message},
+	{Method: "GET", Path: "/api/files/download", Tag: "Files", Summary: "Download a file", Params: []apiParam{query("path", "File")}, Produces: "application/octet-stream"},
+	{Method: "POST", Path: "/api/files/create", Tag: "Files", Summary: "Create a file or directory", Body: object("path", "", "is_dir", true), Response: message},
+	{Method: "DELETE", Path: "/api/files", Tag: "Files", Summary: "Delete a file or directory", Params: []apiParam{query("path", "File or directory")}, Response: message},
+	{Method: "POST", Path: "/api/files/rename", Tag: "Files", Summary: "Rename or move a file", Body: object("old_path", "", "new_path", ""), Response: message},
+	{Method: "POST", Path: "/api/files/chmod", Tag: "Files", Summary: "Change permissions", Body: object("path", "", "mode", ""), Response: message},
+	{Method: "POST", Path: "/api/files/copy", Tag: "Files", Summary: "Copy a file or directory", Body: object("source", "", "dest", ""), Response: message},
+	{Method: "POST", Path: "/api/files/upload", Tag: "Files", Summary: "Upload a file into a directory", Form: []apiParam{{Name: "path", Description: "Target directory"}, {Name: "file", Type: "binary"}}, Response: object("message", "", "path", "")},
+
+	// Terminal
+	{Method: "GET", Path: "/api/terminal/sessions", Tag: "Terminal", Summary: "List the user's terminal sessions", Response: object("sessions", []string{})},
+	{Method: "POST", Path: "/api/terminal/:session/resize", Tag: "Terminal", Summary: "Resize a terminal", Body: object("rows", uint16(0), "cols", uint16(0)), Response: message},
+	{Method: "DELETE", Path: "/api/terminal/:session", Tag: "Terminal", Summary: "Close a terminal session", Response: message},
+
+	// Users
+	{Method: "GET", Path: "/api/users", Tag: "Users", Summary: "List users", Response: []models.User{}},
+	{Method: "POST", Path: "/api/users", Tag: "Users", Summary: "Create a user", Body: CreateUserRequest{}, Response: models.User{}},
+	{Method: "PUT", Path: "/api/users/:id", Tag: "Users", Summary: "Update a user; absent fields are kept", Body: UpdateUserRequest{}, Response: models.User{}},
+	{Method: "DELETE", Path: "/api/users/:id", Tag: "Users", Summary: "Delete a user", Response: message},
+	{Method: "POST", Path: "/api/users/:id/2fa/reset", Tag: "Users", Summary: "Disable a user's two-factor authentication", Response: message},
+	{Method: "POST", Path: "/api/users/:id/unlock", Tag: "Users", Summary: "Unlock an account locked by failed logins", Response: message},
+	{Method: "GET", Path: "/api/users/login-attempts", Tag: "Users", Summary: "Recent login attempts", Params: []apiParam{query("limit", "Default 100"), query("username", ""), query("ip", ""), query("failed", "true lists failures only")}, Response: []models.LoginAttempt{}},
+
+	// Identity providers and signing keys
+	{Method: "GET", Path: "/api/auth/oidc", Tag: "Identity Providers", Summary: "OpenID Connect settings", Response: object("config", services.OIDCConfig{}, "client_secret_set", true)},
+	{Method: "PUT", Path: "/api/auth/oidc", Tag: "Identity Providers", Summary: "Save OpenID Connect settings; an empty secret keeps the stored one", Body: services.OIDCConfig{}, Response: message},
+	{Method: "GET", Path: "/api/auth/ldap", Tag: "Identity Providers", Summary: "LDAP settings", Response: object("config", services.LDAPConfig{}, "bind_password_set", true)},
+	{Method: "PUT", Path: "/api/auth/ldap", Tag: "Identity Providers", Summary: "Save LDAP settings; an empty password keeps the stored one", Body: services.LDAPConfig{}, Response: message},
+	{Method: "POST", Path: "/api/auth/ldap/test", Tag: "Identity Providers", Summary: "Test the directory connection, optionally looking up a user", Body: object("username", ""), Response: object("message", "", "dn", "", "groups", []string{}, "role", "")},
+	{Method: "GET", Path: "/api/auth/keys", Tag: "Identity Providers", Summary: "JWT signing keys and rotation settings", Response: object("keys", []services.JWTKeyInfo{}, "algorithm", "", "rotation_days", 0, "grace_hours", 0, "static", true)},
+	{Method: "PUT", Path: "/api/auth/keys", Tag: "Identity Providers", Summary: "Change the rotation schedule or algorithm", Body: object("algorithm", "", "rotation_days", 0, "grace_hours", 0), Response: object("keys", []services.JWTKeyInfo{}, "algorithm", "", "rotation_days", 0, "grace_hours", 0, "static", true)},
+	{Method: "POST", Path: "/api/auth/keys/rotate", Tag: "Identity Providers", Summary: "Rotate the signing key now", Response: object("message", "", "key", services.JWTKeyInfo{})},
+
+	// Settings and audit
+	{Method: "GET", Path: "/api/settings", Tag: "Settings", Summary: "List the runtime settings with their definitions", Response: object("settings", []services.SettingValue{})},
+	{Method: "PUT", Path: "/api/settings", Tag: "Settings", Summary: "Change several settings at once; null restores the default", Body: schema{"type": "object", "additionalProperties": true}, Response: object("settings", []services.SettingValue{})},
+	{Method: "GET", Path: "/api/audit", Tag: "Audit", Summary: "Query the audit log", Params: []apiParam{query("user", ""), query("action", ""), query("target", ""), query("request_id", ""), query("success", "true or false"), query("from", "RFC 3339 time or date"), query("to", "RFC 3339 time or date"), query("page", "Default 1"), query("per_page", "Default 50"), query("format", "csv exports every matching entry")}, Response: object("entries", []models.AuditLog{}, "total", int64(0), "page", 0, "per_page", 0)},
+	{Method: "GET", Path: "/api/audit/retention", Tag: "Audit", Summary: "Days audit entries are kept", Response: object("retention_days", 0)},
+	{Method: "POST", Path: "/api/audit/retention", Tag: "Audit", Summary: "Change the retention", Body: object("retention_days", 0), Response: object("message", "", "retention_days", 0)},
+}
+
+var (
+	openAPISpec  gin.H
+	ginParamExpr = regexp.MustCompile(`[:*]([A-Za-z_]+)`)
+)
+
+// documentedRoute reports whether a route belongs in the API document.
+// Pages, static files and the terminal and installer WebSockets don't.
+func documentedRoute(path string) bool {
+	return strings.HasPrefix(path, "/api/") || path == "/healthz" || path == "/readyz" ||
+		path == "/metrics" || strings.HasPrefix(path, "/.well-known/")
+}
+
+// BuildOpenAPI generates the OpenAPI document from apiDocs and the
+// registered routes. It returns the API routes that have no entry and the
+// entries that match no route.
+func BuildOpenAPI(routes gin.RoutesInfo) (undocumented, stale []string) {
+	docs := make(map[string]*apiDoc, len(apiDocs))
+	for i := range apiDocs {
+		docs[apiDocs[i].Method+" "+apiDocs[i].Path] = &apiDocs[i]
+	}
+
+	gen := &schemaGen{components: map[string]any{}}
+	paths := map[string]gin.H{}
+	seen := map[string]bool{}
+	for _, route := range routes {
+		path := strings.TrimPrefix(route.Path, config.BasePath())
+		if !documentedRoute(path) {
+			continue
+		}
+		key := route.Method + " " + path
+		doc := docs[key]
+		if doc == nil {
+			undocumented = append(undocumented, key)
+			continue
+		}
+		seen[key] = true
+
+		name := route.Handler[strings.LastIndex(route.Handler, ".")+1:]
+		openPath := ginParamExpr.ReplaceAllString(path, "{$1}")
+		if paths[openPath] == nil {
+			paths[openPath] = gin.H{}
+		}
+		paths[openPath][strings.ToLower(route.Method)] = gen.operation(doc, path, name)
+	}
+	for key := range docs {
+		if !seen[key] {
+			stale = append(stale, key)
+		}
+	}
+	sort.Strings(undocumented)
+	sort.Strings(stale)
+
+	openAPISpec = gin.H{
+		"openapi": "3.0.3",
+		"info": gin.H{
+			"title":       "NetControl Containers API",
+			"version":     "1.0",
+			"description": "Authenticate with an API token (`Authorization: Bearer nct_...`) or the session cookie set by /api/login. Mutating requests authenticated by the cookie must send the csrf_token cookie in an X-CSRF-Token header. Errors are returned as `{\"error\": \"...\"}`.",
+		},
+		"servers": []gin.H{{"url": config.BasePath() + "/"}},
+		"paths":   paths,
+		"components": gin.H{
+			"schemas": gen.components,
+			"securitySchemes": gin.H{
+				"bearerAuth": gin.H{"type": "http", "scheme": "bearer", "description": "API token or JWT"},
+				"cookieAuth": gin.H{"type": "apiKey", "in": "cookie", "name": "token"},
+			},
+		},
+		"security": []gin.H{{"bearerAuth": []string{}}, {"cookieAuth": []string{}}},
+	}
+	return undocumented, stale
+}
+
+// OpenAPISpec serves the generated OpenAPI document.
+func OpenAPISpec(c *gin.Context) {
+	c.JSON(http.StatusOK, openAPISpec)
+}
+
+type schemaGen struct {
+	components map[string]any
+}
+
+func (g *schemaGen) operation(doc *apiDoc, path, handler string) gin.H {
+	op := gin.H{
+		"operationId": handler,
+		"summary":     doc.Summary,
+		"tags":        []string{doc.Tag},
+	}
+	if doc.Public {
+		op["security"] = []gin.H{}
+	}
+
+	var params []gin.H
+	for _, m := range ginParamExpr.FindAllStringSubmatch(path, -1) {
+		params = append(params, gin.H{"name": m[1], "in": "path", "required": true, "schema": gin.H{"type": "string"}})
+	}
+	for _, p := range doc.Params {
+		param := gin.H{"name": p.Name, "in": "query", "schema": gin.H{"type": "string"}}
+		if p.Description != "" {
+			param["description"] = p.Description
+		}
+		params = append(params, param)
+	}
+	if len(params) > 0 {
+		op["parameters"] = params
+	}
+
+	switch {
+	case doc.Body != nil:
+		op["requestBody"] = gin.H{
+			"required": true,
+			"content":  gin.H{"application/json": gin.H{"schema": g.schema(doc.Body)}},
+		}
+	case doc.Form != nil:
+		props := gin.H{}
+		for _, p := range doc.Form {
+			prop := gin.H{"type": "string"}
+			if p.Type == "binary" {
+				prop["format"] = "binary"
+			}
+			if p.Description != "" {
+				prop["description"] = p.Description
+			}
+			props[p.Name] = prop
+		}
+		op["requestBody"] = gin.H{
+			"required": true,
+			"content":  gin.H{"multipart/form-data": gin.H{"schema": gin.H{"type": "object", "properties": props}}},
+		}
+	}
+
+	var content gin.H
+	switch {
+	case doc.Produces != "":
+		content = gin.H{doc.Produces: gin.H{"schema": gin.H{"type": "string"}}}
+	case doc.Response != nil:
+		content = gin.H{"application/json": gin.H{"schema": g.schema(doc.Response)}}
+	}
+	ok := gin.H{"description": "Success"}
+	if content != nil {
+		ok["content"] = content
+	}
+	op["responses"] = gin.H{
+		"200":     ok,
+		"default": gin.H{"description": "Error", "content": gin.H{"application/json": gin.H{"schema": g.schema(object("error", ""))}}},
+	}
+	return op
+}
+
+// schema describes v, which is a schema literal or a Go value.
+func (g *schemaGen) schema(v any) any {
+	if s, ok := v.(schema); ok {
+		switch {
+		case s["x-fields"] != nil:
+			pairs := s["x-fields"].([]any)
+			props := gin.H{}
+			for i := 0; i+1 < len(pairs); i += 2 {
+				props[pairs[i].(string)] = g.schema(pairs[i+1])
+			}
+			return gin.H{"type": "object", "properties": props}
+		case s["x-array"] != nil:
+			return gin.H{"type": "array", "items": g.schema(s["x-array"])}
+		case s["x-oneOf"] != nil:
+			var items []any
+			for _, item := range s["x-oneOf"].([]any) {
+				items = append(items, g.schema(item))
+			}
+			return gin.H{"oneOf": items}
+		}
+		return map[string]any(s)
+	}
+	return g.typeSchema(reflect.TypeOf(v))
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+func (g *schemaGen) typeSchema(t reflect.Type) any {
+	if t == timeType {
+		return gin.H{"type": "string", "format": "date-time"}
+	}
+	switch t.Kind() {
+	case reflect.Pointer:
+		return g.typeSchema(t.Elem())
+	case reflect.Bool:
+		return gin.H{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return gin.H{"type": "integer"}
+	case reflect.Int64, reflect.Uint64:
+		return gin.H{"type": "integer", "format": "int64"}
+	case reflect.Float32, reflect.Float64:
+		return gin.H{"type": "number"}
+	case reflect.String:
+		return gin.H{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		return gin.H{"type": "array", "items": g.typeSchema(t.Elem())}
+	case reflect.Map:
+		return gin.H{"type": "object", "additionalProperties": g.typeSchema(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return g.structSchema(t)
+		}
+		if _, ok := g.components[t.Name()]; !ok {
+			// Reserve the name first so recursive types terminate
+			g.components[t.Name()] = gin.H{}
+			g.components[t.Name()] = g.structSchema(t)
+		}
+		return gin.H{"$ref": "#/components/schemas/" + t.Name()}
+	}
+	return gin.H{}
+}
+
+// structSchema follows encoding/json: embedded structs are flattened,
+// fields tagged "-" are skipped and binding:"required" marks required
+// fields.
+func (g *schemaGen) structSchema(t reflect.Type) gin.H {
+	props := gin.H{}
+	var required []string
+	var collect func(t reflect.Type)
+	collect = func(t reflect.Type) {
+		for i := 0; i < t.NumField(); i++ {
+			f := t.Field(i)
+			tag := f.Tag.Get("json")
+			name, _, _ := strings.Cut(tag, ",")
+			if name == "-" || !f.IsExported() {
+				continue
+			}
+			if f.Anonymous && name == "" {
+				ft := f.Type
+				if ft.Kind() == reflect.Pointer {
+					ft = ft.Elem()
+				}
+				if ft.Kind() == reflect.Struct {
+					collect(ft)
+					continue
+				}
+			}
+			if f.Type.Kind() == reflect.Func {
+				continue
+			}
+			if name == "" {
+				name = f.Name
+			}
+			props[name] = g.typeSchema(f.Type)
+			if strings.Contains(f.Tag.Get("binding"), "required") {
+				required = append(required, name)
+			}
+		}
+	}
+	collect(t)
+
+	s := gin.H{"type": "object", "properties": props}
+	if len(required) > 0 {
+		s["required"] = required
+	}
+	return s
+}
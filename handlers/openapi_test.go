@@ -0,0 +1,21 @@
+package handlers
+
+import (
+	"testing"
+	"testing/fstest"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestOpenAPIDocumentsEveryRoute(t *testing.T) {
+	r := gin.New()
+	RegisterRoutes(r.Group(""), fstest.MapFS{})
+
+	undocumented, stale := BuildOpenAPI(r.Routes())
+	if len(undocumented) > 0 {
+		t.Errorf("routes missing from the OpenAPI document: %v", undocumented)
+	}
+	if len(stale) > 0 {
+		t.Errorf("OpenAPI entries without a route: %v", stale)
+	}
+}
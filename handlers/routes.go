@@ -0,0 +1,274 @@
+package handlers
+
+import (
+	"io/fs"
+	"net/http"
+
+	"netcontrol-containers/database"
+	"netcontrol-containers/middleware"
+	"netcontrol-containers/models"
+	"netcontrol-containers/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RegisterRoutes registers the pages, the API and the WebSocket routes on
+// base, the group for the configured base path. static holds the files
+// served below /static.
+func RegisterRoutes(base *gin.RouterGroup, static fs.FS) {
+	base.StaticFS("/static", &gin.OnlyFilesFS{FileSystem: http.FS(static)})
+
+	// First-run setup, locked once the initial admin exists
+	base.GET("/setup", SetupPage)
+	base.GET("/api/setup", GetSetupStatus)
+	base.POST("/api/setup", CompleteSetup)
+
+	// Public routes
+	base.GET("/login", func(c *gin.Context) {
+		// Check if already logged in AND valid
+		if tokenString, err := c.Cookie("token"); err == nil {
+			// Validate token
+			token, err := middleware.ValidateToken(tokenString)
+			if err == nil && token.Valid {
+				c.Redirect(http.StatusFound, middleware.URL("/"))
+				return
+			}
+		}
+		c.HTML(http.StatusOK, "login.html", gin.H{
+			"OIDCEnabled": services.LoadOIDCConfig(database.Get()).Enabled,
+		})
+	})
+	base.GET("/auth/oidc/login", OIDCLogin)
+	base.GET("/auth/oidc/callback", OIDCCallback)
+	base.GET("/.well-known/jwks.json", JWKS)
+	// Probes for load balancers and uptime checks
+	base.GET("/healthz", Healthz)
+	base.GET("/readyz", Readyz)
+	// Prometheus authenticates with the scrape token, not a user session
+	base.GET("/metrics", Metrics)
+	base.POST("/api/login", Login)
+	base.POST("/api/login/2fa", LoginTwoFactor)
+	base.POST("/api/logout", Logout)
+
+	// Protected page routes
+	pages := base.Group("/")
+	pages.Use(middleware.AuthPageMiddleware())
+	{
+		pages.GET("/", func(c *gin.Context) {
+			username, _ := c.Get("username")
+			c.HTML(http.StatusOK, "dashboard.html", gin.H{"Username": username})
+		})
+		pages.GET("/docker", func(c *gin.Context) {
+			username, _ := c.Get("username")
+			c.HTML(http.StatusOK, "docker.html", gin.H{"Username": username})
+		})
+		pages.GET("/kubernetes", func(c *gin.Context) {
+			username, _ := c.Get("username")
+			c.HTML(http.StatusOK, "kubernetes.html", gin.H{"Username": username})
+		})
+		pages.GET("/files", middleware.RequirePageRole(models.RoleAdmin), func(c *gin.Context) {
+			username, _ := c.Get("username")
+			c.HTML(http.StatusOK, "files.html", gin.H{"Username": username})
+		})
+		pages.GET("/terminal", middleware.RequirePageRole(models.RoleAdmin), func(c *gin.Context) {
+			username, _ := c.Get("username")
+			c.HTML(http.StatusOK, "terminal.html", gin.H{"Username": username})
+		})
+		pages.GET("/settings", func(c *gin.Context) {
+			username, _ := c.Get("username")
+			c.HTML(http.StatusOK, "settings.html", gin.H{"Username": username})
+		})
+		pages.GET("/wireguard", func(c *gin.Context) {
+			username, _ := c.Get("username")
+			c.HTML(http.StatusOK, "wireguard.html", gin.H{"Username": username})
+		})
+		pages.GET("/api-docs", func(c *gin.Context) {
+			username, _ := c.Get("username")
+			c.HTML(http.StatusOK, "apidocs.html", gin.H{"Username": username})
+		})
+	}
+
+	// Protected API routes
+	api := base.Group("/api")
+	api.Use(middleware.AuthMiddleware(), middleware.Audit(), middleware.CSRF())
+
+	// Own account. Credentials and tokens can only be managed from a
+	// browser session, never with an API token.
+	api.GET("/user", GetCurrentUser)
+	api.GET("/openapi.json", OpenAPISpec)
+	account := api.Group("/user", middleware.RequireSession())
+	{
+		account.POST("/password", ChangePassword)
+		account.GET("/2fa", GetTwoFactorStatus)
+		account.POST("/2fa/setup", SetupTwoFactor)
+		account.POST("/2fa/enable", EnableTwoFactor)
+		account.POST("/2fa/disable", DisableTwoFactor)
+		account.POST("/2fa/recovery-codes", RegenerateRecoveryCodes)
+		account.GET("/sessions", ListSessions)
+		account.DELETE("/sessions/:id", RevokeSession)
+		account.POST("/sessions/revoke-others", RevokeOtherSessions)
+		account.GET("/tokens", ListAPITokens)
+		account.GET("/tokens/scopes", ListAPITokenScopes)
+		account.POST("/tokens", CreateAPIToken)
+		account.DELETE("/tokens/:id", RevokeAPIToken)
+	}
+
+	// Read-only routes, available to every role
+	viewer := api.Group("", middleware.RequireRole(models.RoleViewer))
+	{
+		// Dashboard / System
+		system := viewer.Group("/system", middleware.RequireScope(models.ScopeSystemRead))
+		system.GET("/info", GetSystemInfo)
+		system.GET("/stats", GetQuickStats)
+		system.GET("/cpu", GetCPUInfo)
+		system.GET("/memory", GetMemoryInfo)
+		system.GET("/disk", GetDiskInfo)
+
+		// Docker
+		docker := viewer.Group("/docker", middleware.RequireScope(models.ScopeDockerRead))
+		docker.GET("/status", DockerStatus)
+		docker.GET("/system/usage", GetSystemUsage)
+		docker.GET("/system/ws", middleware.Drain(), StreamDockerStats)
+		docker.GET("/containers", ListContainers)
+		docker.GET("/containers/:id/stats", GetContainerStats)
+		docker.GET("/containers/:id/logs", GetContainerLogs)
+		docker.GET("/containers/:id/inspect", InspectContainer)
+		docker.GET("/images", ListImages)
+
+		// Kubernetes
+		k8s := viewer.Group("/kubernetes", middleware.RequireScope(models.ScopeK8sRead))
+		k8s.GET("/status", KubernetesStatus)
+		k8s.GET("/overview", GetClusterOverview)
+		k8s.GET("/namespaces", ListNamespaces)
+		k8s.GET("/pods", ListPods)
+		k8s.GET("/pods/:name/logs", GetPodLogs)
+		k8s.GET("/deployments", ListDeployments)
+		k8s.GET("/services", ListK8sServices)
+
+		// Installer
+		installer := viewer.Group("/installer", middleware.RequireScope(models.ScopeSystemRead))
+		installer.GET("/status", GetSoftwareStatus)
+		installer.GET("/progress", GetInstallStatus)
+
+		// WireGuard
+		wireguard := viewer.Group("/wireguard", middleware.RequireScope(models.ScopeWireGuardRead))
+		wireguard.GET("/status", GetWireGuardStatus)
+	}
+
+	// Day-to-day operations on workloads
+	operator := api.Group("", middleware.RequireRole(models.RoleOperator))
+	{
+		// Docker
+		docker := operator.Group("/docker", middleware.RequireScope(models.ScopeDockerWrite))
+		docker.POST("/containers", CreateContainer)
+		docker.POST("/containers/:id/start", StartContainer)
+		docker.POST("/containers/:id/stop", StopContainer)
+		docker.POST("/containers/:id/restart", RestartContainer)
+		docker.DELETE("/containers/:id", RemoveContainer)
+		docker.POST("/images/pull", middleware.Drain(), PullImage)
+		docker.DELETE("/images/:id", RemoveImage)
+
+		// Kubernetes
+		k8s := operator.Group("/kubernetes", middleware.RequireScope(models.ScopeK8sWrite))
+		k8s.DELETE("/pods/:name", DeletePod)
+		k8s.POST("/deployments/:name/scale", ScaleDeployment)
+		k8s.POST("/deployments/:name/restart", RestartDeployment)
+
+		// WireGuard
+		wireguard := operator.Group("/wireguard", middleware.RequireScope(models.ScopeWireGuardWrite))
+		wireguard.POST("/connect", ConnectWireGuard)
+		wireguard.POST("/disconnect", DisconnectWireGuard)
+	}
+
+	// Administration. Files are confined to the user's file root; the
+	// rest acts on the whole host and is closed to restricted accounts.
+	admin := api.Group("", middleware.RequireRole(models.RoleAdmin))
+	unrestricted := admin.Group("", middleware.RequireUnrestricted())
+	{
+		// Users
+		users := unrestricted.Group("/users", middleware.RequireScope(models.ScopeUsersWrite))
+		users.GET("", ListUsers)
+		users.GET("/login-attempts", ListLoginAttempts)
+		users.POST("", CreateUser)
+		users.PUT("/:id", UpdateUser)
+		users.DELETE("/:id", DeleteUser)
+		users.POST("/:id/2fa/reset", ResetUserTwoFactor)
+		users.POST("/:id/unlock", UnlockUser)
+
+		// External identity providers
+		auth := unrestricted.Group("/auth", middleware.RequireScope(models.ScopeUsersWrite))
+		auth.GET("/oidc", GetOIDCConfig)
+		auth.PUT("/oidc", SaveOIDCConfig)
+		auth.GET("/ldap", GetLDAPConfig)
+		auth.PUT("/ldap", SaveLDAPConfig)
+		auth.POST("/ldap/test", TestLDAPConfig)
+		auth.GET("/keys", ListJWTKeys)
+		auth.PUT("/keys", UpdateJWTKeySettings)
+		auth.POST("/keys/rotate", RotateJWTKey)
+
+		// Panel settings
+		settings := unrestricted.Group("/settings")
+		settings.GET("", middleware.RequireScope(models.ScopeSettingsRead), ListSettings)
+		settings.PUT("", middleware.RequireScope(models.ScopeSettingsWrite), UpdateSettings)
+
+		// Dependency diagnostics
+		unrestricted.GET("/health", middleware.RequireScope(models.ScopeSystemRead), GetHealth)
+
+		// Audit log
+		audit := unrestricted.Group("/audit")
+		audit.GET("", middleware.RequireScope(models.ScopeAuditRead), ListAuditLogs)
+		audit.GET("/retention", middleware.RequireScope(models.ScopeAuditRead), GetAuditRetention)
+		// Shortening the retention prunes the trail, so it is a setting
+		audit.POST("/retention", middleware.RequireScope(models.ScopeSettingsWrite), SetAuditRetention)
+
+		// Installer
+		installer := unrestricted.Group("/installer", middleware.RequireScope(models.ScopeInstallerWrite), middleware.Drain())
+		installer.POST("/unlock", ForceUnlock)
+		installer.POST("/docker", InstallDocker)
+		installer.POST("/kubernetes", InstallKubernetes)
+		installer.POST("/restart/:service", RestartSoftware)
+
+		// Files. Reading is as powerful as writing: the host's credentials
+		// and the panel's own database, with its signing keys, are files.
+		fileReads := admin.Group("/files", middleware.RequireScope(models.ScopeFilesRead))
+		fileReads.GET("", ListFiles)
+		fileReads.GET("/drives", GetDrives)
+		fileReads.GET("/content", GetFileContent)
+		fileReads.GET("/download", DownloadFile)
+		files := admin.Group("/files", middleware.RequireScope(models.ScopeFilesWrite))
+		files.POST("/content", SaveFile)
+		files.POST("/create", CreateFile)
+		files.DELETE("", DeleteFile)
+		files.POST("/rename", RenameFile)
+		files.POST("/chmod", ChmodFile)
+		files.POST("/copy", CopyFile)
+		files.POST("/upload", UploadFile)
+
+		// Terminal
+		terminal := unrestricted.Group("/terminal", middleware.RequireScope(models.ScopeTerminal))
+		terminal.GET("/sessions", ListTerminalSessions)
+		terminal.POST("/:session/resize", TerminalResize)
+		terminal.DELETE("/:session", CloseTerminalSession)
+
+		// WireGuard (the config holds the private key)
+		wireguard := unrestricted.Group("/wireguard", middleware.RequireScope(models.ScopeWireGuardWrite))
+		wireguard.GET("/config", GetWireGuardConfig)
+		wireguard.POST("/config", SaveWireGuardConfig)
+	}
+
+	// WebSocket routes. Browsers send the token cookie with the upgrade
+	// request; the upgraders additionally check the Origin header. They
+	// are drained on shutdown.
+	ws := base.Group("/ws")
+	ws.Use(middleware.Drain(), middleware.AuthMiddleware(), middleware.RequireRole(models.RoleAdmin), middleware.RequireUnrestricted())
+	{
+		ws.GET("/terminal", middleware.RequireScope(models.ScopeTerminal), TerminalWS)
+
+		installer := ws.Group("/installer", middleware.RequireScope(models.ScopeInstallerWrite))
+		installer.GET("/docker", InstallDockerWS)
+		installer.GET("/kubernetes", InstallKubernetesWS)
+		installer.GET("/setup-k8s", SetupKubernetesWS)
+		installer.GET("/docker/uninstall", UninstallDockerWS)
+		installer.GET("/kubernetes/uninstall", UninstallKubernetesWS)
+	}
+}
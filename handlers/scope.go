@@ -0,0 +1,162 @@
+package handlers
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"netcontrol-containers/models"
+	"netcontrol-containers/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// resourceScope returns the restrictions of the current user. A request
+// without an authenticated user gets a 403 instead of the whole host, so a
+// route registered without the auth middleware fails closed.
+func resourceScope(c *gin.Context) (*models.ResourceScope, bool) {
+	scope, ok := c.Get("resource_scope")
+	if !ok {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Access denied"})
+		return nil, false
+	}
+	return scope.(*models.ResourceScope), true
+}
+
+// scopedNamespace returns the namespace query parameter, defaulting to the
+// first allowed namespace for restricted users. It writes a 403 and
+// returns false when the namespace is outside the user's scope.
+func scopedNamespace(c *gin.Context) (string, bool) {
+	scope, ok := resourceScope(c)
+	if !ok {
+		return "", false
+	}
+	if !scope.AllowsKubernetes() {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Kubernetes is not available to your account"})
+		return "", false
+	}
+	namespace := c.Query("namespace")
+	if namespace == "" {
+		namespace = "default"
+		if len(scope.Namespaces) > 0 {
+			namespace = scope.Namespaces[0]
+		}
+	}
+
+	ns := namespace
+	if ns == "all" {
+		ns = ""
+	}
+	if !scope.AllowsNamespace(ns) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Access to namespace " + namespace + " is not allowed"})
+		return "", false
+	}
+	return namespace, true
+}
+
+// containerLabels returns the labels that every container visible to the
+// user carries, none meaning all containers. It writes a 403 and returns
+// false when the user has no access to Docker.
+func containerLabels(c *gin.Context) (map[string]string, bool) {
+	scope, ok := resourceScope(c)
+	if !ok {
+		return nil, false
+	}
+	if !scope.AllowsDocker() {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Docker is not available to your account"})
+		return nil, false
+	}
+	return scope.ContainerLabels, true
+}
+
+// authorizeContainer checks that the container is visible to the user. A
+// container outside the scope is reported as not found.
+func authorizeContainer(c *gin.Context, docker services.DockerService, id string) bool {
+	scope, ok := resourceScope(c)
+	if !ok {
+		return false
+	}
+	if !scope.Restricted() {
+		return true
+	}
+
+	labels, err := docker.ContainerLabels(c.Request.Context(), id)
+	if err != nil || !scope.AllowsContainer(labels) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Container not found"})
+		return false
+	}
+	return true
+}
+
+// fileRoots returns the directories the file manager is confined to for
+// the current user: their own file root, or else the configured file roots.
+// None means the whole file system. Like resourceScope it writes a 403 and
+// returns false without a user, and also for a restricted user without a
+// file root.
+func fileRoots(c *gin.Context) ([]string, bool) {
+	scope, ok := resourceScope(c)
+	if !ok {
+		return nil, false
+	}
+	if !scope.AllowsFiles() {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Files are not available to your account"})
+		return nil, false
+	}
+	if scope.FileRoot != "" {
+		return []string{filepath.Clean(scope.FileRoot)}, true
+	}
+	return services.FileRoots(), true
+}
+
+// scopedPath cleans path and confines it to the user's file roots. Relative
+// paths are taken relative to the first root. It writes a 403 and returns
+// false when the path, after resolving symlinks, lies outside every root.
+func scopedPath(c *gin.Context, path string) (string, bool) {
+	roots, ok := fileRoots(c)
+	if !ok {
+		return "", false
+	}
+	if len(roots) == 0 {
+		return filepath.Clean(path), true
+	}
+
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(roots[0], path)
+	}
+	path = filepath.Clean(path)
+
+	for _, root := range roots {
+		realRoot, err := filepath.EvalSymlinks(root)
+		if err != nil {
+			realRoot = root
+		}
+		if withinDir(root, path) && withinDir(realRoot, resolveExisting(path)) {
+			return path, true
+		}
+	}
+	c.JSON(http.StatusForbidden, gin.H{"error": "Path is outside the allowed file roots"})
+	return "", false
+}
+
+// resolveExisting resolves symlinks in the longest existing prefix of path,
+// so paths that are about to be created are checked too.
+func resolveExisting(path string) string {
+	rest := ""
+	for {
+		if real, err := filepath.EvalSymlinks(path); err == nil {
+			return filepath.Join(real, rest)
+		}
+		parent := filepath.Dir(path)
+		if parent == path {
+			return filepath.Join(path, rest)
+		}
+		rest = filepath.Join(filepath.Base(path), rest)
+		path = parent
+	}
+}
+
+func withinDir(dir, path string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(os.PathSeparator))
+}
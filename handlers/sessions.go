@@ -0,0 +1,60 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"netcontrol-containers/database"
+	"netcontrol-containers/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+type SessionResponse struct {
+	models.Session
+	Current bool `json:"current"`
+}
+
+func ListSessions(c *gin.Context) {
+	var sessions []models.Session
+	err := database.Get().
+		Where("user_id = ? AND revoked_at IS NULL AND expires_at > ?", c.GetUint("user_id"), time.Now()).
+		Order("last_seen_at DESC").
+		Find(&sessions).Error
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	current := c.GetString("session_id")
+	result := make([]SessionResponse, 0, len(sessions))
+	for _, s := range sessions {
+		result = append(result, SessionResponse{Session: s, Current: s.ID == current})
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+func RevokeSession(c *gin.Context) {
+	result := database.Get().Model(&models.Session{}).
+		Where("id = ? AND user_id = ? AND revoked_at IS NULL", c.Param("id"), c.GetUint("user_id")).
+		Update("revoked_at", time.Now())
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": result.Error.Error()})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Session not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Session revoked"})
+}
+
+func RevokeOtherSessions(c *gin.Context) {
+	if err := models.RevokeUserSessions(database.Get(), c.GetUint("user_id"), c.GetString("session_id")); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "All other sessions have been logged out"})
+}
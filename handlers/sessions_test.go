@@ -0,0 +1,87 @@
+package handlers
+
+import (
+	"net/http"
+	"testing"
+)
+
+func TestSessionsCanBeListedAndRevoked(t *testing.T) {
+	r := newPanelRouter()
+	user := passwordUser(t, "correct horse", false)
+	current, _ := logIn(t, r, "198.51.100.10", user, "correct horse")
+	laptop, _ := logIn(t, r, "198.51.100.11", user, "correct horse")
+	phone, _ := logIn(t, r, "198.51.100.12", user, "correct horse")
+
+	// Each session sees all three and knows which one it is
+	currentSession := func(token string) string {
+		t.Helper()
+		sessions := decode[[]SessionResponse](t, call(t, r, token, "GET", "/api/user/sessions", "", http.StatusOK))
+		var id string
+		for _, s := range sessions {
+			if s.Current {
+				if id != "" {
+					t.Fatalf("sessions = %+v, want one current", sessions)
+				}
+				id = s.ID
+			}
+		}
+		if len(sessions) != 3 || id == "" {
+			t.Fatalf("sessions = %+v, want 3 with one current", sessions)
+		}
+		return id
+	}
+	currentID, laptopID := currentSession(current), currentSession(laptop)
+	if currentID == laptopID {
+		t.Fatalf("both sessions see %s as their own", currentID)
+	}
+
+	// Sessions of other users can't be revoked
+	stranger := signIn(t, user.Role, nil)
+	call(t, r, stranger, "DELETE", "/api/user/sessions/"+laptopID, "", http.StatusNotFound)
+	call(t, r, laptop, "GET", "/api/user", "", http.StatusOK)
+
+	call(t, r, current, "DELETE", "/api/user/sessions/"+laptopID, "", http.StatusOK)
+	call(t, r, laptop, "GET", "/api/user", "", http.StatusUnauthorized)
+
+	call(t, r, current, "POST", "/api/user/sessions/revoke-others", "", http.StatusOK)
+	call(t, r, phone, "GET", "/api/user", "", http.StatusUnauthorized)
+	call(t, r, current, "GET", "/api/user", "", http.StatusOK)
+}
+
+func TestChangePasswordEndsOtherSessions(t *testing.T) {
+	r := newPanelRouter()
+	user := passwordUser(t, "correct horse", false)
+	current, _ := logIn(t, r, "198.51.100.13", user, "correct horse")
+	other, _ := logIn(t, r, "198.51.100.14", user, "correct horse")
+
+	call(t, r, current, "POST", "/api/user/password", `{"old_password": "wrong", "new_password": "battery staple 9"}`, http.StatusUnauthorized)
+	call(t, r, other, "GET", "/api/user", "", http.StatusOK)
+
+	call(t, r, current, "POST", "/api/user/password", `{"old_password": "correct horse", "new_password": "battery staple 9"}`, http.StatusOK)
+	call(t, r, other, "GET", "/api/user", "", http.StatusUnauthorized)
+	call(t, r, current, "GET", "/api/user", "", http.StatusOK)
+}
+
+func TestLogoutRevokesSession(t *testing.T) {
+	r := newPanelRouter()
+	user := passwordUser(t, "correct horse", false)
+	token, cookies := logIn(t, r, "198.51.100.15", user, "correct horse")
+
+	logout := func(csrf string) {
+		t.Helper()
+		req := newCookieRequest("POST", "/api/logout", cookies)
+		if csrf != "" {
+			req.Header.Set("X-CSRF-Token", csrf)
+		}
+		if w := serve(r, req); w.Code != http.StatusOK {
+			t.Fatalf("logout: %d %s", w.Code, w.Body)
+		}
+	}
+
+	// A cross-site request can clear the cookie but not end the session
+	logout("")
+	call(t, r, token, "GET", "/api/user", "", http.StatusOK)
+
+	logout(cookieValue(cookies, "csrf_token"))
+	call(t, r, token, "GET", "/api/user", "", http.StatusUnauthorized)
+}
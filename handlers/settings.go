@@ -0,0 +1,80 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"netcontrol-containers/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ListSettings returns every declared setting with its type, constraints
+// and current value. Secrets are never returned, only whether they are set.
+func ListSettings(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"settings": services.ListSettings()})
+}
+
+// UpdateSettings changes several settings at once, e.g.
+// {"audit.retention_days": 30, "files.roots": ["/srv"]}. Values may be
+// strings, numbers, booleans or lists; null resets a key to its default.
+// Nothing is stored unless every value is valid.
+func UpdateSettings(c *gin.Context) {
+	var req map[string]json.RawMessage
+	if err := c.ShouldBindJSON(&req); err != nil || len(req) == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Expected an object of setting keys and values"})
+		return
+	}
+
+	values := make(map[string]*string, len(req))
+	for key, raw := range req {
+		value, ok := settingString(raw)
+		if !ok {
+			c.JSON(http.StatusBadRequest, gin.H{"error": key + ": unsupported value"})
+			return
+		}
+		values[key] = value
+	}
+
+	if err := services.UpdateSettings(values); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	ListSettings(c)
+}
+
+// settingString converts a JSON value to the string form settings are
+// stored in. Null becomes nil.
+func settingString(raw json.RawMessage) (*string, bool) {
+	var v any
+	if err := json.Unmarshal(raw, &v); err != nil {
+		return nil, false
+	}
+
+	var s string
+	switch v := v.(type) {
+	case nil:
+		return nil, true
+	case string:
+		s = v
+	case bool:
+		s = strconv.FormatBool(v)
+	case float64:
+		s = strconv.FormatFloat(v, 'f', -1, 64)
+	case []any:
+		items := make([]string, 0, len(v))
+		for _, item := range v {
+			str, ok := item.(string)
+			if !ok {
+				return nil, false
+			}
+			items = append(items, str)
+		}
+		s = strings.Join(items, ",")
+	default:
+		return nil, false
+	}
+	return &s, true
+}
@@ -0,0 +1,105 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"netcontrol-containers/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+func putSettings(t *testing.T, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	r := gin.New()
+	r.PUT("/api/settings", UpdateSettings)
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodPut, "/api/settings", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	r.ServeHTTP(w, req)
+	return w
+}
+
+func TestUpdateSettingsChecksProviderBeforeEnabling(t *testing.T) {
+	tests := []struct {
+		name   string
+		body   string
+		status int
+		error  string
+	}{
+		{
+			name:   "ldap without a directory",
+			body:   `{"ldap.enabled": true, "ldap.url": null, "ldap.search_base": null}`,
+			status: http.StatusBadRequest,
+			error:  "ldap.enabled: url must be",
+		},
+		{
+			name:   "ldap without a search base",
+			body:   `{"ldap.enabled": true, "ldap.url": "ldap://directory.example:389"}`,
+			status: http.StatusBadRequest,
+			error:  "ldap.enabled: search_base is required",
+		},
+		{
+			name:   "ldap configured",
+			body:   `{"ldap.enabled": true, "ldap.url": "ldap://directory.example:389", "ldap.search_base": "dc=example,dc=org"}`,
+			status: http.StatusOK,
+		},
+		{
+			// Already enabled, so breaking the config is refused too
+			name:   "ldap enabled loses its search base",
+			body:   `{"ldap.search_base": ""}`,
+			status: http.StatusBadRequest,
+			error:  "ldap.enabled: search_base is required",
+		},
+		{
+			name:   "ldap disabled together",
+			body:   `{"ldap.enabled": false, "ldap.search_base": null, "ldap.url": null}`,
+			status: http.StatusOK,
+		},
+		{
+			name:   "oidc without a client",
+			body:   `{"oidc.enabled": true, "oidc.issuer": "https://idp.example", "oidc.client_id": null}`,
+			status: http.StatusBadRequest,
+			error:  "oidc.enabled: issuer and client_id are required",
+		},
+		{
+			name:   "oidc configured",
+			body:   `{"oidc.enabled": true, "oidc.issuer": "https://idp.example", "oidc.client_id": "panel"}`,
+			status: http.StatusOK,
+		},
+		{
+			name:   "oidc disabled",
+			body:   `{"oidc.enabled": null}`,
+			status: http.StatusOK,
+		},
+	}
+	for _, tt := range tests {
+		w := putSettings(t, tt.body)
+		if w.Code != tt.status || !strings.Contains(w.Body.String(), tt.error) {
+			t.Fatalf("%s: status %d: %s, want %d with %q", tt.name, w.Code, w.Body, tt.status, tt.error)
+		}
+	}
+}
+
+func TestSettingsNeedUnrestrictedAdmin(t *testing.T) {
+	r := newPanelRouter()
+	for name, token := range map[string]string{
+		"operator":         signIn(t, models.RoleOperator, nil),
+		"restricted admin": signIn(t, models.RoleAdmin, func(u *models.User) { u.ContainerLabels = "team=a" }),
+	} {
+		t.Run(name, func(t *testing.T) {
+			call(t, r, token, "GET", "/api/settings", "", http.StatusForbidden)
+			call(t, r, token, "PUT", "/api/settings", `{"jwt.grace_hours": 1}`, http.StatusForbidden)
+		})
+	}
+
+	reader := apiToken(t, models.RoleAdmin, models.ScopeSettingsRead)
+	call(t, r, reader, "GET", "/api/settings", "", http.StatusOK)
+	call(t, r, reader, "PUT", "/api/settings", `{"jwt.grace_hours": 1}`, http.StatusForbidden)
+
+	admin := signIn(t, models.RoleAdmin, nil)
+	call(t, r, admin, "GET", "/api/settings", "", http.StatusOK)
+	call(t, r, admin, "PUT", "/api/settings", `{"jwt.grace_hours": -5}`, http.StatusBadRequest)
+}
@@ -0,0 +1,148 @@
+package handlers
+
+import (
+	"crypto/tls"
+	"errors"
+	"net/http"
+	"strings"
+	"sync"
+
+	"netcontrol-containers/database"
+	"netcontrol-containers/middleware"
+	"netcontrol-containers/models"
+	"netcontrol-containers/services"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+type SetupRequest struct {
+	SetupToken  string `json:"setup_token" binding:"required"`
+	Username    string `json:"username" binding:"required,max=50"`
+	Password    string `json:"password" binding:"required"`
+	Hostname    string `json:"hostname"`
+	TLSCertFile string `json:"tls_cert_file"`
+	TLSKeyFile  string `json:"tls_key_file"`
+}
+
+var errSetupUsersExist = errors.New("Users already exist; sign in instead")
+
+var setupMu sync.Mutex
+
+// SetupPage serves the first-run wizard, or sends the browser to the login
+// page once setup is done.
+func SetupPage(c *gin.Context) {
+	if !services.SetupRequired() {
+		c.Redirect(http.StatusFound, middleware.URL("/login"))
+		return
+	}
+	c.HTML(http.StatusOK, "setup.html", gin.H{"MinPasswordLength": models.MinPasswordLength})
+}
+
+func GetSetupStatus(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{
+		"setup_required":      services.SetupRequired(),
+		"min_password_length": models.MinPasswordLength,
+	})
+}
+
+// CompleteSetup creates the initial admin, replaces the JWT signing secret,
+// stores the optional hostname and TLS files and logs the admin in. It only
+// works once.
+func CompleteSetup(c *gin.Context) {
+	setupMu.Lock()
+	defer setupMu.Unlock()
+
+	if !services.SetupRequired() {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Setup has already been completed"})
+		return
+	}
+
+	var req SetupRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request: " + err.Error()})
+		return
+	}
+
+	if !services.CheckSetupToken(strings.TrimSpace(req.SetupToken)) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Invalid setup code. It is printed in the server log."})
+		return
+	}
+
+	req.Username = strings.TrimSpace(req.Username)
+	req.Hostname = strings.TrimSpace(req.Hostname)
+	if err := models.ValidatePassword(req.Password, req.Username); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if req.Hostname != "" && !models.ValidPanelHostname(req.Hostname) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Hostname must be a host name or IP address without scheme or path"})
+		return
+	}
+	if (req.TLSCertFile == "") != (req.TLSKeyFile == "") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Both a TLS certificate and key file are required"})
+		return
+	}
+	if req.TLSCertFile != "" {
+		if _, err := tls.LoadX509KeyPair(req.TLSCertFile, req.TLSKeyFile); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to load TLS certificate: " + err.Error()})
+			return
+		}
+	}
+
+	admin := models.User{Username: req.Username, Role: models.RoleAdmin, AuthSource: models.AuthSourceLocal}
+	if err := admin.SetPassword(req.Password); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to set password"})
+		return
+	}
+
+	err := database.Get().Transaction(func(tx *gorm.DB) error {
+		// Users may exist without the completed flag if setup was
+		// interrupted; never hand out a second initial admin.
+		var count int64
+		if err := tx.Model(&models.User{}).Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			return errSetupUsersExist
+		}
+		if err := tx.Create(&admin).Error; err != nil {
+			return err
+		}
+		for key, value := range map[string]string{
+			models.SettingPanelHostname: req.Hostname,
+			models.SettingTLSCertFile:   req.TLSCertFile,
+			models.SettingTLSKeyFile:    req.TLSKeyFile,
+		} {
+			if err := models.SetSetting(tx, key, value); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if errors.Is(err, errSetupUsersExist) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := services.GetJWTKeyManager().Reset(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate signing secret"})
+		return
+	}
+	if err := services.MarkSetupComplete(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	recordLoginAttempt(c, admin.Username, true, "setup")
+	if _, err := startSession(c, &admin); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Setup complete"})
+}
@@ -0,0 +1,45 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"netcontrol-containers/models"
+	"netcontrol-containers/services"
+)
+
+func postSetup(r http.Handler, body string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("POST", "/api/setup", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	return serve(r, req)
+}
+
+func TestSetupNeverCreatesSecondAdmin(t *testing.T) {
+	r := newPanelRouter()
+	// Users exist, as they do after an interrupted setup
+	newUser(t, models.RoleViewer, nil)
+
+	status := decode[map[string]interface{}](t, serve(r, httptest.NewRequest("GET", "/api/setup", nil)))
+	if status["setup_required"] != true {
+		t.Fatalf("setup status = %+v, want required", status)
+	}
+
+	for _, tc := range []struct {
+		body   string
+		status int
+	}{
+		{`{"setup_token": "wrong", "username": "owner", "password": "Setup-Pass-1"}`, http.StatusForbidden},
+		{`{"setup_token": "` + services.SetupToken() + `", "username": "owner", "password": "short"}`, http.StatusBadRequest},
+		{`{"setup_token": "` + services.SetupToken() + `", "username": "owner", "password": "Setup-Pass-1", "hostname": "https://panel.example"}`, http.StatusBadRequest},
+		{`{"setup_token": "` + services.SetupToken() + `", "username": "owner", "password": "Setup-Pass-1"}`, http.StatusConflict},
+	} {
+		if w := postSetup(r, tc.body); w.Code != tc.status {
+			t.Errorf("setup with %s: %d %s, want %d", tc.body, w.Code, w.Body, tc.status)
+		}
+	}
+	if w := postLogin(r, "198.51.100.50", "owner", "Setup-Pass-1"); w.Code != http.StatusUnauthorized {
+		t.Fatalf("login of the refused setup admin: %d %s, want 401", w.Code, w.Body)
+	}
+}
@@ -11,9 +11,7 @@ import (
 )
 
 var terminalUpgrader = websocket.Upgrader{
-	CheckOrigin: func(r *http.Request) bool {
-		return true
-	},
+	CheckOrigin:     checkOrigin,
 	ReadBufferSize:  1024,
 	WriteBufferSize: 1024,
 }
@@ -37,7 +35,8 @@ func TerminalWS(c *gin.Context) {
 
 	// Create PTY session
 	ptyManager := services.GetPTYManager()
-	session, err := ptyManager.CreateSession(sessionID, rows, cols)
+	session, err := ptyManager.CreateSession(sessionID, c.GetUint("user_id"), c.GetString("username"), rows, cols)
+	recordAudit(c, "terminal.open", "session="+sessionID, err)
 	if err != nil {
 		conn.WriteJSON(gin.H{"error": err.Error()})
 		return
@@ -62,6 +61,18 @@ func TerminalWS(c *gin.Context) {
 		}
 	}()
 
+	// On shutdown tell the client and close the socket, which ends the loop
+	// below; the shell is hung up by the PTY manager
+	stop := make(chan struct{})
+	defer close(stop)
+	go func() {
+		select {
+		case <-services.GetShutdownManager().Context().Done():
+			closeGoingAway(conn)
+		case <-stop:
+		}
+	}()
+
 	// Handle WebSocket input -> PTY
 	for {
 		messageType, data, err := conn.ReadMessage()
@@ -88,8 +99,11 @@ func TerminalWS(c *gin.Context) {
 		}
 	}
 
-	// Cleanup
-	session.Close()
+	// Cleanup. On shutdown the PTY manager hangs up the shell instead.
+	if !services.GetShutdownManager().ShuttingDown() {
+		session.Close()
+	}
+	recordAudit(c, "terminal.close", "session="+sessionID, nil)
 }
 
 func TerminalResize(c *gin.Context) {
@@ -107,7 +121,7 @@ func TerminalResize(c *gin.Context) {
 
 	ptyManager := services.GetPTYManager()
 	session := ptyManager.GetSession(sessionID)
-	if session == nil {
+	if session == nil || session.UserID != c.GetUint("user_id") {
 		c.JSON(http.StatusNotFound, gin.H{"error": "Session not found"})
 		return
 	}
@@ -122,7 +136,7 @@ func TerminalResize(c *gin.Context) {
 
 func ListTerminalSessions(c *gin.Context) {
 	ptyManager := services.GetPTYManager()
-	sessions := ptyManager.ListSessions()
+	sessions := ptyManager.ListSessions(c.GetUint("user_id"))
 	c.JSON(http.StatusOK, gin.H{"sessions": sessions})
 }
 
@@ -130,6 +144,10 @@ func CloseTerminalSession(c *gin.Context) {
 	sessionID := c.Param("session")
 
 	ptyManager := services.GetPTYManager()
+	if session := ptyManager.GetSession(sessionID); session == nil || session.UserID != c.GetUint("user_id") {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Session not found"})
+		return
+	}
 	if err := ptyManager.CloseSession(sessionID); err != nil {
 		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
 		return
@@ -0,0 +1,30 @@
+package handlers
+
+import (
+	"net/http"
+	"testing"
+
+	"netcontrol-containers/models"
+)
+
+func TestTerminalNeedsUnrestrictedAdmin(t *testing.T) {
+	r := newPanelRouter()
+	for name, token := range map[string]string{
+		"operator":          signIn(t, models.RoleOperator, nil),
+		"restricted admin":  signIn(t, models.RoleAdmin, func(u *models.User) { u.FileRoot = t.TempDir() }),
+		"token of an admin": apiToken(t, models.RoleAdmin, models.ScopeFilesWrite, models.ScopeInstallerWrite),
+	} {
+		t.Run(name, func(t *testing.T) {
+			call(t, r, token, "GET", "/api/terminal/sessions", "", http.StatusForbidden)
+			call(t, r, token, "DELETE", "/api/terminal/any", "", http.StatusForbidden)
+			// Refused before the upgrade
+			call(t, r, token, "GET", "/ws/terminal", "", http.StatusForbidden)
+		})
+	}
+
+	admin := signIn(t, models.RoleAdmin, nil)
+	call(t, r, admin, "GET", "/api/terminal/sessions", "", http.StatusOK)
+	call(t, r, admin, "POST", "/api/terminal/any/resize", `{"rows": 24, "cols": 80}`, http.StatusNotFound)
+	call(t, r, admin, "DELETE", "/api/terminal/any", "", http.StatusNotFound)
+	call(t, r, apiToken(t, models.RoleAdmin, models.ScopeTerminal), "GET", "/api/terminal/sessions", "", http.StatusOK)
+}
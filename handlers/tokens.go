@@ -0,0 +1,98 @@
+package handlers
+
+import (
+	"net/http"
+	"time"
+
+	"netcontrol-containers/database"
+	"netcontrol-containers/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+type CreateAPITokenRequest struct {
+	Name          string   `json:"name" binding:"required,max=100"`
+	Scopes        []string `json:"scopes" binding:"required,min=1"`
+	ExpiresInDays int      `json:"expires_in_days" binding:"min=0"`
+}
+
+type APITokenResponse struct {
+	models.APIToken
+	Scopes []string `json:"scopes"`
+	Token  string   `json:"token,omitempty"`
+}
+
+func ListAPITokens(c *gin.Context) {
+	var tokens []models.APIToken
+	if err := database.Get().Where("user_id = ?", c.GetUint("user_id")).Order("id").Find(&tokens).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	result := make([]APITokenResponse, 0, len(tokens))
+	for _, t := range tokens {
+		result = append(result, APITokenResponse{APIToken: t, Scopes: t.ScopeList()})
+	}
+	c.JSON(http.StatusOK, result)
+}
+
+func CreateAPIToken(c *gin.Context) {
+	var req CreateAPITokenRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request: " + err.Error()})
+		return
+	}
+
+	for _, scope := range req.Scopes {
+		if !models.ValidScope(scope) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown scope: " + scope})
+			return
+		}
+	}
+
+	plain, err := models.GenerateAPIToken()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	token := models.APIToken{
+		UserID:    c.GetUint("user_id"),
+		Name:      req.Name,
+		Prefix:    plain[:len(models.APITokenPrefix)+8],
+		TokenHash: models.HashAPIToken(plain),
+	}
+	token.SetScopes(req.Scopes)
+	if req.ExpiresInDays > 0 {
+		expires := time.Now().AddDate(0, 0, req.ExpiresInDays)
+		token.ExpiresAt = &expires
+	}
+
+	if err := database.Get().Create(&token).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	// The plain token is only ever returned here
+	c.JSON(http.StatusOK, APITokenResponse{APIToken: token, Scopes: token.ScopeList(), Token: plain})
+}
+
+func RevokeAPIToken(c *gin.Context) {
+	result := database.Get().
+		Where("id = ? AND user_id = ?", c.Param("id"), c.GetUint("user_id")).
+		Delete(&models.APIToken{})
+	if result.Error != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": result.Error.Error()})
+		return
+	}
+	if result.RowsAffected == 0 {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Token not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Token revoked"})
+}
+
+func ListAPITokenScopes(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"scopes": models.AllScopes})
+}
@@ -0,0 +1,65 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"netcontrol-containers/database"
+	"netcontrol-containers/models"
+)
+
+func TestAPITokenLifecycle(t *testing.T) {
+	r := newPanelRouter()
+	owner := signIn(t, models.RoleOperator, nil)
+	other := signIn(t, models.RoleOperator, nil)
+
+	call(t, r, owner, "POST", "/api/user/tokens", `{"name": "ci", "scopes": ["docker:everything"]}`, http.StatusBadRequest)
+	created := decode[APITokenResponse](t, call(t, r, owner, "POST", "/api/user/tokens", `{"name": "ci", "scopes": ["docker:read"]}`, http.StatusOK))
+	if !strings.HasPrefix(created.Token, models.APITokenPrefix) || !strings.HasPrefix(created.Token, created.Prefix) {
+		t.Fatalf("token %q with prefix %q", created.Token, created.Prefix)
+	}
+
+	// Only a hash of the token is stored
+	var stored models.APIToken
+	database.Get().First(&stored, created.ID)
+	if stored.TokenHash == "" || strings.Contains(stored.TokenHash, created.Token[len(created.Prefix):]) {
+		t.Fatalf("stored hash %q for token %q", stored.TokenHash, created.Token)
+	}
+
+	// The token is limited to its scopes and can't manage the account
+	call(t, r, created.Token, "GET", "/api/docker/containers", "", http.StatusOK)
+	call(t, r, created.Token, "POST", "/api/docker/containers/any/stop", "", http.StatusForbidden)
+	call(t, r, created.Token, "GET", "/api/kubernetes/pods", "", http.StatusForbidden)
+	call(t, r, created.Token, "GET", "/api/user/tokens", "", http.StatusForbidden)
+	call(t, r, created.Token, "POST", "/api/user/tokens", `{"name": "more", "scopes": ["docker:write"]}`, http.StatusForbidden)
+
+	tokens := decode[[]APITokenResponse](t, call(t, r, owner, "GET", "/api/user/tokens", "", http.StatusOK))
+	if len(tokens) != 1 || tokens[0].LastUsedAt == nil || tokens[0].Token != "" || strings.Join(tokens[0].Scopes, ",") != "docker:read" {
+		t.Fatalf("tokens = %+v, want the used token without its secret", tokens)
+	}
+
+	path := "/api/user/tokens/" + strconv.Itoa(int(created.ID))
+	call(t, r, other, "DELETE", path, "", http.StatusNotFound)
+	call(t, r, owner, "DELETE", path, "", http.StatusOK)
+	call(t, r, created.Token, "GET", "/api/docker/containers", "", http.StatusUnauthorized)
+}
+
+func TestAPITokenExpiresAndStaysWithinRole(t *testing.T) {
+	r := newPanelRouter()
+	admin := signIn(t, models.RoleAdmin, nil)
+	web := containerByName(t, r, admin, "web")
+
+	// Scopes never grant more than the owner's role
+	viewer := apiToken(t, models.RoleViewer, models.ScopeDockerRead, models.ScopeDockerWrite)
+	call(t, r, viewer, "GET", "/api/docker/containers", "", http.StatusOK)
+	call(t, r, viewer, "POST", "/api/docker/containers/"+web.ID+"/restart", "", http.StatusForbidden)
+
+	expiring := apiToken(t, models.RoleOperator, models.ScopeDockerRead)
+	call(t, r, expiring, "GET", "/api/docker/containers", "", http.StatusOK)
+	expired := time.Now().Add(-time.Minute)
+	database.Get().Model(&models.APIToken{}).Where("token_hash = ?", models.HashAPIToken(expiring)).Update("expires_at", expired)
+	call(t, r, expiring, "GET", "/api/docker/containers", "", http.StatusUnauthorized)
+}
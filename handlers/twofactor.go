@@ -0,0 +1,319 @@
+package handlers
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"netcontrol-containers/database"
+	"netcontrol-containers/models"
+	"netcontrol-containers/services"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+const (
+	totpIssuer          = "NetControl"
+	loginChallengeTTL   = 5 * time.Minute
+	loginChallengeTries = 5
+)
+
+// loginChallenge is a password-verified login waiting for its second factor.
+type loginChallenge struct {
+	userID   uint
+	expires  time.Time
+	attempts int
+}
+
+var (
+	loginChallenges   = make(map[string]*loginChallenge)
+	loginChallengesMu sync.Mutex
+)
+
+func newLoginChallenge(userID uint) string {
+	loginChallengesMu.Lock()
+	defer loginChallengesMu.Unlock()
+
+	// Drop expired challenges while we hold the lock
+	now := time.Now()
+	for id, ch := range loginChallenges {
+		if now.After(ch.expires) {
+			delete(loginChallenges, id)
+		}
+	}
+
+	id := uuid.New().String()
+	loginChallenges[id] = &loginChallenge{userID: userID, expires: now.Add(loginChallengeTTL)}
+	return id
+}
+
+// verifySecondFactor accepts either a current TOTP code or an unused
+// recovery code, and persists the resulting state change on the user. The
+// updates are conditional on the stored state, so of two concurrent logins
+// with the same code only one succeeds.
+func verifySecondFactor(user *models.User, code string) bool {
+	if step, ok := services.ValidateTOTP(user.TOTPSecret, code, time.Now()); ok {
+		// A step at or below the last used one is a replay
+		result := database.Get().Model(&models.User{}).
+			Where("id = ? AND totp_last_step < ?", user.ID, step).
+			Update("totp_last_step", step)
+		if result.Error != nil || result.RowsAffected == 0 {
+			return false
+		}
+		user.TOTPLastStep = step
+		return true
+	}
+
+	codes := user.RecoveryCodes
+	if user.UseRecoveryCode(services.HashRecoveryCode(code)) {
+		// Fails when the codes changed since the user was loaded; the
+		// login can then simply be retried
+		result := database.Get().Model(&models.User{}).
+			Where("id = ? AND recovery_codes = ?", user.ID, codes).
+			Update("recovery_codes", user.RecoveryCodes)
+		return result.Error == nil && result.RowsAffected == 1
+	}
+	return false
+}
+
+func LoginTwoFactor(c *gin.Context) {
+	var req struct {
+		Challenge string `json:"challenge" binding:"required"`
+		Code      string `json:"code" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	if wait := services.GetLoginGuard().RetryAfter("ip:" + c.ClientIP()); wait > 0 {
+		tooManyAttempts(c, wait)
+		return
+	}
+
+	loginChallengesMu.Lock()
+	ch, ok := loginChallenges[req.Challenge]
+	if ok && time.Now().After(ch.expires) {
+		delete(loginChallenges, req.Challenge)
+		ok = false
+	}
+	loginChallengesMu.Unlock()
+
+	if !ok {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Login expired, please sign in again"})
+		return
+	}
+
+	var user models.User
+	if err := database.Get().First(&user, ch.userID).Error; err != nil || !user.TOTPEnabled {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid credentials"})
+		return
+	}
+	if user.Locked() {
+		c.JSON(http.StatusForbidden, gin.H{"error": "Account is temporarily locked. Try again later or contact an administrator."})
+		return
+	}
+
+	if !verifySecondFactor(&user, req.Code) {
+		services.GetLoginGuard().Failure(loginGuardKeys(c.ClientIP(), user.Username)...)
+		registerFailedLogin(&user)
+		recordLoginAttempt(c, user.Username, false, "bad_2fa_code")
+
+		loginChallengesMu.Lock()
+		ch.attempts++
+		if ch.attempts >= loginChallengeTries {
+			delete(loginChallenges, req.Challenge)
+		}
+		loginChallengesMu.Unlock()
+
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid authentication code"})
+		return
+	}
+
+	loginChallengesMu.Lock()
+	delete(loginChallenges, req.Challenge)
+	loginChallengesMu.Unlock()
+
+	completeLogin(c, &user)
+}
+
+func GetTwoFactorStatus(c *gin.Context) {
+	var user models.User
+	if err := database.Get().First(&user, c.GetUint("user_id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"enabled":                  user.TOTPEnabled,
+		"recovery_codes_remaining": user.RemainingRecoveryCodes(),
+	})
+}
+
+// SetupTwoFactor starts enrollment by generating a new secret. 2FA stays
+// disabled until EnableTwoFactor confirms a code from the authenticator.
+func SetupTwoFactor(c *gin.Context) {
+	var user models.User
+	if err := database.Get().First(&user, c.GetUint("user_id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	if user.TOTPEnabled {
+		c.JSON(http.StatusConflict, gin.H{"error": "Two-factor authentication is already enabled"})
+		return
+	}
+
+	secret, err := services.GenerateTOTPSecret()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := database.Get().Model(&user).Update("totp_secret", secret).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save user"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"secret":           secret,
+		"provisioning_uri": services.TOTPProvisioningURI(totpIssuer, user.Username, secret),
+	})
+}
+
+func EnableTwoFactor(c *gin.Context) {
+	var req struct {
+		Code string `json:"code" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	var user models.User
+	if err := database.Get().First(&user, c.GetUint("user_id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	if user.TOTPEnabled {
+		c.JSON(http.StatusConflict, gin.H{"error": "Two-factor authentication is already enabled"})
+		return
+	}
+	if user.TOTPSecret == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Two-factor setup has not been started"})
+		return
+	}
+
+	step, ok := services.ValidateTOTP(user.TOTPSecret, req.Code, time.Now())
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid authentication code"})
+		return
+	}
+
+	codes, hashes, err := services.GenerateRecoveryCodes()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	user.TOTPEnabled = true
+	user.TOTPLastStep = step
+	user.SetRecoveryCodes(hashes)
+	if err := database.Get().Save(&user).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save user"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"message":        "Two-factor authentication enabled",
+		"recovery_codes": codes,
+	})
+}
+
+func DisableTwoFactor(c *gin.Context) {
+	var req struct {
+		Password string `json:"password" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	var user models.User
+	if err := database.Get().First(&user, c.GetUint("user_id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	if !user.CheckPassword(req.Password) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid password"})
+		return
+	}
+
+	user.ResetTwoFactor()
+	if err := database.Get().Save(&user).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save user"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Two-factor authentication disabled"})
+}
+
+func RegenerateRecoveryCodes(c *gin.Context) {
+	var req struct {
+		Password string `json:"password" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request"})
+		return
+	}
+
+	var user models.User
+	if err := database.Get().First(&user, c.GetUint("user_id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	if !user.CheckPassword(req.Password) {
+		c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid password"})
+		return
+	}
+	if !user.TOTPEnabled {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Two-factor authentication is not enabled"})
+		return
+	}
+
+	codes, hashes, err := services.GenerateRecoveryCodes()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	user.SetRecoveryCodes(hashes)
+	if err := database.Get().Model(&user).Update("recovery_codes", user.RecoveryCodes).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save user"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"recovery_codes": codes})
+}
+
+// ResetUserTwoFactor lets an admin remove 2FA from an account whose owner
+// lost both the authenticator and the recovery codes.
+func ResetUserTwoFactor(c *gin.Context) {
+	var user models.User
+	if err := database.Get().First(&user, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	user.ResetTwoFactor()
+	if err := database.Get().Save(&user).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save user"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Two-factor authentication reset"})
+}
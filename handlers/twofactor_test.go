@@ -0,0 +1,173 @@
+package handlers
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"netcontrol-containers/database"
+	"netcontrol-containers/models"
+	"netcontrol-containers/services"
+
+	"github.com/google/uuid"
+)
+
+// totpCode computes the RFC 6238 code of secret at t.
+func totpCode(t *testing.T, secret string, at time.Time) string {
+	t.Helper()
+	key, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], uint64(at.Unix()/30))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+	offset := sum[len(sum)-1] & 0x0f
+	return fmt.Sprintf("%06d", binary.BigEndian.Uint32(sum[offset:offset+4])&0x7fffffff%1000000)
+}
+
+// twoFactorUser creates a user with two-factor login enabled and returns it
+// together with its recovery codes.
+func twoFactorUser(t *testing.T) (*models.User, []string) {
+	t.Helper()
+	secret, err := services.GenerateTOTPSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+	codes, hashes, err := services.GenerateRecoveryCodes()
+	if err != nil {
+		t.Fatal(err)
+	}
+	user := &models.User{Username: "2fa-" + uuid.NewString()[:8], Role: models.RoleViewer, TOTPSecret: secret, TOTPEnabled: true}
+	user.SetRecoveryCodes(hashes)
+	if err := database.Get().Create(user).Error; err != nil {
+		t.Fatal(err)
+	}
+	return user, codes
+}
+
+// loadUser reads the stored user, as each login request does.
+func loadUser(t *testing.T, id uint) *models.User {
+	t.Helper()
+	var user models.User
+	if err := database.Get().First(&user, id).Error; err != nil {
+		t.Fatal(err)
+	}
+	return &user
+}
+
+func TestVerifySecondFactorRejectsReplayedCode(t *testing.T) {
+	user, _ := twoFactorUser(t)
+	code := totpCode(t, user.TOTPSecret, time.Now())
+
+	// Two logins loaded the user before either used the code
+	first, second := loadUser(t, user.ID), loadUser(t, user.ID)
+	if !verifySecondFactor(first, code) {
+		t.Fatal("current code rejected")
+	}
+	if verifySecondFactor(second, code) {
+		t.Fatal("concurrent login accepted the same code")
+	}
+	if verifySecondFactor(loadUser(t, user.ID), code) {
+		t.Fatal("code accepted again after it was used")
+	}
+}
+
+func TestVerifySecondFactorUsesRecoveryCodeOnce(t *testing.T) {
+	user, codes := twoFactorUser(t)
+
+	first, second := loadUser(t, user.ID), loadUser(t, user.ID)
+	if !verifySecondFactor(first, codes[0]) {
+		t.Fatal("recovery code rejected")
+	}
+	if verifySecondFactor(second, codes[0]) {
+		t.Fatal("concurrent login accepted the same recovery code")
+	}
+
+	stored := loadUser(t, user.ID)
+	if verifySecondFactor(stored, codes[0]) {
+		t.Fatal("recovery code accepted twice")
+	}
+	if got, want := stored.RemainingRecoveryCodes(), len(codes)-1; got != want {
+		t.Fatalf("%d recovery codes left, want %d", got, want)
+	}
+	if !verifySecondFactor(stored, codes[1]) {
+		t.Fatal("unused recovery code rejected")
+	}
+}
+
+func TestLoginWithSecondFactor(t *testing.T) {
+	r := newPanelRouter()
+	user, _ := twoFactorUser(t)
+	if err := user.SetPassword("correct horse"); err != nil {
+		t.Fatal(err)
+	}
+	database.Get().Save(user)
+
+	w := postLogin(r, "198.51.100.30", user.Username, "correct horse")
+	pending := decode[map[string]interface{}](t, w)
+	challenge, _ := pending["challenge"].(string)
+	if w.Code != http.StatusOK || pending["two_factor_required"] != true || challenge == "" || pending["token"] != nil {
+		t.Fatalf("password step: %d %s, want a challenge and no token", w.Code, w.Body)
+	}
+	if cookieValue(w.Result().Cookies(), "token") != "" {
+		t.Fatal("session cookie set before the second factor")
+	}
+
+	second := func(challenge, code string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", "/api/login/2fa", strings.NewReader(`{"challenge":"`+challenge+`","code":"`+code+`"}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.RemoteAddr = "198.51.100.30:40000"
+		return serve(r, req)
+	}
+	if w := second("made-up", totpCode(t, user.TOTPSecret, time.Now())); w.Code != http.StatusUnauthorized {
+		t.Fatalf("unknown challenge: %d %s, want 401", w.Code, w.Body)
+	}
+	if w := second(challenge, "000000"); w.Code != http.StatusUnauthorized {
+		t.Fatalf("wrong code: %d %s, want 401", w.Code, w.Body)
+	}
+	w = second(challenge, totpCode(t, user.TOTPSecret, time.Now()))
+	if w.Code != http.StatusOK {
+		t.Fatalf("right code: %d %s, want 200", w.Code, w.Body)
+	}
+	call(t, r, decode[LoginResponse](t, w).Token, "GET", "/api/user", "", http.StatusOK)
+
+	// The challenge is spent
+	if w := second(challenge, totpCode(t, user.TOTPSecret, time.Now().Add(30*time.Second))); w.Code != http.StatusUnauthorized {
+		t.Fatalf("reused challenge: %d %s, want 401", w.Code, w.Body)
+	}
+}
+
+func TestTwoFactorEnrollment(t *testing.T) {
+	r := newPanelRouter()
+	user := passwordUser(t, "correct horse", false)
+	token, _ := logIn(t, r, "198.51.100.31", user, "correct horse")
+
+	call(t, r, token, "POST", "/api/user/2fa/enable", `{"code": "123456"}`, http.StatusBadRequest)
+	setup := decode[map[string]string](t, call(t, r, token, "POST", "/api/user/2fa/setup", "", http.StatusOK))
+	call(t, r, token, "POST", "/api/user/2fa/enable", `{"code": "000000"}`, http.StatusBadRequest)
+	enabled := decode[map[string]interface{}](t, call(t, r, token, "POST", "/api/user/2fa/enable", `{"code": "`+totpCode(t, setup["secret"], time.Now())+`"}`, http.StatusOK))
+	if codes, _ := enabled["recovery_codes"].([]interface{}); len(codes) == 0 {
+		t.Fatalf("enabled without recovery codes: %+v", enabled)
+	}
+	call(t, r, token, "POST", "/api/user/2fa/setup", "", http.StatusConflict)
+
+	// Only an admin can reset someone else's second factor
+	reset := "/api/users/" + strconv.Itoa(int(user.ID)) + "/2fa/reset"
+	call(t, r, signIn(t, models.RoleOperator, nil), "POST", reset, "", http.StatusForbidden)
+	call(t, r, token, "POST", "/api/user/2fa/disable", `{"password": "wrong"}`, http.StatusUnauthorized)
+	call(t, r, signIn(t, models.RoleAdmin, nil), "POST", reset, "", http.StatusOK)
+	if loadUser(t, user.ID).TOTPEnabled {
+		t.Fatal("two-factor login still enabled after the reset")
+	}
+}
@@ -0,0 +1,242 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"netcontrol-containers/database"
+	"netcontrol-containers/models"
+	"netcontrol-containers/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+type CreateUserRequest struct {
+	Username        string `json:"username" binding:"required,max=50"`
+	Password        string `json:"password" binding:"required,min=6"`
+	Role            string `json:"role" binding:"required"`
+	Namespaces      string `json:"namespaces"`
+	ContainerLabels string `json:"container_labels"`
+	FileRoot        string `json:"file_root"`
+}
+
+// UpdateUserRequest changes only the fields that are present. An empty
+// string clears a resource restriction.
+type UpdateUserRequest struct {
+	Password        string  `json:"password" binding:"omitempty,min=6"`
+	Role            string  `json:"role"`
+	Namespaces      *string `json:"namespaces"`
+	ContainerLabels *string `json:"container_labels"`
+	FileRoot        *string `json:"file_root"`
+}
+
+func ListUsers(c *gin.Context) {
+	var users []models.User
+	if err := database.Get().Order("id").Find(&users).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusOK, users)
+}
+
+func CreateUser(c *gin.Context) {
+	var req CreateUserRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request: " + err.Error()})
+		return
+	}
+
+	if !models.ValidRole(req.Role) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid role"})
+		return
+	}
+
+	if err := models.ValidatePassword(req.Password, req.Username); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err := models.ValidateResourceScope(req.Namespaces, req.ContainerLabels, req.FileRoot); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var count int64
+	database.Get().Model(&models.User{}).Where("username = ?", req.Username).Count(&count)
+	if count > 0 {
+		c.JSON(http.StatusConflict, gin.H{"error": "Username already exists"})
+		return
+	}
+
+	user := models.User{
+		Username:        req.Username,
+		Role:            req.Role,
+		Namespaces:      req.Namespaces,
+		ContainerLabels: req.ContainerLabels,
+		FileRoot:        req.FileRoot,
+	}
+	if err := user.SetPassword(req.Password); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to set password"})
+		return
+	}
+
+	if err := database.Get().Create(&user).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, user)
+}
+
+func UpdateUser(c *gin.Context) {
+	var req UpdateUserRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid request: " + err.Error()})
+		return
+	}
+
+	var user models.User
+	if err := database.Get().First(&user, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	if req.Role != "" && req.Role != user.Role {
+		if !models.ValidRole(req.Role) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid role"})
+			return
+		}
+		if user.Role == models.RoleAdmin && isLastAdmin(user.ID) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Cannot demote the last admin"})
+			return
+		}
+		user.Role = req.Role
+	}
+
+	if req.Namespaces != nil {
+		user.Namespaces = *req.Namespaces
+	}
+	if req.ContainerLabels != nil {
+		user.ContainerLabels = *req.ContainerLabels
+	}
+	if req.FileRoot != nil {
+		user.FileRoot = *req.FileRoot
+	}
+	if err := models.ValidateResourceScope(user.Namespaces, user.ContainerLabels, user.FileRoot); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if req.Password != "" {
+		if user.External() {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Password is managed by the user's identity provider"})
+			return
+		}
+		if err := models.ValidatePassword(req.Password, user.Username); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if err := user.SetPassword(req.Password); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to set password"})
+			return
+		}
+	}
+
+	if err := database.Get().Save(&user).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save user"})
+		return
+	}
+
+	// A password reset by an admin logs the user out everywhere
+	if req.Password != "" {
+		models.RevokeUserSessions(database.Get(), user.ID, "")
+	}
+
+	c.JSON(http.StatusOK, user)
+}
+
+func DeleteUser(c *gin.Context) {
+	var user models.User
+	if err := database.Get().First(&user, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	if user.ID == c.GetUint("user_id") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Cannot delete your own account"})
+		return
+	}
+
+	if user.Role == models.RoleAdmin && isLastAdmin(user.ID) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Cannot delete the last admin"})
+		return
+	}
+
+	// Hard delete so the username can be reused
+	if err := database.Get().Unscoped().Delete(&user).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+	database.Get().Where("user_id = ?", user.ID).Delete(&models.APIToken{})
+	database.Get().Where("user_id = ?", user.ID).Delete(&models.Session{})
+
+	c.JSON(http.StatusOK, gin.H{"message": "User deleted successfully"})
+}
+
+// UnlockUser clears a temporary lockout and the failure counters that led
+// to it.
+func UnlockUser(c *gin.Context) {
+	var user models.User
+	if err := database.Get().First(&user, c.Param("id")).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return
+	}
+
+	if err := database.Get().Model(&user).Updates(map[string]interface{}{
+		"failed_logins": 0,
+		"locked_until":  nil,
+	}).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save user"})
+		return
+	}
+	services.GetLoginGuard().Success("user:" + strings.ToLower(user.Username))
+
+	c.JSON(http.StatusOK, gin.H{"message": "User unlocked"})
+}
+
+// ListLoginAttempts returns recorded login attempts, newest first,
+// optionally filtered by username, IP or outcome.
+func ListLoginAttempts(c *gin.Context) {
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "100"))
+	if limit <= 0 || limit > 1000 {
+		limit = 100
+	}
+
+	query := database.Get().Model(&models.LoginAttempt{})
+	if username := c.Query("username"); username != "" {
+		query = query.Where("username = ?", username)
+	}
+	if ip := c.Query("ip"); ip != "" {
+		query = query.Where("ip = ?", ip)
+	}
+	if c.Query("failed") == "true" {
+		query = query.Where("success = ?", false)
+	}
+
+	var attempts []models.LoginAttempt
+	if err := query.Order("id DESC").Limit(limit).Find(&attempts).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, attempts)
+}
+
+// isLastAdmin reports whether userID is the only remaining admin account.
+func isLastAdmin(userID uint) bool {
+	var count int64
+	database.Get().Model(&models.User{}).
+		Where("role = ? AND id <> ?", models.RoleAdmin, userID).
+		Count(&count)
+	return count == 0
+}
@@ -0,0 +1,77 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"testing"
+
+	"netcontrol-containers/models"
+
+	"github.com/google/uuid"
+)
+
+func TestUsersNeedUnrestrictedAdmin(t *testing.T) {
+	r := newPanelRouter()
+	for name, token := range map[string]string{
+		"viewer":            signIn(t, models.RoleViewer, nil),
+		"operator":          signIn(t, models.RoleOperator, nil),
+		"restricted admin":  signIn(t, models.RoleAdmin, func(u *models.User) { u.Namespaces = "shop" }),
+		"token of an admin": apiToken(t, models.RoleAdmin, models.ScopeDockerWrite, models.ScopeSettingsWrite),
+	} {
+		t.Run(name, func(t *testing.T) {
+			call(t, r, token, "GET", "/api/users", "", http.StatusForbidden)
+			call(t, r, token, "POST", "/api/users", `{"username": "intruder", "password": "Intruder-Pass-1", "role": "admin"}`, http.StatusForbidden)
+			call(t, r, token, "GET", "/api/users/login-attempts", "", http.StatusForbidden)
+			call(t, r, token, "GET", "/api/auth/keys", "", http.StatusForbidden)
+		})
+	}
+	call(t, r, apiToken(t, models.RoleAdmin, models.ScopeUsersWrite), "GET", "/api/users", "", http.StatusOK)
+}
+
+func TestUsersCreateUpdateDelete(t *testing.T) {
+	r := newPanelRouter()
+	admin := signIn(t, models.RoleAdmin, nil)
+	username := "member-" + uuid.NewString()[:8]
+
+	for _, body := range []string{
+		`{"username": "` + username + `", "password": "Member-Pass-1", "role": "root"}`,
+		`{"username": "` + username + `", "password": "` + username + `", "role": "viewer"}`,
+		`{"username": "` + username + `", "password": "Member-Pass-1", "role": "viewer", "file_root": "relative/dir"}`,
+	} {
+		call(t, r, admin, "POST", "/api/users", body, http.StatusBadRequest)
+	}
+	created := decode[models.User](t, call(t, r, admin, "POST", "/api/users", `{"username": "`+username+`", "password": "Member-Pass-1", "role": "viewer"}`, http.StatusOK))
+	call(t, r, admin, "POST", "/api/users", `{"username": "`+username+`", "password": "Member-Pass-1", "role": "viewer"}`, http.StatusConflict)
+
+	path := "/api/users/" + strconv.Itoa(int(created.ID))
+	member, _ := logIn(t, r, "198.51.100.40", &created, "Member-Pass-1")
+	call(t, r, member, "POST", "/api/docker/containers/any/stop", "", http.StatusForbidden)
+
+	// Promotion takes effect on the next request of the same session
+	call(t, r, admin, "PUT", path, `{"role": "superuser"}`, http.StatusBadRequest)
+	updated := decode[models.User](t, call(t, r, admin, "PUT", path, `{"role": "operator", "namespaces": "shop"}`, http.StatusOK))
+	if updated.Role != models.RoleOperator || updated.Namespaces != "shop" {
+		t.Fatalf("updated user = %+v", updated)
+	}
+	call(t, r, member, "GET", "/api/kubernetes/pods?namespace=shop", "", http.StatusOK)
+	call(t, r, member, "GET", "/api/kubernetes/pods?namespace=kube-system", "", http.StatusForbidden)
+
+	// A password reset by an admin ends the user's sessions
+	call(t, r, admin, "PUT", path, `{"password": "Member-Pass-2"}`, http.StatusOK)
+	call(t, r, member, "GET", "/api/user", "", http.StatusUnauthorized)
+
+	call(t, r, admin, "DELETE", path, "", http.StatusOK)
+	call(t, r, admin, "DELETE", path, "", http.StatusNotFound)
+	if w := postLogin(r, "198.51.100.40", username, "Member-Pass-2"); w.Code != http.StatusUnauthorized {
+		t.Fatalf("login of a deleted user: %d %s, want 401", w.Code, w.Body)
+	}
+}
+
+func TestUsersCannotDeleteOwnAccount(t *testing.T) {
+	r := newPanelRouter()
+	admin := signIn(t, models.RoleAdmin, nil)
+	self := decode[map[string]interface{}](t, call(t, r, admin, "GET", "/api/user", "", http.StatusOK))
+
+	call(t, r, admin, "DELETE", "/api/users/"+strconv.Itoa(int(self["user_id"].(float64))), "", http.StatusBadRequest)
+	call(t, r, admin, "GET", "/api/user", "", http.StatusOK)
+}
@@ -0,0 +1,32 @@
+package handlers
+
+import (
+	"net/http"
+	"testing"
+
+	"netcontrol-containers/models"
+	"netcontrol-containers/services"
+)
+
+func TestWireGuardConnect(t *testing.T) {
+	r := newPanelRouter()
+	operator := signIn(t, models.RoleOperator, nil)
+	viewer := signIn(t, models.RoleViewer, nil)
+	restricted := signIn(t, models.RoleAdmin, func(u *models.User) { u.Namespaces = "shop" })
+
+	call(t, r, viewer, "POST", "/api/wireguard/connect", "", http.StatusForbidden)
+	call(t, r, operator, "POST", "/api/wireguard/connect", "", http.StatusOK)
+	status := decode[services.WireGuardStatus](t, call(t, r, viewer, "GET", "/api/wireguard/status", "", http.StatusOK))
+	if !status.IsActive || status.IP != "10.8.0.2/24" {
+		t.Fatalf("status after connect = %+v", status)
+	}
+
+	call(t, r, operator, "POST", "/api/wireguard/disconnect", "", http.StatusOK)
+	if status := decode[services.WireGuardStatus](t, call(t, r, viewer, "GET", "/api/wireguard/status", "", http.StatusOK)); status.IsActive {
+		t.Fatalf("status after disconnect = %+v", status)
+	}
+
+	// The config holds the private key of the host
+	call(t, r, operator, "GET", "/api/wireguard/config", "", http.StatusForbidden)
+	call(t, r, restricted, "GET", "/api/wireguard/config", "", http.StatusForbidden)
+}
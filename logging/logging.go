@@ -0,0 +1,152 @@
+// Package logging configures the process-wide log/slog logger: text or
+// JSON output on stderr, a level that can change at runtime, request IDs
+// taken from the context, and a copy to the system log when running as a
+// service.
+package logging
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/kardianos/service"
+)
+
+// Output formats.
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+)
+
+type requestIDKey struct{}
+
+var (
+	level = new(slog.LevelVar)
+
+	mu        sync.Mutex
+	svcLogger service.Logger
+	logFormat = FormatText
+)
+
+// Setup installs the default logger. It can be called again, e.g. after a
+// config reload, to change the level or format.
+func Setup(levelName, format string) {
+	level.Set(ParseLevel(levelName))
+
+	mu.Lock()
+	defer mu.Unlock()
+	logFormat = format
+	install()
+}
+
+// SetServiceLogger also sends records to the system log (journal, syslog,
+// Windows event log) when running as a service rather than interactively.
+func SetServiceLogger(l service.Logger) {
+	mu.Lock()
+	defer mu.Unlock()
+	if service.Interactive() {
+		l = nil
+	}
+	svcLogger = l
+	install()
+}
+
+func install() {
+	opts := &slog.HandlerOptions{Level: level}
+	var h slog.Handler
+	if logFormat == FormatJSON {
+		h = slog.NewJSONHandler(os.Stderr, opts)
+	} else {
+		h = slog.NewTextHandler(os.Stderr, opts)
+	}
+	if svcLogger != nil {
+		h = &serviceHandler{Handler: h, svc: svcLogger}
+	}
+	slog.SetDefault(slog.New(&contextHandler{h}))
+}
+
+// ParseLevel converts debug, info, warn or error to a slog level. Unknown
+// names mean info.
+func ParseLevel(name string) slog.Level {
+	switch strings.ToLower(name) {
+	case "debug":
+		return slog.LevelDebug
+	case "warn", "warning":
+		return slog.LevelWarn
+	case "error":
+		return slog.LevelError
+	}
+	return slog.LevelInfo
+}
+
+// WithRequestID returns a context whose log records carry id.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, requestIDKey{}, id)
+}
+
+// RequestID returns the request ID stored in ctx, if any.
+func RequestID(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
+
+// contextHandler adds the request ID of the context to every record.
+type contextHandler struct {
+	slog.Handler
+}
+
+func (h *contextHandler) Handle(ctx context.Context, r slog.Record) error {
+	if id := RequestID(ctx); id != "" {
+		r.AddAttrs(slog.String("request_id", id))
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h *contextHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &contextHandler{h.Handler.WithAttrs(attrs)}
+}
+
+func (h *contextHandler) WithGroup(name string) slog.Handler {
+	return &contextHandler{h.Handler.WithGroup(name)}
+}
+
+// serviceHandler copies info and higher records to the service logger.
+type serviceHandler struct {
+	slog.Handler
+	svc   service.Logger
+	attrs []slog.Attr
+}
+
+func (h *serviceHandler) Handle(ctx context.Context, r slog.Record) error {
+	if r.Level >= slog.LevelInfo {
+		var b strings.Builder
+		b.WriteString(r.Message)
+		for _, a := range h.attrs {
+			fmt.Fprintf(&b, " %s=%v", a.Key, a.Value)
+		}
+		r.Attrs(func(a slog.Attr) bool {
+			fmt.Fprintf(&b, " %s=%v", a.Key, a.Value)
+			return true
+		})
+		switch {
+		case r.Level >= slog.LevelError:
+			h.svc.Error(b.String())
+		case r.Level >= slog.LevelWarn:
+			h.svc.Warning(b.String())
+		default:
+			h.svc.Info(b.String())
+		}
+	}
+	return h.Handler.Handle(ctx, r)
+}
+
+func (h *serviceHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &serviceHandler{Handler: h.Handler.WithAttrs(attrs), svc: h.svc, attrs: append(append([]slog.Attr{}, h.attrs...), attrs...)}
+}
+
+func (h *serviceHandler) WithGroup(name string) slog.Handler {
+	return &serviceHandler{Handler: h.Handler.WithGroup(name), svc: h.svc, attrs: h.attrs}
+}
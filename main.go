@@ -5,16 +5,24 @@ import (
 	"flag"
 	"fmt"
 	"html/template"
-	"log"
+	"io/fs"
+	"log/slog"
+	"net"
 	"net/http"
 	"os"
-	"path/filepath"
+	"os/signal"
+	"strconv"
+	"strings"
+	"syscall"
 	"time"
 
 	"netcontrol-containers/config"
 	"netcontrol-containers/database"
 	"netcontrol-containers/handlers"
+	"netcontrol-containers/logging"
 	"netcontrol-containers/middleware"
+	"netcontrol-containers/models"
+	"netcontrol-containers/services"
 
 	"github.com/gin-gonic/gin"
 	"github.com/kardianos/service"
@@ -23,7 +31,8 @@ import (
 var logger service.Logger
 
 type program struct {
-	srv *http.Server
+	srv         *http.Server
+	redirectSrv *http.Server
 }
 
 func (p *program) Start(s service.Service) error {
@@ -33,23 +42,31 @@ func (p *program) Start(s service.Service) error {
 }
 
 func (p *program) run() {
-	// Ensure we are in the executable directory so relative paths work
-	exePath, err := os.Executable()
-	if err == nil {
-		exeDir := filepath.Dir(exePath)
-		os.Chdir(exeDir)
-	}
-
-	// Initialize config
-	config.Init()
+	// Config was loaded and validated in main
 	cfg := config.Get()
+	watchConfig()
+
+	if cfg.Demo {
+		services.EnableDemo()
+		slog.Warn("Demo mode: Docker, Kubernetes, WireGuard, the installer and host stats are simulated; the file manager and terminal still act on this host")
+	}
 
 	// Initialize database
 	if err := database.Init(); err != nil {
-		if logger != nil {
-			logger.Error(fmt.Sprintf("Failed to initialize database: %v", err))
-		}
-		log.Fatalf("Failed to initialize database: %v", err)
+		fatal("Failed to initialize database", "error", err)
+	}
+
+	// Start the audit writer
+	services.GetAuditLogger()
+
+	// Load the JWT signing keys and rotate them on schedule
+	if err := services.GetJWTKeyManager().Load(); err != nil {
+		fatal("Failed to load JWT signing keys", "error", err)
+	}
+	services.GetJWTKeyManager().Start()
+
+	if services.SetupRequired() {
+		slog.Info("First-run setup required: open the setup page and enter the setup code", "path", cfg.BasePath+"/setup", "setup_code", services.SetupToken())
 	}
 
 	// Setup Gin
@@ -57,217 +74,272 @@ func (p *program) run() {
 		gin.SetMode(gin.ReleaseMode)
 	}
 
-	r := gin.Default()
+	r := gin.New()
+	r.Use(middleware.RequestID(), middleware.Logger(), middleware.Metrics(), gin.CustomRecovery(func(c *gin.Context, err any) {
+		slog.ErrorContext(c.Request.Context(), "Panic while handling request", "path", c.Request.URL.Path, "error", err)
+		c.AbortWithStatus(http.StatusInternalServerError)
+	}))
+	// Only these proxies may set the client address and scheme
+	if err := r.SetTrustedProxies(cfg.TrustedProxies); err != nil {
+		fatal("Invalid trusted proxies", "error", err)
+	}
+	r.Use(middleware.RequireSetup())
 
-	// Load templates
-	r.SetFuncMap(template.FuncMap{
+	// Load templates, built in unless overridden from assets_dir
+	assets := assetsFS(cfg.AssetsDir)
+	if cfg.AssetsDir != "" {
+		slog.Info("Serving templates and static files from the assets directory where present", "dir", cfg.AssetsDir)
+	}
+	tmpl, err := template.New("").Funcs(template.FuncMap{
 		"formatBytes": formatBytes,
-	})
-	// Check if running in dev mode (relative path) or installed mode (absolute path might be needed, but for now assume CWD)
-	// Ideally we find where the executable is.
-	r.LoadHTMLGlob("templates/*")
-
-	// Serve static files
-	r.Static("/static", "./static")
-
-	// Public routes
-	r.GET("/login", func(c *gin.Context) {
-		// Check if already logged in AND valid
-		if tokenString, err := c.Cookie("token"); err == nil {
-			// Validate token
-			token, err := middleware.ValidateToken(tokenString)
-			if err == nil && token.Valid {
-				c.Redirect(http.StatusFound, "/")
-				return
-			}
-		}
-		c.HTML(http.StatusOK, "login.html", nil)
-	})
-	r.POST("/api/login", handlers.Login)
-	r.POST("/api/logout", handlers.Logout)
-
-	// Protected page routes
-	pages := r.Group("/")
-	pages.Use(middleware.AuthPageMiddleware())
-	{
-		pages.GET("/", func(c *gin.Context) {
-			username, _ := c.Get("username")
-			c.HTML(http.StatusOK, "dashboard.html", gin.H{"Username": username})
-		})
-		pages.GET("/docker", func(c *gin.Context) {
-			username, _ := c.Get("username")
-			c.HTML(http.StatusOK, "docker.html", gin.H{"Username": username})
-		})
-		pages.GET("/kubernetes", func(c *gin.Context) {
-			username, _ := c.Get("username")
-			c.HTML(http.StatusOK, "kubernetes.html", gin.H{"Username": username})
-		})
+		"base":        config.BasePath,
+	}).ParseFS(assets, "templates/*.html")
+	if err != nil {
+		fatal("Failed to load templates", "error", err)
+	}
+	r.SetHTMLTemplate(tmpl)
 
-		pages.GET("/files", func(c *gin.Context) {
-			username, _ := c.Get("username")
-			c.HTML(http.StatusOK, "files.html", gin.H{"Username": username})
-		})
-		pages.GET("/terminal", func(c *gin.Context) {
-			username, _ := c.Get("username")
-			c.HTML(http.StatusOK, "terminal.html", gin.H{"Username": username})
-		})
-		pages.GET("/settings", func(c *gin.Context) {
-			username, _ := c.Get("username")
-			c.HTML(http.StatusOK, "settings.html", gin.H{"Username": username})
-		})
-		pages.GET("/wireguard", func(c *gin.Context) {
-			username, _ := c.Get("username")
-			c.HTML(http.StatusOK, "wireguard.html", gin.H{"Username": username})
-		})
+	// Every route lives below the base path, which is empty unless the
+	// panel is served under a sub-path by a reverse proxy
+	static, err := fs.Sub(assets, "static")
+	if err != nil {
+		fatal("Failed to load static files", "error", err)
 	}
+	handlers.RegisterRoutes(r.Group(cfg.BasePath), static)
 
-	// Protected API routes
-	api := r.Group("/api")
-	api.Use(middleware.AuthMiddleware())
-	{
-		// User
-		api.GET("/user", handlers.GetCurrentUser)
-		api.POST("/user/password", handlers.ChangePassword)
-
-		// Dashboard / System
-		api.GET("/system/info", handlers.GetSystemInfo)
-		api.GET("/system/stats", handlers.GetQuickStats)
-		api.GET("/system/cpu", handlers.GetCPUInfo)
-		api.GET("/system/memory", handlers.GetMemoryInfo)
-		api.GET("/system/disk", handlers.GetDiskInfo)
-
-		// Docker
-		api.GET("/docker/status", handlers.DockerStatus)
-		api.GET("/docker/system/usage", handlers.GetSystemUsage)
-		api.GET("/docker/system/ws", handlers.StreamDockerStats)
-		api.GET("/docker/containers", handlers.ListContainers)
-		api.GET("/docker/containers/:id/stats", handlers.GetContainerStats)
-		api.GET("/docker/containers/:id/logs", handlers.GetContainerLogs)
-		api.GET("/docker/containers/:id/inspect", handlers.InspectContainer)
-		api.POST("/docker/containers", handlers.CreateContainer)
-		api.POST("/docker/containers/:id/start", handlers.StartContainer)
-		api.POST("/docker/containers/:id/stop", handlers.StopContainer)
-		api.POST("/docker/containers/:id/restart", handlers.RestartContainer)
-		api.DELETE("/docker/containers/:id", handlers.RemoveContainer)
-		api.GET("/docker/images", handlers.ListImages)
-		api.POST("/docker/images/pull", handlers.PullImage)
-		api.DELETE("/docker/images/:id", handlers.RemoveImage)
-
-		// Kubernetes
-		api.GET("/kubernetes/status", handlers.KubernetesStatus)
-		api.GET("/kubernetes/overview", handlers.GetClusterOverview)
-		api.GET("/kubernetes/namespaces", handlers.ListNamespaces)
-		api.GET("/kubernetes/pods", handlers.ListPods)
-		api.GET("/kubernetes/pods/:name/logs", handlers.GetPodLogs)
-		api.DELETE("/kubernetes/pods/:name", handlers.DeletePod)
-		api.GET("/kubernetes/deployments", handlers.ListDeployments)
-		api.POST("/kubernetes/deployments/:name/scale", handlers.ScaleDeployment)
-		api.POST("/kubernetes/deployments/:name/restart", handlers.RestartDeployment)
-		api.GET("/kubernetes/services", handlers.ListK8sServices)
-
-		// Installer
-		api.GET("/installer/status", handlers.GetSoftwareStatus)
-		api.GET("/installer/progress", handlers.GetInstallStatus)
-		api.POST("/installer/unlock", handlers.ForceUnlock)
-		api.POST("/installer/docker", handlers.InstallDocker)
-		api.POST("/installer/kubernetes", handlers.InstallKubernetes)
-
-		api.POST("/installer/restart/:service", handlers.RestartSoftware)
-
-		// Files
-		api.GET("/files", handlers.ListFiles)
-		api.GET("/files/drives", handlers.GetDrives)
-		api.GET("/files/content", handlers.GetFileContent)
-		api.POST("/files/content", handlers.SaveFile)
-		api.POST("/files/create", handlers.CreateFile)
-		api.DELETE("/files", handlers.DeleteFile)
-		api.POST("/files/rename", handlers.RenameFile)
-		api.POST("/files/chmod", handlers.ChmodFile)
-		api.POST("/files/copy", handlers.CopyFile)
-		api.POST("/files/upload", handlers.UploadFile)
-		api.GET("/files/download", handlers.DownloadFile)
-
-		// Terminal
-		api.GET("/terminal/sessions", handlers.ListTerminalSessions)
-		api.POST("/terminal/:session/resize", handlers.TerminalResize)
-		api.DELETE("/terminal/:session", handlers.CloseTerminalSession)
-
-		// WireGuard
-		api.GET("/wireguard/status", handlers.GetWireGuardStatus)
-		api.GET("/wireguard/config", handlers.GetWireGuardConfig)
-		api.POST("/wireguard/config", handlers.SaveWireGuardConfig)
-		api.POST("/wireguard/connect", handlers.ConnectWireGuard)
-		api.POST("/wireguard/disconnect", handlers.DisconnectWireGuard)
-	}
-
-	// WebSocket routes
-	r.GET("/ws/terminal", handlers.TerminalWS)
-	r.GET("/ws/installer/docker", handlers.InstallDockerWS)
-	r.GET("/ws/installer/kubernetes", handlers.InstallKubernetesWS)
-	r.GET("/ws/installer/setup-k8s", handlers.SetupKubernetesWS)
-	r.GET("/ws/installer/docker/uninstall", handlers.UninstallDockerWS)
-	r.GET("/ws/installer/kubernetes/uninstall", handlers.UninstallKubernetesWS)
+	// Every API route must be described in the OpenAPI document; the
+	// handlers tests fail when one is missing or stale.
+	if undocumented, stale := handlers.BuildOpenAPI(r.Routes()); len(undocumented) > 0 || len(stale) > 0 {
+		slog.Error("OpenAPI document is out of date", "undocumented", undocumented, "stale", stale)
+	}
 
 	// Start server
-	addr := fmt.Sprintf(":%d", cfg.Port)
-	log.Printf("🚀 NetControl Containers starting on http://localhost%s", addr)
+	addr := cfg.Addr()
+	host := models.GetSetting(database.Get(), models.SettingPanelHostname)
+	if host == "" {
+		host = "localhost"
+	}
+	scheme := "https"
+	if cfg.TLS.Disabled {
+		scheme = "http"
+	}
 
 	p.srv = &http.Server{
 		Addr:    addr,
 		Handler: r,
 	}
 
-	if err := p.srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-		if logger != nil {
-			logger.Error(fmt.Sprintf("Failed to start server: %v", err))
+	var ln net.Listener
+	if cfg.Socket != "" {
+		addr = cfg.Socket
+		if ln, err = listenUnix(cfg.Socket); err != nil {
+			fatal("Failed to listen", "addr", cfg.Socket, "error", err)
 		}
-		log.Fatalf("Failed to start server: %v", err)
+		// Requests over the socket come from the local proxy
+		p.srv.Handler = http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			req.RemoteAddr = "127.0.0.1:0"
+			r.ServeHTTP(w, req)
+		})
+	} else if ln, err = net.Listen("tcp", addr); err != nil {
+		fatal("Failed to listen", "addr", addr, "error", err)
+	}
+
+	if cfg.TLS.Disabled {
+		slog.Info("🚀 NetControl Containers starting", "url", fmt.Sprintf("%s://%s:%d%s", scheme, host, cfg.Port, cfg.BasePath), "listen", addr)
+		err = p.srv.Serve(ln)
+	} else {
+		// The certificate is reloaded from disk when it changes
+		if err := services.GetCertReloader().Load(); err != nil {
+			fatal("Failed to load TLS certificate", "error", err)
+		}
+		certFile, _ := services.GetCertReloader().Files()
+		slog.Info("Serving HTTPS", "cert", certFile, "min_version", cfg.TLS.MinVersion)
+		if cfg.TLS.RedirectPort != 0 {
+			p.startRedirect(cfg)
+		}
+
+		slog.Info("🚀 NetControl Containers starting", "url", fmt.Sprintf("%s://%s:%d%s", scheme, host, cfg.Port, cfg.BasePath), "listen", addr)
+		p.srv.TLSConfig = services.ServerTLSConfig()
+		err = p.srv.ServeTLS(ln, "", "")
+	}
+	if err != nil && err != http.ErrServerClosed {
+		fatal("Failed to start server", "error", err)
 	}
 }
 
+// startRedirect serves plain HTTP on the redirect port, sending every
+// request to the same path over HTTPS.
+func (p *program) startRedirect(cfg *config.Config) {
+	port := strconv.Itoa(cfg.Port)
+	p.redirectSrv = &http.Server{
+		Addr: net.JoinHostPort(cfg.Host, strconv.Itoa(cfg.TLS.RedirectPort)),
+		Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			host := r.Host
+			if h, _, err := net.SplitHostPort(host); err == nil {
+				host = h
+			}
+			target := "https://" + net.JoinHostPort(host, port) + r.URL.RequestURI()
+			http.Redirect(w, r, target, http.StatusMovedPermanently)
+		}),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	go func() {
+		slog.Info("Redirecting HTTP to HTTPS", "listen", p.redirectSrv.Addr)
+		if err := p.redirectSrv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			slog.Error("HTTP redirect listener failed", "error", err)
+		}
+	}()
+}
+
+// listenUnix listens on a unix socket, replacing a stale socket left by a
+// previous run. The socket is only accessible to the owner and group so the
+// proxy can be granted access through its group.
+func listenUnix(path string) (net.Listener, error) {
+	if info, err := os.Stat(path); err == nil && info.Mode()&os.ModeSocket != 0 {
+		os.Remove(path)
+	}
+	ln, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(path, 0660); err != nil {
+		ln.Close()
+		return nil, err
+	}
+	return ln, nil
+}
+
+// Stop shuts down gracefully within the configured timeout: new requests
+// and sessions are refused, WebSocket clients are told the server is going
+// away, terminals are hung up, installer jobs finish or are cancelled as
+// configured, and the audit log is flushed before the database is closed.
 func (p *program) Stop(s service.Service) error {
-	// Stop should not block. Return with a few seconds.
-	if p.srv != nil {
-		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
-		defer cancel()
-		if err := p.srv.Shutdown(ctx); err != nil {
-			log.Printf("Server forced to shutdown: %v", err)
+	cfg := config.Get()
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.Shutdown.Timeout)
+	defer cancel()
+	slog.Info("Shutting down", "timeout", cfg.Shutdown.Timeout)
+
+	shutdown := services.GetShutdownManager()
+	shutdown.Begin()
+
+	if p.redirectSrv != nil {
+		p.redirectSrv.Close()
+	}
+	// Shutdown waits for plain requests; hijacked WebSockets are drained below
+	httpDone := make(chan struct{})
+	go func() {
+		defer close(httpDone)
+		if p.srv != nil {
+			if err := p.srv.Shutdown(ctx); err != nil {
+				slog.Warn("Server forced to shutdown", "error", err)
+			}
 		}
+	}()
+
+	services.GetPTYManager().CloseAll(2 * time.Second)
+
+	installer := services.GetInstallerService()
+	if cfg.Shutdown.Installer == config.ShutdownInstallerCancel {
+		installer.Cancel()
+	} else if installer.GetStatus().IsInstalling {
+		slog.Info("Waiting for the running installer job to finish")
+	}
+	if !installer.WaitIdle(ctx) {
+		slog.Warn("Installer job did not finish in time, cancelling it")
+		installer.Cancel()
+	}
+
+	if !shutdown.Wait(ctx) {
+		slog.Warn("Some connections did not close in time")
+	}
+	<-httpDone
+	if p.srv != nil {
+		p.srv.Close()
+	}
+
+	services.GetJWTKeyManager().Stop()
+	services.GetAuditLogger().Flush()
+	if err := database.Close(); err != nil {
+		slog.Error("Failed to close the database", "error", err)
 	}
+	slog.Info("Shutdown complete")
 	return nil
 }
 
+// watchConfig reloads the config file on SIGHUP and applies the settings
+// that can change at runtime.
+func watchConfig() {
+	config.OnReload(func(old, new *config.Config) {
+		logging.Setup(new.LogLevel, new.LogFormat)
+		database.SetDebug(new.DebugMode)
+		if old.DockerHost != new.DockerHost {
+			services.ResetDockerService()
+		}
+		if old.Kubeconfig != new.Kubeconfig {
+			services.ResetKubernetesService()
+		}
+	})
+
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for range hup {
+			pending, err := config.Reload()
+			if err != nil {
+				slog.Error("Config reload failed, keeping the current config", "error", err)
+				continue
+			}
+			slog.Info("Config reloaded")
+			if len(pending) > 0 {
+				slog.Warn("Restart to apply config changes", "settings", strings.Join(pending, ", "))
+			}
+		}
+	}()
+}
+
 func main() {
+	// Define flags
+	install := flag.Bool("install", false, "Install service")
+	uninstall := flag.Bool("uninstall", false, "Uninstall service")
+	start := flag.Bool("start", false, "Start service")
+	stop := flag.Bool("stop", false, "Stop service")
+	restart := flag.Bool("restart", false, "Restart service")
+	config.RegisterFlags(flag.CommandLine)
+
+	flag.Usage = func() {
+		cliUsage(flag.CommandLine.Output())
+		fmt.Fprintln(flag.CommandLine.Output(), "\nFlags:")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	// Administrative commands run instead of the panel
+	if flag.NArg() > 0 && isCLICommand(flag.Arg(0)) {
+		os.Exit(runCLI(flag.Args()))
+	}
+
 	svcConfig := &service.Config{
 		Name:        "NetControlContainers",
 		DisplayName: "NetControl Containers Service",
 		Description: "Container Management VPS Panel",
-		Arguments:   []string{},
+		Arguments:   config.ServiceArguments(),
 	}
 
 	prg := &program{}
 	s, err := service.New(prg, svcConfig)
 	if err != nil {
-		log.Fatal(err)
+		fatal("Service command failed", "error", err)
 	}
 
 	logger, err = s.Logger(nil)
 	if err != nil {
-		log.Fatal(err)
+		fatal("Service command failed", "error", err)
 	}
 
-	// Define flags
-	install := flag.Bool("install", false, "Install service")
-	uninstall := flag.Bool("uninstall", false, "Uninstall service")
-	start := flag.Bool("start", false, "Start service")
-	stop := flag.Bool("stop", false, "Stop service")
-	restart := flag.Bool("restart", false, "Restart service")
-
-	flag.Parse()
-
 	// Handle simple legacy commands or explicit service commands
-	if len(os.Args) > 1 {
-		verb := os.Args[1]
+	if flag.NArg() > 0 {
+		verb := flag.Arg(0)
 		switch verb {
 		case "install":
 			err = s.Install()
@@ -316,7 +388,7 @@ func main() {
 	if *install {
 		err = s.Install()
 		if err != nil {
-			log.Fatal(err)
+			fatal("Service command failed", "error", err)
 		}
 		fmt.Println("Service installed.")
 		return
@@ -325,7 +397,7 @@ func main() {
 	if *uninstall {
 		err = s.Uninstall()
 		if err != nil {
-			log.Fatal(err)
+			fatal("Service command failed", "error", err)
 		}
 		fmt.Println("Service uninstalled.")
 		return
@@ -334,7 +406,7 @@ func main() {
 	if *start {
 		err = s.Start()
 		if err != nil {
-			log.Fatal(err)
+			fatal("Service command failed", "error", err)
 		}
 		fmt.Println("Service started.")
 		return
@@ -343,7 +415,7 @@ func main() {
 	if *stop {
 		err = s.Stop()
 		if err != nil {
-			log.Fatal(err)
+			fatal("Service command failed", "error", err)
 		}
 		fmt.Println("Service stopped.")
 		return
@@ -352,19 +424,36 @@ func main() {
 	if *restart {
 		err = s.Restart()
 		if err != nil {
-			log.Fatal(err)
+			fatal("Service command failed", "error", err)
 		}
 		fmt.Println("Service restarted.")
 		return
 	}
 
+	// Report every config problem before starting
+	if err := config.Init(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		if logger != nil {
+			logger.Error(err.Error())
+		}
+		os.Exit(1)
+	}
+	logging.Setup(config.Get().LogLevel, config.Get().LogFormat)
+	logging.SetServiceLogger(logger)
+
 	// Default: Run the service (foreground or background)
 	err = s.Run()
 	if err != nil {
-		logger.Error(err.Error())
+		slog.Error("Service failed", "error", err)
 	}
 }
 
+// fatal logs an error that prevents the panel from running and exits.
+func fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(1)
+}
+
 func formatBytes(bytes uint64) string {
 	const unit = 1024
 	if bytes < unit {
@@ -0,0 +1,176 @@
+package middleware
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"netcontrol-containers/models"
+	"netcontrol-containers/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	auditMaxBody     = 64 * 1024
+	auditMaxResponse = 4 * 1024
+)
+
+// Request fields that are never written to the audit log.
+var auditRedactedFields = map[string]bool{
+	"password":      true,
+	"old_password":  true,
+	"new_password":  true,
+	"code":          true,
+	"secret":        true,
+	"client_secret": true,
+	"bind_password": true,
+	"token":         true,
+	"setup_token":   true,
+	"content":       true,
+	"config":        true,
+}
+
+// auditWriter keeps the beginning of the response so the error message of
+// a failed action can be stored with the entry.
+type auditWriter struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *auditWriter) Write(b []byte) (int, error) {
+	if room := auditMaxResponse - w.body.Len(); room > 0 {
+		if len(b) > room {
+			w.body.Write(b[:room])
+		} else {
+			w.body.Write(b)
+		}
+	}
+	return w.ResponseWriter.Write(b)
+}
+
+// Audit records every mutating request that reaches it. It must run after
+// AuthMiddleware so the acting user is known.
+func Audit() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.Request.Method == http.MethodGet || c.Request.Method == http.MethodHead || c.Request.Method == http.MethodOptions {
+			c.Next()
+			return
+		}
+
+		start := time.Now()
+		params := auditParams(c)
+
+		writer := &auditWriter{ResponseWriter: c.Writer}
+		c.Writer = writer
+
+		c.Next()
+
+		entry := NewAuditEntry(c, c.Request.Method+" "+c.FullPath(), auditTarget(c))
+		entry.Params = params
+		entry.Status = c.Writer.Status()
+		entry.Success = entry.Status < http.StatusBadRequest
+		entry.DurationMs = time.Since(start).Milliseconds()
+		if !entry.Success {
+			var resp struct {
+				Error string `json:"error"`
+			}
+			if json.Unmarshal(writer.body.Bytes(), &resp) == nil {
+				entry.Error = resp.Error
+			}
+		}
+
+		services.GetAuditLogger().Record(entry)
+	}
+}
+
+// NewAuditEntry starts an entry for the current user and client. Handlers
+// that act outside the Audit middleware, such as WebSocket endpoints, use it
+// to record their own entries.
+func NewAuditEntry(c *gin.Context, action, target string) *models.AuditLog {
+	return &models.AuditLog{
+		UserID:    c.GetUint("user_id"),
+		Username:  c.GetString("username"),
+		IP:        c.ClientIP(),
+		Action:    action,
+		Target:    target,
+		RequestID: c.GetString(RequestIDKey),
+	}
+}
+
+// auditTarget describes what the request acted on from its route
+// parameters and the query parameters handlers use to address objects.
+func auditTarget(c *gin.Context) string {
+	var parts []string
+	for _, p := range c.Params {
+		parts = append(parts, p.Key+"="+p.Value)
+	}
+	for _, key := range []string{"path", "namespace"} {
+		if v := c.Query(key); v != "" {
+			parts = append(parts, key+"="+v)
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+// auditParams captures the request body, with sensitive fields redacted,
+// and restores it for the handler.
+func auditParams(c *gin.Context) string {
+	if c.Request.Body == nil {
+		return ""
+	}
+
+	contentType := c.ContentType()
+	if contentType == "multipart/form-data" {
+		// Uploads: record the form fields, not the file content
+		if err := c.Request.ParseMultipartForm(32 << 20); err != nil {
+			return ""
+		}
+		fields := map[string]interface{}{}
+		for k, v := range c.Request.MultipartForm.Value {
+			fields[k] = strings.Join(v, ",")
+		}
+		for k, files := range c.Request.MultipartForm.File {
+			var names []string
+			for _, f := range files {
+				names = append(names, f.Filename)
+			}
+			fields[k] = strings.Join(names, ",")
+		}
+		data, _ := json.Marshal(fields)
+		return string(data)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(c.Request.Body, auditMaxBody+1))
+	if err != nil {
+		return ""
+	}
+	c.Request.Body = io.NopCloser(io.MultiReader(bytes.NewReader(body), c.Request.Body))
+
+	if len(body) == 0 {
+		return ""
+	}
+	if len(body) > auditMaxBody {
+		return "(body too large)"
+	}
+
+	var fields map[string]interface{}
+	if err := json.Unmarshal(body, &fields); err != nil {
+		return "(non-JSON body)"
+	}
+	return redactParams(fields)
+}
+
+func redactParams(fields map[string]interface{}) string {
+	for k := range fields {
+		// Settings keys such as oidc.client_secret are matched on their last part
+		if auditRedactedFields[k[strings.LastIndex(k, ".")+1:]] {
+			fields[k] = "[redacted]"
+		}
+	}
+	data, _ := json.Marshal(fields)
+	return string(data)
+}
@@ -1,10 +1,14 @@
 package middleware
 
 import (
+	"errors"
 	"net/http"
 	"strings"
+	"time"
 
-	"netcontrol-containers/config"
+	"netcontrol-containers/database"
+	"netcontrol-containers/models"
+	"netcontrol-containers/services"
 
 	"github.com/gin-gonic/gin"
 	"github.com/golang-jwt/jwt/v5"
@@ -16,20 +20,131 @@ type Claims struct {
 	jwt.RegisteredClaims
 }
 
+// ValidateToken parses a session JWT and checks that its server-side
+// session, identified by the jti claim, has not been revoked or expired.
 func ValidateToken(tokenString string) (*jwt.Token, error) {
+	token, claims, err := parseToken(tokenString)
+	if err != nil {
+		return token, err
+	}
+
+	if _, err := activeSession(claims); err != nil {
+		return token, err
+	}
+	return token, nil
+}
+
+func parseToken(tokenString string) (*jwt.Token, *Claims, error) {
 	claims := &Claims{}
-	return jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
-		return []byte(config.Get().JWTSecret), nil
-	})
+	keys := services.GetJWTKeyManager()
+	token, err := jwt.ParseWithClaims(tokenString, claims, keys.KeyFunc, jwt.WithValidMethods(keys.ValidMethods()))
+	return token, claims, err
+}
+
+func activeSession(claims *Claims) (*models.Session, error) {
+	if claims.ID == "" {
+		return nil, errors.New("token has no session")
+	}
+
+	var session models.Session
+	if err := database.Get().First(&session, "id = ?", claims.ID).Error; err != nil {
+		return nil, errors.New("session not found")
+	}
+	if !session.Active() || session.UserID != claims.UserID {
+		return nil, errors.New("session revoked")
+	}
+	return &session, nil
+}
+
+// authenticate validates a JWT and loads the user it was issued for, so that
+// deleted users and role changes take effect without waiting for expiry.
+func authenticate(tokenString, clientIP string) (*models.User, *models.Session, error) {
+	token, claims, err := parseToken(tokenString)
+	if err != nil || !token.Valid {
+		return nil, nil, errors.New("invalid token")
+	}
+
+	session, err := activeSession(claims)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var user models.User
+	if err := database.Get().First(&user, claims.UserID).Error; err != nil {
+		return nil, nil, errors.New("user not found")
+	}
+
+	// Only touch the row once a minute to keep writes down under polling
+	now := time.Now()
+	if now.Sub(session.LastSeenAt) > time.Minute || session.IP != clientIP {
+		database.Get().Model(session).Updates(map[string]interface{}{
+			"last_seen_at": now,
+			"ip":           clientIP,
+		})
+	}
+
+	return &user, session, nil
+}
+
+// authenticateAPIToken resolves a personal API token to its owner and
+// records when and from where it was used.
+func authenticateAPIToken(tokenString, clientIP string) (*models.User, *models.APIToken, error) {
+	var apiToken models.APIToken
+	if err := database.Get().Where("token_hash = ?", models.HashAPIToken(tokenString)).First(&apiToken).Error; err != nil {
+		return nil, nil, errors.New("invalid token")
+	}
+	if apiToken.Expired() {
+		return nil, nil, errors.New("token expired")
+	}
+
+	var user models.User
+	if err := database.Get().First(&user, apiToken.UserID).Error; err != nil {
+		return nil, nil, errors.New("user not found")
+	}
+
+	// Only touch the row once a minute to keep writes down under polling
+	now := time.Now()
+	if apiToken.LastUsedAt == nil || now.Sub(*apiToken.LastUsedAt) > time.Minute || apiToken.LastUsedIP != clientIP {
+		database.Get().Model(&apiToken).Updates(map[string]interface{}{
+			"last_used_at": now,
+			"last_used_ip": clientIP,
+		})
+	}
+
+	return &user, &apiToken, nil
+}
+
+func setUser(c *gin.Context, user *models.User) {
+	c.Set("user_id", user.ID)
+	c.Set("username", user.Username)
+	c.Set("role", user.Role)
+	c.Set("resource_scope", user.ResourceScope())
 }
 
 func AuthMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
+		// API tokens are only accepted from the Authorization header
+		authHeader := c.GetHeader("Authorization")
+		if bearer := strings.TrimPrefix(authHeader, "Bearer "); strings.HasPrefix(bearer, models.APITokenPrefix) {
+			user, apiToken, err := authenticateAPIToken(bearer, c.ClientIP())
+			if err != nil {
+				c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
+				c.Abort()
+				return
+			}
+
+			setUser(c, user)
+			c.Set("token_id", apiToken.ID)
+			c.Set("scopes", apiToken.ScopeList())
+			c.Next()
+			return
+		}
+
 		// Check cookie first
 		tokenString, err := c.Cookie("token")
+		fromCookie := err == nil
 		if err != nil {
 			// Check Authorization header
-			authHeader := c.GetHeader("Authorization")
 			if authHeader == "" {
 				c.JSON(http.StatusUnauthorized, gin.H{"error": "Authorization required"})
 				c.Abort()
@@ -38,20 +153,21 @@ func AuthMiddleware() gin.HandlerFunc {
 			tokenString = strings.TrimPrefix(authHeader, "Bearer ")
 		}
 
-		// Parse token
-		token, err := ValidateToken(tokenString)
-
-		if err != nil || !token.Valid {
+		user, session, err := authenticate(tokenString, c.ClientIP())
+		if err != nil {
 			c.JSON(http.StatusUnauthorized, gin.H{"error": "Invalid token"})
 			c.Abort()
 			return
 		}
 
-		claims, _ := token.Claims.(*Claims)
-
 		// Set user info in context
-		c.Set("user_id", claims.UserID)
-		c.Set("username", claims.Username)
+		setUser(c, user)
+		c.Set("session_id", session.ID)
+		if fromCookie {
+			ensureCSRFToken(c, session)
+			c.Set("cookie_auth", true)
+			c.Set("csrf_token", session.CSRFToken)
+		}
 		c.Next()
 	}
 }
@@ -60,24 +176,94 @@ func AuthPageMiddleware() gin.HandlerFunc {
 	return func(c *gin.Context) {
 		tokenString, err := c.Cookie("token")
 		if err != nil {
-			c.Redirect(http.StatusFound, "/login")
+			c.Redirect(http.StatusFound, URL("/login"))
 			c.Abort()
 			return
 		}
 
-		claims := &Claims{}
-		token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
-			return []byte(config.Get().JWTSecret), nil
-		})
+		user, session, err := authenticate(tokenString, c.ClientIP())
+		if err != nil {
+			c.Redirect(http.StatusFound, URL("/login"))
+			c.Abort()
+			return
+		}
+
+		setUser(c, user)
+		c.Set("session_id", session.ID)
+		ensureCSRFToken(c, session)
+		c.Next()
+	}
+}
+
+// RequireRole rejects requests from users whose role ranks below role.
+// It must run after AuthMiddleware.
+func RequireRole(role string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !models.RoleAtLeast(c.GetString("role"), role) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Insufficient permissions"})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// RequirePageRole is the page equivalent of RequireRole.
+func RequirePageRole(role string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if !models.RoleAtLeast(c.GetString("role"), role) {
+			c.Redirect(http.StatusFound, URL("/"))
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// RequireScope rejects API token requests whose token lacks scope. Session
+// requests are governed by role alone and always pass.
+func RequireScope(scope string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		value, isToken := c.Get("scopes")
+		if !isToken {
+			c.Next()
+			return
+		}
+
+		for _, s := range value.([]string) {
+			if s == scope {
+				c.Next()
+				return
+			}
+		}
 
-		if err != nil || !token.Valid {
-			c.Redirect(http.StatusFound, "/login")
+		c.JSON(http.StatusForbidden, gin.H{"error": "Token is missing scope " + scope})
+		c.Abort()
+	}
+}
+
+// RequireSession rejects API token requests. It guards account management,
+// so a leaked token cannot mint new tokens or change credentials.
+func RequireSession() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if _, isToken := c.Get("scopes"); isToken {
+			c.JSON(http.StatusForbidden, gin.H{"error": "This endpoint requires an interactive session"})
 			c.Abort()
 			return
 		}
+		c.Next()
+	}
+}
 
-		c.Set("user_id", claims.UserID)
-		c.Set("username", claims.Username)
+// RequireUnrestricted rejects users with a resource scope. It guards
+// host-level features, such as the terminal, that would bypass the scope.
+func RequireUnrestricted() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if scope, ok := c.Get("resource_scope"); ok && scope.(*models.ResourceScope).Restricted() {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Not available to accounts restricted to specific resources"})
+			c.Abort()
+			return
+		}
 		c.Next()
 	}
 }
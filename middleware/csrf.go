@@ -0,0 +1,85 @@
+package middleware
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"net/http"
+	"time"
+
+	"netcontrol-containers/database"
+	"netcontrol-containers/models"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// CSRFCookie carries the session's CSRF token to the browser. It is
+	// readable by scripts so they can echo it in CSRFHeader.
+	CSRFCookie = "csrf_token"
+	CSRFHeader = "X-CSRF-Token"
+)
+
+// CSRF rejects mutating requests authenticated by the session cookie unless
+// they carry the session's CSRF token in the X-CSRF-Token header. Requests
+// with a bearer token are not sent automatically by browsers and are exempt.
+// It must run after AuthMiddleware.
+func CSRF() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		switch c.Request.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			c.Next()
+			return
+		}
+		if !c.GetBool("cookie_auth") {
+			c.Next()
+			return
+		}
+
+		if !ValidCSRFToken(c.GetHeader(CSRFHeader), c.GetString("csrf_token")) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Missing or invalid CSRF token, reload the page"})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// ValidCSRFToken compares a submitted token with the session's.
+func ValidCSRFToken(submitted, expected string) bool {
+	return expected != "" && subtle.ConstantTimeCompare([]byte(submitted), []byte(expected)) == 1
+}
+
+// NewCSRFToken returns a random token for a new session.
+func NewCSRFToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// ensureCSRFToken gives sessions created before CSRF protection a token and
+// makes sure the browser holds the session's token in its cookie.
+func ensureCSRFToken(c *gin.Context, session *models.Session) {
+	if session.CSRFToken == "" {
+		token, err := NewCSRFToken()
+		if err != nil {
+			return
+		}
+		if err := database.Get().Model(session).Update("csrf_token", token).Error; err != nil {
+			return
+		}
+		session.CSRFToken = token
+	}
+	if cookie, err := c.Cookie(CSRFCookie); err != nil || cookie != session.CSRFToken {
+		SetCookie(c, CSRFCookie, session.CSRFToken, int(time.Until(session.ExpiresAt).Seconds()), false)
+	}
+}
+
+// SetCookie sets a cookie for the whole panel with SameSite=Lax, marked
+// Secure when the request came in over HTTPS. A negative maxAge deletes it.
+func SetCookie(c *gin.Context, name, value string, maxAge int, httpOnly bool) {
+	c.SetSameSite(http.SameSiteLaxMode)
+	c.SetCookie(name, value, maxAge, URL("/"), "", IsSecureRequest(c), httpOnly)
+}
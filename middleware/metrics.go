@@ -0,0 +1,30 @@
+package middleware
+
+import (
+	"time"
+
+	"netcontrol-containers/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Metrics records the latency and status of every request for /metrics.
+// WebSocket connections are left out since their duration is the length
+// of the session.
+func Metrics() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if c.IsWebsocket() {
+			c.Next()
+			return
+		}
+
+		start := time.Now()
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = "unmatched"
+		}
+		services.ObserveHTTPRequest(c.Request.Method, route, c.Writer.Status(), time.Since(start))
+	}
+}
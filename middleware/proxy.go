@@ -0,0 +1,28 @@
+package middleware
+
+import (
+	"net"
+
+	"netcontrol-containers/config"
+
+	"github.com/gin-gonic/gin"
+)
+
+// URL prefixes a root-relative path with the base path the panel is
+// served under.
+func URL(path string) string {
+	return config.BasePath() + path
+}
+
+// IsSecureRequest reports whether the client connected over HTTPS, either
+// directly or through a trusted proxy that sets X-Forwarded-Proto.
+func IsSecureRequest(c *gin.Context) bool {
+	if c.Request.TLS != nil {
+		return true
+	}
+	if c.GetHeader("X-Forwarded-Proto") != "https" {
+		return false
+	}
+	ip := net.ParseIP(c.RemoteIP())
+	return ip != nil && config.Get().IsTrustedProxy(ip)
+}
@@ -0,0 +1,47 @@
+package middleware
+
+import (
+	"bytes"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"netcontrol-containers/config"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestLoggerQuietsProbesUnderBasePath(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	t.Setenv("DATA_DIR", t.TempDir())
+	t.Setenv("BASE_PATH", "/panel")
+	if err := config.Init(); err != nil {
+		t.Fatal(err)
+	}
+
+	var out bytes.Buffer
+	previous := slog.Default()
+	slog.SetDefault(slog.New(slog.NewTextHandler(&out, &slog.HandlerOptions{Level: slog.LevelDebug})))
+	t.Cleanup(func() { slog.SetDefault(previous) })
+
+	r := gin.New()
+	base := r.Group(config.BasePath(), Logger())
+	for _, path := range []string{"/healthz", "/readyz", "/metrics", "/api/version"} {
+		base.GET(path, func(c *gin.Context) { c.Status(http.StatusOK) })
+	}
+
+	for path, level := range map[string]string{
+		"/panel/healthz":     "DEBUG",
+		"/panel/readyz":      "DEBUG",
+		"/panel/metrics":     "DEBUG",
+		"/panel/api/version": "INFO",
+	} {
+		out.Reset()
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", path, nil))
+		if !strings.Contains(out.String(), "level="+level+" ") {
+			t.Errorf("GET %s logged %q, want level %s", path, out.String(), level)
+		}
+	}
+}
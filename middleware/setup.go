@@ -0,0 +1,35 @@
+package middleware
+
+import (
+	"net/http"
+	"strings"
+
+	"netcontrol-containers/config"
+	"netcontrol-containers/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RequireSetup sends every request to the first-run setup until the
+// initial admin has been created. Pages are redirected, API and WebSocket
+// calls are refused.
+func RequireSetup() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		path := strings.TrimPrefix(c.Request.URL.Path, config.BasePath())
+		if path == "/setup" || strings.HasPrefix(path, "/api/setup") || strings.HasPrefix(path, "/static/") || path == "/healthz" || path == "/readyz" {
+			c.Next()
+			return
+		}
+		if !services.SetupRequired() {
+			c.Next()
+			return
+		}
+
+		if strings.HasPrefix(path, "/api/") || strings.HasPrefix(path, "/ws/") {
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Initial setup has not been completed", "setup_required": true})
+		} else {
+			c.Redirect(http.StatusFound, URL("/setup"))
+		}
+		c.Abort()
+	}
+}
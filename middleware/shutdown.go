@@ -0,0 +1,26 @@
+package middleware
+
+import (
+	"net/http"
+
+	"netcontrol-containers/services"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Drain registers long-lived requests such as WebSockets, event streams
+// and installer jobs with the shutdown manager so the server waits for
+// them, and refuses new ones once the shutdown has begun.
+func Drain() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		shutdown := services.GetShutdownManager()
+		if !shutdown.Acquire() {
+			c.Header("Connection", "close")
+			c.JSON(http.StatusServiceUnavailable, gin.H{"error": "Server is shutting down"})
+			c.Abort()
+			return
+		}
+		defer shutdown.Release()
+		c.Next()
+	}
+}
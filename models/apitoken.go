@@ -0,0 +1,103 @@
+package models
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+	"time"
+)
+
+// APITokenPrefix marks panel API tokens so they can be told apart from
+// session JWTs in an Authorization header.
+const APITokenPrefix = "nct_"
+
+// API token scopes. A token can never do more than its owner's role allows;
+// scopes only narrow that further.
+const (
+	ScopeSystemRead     = "system:read"
+	ScopeDockerRead     = "docker:read"
+	ScopeDockerWrite    = "docker:write"
+	ScopeK8sRead        = "k8s:read"
+	ScopeK8sWrite       = "k8s:write"
+	ScopeFilesRead      = "files:read"
+	ScopeFilesWrite     = "files:write"
+	ScopeInstallerWrite = "installer:write"
+	ScopeWireGuardRead  = "wireguard:read"
+	ScopeWireGuardWrite = "wireguard:write"
+	ScopeTerminal       = "terminal"
+	ScopeUsersWrite     = "users:write"
+	ScopeAuditRead      = "audit:read"
+	ScopeSettingsRead   = "settings:read"
+	ScopeSettingsWrite  = "settings:write"
+)
+
+var AllScopes = []string{
+	ScopeSystemRead,
+	ScopeDockerRead,
+	ScopeDockerWrite,
+	ScopeK8sRead,
+	ScopeK8sWrite,
+	ScopeFilesRead,
+	ScopeFilesWrite,
+	ScopeInstallerWrite,
+	ScopeWireGuardRead,
+	ScopeWireGuardWrite,
+	ScopeTerminal,
+	ScopeUsersWrite,
+	ScopeAuditRead,
+	ScopeSettingsRead,
+	ScopeSettingsWrite,
+}
+
+// APIToken is a long-lived credential for automation. Only a SHA-256 hash of
+// the token is stored; the plain value is shown once at creation.
+type APIToken struct {
+	ID         uint       `gorm:"primarykey" json:"id"`
+	UserID     uint       `gorm:"index" json:"user_id"`
+	Name       string     `gorm:"size:100" json:"name"`
+	Prefix     string     `gorm:"size:16" json:"prefix"`
+	TokenHash  string     `gorm:"uniqueIndex;size:64" json:"-"`
+	Scopes     string     `gorm:"size:500" json:"-"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	LastUsedIP string     `gorm:"size:64" json:"last_used_ip"`
+	ExpiresAt  *time.Time `json:"expires_at"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+// ValidScope reports whether scope is a known token scope.
+func ValidScope(scope string) bool {
+	for _, s := range AllScopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+func (t *APIToken) SetScopes(scopes []string) {
+	t.Scopes = strings.Join(scopes, " ")
+}
+
+func (t *APIToken) ScopeList() []string {
+	return strings.Fields(t.Scopes)
+}
+
+func (t *APIToken) Expired() bool {
+	return t.ExpiresAt != nil && time.Now().After(*t.ExpiresAt)
+}
+
+// GenerateAPIToken returns a new random token in plain text.
+func GenerateAPIToken() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return APITokenPrefix + hex.EncodeToString(buf), nil
+}
+
+// HashAPIToken returns the value stored in TokenHash for a plain token.
+func HashAPIToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,20 @@
+package models
+
+import "time"
+
+// AuditLog is one mutating action performed through the panel.
+type AuditLog struct {
+	ID         uint      `gorm:"primarykey" json:"id"`
+	CreatedAt  time.Time `gorm:"index" json:"created_at"`
+	UserID     uint      `gorm:"index" json:"user_id"`
+	Username   string    `gorm:"index;size:50" json:"username"`
+	IP         string    `gorm:"size:64" json:"ip"`
+	Action     string    `gorm:"index;size:150" json:"action"`
+	Target     string    `gorm:"size:500" json:"target"`
+	Params     string    `gorm:"type:text" json:"params"`
+	Status     int       `json:"status"`
+	Success    bool      `json:"success"`
+	Error      string    `gorm:"type:text" json:"error"`
+	DurationMs int64     `json:"duration_ms"`
+	RequestID  string    `gorm:"index;size:64" json:"request_id"`
+}
@@ -0,0 +1,15 @@
+package models
+
+import "time"
+
+// LoginAttempt records every password or second-factor check made against
+// the login endpoints.
+type LoginAttempt struct {
+	ID        uint      `gorm:"primarykey" json:"id"`
+	Username  string    `gorm:"index;size:50" json:"username"`
+	IP        string    `gorm:"index;size:64" json:"ip"`
+	UserAgent string    `gorm:"size:255" json:"user_agent"`
+	Success   bool      `json:"success"`
+	Reason    string    `gorm:"size:50" json:"reason"`
+	CreatedAt time.Time `gorm:"index" json:"created_at"`
+}
@@ -0,0 +1,71 @@
+package models
+
+import (
+	"errors"
+	"strings"
+	"unicode"
+)
+
+// MinPasswordLength is the shortest password the policy accepts.
+const MinPasswordLength = 10
+
+// commonPasswords are rejected even though they satisfy the other rules.
+// Compared case-insensitively.
+var commonPasswords = map[string]bool{
+	"admin12345":    true,
+	"admin123456":   true,
+	"password123":   true,
+	"password123!":  true,
+	"p@ssword123":   true,
+	"p@ssw0rd123":   true,
+	"qwerty12345":   true,
+	"changeme123":   true,
+	"welcome123":    true,
+	"welcome123!":   true,
+	"letmein123":    true,
+	"1qaz2wsx3edc":  true,
+	"netcontrol1":   true,
+	"netcontrol123": true,
+}
+
+// ValidatePassword enforces the password policy: at least
+// MinPasswordLength characters from at least three of lower case, upper
+// case, digits and symbols, not a common password and not containing the
+// username.
+func ValidatePassword(password, username string) error {
+	if len(password) < MinPasswordLength {
+		return errors.New("password must be at least 10 characters long")
+	}
+
+	var lower, upper, digit, symbol bool
+	for _, r := range password {
+		switch {
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsDigit(r):
+			digit = true
+		default:
+			symbol = true
+		}
+	}
+	classes := 0
+	for _, ok := range []bool{lower, upper, digit, symbol} {
+		if ok {
+			classes++
+		}
+	}
+	if classes < 3 {
+		return errors.New("password must contain at least three of: lower case letters, upper case letters, digits, symbols")
+	}
+
+	lowered := strings.ToLower(password)
+	if commonPasswords[lowered] {
+		return errors.New("password is too common")
+	}
+	if username != "" && strings.Contains(lowered, strings.ToLower(username)) {
+		return errors.New("password must not contain the username")
+	}
+	return nil
+}
@@ -0,0 +1,122 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+var namespacePattern = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`)
+
+// ResourceScope limits which workloads and files a user can see and act
+// on. A zero value grants access to the whole host. Once any restriction
+// is set, a resource without one is closed to the user rather than open.
+type ResourceScope struct {
+	// Namespaces the user may access in Kubernetes.
+	Namespaces []string
+	// ContainerLabels a Docker container must all carry to be visible.
+	ContainerLabels map[string]string
+	// FileRoot confines the file manager to this directory.
+	FileRoot string
+}
+
+// ResourceScope returns the restrictions configured for the user.
+func (u *User) ResourceScope() *ResourceScope {
+	scope := &ResourceScope{FileRoot: u.FileRoot}
+	for _, ns := range strings.Split(u.Namespaces, ",") {
+		if ns = strings.TrimSpace(ns); ns != "" {
+			scope.Namespaces = append(scope.Namespaces, ns)
+		}
+	}
+	labels, _ := ParseLabelSelector(u.ContainerLabels)
+	if len(labels) > 0 {
+		scope.ContainerLabels = labels
+	}
+	return scope
+}
+
+// Restricted reports whether any restriction applies.
+func (s *ResourceScope) Restricted() bool {
+	return len(s.Namespaces) > 0 || len(s.ContainerLabels) > 0 || s.FileRoot != ""
+}
+
+// AllowsKubernetes reports whether the user may access Kubernetes at all.
+func (s *ResourceScope) AllowsKubernetes() bool {
+	return !s.Restricted() || len(s.Namespaces) > 0
+}
+
+// AllowsDocker reports whether the user may access Docker at all.
+func (s *ResourceScope) AllowsDocker() bool {
+	return !s.Restricted() || len(s.ContainerLabels) > 0
+}
+
+// AllowsFiles reports whether the user may access files at all.
+func (s *ResourceScope) AllowsFiles() bool {
+	return !s.Restricted() || s.FileRoot != ""
+}
+
+// AllowsNamespace reports whether the user may access namespace. The empty
+// namespace stands for all namespaces and is only allowed when
+// unrestricted.
+func (s *ResourceScope) AllowsNamespace(namespace string) bool {
+	if len(s.Namespaces) == 0 {
+		return !s.Restricted()
+	}
+	for _, ns := range s.Namespaces {
+		if ns == namespace {
+			return true
+		}
+	}
+	return false
+}
+
+// AllowsContainer reports whether a container with the given labels is
+// visible to the user.
+func (s *ResourceScope) AllowsContainer(labels map[string]string) bool {
+	if !s.AllowsDocker() {
+		return false
+	}
+	for k, v := range s.ContainerLabels {
+		if labels[k] != v {
+			return false
+		}
+	}
+	return true
+}
+
+// ParseLabelSelector parses "key=value,key=value".
+func ParseLabelSelector(selector string) (map[string]string, error) {
+	labels := make(map[string]string)
+	for _, pair := range strings.Split(selector, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		key, value, ok := strings.Cut(pair, "=")
+		key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+		if !ok || key == "" {
+			return nil, fmt.Errorf("invalid label selector %q, expected key=value", pair)
+		}
+		labels[key] = value
+	}
+	return labels, nil
+}
+
+// ValidateResourceScope checks the restriction fields of a user before
+// they are saved.
+func ValidateResourceScope(namespaces, containerLabels, fileRoot string) error {
+	for _, ns := range strings.Split(namespaces, ",") {
+		if ns = strings.TrimSpace(ns); ns != "" && !namespacePattern.MatchString(ns) {
+			return fmt.Errorf("invalid namespace %q", ns)
+		}
+	}
+	if _, err := ParseLabelSelector(containerLabels); err != nil {
+		return err
+	}
+	if fileRoot != "" && !filepath.IsAbs(fileRoot) {
+		return errors.New("file_root must be an absolute path")
+	}
+	return nil
+}
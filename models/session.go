@@ -0,0 +1,37 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Session is the server-side record of an issued login JWT, keyed by the
+// token's jti claim. A JWT is only accepted while its session is active.
+type Session struct {
+	ID         string     `gorm:"primarykey;size:36" json:"id"`
+	UserID     uint       `gorm:"index" json:"user_id"`
+	IP         string     `gorm:"size:64" json:"ip"`
+	UserAgent  string     `gorm:"size:255" json:"user_agent"`
+	CreatedAt  time.Time  `json:"created_at"`
+	LastSeenAt time.Time  `json:"last_seen_at"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+	// CSRFToken must accompany mutating requests authenticated by the
+	// session cookie.
+	CSRFToken string `gorm:"size:64" json:"-"`
+}
+
+func (s *Session) Active() bool {
+	return s.RevokedAt == nil && time.Now().Before(s.ExpiresAt)
+}
+
+// RevokeUserSessions revokes every active session of userID except the one
+// with ID exceptID, which may be empty.
+func RevokeUserSessions(db *gorm.DB, userID uint, exceptID string) error {
+	query := db.Model(&Session{}).Where("user_id = ? AND revoked_at IS NULL", userID)
+	if exceptID != "" {
+		query = query.Where("id <> ?", exceptID)
+	}
+	return query.Update("revoked_at", time.Now()).Error
+}
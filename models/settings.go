@@ -1,11 +1,34 @@
 package models
 
 import (
+	"regexp"
 	"time"
 
 	"gorm.io/gorm"
 )
 
+// Settings keys written during first-run setup.
+const (
+	SettingSetupCompleted = "setup.completed"
+	SettingJWTSecret      = "jwt.secret" // superseded by rotating keys, read once to migrate
+	SettingPanelHostname  = "panel.hostname"
+	SettingTLSCertFile    = "tls.cert_file"
+	SettingTLSKeyFile     = "tls.key_file"
+)
+
+// Settings keys marking one-time data migrations as done.
+const (
+	SettingMigratedRoles = "migrated.roles"
+)
+
+var panelHostnamePattern = regexp.MustCompile(`^[A-Za-z0-9]([A-Za-z0-9.-]*[A-Za-z0-9])?(:[0-9]{1,5})?$`)
+
+// ValidPanelHostname reports whether host is a host name or address,
+// optionally with a port.
+func ValidPanelHostname(host string) bool {
+	return panelHostnamePattern.MatchString(host)
+}
+
 type Settings struct {
 	ID        uint           `gorm:"primarykey" json:"id"`
 	Key       string         `gorm:"uniqueIndex;size:100" json:"key"`
@@ -1,19 +1,63 @@
 package models
 
 import (
+	"encoding/json"
 	"time"
 
 	"golang.org/x/crypto/bcrypt"
 	"gorm.io/gorm"
 )
 
+// Panel roles, from least to most privileged.
+const (
+	RoleViewer   = "viewer"
+	RoleOperator = "operator"
+	RoleAdmin    = "admin"
+)
+
+// Where an account's identity comes from.
+const (
+	AuthSourceLocal = "local"
+	AuthSourceOIDC  = "oidc"
+	AuthSourceLDAP  = "ldap"
+)
+
+var roleRank = map[string]int{
+	RoleViewer:   1,
+	RoleOperator: 2,
+	RoleAdmin:    3,
+}
+
 type User struct {
 	ID        uint           `gorm:"primarykey" json:"id"`
 	Username  string         `gorm:"uniqueIndex;size:50" json:"username"`
 	Password  string         `gorm:"size:255" json:"-"`
+	Role      string         `gorm:"size:20" json:"role"`
 	CreatedAt time.Time      `json:"created_at"`
 	UpdatedAt time.Time      `json:"updated_at"`
 	DeletedAt gorm.DeletedAt `gorm:"index" json:"-"`
+
+	// Accounts provisioned by an external identity provider have no local
+	// password; ExternalID is the provider's stable subject identifier.
+	AuthSource string `gorm:"size:20;default:local" json:"auth_source"`
+	ExternalID string `gorm:"size:255;index" json:"-"`
+
+	// Two-factor authentication. TOTPSecret is set as soon as enrollment
+	// starts, TOTPEnabled only once the user confirmed a first code.
+	TOTPSecret    string `gorm:"size:64" json:"-"`
+	TOTPEnabled   bool   `json:"totp_enabled"`
+	TOTPLastStep  int64  `json:"-"`
+	RecoveryCodes string `gorm:"type:text" json:"-"` // JSON array of hashes
+
+	// Resource restrictions for shared hosts, see ResourceScope. Empty
+	// fields leave that resource unrestricted.
+	Namespaces      string `gorm:"type:text" json:"namespaces"`       // comma separated
+	ContainerLabels string `gorm:"type:text" json:"container_labels"` // comma separated key=value
+	FileRoot        string `gorm:"size:1024" json:"file_root"`
+
+	// Consecutive failed logins and the resulting temporary lockout
+	FailedLogins int        `json:"failed_logins"`
+	LockedUntil  *time.Time `json:"locked_until"`
 }
 
 func (u *User) SetPassword(password string) error {
@@ -29,3 +73,64 @@ func (u *User) CheckPassword(password string) bool {
 	err := bcrypt.CompareHashAndPassword([]byte(u.Password), []byte(password))
 	return err == nil
 }
+
+// ValidRole reports whether role is one of the known panel roles.
+func ValidRole(role string) bool {
+	_, ok := roleRank[role]
+	return ok
+}
+
+// RoleAtLeast reports whether role grants at least the privileges of required.
+func RoleAtLeast(role, required string) bool {
+	return roleRank[role] >= roleRank[required] && ValidRole(required)
+}
+
+// SetRecoveryCodes stores the given recovery code hashes.
+func (u *User) SetRecoveryCodes(hashes []string) {
+	data, _ := json.Marshal(hashes)
+	u.RecoveryCodes = string(data)
+}
+
+// UseRecoveryCode consumes the recovery code with the given hash. It reports
+// false when no unused code matches.
+func (u *User) UseRecoveryCode(hash string) bool {
+	var hashes []string
+	if u.RecoveryCodes != "" {
+		json.Unmarshal([]byte(u.RecoveryCodes), &hashes)
+	}
+	for i, h := range hashes {
+		if h == hash {
+			u.SetRecoveryCodes(append(hashes[:i], hashes[i+1:]...))
+			return true
+		}
+	}
+	return false
+}
+
+// RemainingRecoveryCodes returns how many recovery codes are still unused.
+func (u *User) RemainingRecoveryCodes() int {
+	var hashes []string
+	if u.RecoveryCodes != "" {
+		json.Unmarshal([]byte(u.RecoveryCodes), &hashes)
+	}
+	return len(hashes)
+}
+
+// ResetTwoFactor removes any TOTP enrollment and recovery codes.
+func (u *User) ResetTwoFactor() {
+	u.TOTPSecret = ""
+	u.TOTPEnabled = false
+	u.TOTPLastStep = 0
+	u.RecoveryCodes = ""
+}
+
+// External reports whether the account's credentials are managed by an
+// identity provider rather than a local password.
+func (u *User) External() bool {
+	return u.AuthSource != "" && u.AuthSource != AuthSourceLocal
+}
+
+// Locked reports whether the account is currently locked out.
+func (u *User) Locked() bool {
+	return u.LockedUntil != nil && time.Now().Before(*u.LockedUntil)
+}
@@ -0,0 +1,138 @@
+package services
+
+import (
+	"log/slog"
+	"sync"
+	"time"
+
+	"netcontrol-containers/database"
+	"netcontrol-containers/models"
+)
+
+const (
+	// SettingAuditRetentionDays is the settings key holding how many days
+	// of audit entries are kept. Zero or less keeps everything.
+	SettingAuditRetentionDays = "audit.retention_days"
+
+	DefaultAuditRetentionDays = 90
+)
+
+// AuditLogger writes audit entries to the database from a single
+// background goroutine so request handlers never wait on SQLite.
+type AuditLogger struct {
+	entries chan *models.AuditLog
+	wg      sync.WaitGroup
+	stop    chan struct{}
+	// mu orders queueing against Flush: once stopped is set, nothing more
+	// is queued and the writer drains what already was
+	mu      sync.RWMutex
+	stopped bool
+}
+
+var (
+	auditLogger     *AuditLogger
+	auditLoggerOnce sync.Once
+)
+
+func GetAuditLogger() *AuditLogger {
+	auditLoggerOnce.Do(func() {
+		auditLogger = newAuditLogger()
+	})
+	return auditLogger
+}
+
+func newAuditLogger() *AuditLogger {
+	a := &AuditLogger{
+		entries: make(chan *models.AuditLog, 1000),
+		stop:    make(chan struct{}),
+	}
+	a.wg.Add(1)
+	go a.run()
+	return a
+}
+
+// Record queues an entry for writing. If the queue is full, or the writer
+// has been stopped, the entry is written synchronously rather than dropped.
+func (a *AuditLogger) Record(entry *models.AuditLog) {
+	if entry.CreatedAt.IsZero() {
+		entry.CreatedAt = time.Now()
+	}
+	a.mu.RLock()
+	if !a.stopped {
+		select {
+		case a.entries <- entry:
+			a.mu.RUnlock()
+			return
+		default:
+		}
+	}
+	a.mu.RUnlock()
+	a.write(entry)
+}
+
+// Flush writes every queued entry and stops the writer. Entries recorded
+// afterwards are written synchronously.
+func (a *AuditLogger) Flush() {
+	a.mu.Lock()
+	if a.stopped {
+		a.mu.Unlock()
+		return
+	}
+	a.stopped = true
+	close(a.stop)
+	a.mu.Unlock()
+	a.wg.Wait()
+}
+
+func (a *AuditLogger) run() {
+	defer a.wg.Done()
+
+	prune := time.NewTicker(24 * time.Hour)
+	defer prune.Stop()
+	a.Prune()
+
+	for {
+		select {
+		case entry := <-a.entries:
+			a.write(entry)
+		case <-prune.C:
+			a.Prune()
+		case <-a.stop:
+			for {
+				select {
+				case entry := <-a.entries:
+					a.write(entry)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+func (a *AuditLogger) write(entry *models.AuditLog) {
+	db := database.Get()
+	if db == nil {
+		return
+	}
+	if err := db.Create(entry).Error; err != nil {
+		slog.Error("Failed to write audit entry", "action", entry.Action, "request_id", entry.RequestID, "error", err)
+	}
+}
+
+// Prune deletes entries older than the configured retention.
+func (a *AuditLogger) Prune() {
+	days := AuditRetentionDays()
+	if days <= 0 {
+		return
+	}
+	cutoff := time.Now().AddDate(0, 0, -days)
+	if err := database.Get().Where("created_at < ?", cutoff).Delete(&models.AuditLog{}).Error; err != nil {
+		slog.Error("Failed to prune audit log", "error", err)
+	}
+}
+
+// AuditRetentionDays returns the configured retention in days.
+func AuditRetentionDays() int {
+	return SettingInt(SettingAuditRetentionDays)
+}
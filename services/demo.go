@@ -0,0 +1,163 @@
+package services
+
+import (
+	"fmt"
+	"math"
+	"math/rand/v2"
+	"time"
+)
+
+// demo holds the simulated backends while demo mode is on. It is set once
+// before the server starts and never changes afterwards.
+var demo *demoBackends
+
+type demoBackends struct {
+	docker     *demoDocker
+	kubernetes *demoKubernetes
+	wireguard  *demoWireGuard
+	installer  *demoInstaller
+	system     *demoSystem
+}
+
+// EnableDemo replaces Docker, Kubernetes, WireGuard, the installer and the
+// host stats with in-memory simulations, so the panel runs without any of
+// them and without root. The simulated state starts from the same sample
+// data every time and is lost on exit.
+func EnableDemo() {
+	now := time.Now()
+	d := &demoBackends{
+		docker:     newDemoDocker(now),
+		kubernetes: newDemoKubernetes(now),
+		wireguard:  newDemoWireGuard(),
+	}
+	d.installer = newDemoInstaller(d)
+	d.system = &demoSystem{boot: now.Add(-12*24*time.Hour - 5*time.Hour), docker: d.docker}
+	demo = d
+}
+
+// DemoMode reports whether the backends are simulated.
+func DemoMode() bool {
+	return demo != nil
+}
+
+// demoWave is a smooth curve around base that swings by amplitude over
+// period, with some noise on top so repeated samples never look flat.
+func demoWave(now time.Time, base, amplitude float64, period time.Duration, phase float64) float64 {
+	x := float64(now.UnixNano())/float64(period)*2*math.Pi + phase
+	v := base + amplitude*math.Sin(x) + amplitude*0.2*(rand.Float64()*2-1)
+	return math.Max(v, 0)
+}
+
+// demoID returns a random 64 digit hex ID like the ones Docker assigns.
+func demoID() string {
+	return fmt.Sprintf("%016x%016x%016x%016x", rand.Uint64(), rand.Uint64(), rand.Uint64(), rand.Uint64())
+}
+
+// demoSuffix returns a random lowercase suffix like the ones Kubernetes
+// appends to pod names.
+func demoSuffix(n int) string {
+	const chars = "bcdfghjklmnpqrstvwxz2456789"
+	b := make([]byte, n)
+	for i := range b {
+		b[i] = chars[rand.IntN(len(chars))]
+	}
+	return string(b)
+}
+
+// demoSystem derives the host figures from the simulated containers, so
+// stopping a busy container shows on the dashboard.
+type demoSystem struct {
+	boot   time.Time
+	docker *demoDocker
+}
+
+const (
+	demoHostCores  = 8
+	demoHostMemory = 16 << 30
+)
+
+func (s *demoSystem) Host() (*SystemInfo, error) {
+	cpu, _ := s.CPU()
+	memory, _ := s.Memory()
+	disks, _ := s.Disks()
+	return &SystemInfo{
+		Hostname:   "demo-node-01",
+		Platform:   "ubuntu",
+		OS:         "linux",
+		Arch:       "amd64",
+		Uptime:     uint64(time.Since(s.boot).Seconds()),
+		BootTime:   uint64(s.boot.Unix()),
+		CPUInfo:    *cpu,
+		MemoryInfo: *memory,
+		DiskInfo:   disks,
+	}, nil
+}
+
+func (s *demoSystem) CPU() (*CPUInfo, error) {
+	now := time.Now()
+	containerCPU, _ := s.docker.load()
+	perCore := make([]float64, demoHostCores)
+	total := 0.0
+	for i := range perCore {
+		v := demoWave(now, 4+containerCPU/demoHostCores, 3, 90*time.Second, float64(i))
+		perCore[i] = math.Min(v, 100)
+		total += perCore[i]
+	}
+	return &CPUInfo{
+		ModelName:    "AMD EPYC 7763 64-Core Processor",
+		Cores:        demoHostCores,
+		Threads:      demoHostCores,
+		Mhz:          2445.406,
+		UsagePercent: perCore,
+		TotalUsage:   total / demoHostCores,
+	}, nil
+}
+
+func (s *demoSystem) Memory() (*MemoryInfo, error) {
+	_, containerMemory := s.docker.load()
+	base := uint64(demoWave(time.Now(), 2.4*(1<<30), 0.2*(1<<30), 5*time.Minute, 0))
+	used := min(base+containerMemory, demoHostMemory)
+	cache := uint64(3 << 30)
+	free := demoHostMemory - min(used+cache, demoHostMemory)
+	return &MemoryInfo{
+		Total:       demoHostMemory,
+		Used:        used,
+		Free:        free,
+		UsedPercent: float64(used) / demoHostMemory * 100,
+		Available:   demoHostMemory - used,
+	}, nil
+}
+
+func (s *demoSystem) Disks() ([]DiskInfo, error) {
+	// The root file system slowly fills up with logs
+	grown := uint64(time.Since(s.boot).Minutes()) * 64 << 10
+	disks := []DiskInfo{
+		{Device: "/dev/vda1", Mountpoint: "/", Fstype: "ext4", Total: 160 << 30, Used: 41<<30 + grown},
+		{Device: "/dev/vdb1", Mountpoint: "/var/lib/docker", Fstype: "xfs", Total: 500 << 30, Used: 87 << 30},
+	}
+	for i := range disks {
+		disks[i].Free = disks[i].Total - disks[i].Used
+		disks[i].UsedPercent = float64(disks[i].Used) / float64(disks[i].Total) * 100
+	}
+	return disks, nil
+}
+
+func (s *demoSystem) QuickStats() (map[string]interface{}, error) {
+	cpu, _ := s.CPU()
+	memory, _ := s.Memory()
+	disks, _ := s.Disks()
+	var totalDisk, usedDisk uint64
+	for _, d := range disks {
+		totalDisk += d.Total
+		usedDisk += d.Used
+	}
+	return map[string]interface{}{
+		"cpu_percent":    cpu.TotalUsage,
+		"memory_percent": memory.UsedPercent,
+		"memory_used":    memory.Used,
+		"memory_total":   memory.Total,
+		"disk_percent":   float64(usedDisk) / float64(totalDisk) * 100,
+		"disk_used":      usedDisk,
+		"disk_total":     totalDisk,
+	}, nil
+}
@@ -0,0 +1,731 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/rand/v2"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+var errDemoDockerDown = errors.New("Cannot connect to the Docker daemon at unix:///var/run/docker.sock. Is the docker daemon running?")
+
+// demoDocker is a Docker daemon kept in memory. Containers keep their state
+// between calls and their stats follow a curve per container.
+type demoDocker struct {
+	mu         sync.Mutex
+	running    bool
+	containers []*demoContainer
+	images     []*demoImage
+}
+
+type demoContainer struct {
+	id         string
+	name       string
+	image      string
+	state      string
+	exitCode   int
+	created    time.Time
+	startedAt  time.Time
+	finishedAt time.Time
+	ports      []PortMapping
+	ip         string
+	labels     map[string]string
+	env        []string
+
+	// Stats: typical CPU percent and memory, and the cumulative counters
+	// Docker reports, advanced on every sample
+	cpuBase     float64
+	memoryBase  uint64
+	memoryLimit uint64
+	phase       float64
+	cpuTotal    uint64
+	systemTotal uint64
+	rx, tx      uint64
+	sampled     time.Time
+}
+
+type demoImage struct {
+	id      string
+	tags    []string
+	size    int64
+	created time.Time
+}
+
+func newDemoDocker(now time.Time) *demoDocker {
+	d := &demoDocker{running: true}
+	for _, img := range []struct {
+		tag  string
+		size int64
+		age  time.Duration
+	}{
+		{"nginx:1.27-alpine", 47 << 20, 40 * 24 * time.Hour},
+		{"postgres:16", 432 << 20, 55 * 24 * time.Hour},
+		{"redis:7-alpine", 41 << 20, 30 * 24 * time.Hour},
+		{"grafana/grafana:11.1.0", 452 << 20, 20 * 24 * time.Hour},
+		{"prom/prometheus:v2.53.0", 281 << 20, 25 * 24 * time.Hour},
+		{"ghcr.io/acme/shop-api:2.4.1", 96 << 20, 3 * 24 * time.Hour},
+	} {
+		d.images = append(d.images, &demoImage{id: demoID(), tags: []string{img.tag}, size: img.size, created: now.Add(-img.age)})
+	}
+
+	for i, c := range []struct {
+		name, image string
+		port        uint16
+		publish     uint16
+		cpu         float64
+		memory      uint64
+		running     bool
+		age         time.Duration
+	}{
+		{"web", "nginx:1.27-alpine", 80, 8080, 1.5, 24 << 20, true, 9 * 24 * time.Hour},
+		{"shop-api", "ghcr.io/acme/shop-api:2.4.1", 3000, 3000, 18, 210 << 20, true, 3 * 24 * time.Hour},
+		{"postgres", "postgres:16", 5432, 0, 6, 380 << 20, true, 9 * 24 * time.Hour},
+		{"redis", "redis:7-alpine", 6379, 0, 2.5, 18 << 20, true, 9 * 24 * time.Hour},
+		{"grafana", "grafana/grafana:11.1.0", 3000, 3001, 3, 120 << 20, true, 6 * 24 * time.Hour},
+		{"prometheus", "prom/prometheus:v2.53.0", 9090, 9090, 9, 340 << 20, false, 6 * 24 * time.Hour},
+	} {
+		ports := []PortMapping{{PrivatePort: c.port, Type: "tcp"}}
+		if c.publish != 0 {
+			ports = []PortMapping{{PrivatePort: c.port, PublicPort: c.publish, Type: "tcp", IP: "0.0.0.0"}}
+		}
+		container := &demoContainer{
+			id:          demoID(),
+			name:        c.name,
+			image:       c.image,
+			state:       "running",
+			created:     now.Add(-c.age),
+			startedAt:   now.Add(-c.age + time.Minute),
+			ports:       ports,
+			ip:          fmt.Sprintf("172.17.0.%d", i+2),
+			labels:      map[string]string{"com.docker.compose.project": "shop"},
+			cpuBase:     c.cpu,
+			memoryBase:  c.memory,
+			memoryLimit: demoHostMemory,
+			phase:       float64(i),
+		}
+		if !c.running {
+			container.state = "exited"
+			container.exitCode = 137
+			container.finishedAt = now.Add(-2 * time.Hour)
+		}
+		d.containers = append(d.containers, container)
+	}
+	return d
+}
+
+// setRunning starts or stops the daemon, as installing or uninstalling
+// Docker does.
+func (d *demoDocker) setRunning(running bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.running = running
+}
+
+// restartDaemon restarts the running containers, as restarting the docker
+// service does.
+func (d *demoDocker) restartDaemon() {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	now := time.Now()
+	for _, c := range d.containers {
+		if c.state == "running" {
+			c.startedAt = now
+			c.sampled = time.Time{}
+		}
+	}
+}
+
+// load returns the CPU percent and memory used by the running containers.
+func (d *demoDocker) load() (cpu float64, memory uint64) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if !d.running {
+		return 0, 0
+	}
+	for _, c := range d.containers {
+		if c.state == "running" {
+			cpu += c.cpuBase
+			memory += c.memoryBase
+		}
+	}
+	return cpu, memory
+}
+
+// find looks a container up by name or ID prefix, like the Docker API.
+// d.mu must be held.
+func (d *demoDocker) find(ref string) (*demoContainer, error) {
+	ref = strings.TrimPrefix(ref, "/")
+	var match *demoContainer
+	for _, c := range d.containers {
+		if c.name == ref || c.id == ref {
+			return c, nil
+		}
+		if ref != "" && strings.HasPrefix(c.id, ref) {
+			if match != nil {
+				return nil, fmt.Errorf("Error response from daemon: multiple IDs found with provided prefix: %s", ref)
+			}
+			match = c
+		}
+	}
+	if match == nil {
+		return nil, fmt.Errorf("Error response from daemon: No such container: %s", ref)
+	}
+	return match, nil
+}
+
+// findImage looks an image up by tag or ID prefix. d.mu must be held.
+func (d *demoDocker) findImage(ref string) *demoImage {
+	ref = strings.TrimPrefix(ref, "sha256:")
+	for _, img := range d.images {
+		if ref != "" && strings.HasPrefix(img.id, ref) {
+			return img
+		}
+		for _, tag := range img.tags {
+			if tag == ref || tag == ref+":latest" {
+				return img
+			}
+		}
+	}
+	return nil
+}
+
+// lock locks d. It fails while the daemon is down.
+func (d *demoDocker) lock() error {
+	d.mu.Lock()
+	if !d.running {
+		d.mu.Unlock()
+		return errDemoDockerDown
+	}
+	return nil
+}
+
+func (d *demoDocker) IsAvailable(ctx context.Context) bool {
+	return d.Ping(ctx) == nil
+}
+
+func (d *demoDocker) Ping(ctx context.Context) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if !d.running {
+		return errDemoDockerDown
+	}
+	return nil
+}
+
+func (d *demoDocker) ListContainers(ctx context.Context, all bool, labels map[string]string) ([]ContainerInfo, error) {
+	if err := d.lock(); err != nil {
+		return nil, err
+	}
+	defer d.mu.Unlock()
+
+	result := make([]ContainerInfo, 0)
+	now := time.Now()
+	for _, c := range d.containers {
+		if !all && c.state != "running" {
+			continue
+		}
+		matches := true
+		for k, v := range labels {
+			if c.labels[k] != v {
+				matches = false
+			}
+		}
+		if !matches {
+			continue
+		}
+		result = append(result, ContainerInfo{
+			ID:       c.id[:12],
+			Name:     c.name,
+			Image:    c.image,
+			State:    c.state,
+			Status:   c.status(now),
+			Created:  c.created.Unix(),
+			Ports:    c.ports,
+			Networks: []string{"bridge"},
+			IP:       c.ip,
+			Labels:   c.labels,
+		})
+	}
+	return result, nil
+}
+
+// status is the human readable state, e.g. "Up 3 hours".
+func (c *demoContainer) status(now time.Time) string {
+	switch c.state {
+	case "running":
+		return "Up " + demoDockerDuration(now.Sub(c.startedAt))
+	case "exited":
+		return fmt.Sprintf("Exited (%d) %s ago", c.exitCode, demoDockerDuration(now.Sub(c.finishedAt)))
+	}
+	return "Created"
+}
+
+// demoDockerDuration formats a duration the way the docker CLI does.
+func demoDockerDuration(d time.Duration) string {
+	switch {
+	case d < time.Second:
+		return "Less than a second"
+	case d < time.Minute:
+		return fmt.Sprintf("%d seconds", int(d.Seconds()))
+	case d < 2*time.Minute:
+		return "About a minute"
+	case d < time.Hour:
+		return fmt.Sprintf("%d minutes", int(d.Minutes()))
+	case d < 2*time.Hour:
+		return "About an hour"
+	case d < 48*time.Hour:
+		return fmt.Sprintf("%d hours", int(d.Hours()))
+	}
+	return fmt.Sprintf("%d days", int(d.Hours()/24))
+}
+
+func (d *demoDocker) GetContainerStats(ctx context.Context, containerID string) (*ContainerStats, error) {
+	if err := d.lock(); err != nil {
+		return nil, err
+	}
+	defer d.mu.Unlock()
+	c, err := d.find(containerID)
+	if err != nil {
+		return nil, err
+	}
+
+	stats := &ContainerStats{MemoryLimit: c.memoryLimit, OnlineCPUs: demoHostCores}
+	now := time.Now()
+	if c.state != "running" {
+		c.sampled = time.Time{}
+		return stats, nil
+	}
+
+	cpu := demoWave(now, c.cpuBase, c.cpuBase*0.6, 2*time.Minute, c.phase)
+	memory := uint64(demoWave(now, float64(c.memoryBase), float64(c.memoryBase)*0.08, 7*time.Minute, c.phase))
+	memory = min(memory, c.memoryLimit)
+
+	// Advance the counters so that the CPU percent computed from two
+	// samples, as the stats stream does, matches the curve
+	if !c.sampled.IsZero() {
+		elapsed := uint64(now.Sub(c.sampled).Nanoseconds())
+		c.systemTotal += elapsed * demoHostCores
+		c.cpuTotal += uint64(cpu / 100 * float64(elapsed))
+		seconds := now.Sub(c.sampled).Seconds()
+		c.rx += uint64(seconds * demoWave(now, c.cpuBase*9000, c.cpuBase*4000, 3*time.Minute, c.phase))
+		c.tx += uint64(seconds * demoWave(now, c.cpuBase*5000, c.cpuBase*2500, 3*time.Minute, c.phase+1))
+	}
+	c.sampled = now
+
+	stats.CPUPercent = cpu
+	stats.MemoryUsage = memory
+	stats.MemoryPercent = float64(memory) / float64(c.memoryLimit) * 100
+	stats.NetworkRx = c.rx
+	stats.NetworkTx = c.tx
+	stats.CPUTotalUsage = c.cpuTotal
+	stats.SystemUsage = c.systemTotal
+	return stats, nil
+}
+
+func (d *demoDocker) StartContainer(ctx context.Context, containerID string) error {
+	if err := d.lock(); err != nil {
+		return err
+	}
+	defer d.mu.Unlock()
+	c, err := d.find(containerID)
+	if err != nil {
+		return err
+	}
+	if c.state != "running" {
+		c.state = "running"
+		c.startedAt = time.Now()
+	}
+	return nil
+}
+
+func (d *demoDocker) StopContainer(ctx context.Context, containerID string) error {
+	if err := d.lock(); err != nil {
+		return err
+	}
+	defer d.mu.Unlock()
+	c, err := d.find(containerID)
+	if err != nil {
+		return err
+	}
+	if c.state == "running" {
+		c.state = "exited"
+		c.exitCode = 0
+		c.finishedAt = time.Now()
+	}
+	return nil
+}
+
+func (d *demoDocker) RestartContainer(ctx context.Context, containerID string) error {
+	if err := d.lock(); err != nil {
+		return err
+	}
+	defer d.mu.Unlock()
+	c, err := d.find(containerID)
+	if err != nil {
+		return err
+	}
+	c.state = "running"
+	c.startedAt = time.Now()
+	return nil
+}
+
+func (d *demoDocker) RemoveContainer(ctx context.Context, containerID string, force bool) error {
+	if err := d.lock(); err != nil {
+		return err
+	}
+	defer d.mu.Unlock()
+	c, err := d.find(containerID)
+	if err != nil {
+		return err
+	}
+	if c.state == "running" && !force {
+		return fmt.Errorf("Error response from daemon: You cannot remove a running container %s. Stop the container before attempting removal or force remove", c.id)
+	}
+	for i := range d.containers {
+		if d.containers[i] == c {
+			d.containers = append(d.containers[:i], d.containers[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+func (d *demoDocker) GetContainerLogs(ctx context.Context, containerID string, tail string) (string, error) {
+	if err := d.lock(); err != nil {
+		return "", err
+	}
+	defer d.mu.Unlock()
+	c, err := d.find(containerID)
+	if err != nil {
+		return "", err
+	}
+
+	limit := 500
+	if n, err := fmt.Sscan(tail, &limit); n == 0 || err != nil || limit > 500 {
+		limit = 500
+	}
+	end := time.Now()
+	if c.state != "running" {
+		end = c.finishedAt
+	}
+	if c.startedAt.IsZero() || limit <= 0 {
+		return "", nil
+	}
+
+	// One line every 20 seconds of the last run, the newest last
+	var lines []string
+	for t := end; !t.Before(c.startedAt) && len(lines) < limit; t = t.Add(-20 * time.Second) {
+		lines = append(lines, t.UTC().Format(time.RFC3339Nano)+" "+demoLogLine(c.image, t))
+	}
+	for i, j := 0, len(lines)-1; i < j; i, j = i+1, j-1 {
+		lines[i], lines[j] = lines[j], lines[i]
+	}
+	return strings.Join(lines, "\n") + "\n", nil
+}
+
+// demoLogLine makes up a log line typical for the image.
+func demoLogLine(image string, t time.Time) string {
+	n := int(t.Unix() / 20)
+	paths := []string{"/", "/api/products", "/api/cart", "/static/app.js", "/healthz", "/api/orders"}
+	switch {
+	case strings.Contains(image, "nginx"):
+		return fmt.Sprintf(`172.17.0.1 - - [%s] "GET %s HTTP/1.1" 200 %d "-" "Mozilla/5.0"`, t.Format("02/Jan/2006:15:04:05 -0700"), paths[n%len(paths)], 512+n%4096)
+	case strings.Contains(image, "postgres"):
+		return fmt.Sprintf("%s UTC [%d] LOG:  checkpoint complete: wrote %d buffers (0.%d%%)", t.UTC().Format("2006-01-02 15:04:05.000"), 60+n%30, n%200, n%10)
+	case strings.Contains(image, "redis"):
+		return fmt.Sprintf("1:M %s * %d changes in 60 seconds. Saving...", t.Format("02 Jan 2006 15:04:05.000"), 1+n%100)
+	case strings.Contains(image, "prometheus"), strings.Contains(image, "grafana"):
+		return fmt.Sprintf(`level=info ts=%s caller=compact.go:%d msg="write block" duration=%dms`, t.UTC().Format(time.RFC3339), 500+n%90, 10+n%300)
+	}
+	return fmt.Sprintf(`{"level":"info","msg":"request completed","method":"GET","path":"%s","status":200,"duration_ms":%d}`, paths[n%len(paths)], 2+n%80)
+}
+
+func (d *demoDocker) ListImages(ctx context.Context) ([]ImageInfo, error) {
+	if err := d.lock(); err != nil {
+		return nil, err
+	}
+	defer d.mu.Unlock()
+
+	result := make([]ImageInfo, 0)
+	for _, img := range d.images {
+		result = append(result, ImageInfo{
+			ID:       img.id[:12],
+			RepoTags: img.tags,
+			Size:     img.size,
+			Created:  img.created.Unix(),
+		})
+	}
+	return result, nil
+}
+
+// PullImage streams the progress messages of a pull like the daemon does,
+// over a few seconds, and adds the image when done.
+func (d *demoDocker) PullImage(ctx context.Context, imageName string) (io.ReadCloser, error) {
+	if err := d.Ping(ctx); err != nil {
+		return nil, err
+	}
+	ref := imageName
+	if i := strings.LastIndex(ref, ":"); i < 0 || strings.Contains(ref[i:], "/") {
+		ref += ":latest"
+	}
+	tag := ref[strings.LastIndex(ref, ":")+1:]
+
+	r, w := io.Pipe()
+	go func() {
+		enc := json.NewEncoder(w)
+		send := func(msg map[string]any) bool {
+			select {
+			case <-ctx.Done():
+				w.CloseWithError(ctx.Err())
+				return false
+			case <-time.After(150 * time.Millisecond):
+			}
+			return enc.Encode(msg) == nil
+		}
+
+		d.mu.Lock()
+		existing := d.findImage(ref)
+		d.mu.Unlock()
+		if !send(map[string]any{"status": "Pulling from " + strings.TrimSuffix(ref, ":"+tag), "id": tag}) {
+			return
+		}
+		if existing != nil {
+			send(map[string]any{"status": "Digest: sha256:" + existing.id})
+			send(map[string]any{"status": "Status: Image is up to date for " + ref})
+			w.Close()
+			return
+		}
+
+		layers := 2 + rand.IntN(3)
+		var size int64
+		for l := 0; l < layers; l++ {
+			id := demoID()[:12]
+			total := int64(5+rand.IntN(40)) << 20
+			size += total
+			if !send(map[string]any{"status": "Pulling fs layer", "id": id}) {
+				return
+			}
+			for done := int64(0); done < total; done += total / 4 {
+				if !send(map[string]any{"status": "Downloading", "id": id, "progressDetail": map[string]int64{"current": done, "total": total}}) {
+					return
+				}
+			}
+			if !send(map[string]any{"status": "Download complete", "id": id}) || !send(map[string]any{"status": "Pull complete", "id": id}) {
+				return
+			}
+		}
+
+		img := &demoImage{id: demoID(), tags: []string{ref}, size: size, created: time.Now()}
+		d.mu.Lock()
+		d.images = append(d.images, img)
+		d.mu.Unlock()
+		send(map[string]any{"status": "Digest: sha256:" + img.id})
+		send(map[string]any{"status": "Status: Downloaded newer image for " + ref})
+		w.Close()
+	}()
+	return r, nil
+}
+
+func (d *demoDocker) RemoveImage(ctx context.Context, imageID string, force bool) error {
+	if err := d.lock(); err != nil {
+		return err
+	}
+	defer d.mu.Unlock()
+	img := d.findImage(imageID)
+	if img == nil {
+		return fmt.Errorf("Error response from daemon: No such image: %s", imageID)
+	}
+	if !force {
+		for _, c := range d.containers {
+			if d.findImage(c.image) == img {
+				state := "stopped"
+				if c.state == "running" {
+					state = "running"
+				}
+				return fmt.Errorf("Error response from daemon: conflict: unable to delete %s (must be forced) - image is being used by %s container %s", img.id[:12], state, c.id[:12])
+			}
+		}
+	}
+	for i := range d.images {
+		if d.images[i] == img {
+			d.images = append(d.images[:i], d.images[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+func (d *demoDocker) ContainerLabels(ctx context.Context, containerID string) (map[string]string, error) {
+	if err := d.lock(); err != nil {
+		return nil, err
+	}
+	defer d.mu.Unlock()
+	c, err := d.find(containerID)
+	if err != nil {
+		return nil, err
+	}
+	return c.labels, nil
+}
+
+// InspectContainer returns the commonly read parts of docker inspect.
+func (d *demoDocker) InspectContainer(ctx context.Context, containerID string) (interface{}, error) {
+	if err := d.lock(); err != nil {
+		return nil, err
+	}
+	defer d.mu.Unlock()
+	c, err := d.find(containerID)
+	if err != nil {
+		return nil, err
+	}
+
+	exposed := map[string]struct{}{}
+	bindings := map[string][]map[string]string{}
+	for _, p := range c.ports {
+		key := fmt.Sprintf("%d/%s", p.PrivatePort, p.Type)
+		exposed[key] = struct{}{}
+		if p.PublicPort != 0 {
+			bindings[key] = []map[string]string{{"HostIp": "", "HostPort": fmt.Sprint(p.PublicPort)}}
+		}
+	}
+	imageID := ""
+	if img := d.findImage(c.image); img != nil {
+		imageID = "sha256:" + img.id
+	}
+	formatTime := func(t time.Time) string {
+		if t.IsZero() {
+			return "0001-01-01T00:00:00Z"
+		}
+		return t.UTC().Format(time.RFC3339Nano)
+	}
+	// No limit reads as 0
+	memoryLimit := c.memoryLimit
+	if memoryLimit == demoHostMemory {
+		memoryLimit = 0
+	}
+	pid := 0
+	if c.state == "running" {
+		pid = 1000 + int(c.startedAt.Unix()%30000)
+	}
+	return map[string]any{
+		"Id":      c.id,
+		"Name":    "/" + c.name,
+		"Created": formatTime(c.created),
+		"Image":   imageID,
+		"State": map[string]any{
+			"Status":     c.state,
+			"Running":    c.state == "running",
+			"Paused":     false,
+			"Restarting": false,
+			"OOMKilled":  false,
+			"Dead":       false,
+			"Pid":        pid,
+			"ExitCode":   c.exitCode,
+			"StartedAt":  formatTime(c.startedAt),
+			"FinishedAt": formatTime(c.finishedAt),
+		},
+		"Config": map[string]any{
+			"Image":        c.image,
+			"Env":          c.env,
+			"Labels":       c.labels,
+			"ExposedPorts": exposed,
+		},
+		"HostConfig": map[string]any{
+			"PortBindings": bindings,
+			"Memory":       memoryLimit,
+		},
+		"NetworkSettings": map[string]any{
+			"Networks": map[string]any{
+				"bridge": map[string]any{"IPAddress": c.ip, "Gateway": "172.17.0.1"},
+			},
+		},
+	}, nil
+}
+
+func (d *demoDocker) CreateContainer(ctx context.Context, req CreateContainerRequest) (string, error) {
+	if err := d.lock(); err != nil {
+		return "", err
+	}
+	defer d.mu.Unlock()
+	img := d.findImage(req.Image)
+	if img == nil {
+		return "", fmt.Errorf("Error response from daemon: No such image: %s", req.Image)
+	}
+
+	name := req.Name
+	if name == "" {
+		adjectives := []string{"brave", "calm", "eager", "jolly", "quirky", "vibrant"}
+		names := []string{"hopper", "lovelace", "turing", "curie", "ritchie", "thompson"}
+		name = adjectives[rand.IntN(len(adjectives))] + "_" + names[rand.IntN(len(names))]
+	}
+	for _, c := range d.containers {
+		if c.name == name {
+			return "", fmt.Errorf("Error response from daemon: Conflict. The container name \"/%s\" is already in use by container %q. You have to remove (or rename) that container to be able to reuse that name.", name, c.id)
+		}
+	}
+
+	var ports []PortMapping
+	for _, spec := range req.Ports {
+		parts := parsePortSpec(spec)
+		if parts == nil {
+			continue
+		}
+		var private, public uint16
+		fmt.Sscan(parts.ContainerPort, &private)
+		fmt.Sscan(parts.HostPort, &public)
+		ports = append(ports, PortMapping{PrivatePort: private, PublicPort: public, Type: parts.Protocol, IP: "0.0.0.0"})
+	}
+	sort.Slice(ports, func(i, j int) bool { return ports[i].PrivatePort < ports[j].PrivatePort })
+
+	limit := uint64(demoHostMemory)
+	if req.MemoryMB > 0 {
+		limit = uint64(req.MemoryMB) << 20
+	}
+	labels := req.Labels
+	if labels == nil {
+		labels = map[string]string{}
+	}
+	c := &demoContainer{
+		id:          demoID(),
+		name:        name,
+		image:       img.tags[0],
+		state:       "created",
+		created:     time.Now(),
+		ports:       ports,
+		ip:          fmt.Sprintf("172.17.0.%d", len(d.containers)+2),
+		labels:      labels,
+		env:         req.Env,
+		cpuBase:     0.5 + rand.Float64()*4,
+		memoryBase:  min(uint64(20+rand.IntN(100))<<20, limit),
+		memoryLimit: limit,
+		phase:       rand.Float64() * 6,
+	}
+	d.containers = append(d.containers, c)
+	return c.id, nil
+}
+
+func (d *demoDocker) GetSystemUsage(ctx context.Context) (*SystemUsage, error) {
+	if err := d.lock(); err != nil {
+		return nil, err
+	}
+	defer d.mu.Unlock()
+
+	var imagesSize int64
+	for _, img := range d.images {
+		imagesSize += img.size
+	}
+	return &SystemUsage{
+		Containers:     len(d.containers),
+		ContainersSize: int64(len(d.containers)) * 12 << 20,
+		Images:         len(d.images),
+		ImagesSize:     imagesSize,
+		Volumes:        3,
+		VolumesSize:    1536 << 20,
+		Networks:       4,
+	}, nil
+}
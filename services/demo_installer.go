@@ -0,0 +1,266 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// demoInstaller plays the installer jobs step by step without running
+// anything, and installs or removes the simulated Docker and Kubernetes.
+type demoInstaller struct {
+	backends     *demoBackends
+	ctx          context.Context
+	cancel       context.CancelFunc
+	mu           sync.Mutex
+	isInstalling bool
+	currentTask  string
+	progress     int
+	logs         []string
+	docker       bool
+	kubernetes   bool
+}
+
+// demoStep is one step of a job with the output it prints. check, when
+// set, fails the step.
+type demoStep struct {
+	name    string
+	percent int
+	output  []string
+	check   func() error
+}
+
+// demoStepDelay is how long each step of a job takes
+const demoStepDelay = 700 * time.Millisecond
+
+func newDemoInstaller(backends *demoBackends) *demoInstaller {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &demoInstaller{
+		backends:   backends,
+		ctx:        ctx,
+		cancel:     cancel,
+		logs:       make([]string, 0),
+		docker:     true,
+		kubernetes: true,
+	}
+}
+
+func (i *demoInstaller) GetStatus() InstallStatus {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	return InstallStatus{
+		IsInstalling: i.isInstalling,
+		CurrentTask:  i.currentTask,
+		Progress:     i.progress,
+		Logs:         i.logs,
+	}
+}
+
+// log records msg and sends it to progressChan when that is not nil.
+func (i *demoInstaller) log(msg string, progressChan chan<- string) {
+	i.mu.Lock()
+	i.logs = append(i.logs, msg)
+	i.mu.Unlock()
+	if progressChan != nil {
+		progressChan <- msg
+	}
+}
+
+func (i *demoInstaller) Cancel() {
+	i.log("Installation cancelled: the server is shutting down.", nil)
+	i.cancel()
+}
+
+func (i *demoInstaller) WaitIdle(ctx context.Context) bool {
+	ticker := time.NewTicker(200 * time.Millisecond)
+	defer ticker.Stop()
+	for i.GetStatus().IsInstalling {
+		select {
+		case <-ctx.Done():
+			return false
+		case <-ticker.C:
+		}
+	}
+	return true
+}
+
+func (i *demoInstaller) ResetLock() {
+	i.mu.Lock()
+	i.isInstalling = false
+	i.mu.Unlock()
+	i.log("Installation lock force-cleared by user request.", nil)
+}
+
+func (i *demoInstaller) CheckSoftwareStatus() *SoftwareStatus {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	status := &SoftwareStatus{Docker: &SoftwareInfo{}, Kubernetes: &SoftwareInfo{}}
+	if i.docker {
+		status.Docker = &SoftwareInfo{
+			Installed: true,
+			Version:   "Docker version 27.1.1, build 6312585",
+			Running:   i.backends.docker.IsAvailable(context.Background()),
+		}
+	}
+	if i.kubernetes {
+		status.Kubernetes = &SoftwareInfo{
+			Installed: true,
+			Version:   "Client Version: v1.30.2\nKustomize Version: v5.0.4-0.20230601165947-6ce0bf390ce3",
+			Running:   i.backends.kubernetes.IsAvailable(),
+		}
+	}
+	return status
+}
+
+// run plays the steps of a job and calls done when all of them succeeded.
+func (i *demoInstaller) run(steps []demoStep, success string, progressChan chan<- string, done func()) error {
+	i.mu.Lock()
+	if i.isInstalling {
+		i.mu.Unlock()
+		return fmt.Errorf("another installation is in progress")
+	}
+	i.isInstalling = true
+	i.logs = make([]string, 0)
+	i.mu.Unlock()
+
+	defer func() {
+		i.mu.Lock()
+		i.isInstalling = false
+		i.mu.Unlock()
+	}()
+
+	for _, step := range steps {
+		i.mu.Lock()
+		i.currentTask = step.name
+		i.progress = step.percent
+		i.mu.Unlock()
+		i.log(fmt.Sprintf("[%d%%] %s...", step.percent, step.name), progressChan)
+
+		select {
+		case <-i.ctx.Done():
+			i.log("Command failed: signal: killed", progressChan)
+			return i.ctx.Err()
+		case <-time.After(demoStepDelay):
+		}
+		if step.check != nil {
+			if err := step.check(); err != nil {
+				i.log(fmt.Sprintf("Command failed: %v", err), progressChan)
+				return fmt.Errorf("step '%s' failed: %v", step.name, err)
+			}
+		}
+		for _, line := range step.output {
+			i.log(line, progressChan)
+		}
+	}
+
+	done()
+	i.log(success, progressChan)
+	return nil
+}
+
+func (i *demoInstaller) InstallDocker(progressChan chan<- string) error {
+	return i.run([]demoStep{
+		{name: "Updating package index", percent: 10, output: []string{"Hit:1 http://archive.ubuntu.com/ubuntu noble InRelease", "Reading package lists..."}},
+		{name: "Installing prerequisites", percent: 20, output: []string{"ca-certificates is already the newest version (20240203).", "curl is already the newest version (8.5.0-2ubuntu10.1)."}},
+		{name: "Adding Docker GPG key", percent: 30},
+		{name: "Adding Docker repository", percent: 40},
+		{name: "Updating package index", percent: 50, output: []string{"Get:1 https://download.docker.com/linux/ubuntu noble InRelease [48.8 kB]", "Reading package lists..."}},
+		{name: "Installing Docker Engine", percent: 80, output: []string{"Setting up containerd.io (1.7.19-1) ...", "Setting up docker-ce-cli (5:27.1.1-1~ubuntu.24.04~noble) ...", "Setting up docker-ce (5:27.1.1-1~ubuntu.24.04~noble) ..."}},
+		{name: "Starting Docker service", percent: 90},
+		{name: "Enabling Docker service", percent: 100, output: []string{"Synchronizing state of docker.service with SysV service script with /usr/lib/systemd/systemd-sysv-install."}},
+	}, "Installation completed successfully!", progressChan, func() {
+		i.setInstalled(&i.docker, true)
+		i.backends.docker.setRunning(true)
+	})
+}
+
+func (i *demoInstaller) InstallKubernetes(progressChan chan<- string) error {
+	return i.run([]demoStep{
+		{name: "Installing system dependencies", percent: 10, output: []string{"Dependencies installed successfully."}},
+		{name: "Downloading Kubernetes binaries", percent: 30, output: []string{"Downloading crictl...", "Downloading kubeadm...", "Downloading kubelet...", "Downloading kubectl...", "Binaries downloaded and installed to /usr/local/bin"}},
+		{name: "Configuring kubelet service", percent: 80, output: []string{"Setting up systemd service for kubelet..."}},
+	}, "Installation check complete. You can now use the 'Setup Cluster' button.", progressChan, func() {
+		i.setInstalled(&i.kubernetes, true)
+	})
+}
+
+func (i *demoInstaller) UninstallDocker(progressChan chan<- string) error {
+	return i.run([]demoStep{
+		{name: "Stopping Docker service", percent: 20},
+		{name: "Removing Docker packages", percent: 60, output: []string{"Removing docker-ce (5:27.1.1-1~ubuntu.24.04~noble) ...", "Removing containerd.io (1.7.19-1) ..."}},
+		{name: "Refreshing apt", percent: 70},
+		{name: "Removing Docker data", percent: 80},
+		{name: "Removing Docker config", percent: 100},
+	}, "Docker uninstalled successfully!", progressChan, func() {
+		i.setInstalled(&i.docker, false)
+		i.backends.docker.setRunning(false)
+	})
+}
+
+func (i *demoInstaller) UninstallKubernetes(progressChan chan<- string) error {
+	return i.run([]demoStep{
+		{name: "Stopping kubelet", percent: 10},
+		{name: "Removing Kubernetes packages", percent: 50},
+		{name: "Refreshing apt", percent: 60},
+		{name: "Removing configs", percent: 80},
+		{name: "Cleaning CNI", percent: 90},
+		{name: "Cleaning containerd config", percent: 95},
+	}, "Kubernetes uninstalled successfully!", progressChan, func() {
+		i.setInstalled(&i.kubernetes, false)
+		i.backends.kubernetes.setRunning(false)
+	})
+}
+
+func (i *demoInstaller) SetupKubernetes(progressChan chan<- string) error {
+	requireKubeadm := func() error {
+		i.mu.Lock()
+		defer i.mu.Unlock()
+		if !i.kubernetes {
+			return fmt.Errorf(`exec: "kubeadm": executable file not found in $PATH`)
+		}
+		return nil
+	}
+	return i.run([]demoStep{
+		{name: "Installing crictl", percent: 2},
+		{name: "Generating containerd config", percent: 5},
+		{name: "Enabling SystemdCgroup for containerd", percent: 7},
+		{name: "Restarting containerd", percent: 9},
+		{name: "Disabling Swap", percent: 12},
+		{name: "Resetting previous state (ignore errors)", percent: 15},
+		{name: "Initializing Cluster (this may take a minute)", percent: 20, check: requireKubeadm, output: []string{"[init] Using Kubernetes version: v1.30.2", "[preflight] Running pre-flight checks", "[certs] Using certificateDir folder \"/etc/kubernetes/pki\"", "[control-plane] Creating static Pod manifest for \"kube-apiserver\"", "Your Kubernetes control-plane has initialized successfully!"}},
+		{name: "Configuring kubeconfig", percent: 40},
+		{name: "Installing Flannel CNI", percent: 60, output: []string{"namespace/kube-flannel created", "daemonset.apps/kube-flannel-ds created"}},
+		{name: "Untainting control-plane node", percent: 80, output: []string{"node/demo-node-01 untainted"}},
+	}, "Kubernetes Cluster initialized successfully! You can now use kubectl.", progressChan, func() {
+		i.backends.kubernetes.setRunning(true)
+	})
+}
+
+func (i *demoInstaller) setInstalled(flag *bool, installed bool) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+	*flag = installed
+}
+
+// RestartService restarts the simulated service, which restarts the
+// running containers when it is Docker.
+func (i *demoInstaller) RestartService(serviceName string) error {
+	i.mu.Lock()
+	installed := i.docker
+	if serviceName == "kubelet" {
+		installed = i.kubernetes
+	}
+	i.mu.Unlock()
+	if !installed {
+		return fmt.Errorf("failed to restart %s: Failed to restart %s.service: Unit %s.service not found.\n (exit status 5)", serviceName, serviceName, serviceName)
+	}
+
+	time.Sleep(time.Second)
+	if serviceName == "docker" {
+		i.backends.docker.restartDaemon()
+	}
+	return nil
+}
@@ -0,0 +1,502 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"strings"
+	"sync"
+	"time"
+)
+
+var errDemoKubernetesDown = errors.New(`Get "https://10.0.0.10:6443/version": dial tcp 10.0.0.10:6443: connect: connection refused`)
+
+// demoKubernetes is a small three node cluster kept in memory. Pods belong
+// to deployments, which replace them when they are deleted, scaled or
+// restarted. Some pods crash now and then and are restarted.
+type demoKubernetes struct {
+	mu          sync.Mutex
+	running     bool
+	started     time.Time
+	namespaces  []NamespaceInfo
+	deployments []*demoDeployment
+	pods        []*demoPod
+	services    []ServiceInfo
+}
+
+type demoDeployment struct {
+	namespace string
+	name      string
+	image     string
+	port      int32
+	replicas  int32
+	created   time.Time
+	// hash names the current pod template, as the ReplicaSet hash does
+	hash string
+	// crashEvery, when set, makes every pod crash at that interval
+	crashEvery time.Duration
+}
+
+type demoPod struct {
+	namespace  string
+	name       string
+	deployment *demoDeployment
+	image      string
+	port       int32
+	ip         string
+	node       string
+	created    time.Time
+	crashEvery time.Duration
+	labels     map[string]string
+	// retireAt, when set, is when the pod goes away after a rollout
+	retireAt time.Time
+}
+
+// Pods take a moment to be scheduled and to pass their readiness probe
+const (
+	demoPodPending  = 3 * time.Second
+	demoPodStarting = 6 * time.Second
+	demoPodBackOff  = 20 * time.Second
+)
+
+var demoNodes = []string{"demo-node-01", "demo-node-02", "demo-node-03"}
+
+func newDemoKubernetes(now time.Time) *demoKubernetes {
+	k := &demoKubernetes{running: true, started: now}
+	for _, ns := range []struct {
+		name string
+		age  time.Duration
+	}{
+		{"default", 90 * 24 * time.Hour},
+		{"kube-system", 90 * 24 * time.Hour},
+		{"monitoring", 41 * 24 * time.Hour},
+		{"shop", 12 * 24 * time.Hour},
+	} {
+		k.namespaces = append(k.namespaces, NamespaceInfo{Name: ns.name, Status: "Active", Age: formatDuration(now.Add(-ns.age))})
+	}
+
+	for _, dep := range []demoDeployment{
+		{namespace: "kube-system", name: "coredns", image: "registry.k8s.io/coredns/coredns:v1.11.1", port: 53, replicas: 2},
+		{namespace: "monitoring", name: "prometheus", image: "prom/prometheus:v2.53.0", port: 9090, replicas: 1},
+		{namespace: "monitoring", name: "grafana", image: "grafana/grafana:11.1.0", port: 3000, replicas: 1},
+		{namespace: "shop", name: "frontend", image: "nginx:1.27-alpine", port: 80, replicas: 3},
+		{namespace: "shop", name: "api", image: "ghcr.io/acme/shop-api:2.4.1", port: 3000, replicas: 2},
+		{namespace: "shop", name: "worker", image: "ghcr.io/acme/shop-worker:2.4.1", port: 8080, replicas: 1, crashEvery: 7 * time.Minute},
+		{namespace: "default", name: "hello", image: "nginxdemos/hello:plain-text", port: 80, replicas: 1},
+	} {
+		d := dep
+		d.created = now.Add(-time.Duration(2+rand.IntN(9)) * 24 * time.Hour)
+		d.hash = demoSuffix(10)
+		k.deployments = append(k.deployments, &d)
+		for range d.replicas {
+			pod := k.newPod(&d, d.created.Add(time.Duration(rand.IntN(72))*time.Hour))
+			// The crashing pod has been at it for a while
+			if d.crashEvery > 0 {
+				pod.created = now.Add(-13*d.crashEvery - time.Minute)
+			}
+		}
+	}
+
+	// Static pods of the control plane have no deployment
+	for _, name := range []string{"etcd", "kube-apiserver", "kube-controller-manager", "kube-scheduler"} {
+		k.pods = append(k.pods, &demoPod{
+			namespace: "kube-system",
+			name:      name + "-" + demoNodes[0],
+			image:     "registry.k8s.io/" + name + ":v1.30.2",
+			ip:        "10.0.0.10",
+			node:      demoNodes[0],
+			created:   now.Add(-90 * 24 * time.Hour),
+			labels:    map[string]string{"component": name, "tier": "control-plane"},
+		})
+	}
+
+	k.services = []ServiceInfo{
+		{Name: "kubernetes", Namespace: "default", Type: "ClusterIP", ClusterIP: "10.96.0.1", ExternalIP: "<none>", Ports: "443/TCP", Labels: map[string]string{"component": "apiserver"}},
+		{Name: "hello", Namespace: "default", Type: "ClusterIP", ClusterIP: "10.96.41.7", ExternalIP: "<none>", Ports: "80/TCP", Labels: map[string]string{"app": "hello"}},
+		{Name: "kube-dns", Namespace: "kube-system", Type: "ClusterIP", ClusterIP: "10.96.0.10", ExternalIP: "<none>", Ports: "53/UDP,53/TCP,9153/TCP", Labels: map[string]string{"k8s-app": "kube-dns"}},
+		{Name: "prometheus", Namespace: "monitoring", Type: "ClusterIP", ClusterIP: "10.96.120.33", ExternalIP: "<none>", Ports: "9090/TCP", Labels: map[string]string{"app": "prometheus"}},
+		{Name: "grafana", Namespace: "monitoring", Type: "NodePort", ClusterIP: "10.96.87.140", ExternalIP: "<none>", Ports: "3000:30300/TCP", Labels: map[string]string{"app": "grafana"}},
+		{Name: "frontend", Namespace: "shop", Type: "LoadBalancer", ClusterIP: "10.96.200.12", ExternalIP: "203.0.113.10", Ports: "80:31080/TCP", Labels: map[string]string{"app": "frontend"}},
+		{Name: "api", Namespace: "shop", Type: "ClusterIP", ClusterIP: "10.96.15.201", ExternalIP: "<none>", Ports: "3000/TCP", Labels: map[string]string{"app": "api"}},
+	}
+	for i := range k.services {
+		k.services[i].Age = formatDuration(now.Add(-time.Duration(3+i*4) * 24 * time.Hour))
+	}
+	return k
+}
+
+// newPod schedules a pod of the deployment on a random node. k.mu must be
+// held.
+func (k *demoKubernetes) newPod(d *demoDeployment, created time.Time) *demoPod {
+	node := rand.IntN(len(demoNodes))
+	pod := &demoPod{
+		namespace:  d.namespace,
+		name:       d.name + "-" + d.hash + "-" + demoSuffix(5),
+		deployment: d,
+		image:      d.image,
+		port:       d.port,
+		ip:         fmt.Sprintf("10.244.%d.%d", node, 2+rand.IntN(250)),
+		node:       demoNodes[node],
+		created:    created,
+		crashEvery: d.crashEvery,
+		labels:     map[string]string{"app": d.name, "pod-template-hash": d.hash},
+	}
+	k.pods = append(k.pods, pod)
+	return pod
+}
+
+// removePod deletes the pod. k.mu must be held.
+func (k *demoKubernetes) removePod(p *demoPod) {
+	for i := range k.pods {
+		if k.pods[i] == p {
+			k.pods = append(k.pods[:i], k.pods[i+1:]...)
+			return
+		}
+	}
+}
+
+// prune removes the pods replaced by a rollout once their successors are
+// ready. k.mu must be held.
+func (k *demoKubernetes) prune(now time.Time) {
+	pods := k.pods[:0]
+	for _, p := range k.pods {
+		if p.retireAt.IsZero() || now.Before(p.retireAt) {
+			pods = append(pods, p)
+		}
+	}
+	k.pods = pods
+}
+
+// podsOf returns the current pods of the deployment, not counting those
+// being retired. k.mu must be held.
+func (k *demoKubernetes) podsOf(d *demoDeployment) []*demoPod {
+	var pods []*demoPod
+	for _, p := range k.pods {
+		if p.deployment == d && p.retireAt.IsZero() {
+			pods = append(pods, p)
+		}
+	}
+	return pods
+}
+
+func (k *demoKubernetes) findDeployment(namespace, name string) (*demoDeployment, error) {
+	for _, d := range k.deployments {
+		if d.namespace == namespace && d.name == name {
+			return d, nil
+		}
+	}
+	return nil, fmt.Errorf("deployments.apps %q not found", name)
+}
+
+func (k *demoKubernetes) findPod(namespace, name string) (*demoPod, error) {
+	for _, p := range k.pods {
+		if p.namespace == namespace && p.name == name {
+			return p, nil
+		}
+	}
+	return nil, fmt.Errorf("pods %q not found", name)
+}
+
+// state returns the phase of the pod, whether it is ready and how often it
+// restarted, as of now.
+func (p *demoPod) state(now time.Time) (phase string, ready bool, restarts int32) {
+	age := now.Sub(p.created)
+	if age < demoPodPending {
+		return "Pending", false, 0
+	}
+	if p.crashEvery > 0 {
+		restarts = int32((age - demoPodPending) / p.crashEvery)
+		if restarts > 0 && (age-demoPodPending)%p.crashEvery < demoPodBackOff {
+			return "Running", false, restarts
+		}
+	}
+	return "Running", age >= demoPodStarting, restarts
+}
+
+// setRunning starts or stops the API server, as installing or uninstalling
+// Kubernetes does.
+func (k *demoKubernetes) setRunning(running bool) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	k.running = running
+}
+
+// lock locks k and removes the retired pods. It fails while the API
+// server is down.
+func (k *demoKubernetes) lock() error {
+	k.mu.Lock()
+	if !k.running {
+		k.mu.Unlock()
+		return errDemoKubernetesDown
+	}
+	k.prune(time.Now())
+	return nil
+}
+
+func (k *demoKubernetes) IsAvailable() bool {
+	return k.Ping(context.Background()) == nil
+}
+
+func (k *demoKubernetes) Ping(ctx context.Context) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if !k.running {
+		return errDemoKubernetesDown
+	}
+	return nil
+}
+
+func (k *demoKubernetes) ClientCertExpiry() (time.Time, bool) {
+	return k.started.Add(287 * 24 * time.Hour), true
+}
+
+func (k *demoKubernetes) ListNamespaces(ctx context.Context) ([]NamespaceInfo, error) {
+	if err := k.lock(); err != nil {
+		return nil, err
+	}
+	defer k.mu.Unlock()
+	return append([]NamespaceInfo(nil), k.namespaces...), nil
+}
+
+func (k *demoKubernetes) ListPods(ctx context.Context, namespace string) ([]PodInfo, error) {
+	if err := k.lock(); err != nil {
+		return nil, err
+	}
+	defer k.mu.Unlock()
+	if namespace == "" {
+		namespace = "default"
+	}
+
+	result := make([]PodInfo, 0)
+	now := time.Now()
+	for _, p := range k.pods {
+		if p.namespace != namespace {
+			continue
+		}
+		phase, ready, restarts := p.state(now)
+		readyCount, ip := 0, p.ip
+		if ready {
+			readyCount = 1
+		}
+		if phase == "Pending" {
+			ip = ""
+		}
+		result = append(result, PodInfo{
+			Name:      p.name,
+			Namespace: p.namespace,
+			Status:    phase,
+			Ready:     fmt.Sprintf("%d/1", readyCount),
+			Restarts:  restarts,
+			Age:       formatDuration(p.created),
+			IP:        ip,
+			Node:      p.node,
+			Ports:     fmt.Sprintf("%d/TCP", p.port),
+			Labels:    p.labels,
+		})
+	}
+	return result, nil
+}
+
+func (k *demoKubernetes) ListDeployments(ctx context.Context, namespace string) ([]DeploymentInfo, error) {
+	if err := k.lock(); err != nil {
+		return nil, err
+	}
+	defer k.mu.Unlock()
+	if namespace == "" {
+		namespace = "default"
+	}
+
+	result := make([]DeploymentInfo, 0)
+	now := time.Now()
+	for _, d := range k.deployments {
+		if d.namespace != namespace {
+			continue
+		}
+		// Pods being retired still serve and count as ready
+		var ready, upToDate int32
+		for _, p := range k.pods {
+			if p.deployment != d {
+				continue
+			}
+			if _, ok, _ := p.state(now); ok {
+				ready++
+			}
+			if p.labels["pod-template-hash"] == d.hash {
+				upToDate++
+			}
+		}
+		result = append(result, DeploymentInfo{
+			Name:      d.name,
+			Namespace: d.namespace,
+			Ready:     fmt.Sprintf("%d/%d", ready, d.replicas),
+			UpToDate:  upToDate,
+			Available: ready,
+			Age:       formatDuration(d.created),
+			Labels:    map[string]string{"app": d.name},
+		})
+	}
+	return result, nil
+}
+
+func (k *demoKubernetes) ListServices(ctx context.Context, namespace string) ([]ServiceInfo, error) {
+	if err := k.lock(); err != nil {
+		return nil, err
+	}
+	defer k.mu.Unlock()
+	if namespace == "" {
+		namespace = "default"
+	}
+
+	result := make([]ServiceInfo, 0)
+	for _, s := range k.services {
+		if s.Namespace == namespace {
+			result = append(result, s)
+		}
+	}
+	return result, nil
+}
+
+func (k *demoKubernetes) GetPodLogs(ctx context.Context, namespace, podName, container string, tailLines int64) (string, error) {
+	if err := k.lock(); err != nil {
+		return "", err
+	}
+	defer k.mu.Unlock()
+	p, err := k.findPod(namespace, podName)
+	if err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	phase, _, restarts := p.state(now)
+	if phase == "Pending" {
+		return "", fmt.Errorf("container %q in pod %q is waiting to start: ContainerCreating", p.labels["app"], p.name)
+	}
+	// Logs start over with every restart
+	since := p.created.Add(demoPodPending)
+	if restarts > 0 {
+		since = since.Add(time.Duration(restarts) * p.crashEvery)
+	}
+	if tailLines <= 0 || tailLines > 500 {
+		tailLines = 500
+	}
+
+	var lines []string
+	for t := now; !t.Before(since) && int64(len(lines)) < tailLines; t = t.Add(-15 * time.Second) {
+		lines = append(lines, demoLogLine(p.image, t))
+	}
+	for i, j := 0, len(lines)-1; i < j; i, j = i+1, j-1 {
+		lines[i], lines[j] = lines[j], lines[i]
+	}
+	if len(lines) == 0 {
+		return "", nil
+	}
+	return strings.Join(lines, "\n") + "\n", nil
+}
+
+func (k *demoKubernetes) ScaleDeployment(ctx context.Context, namespace, deploymentName string, replicas int32) error {
+	if err := k.lock(); err != nil {
+		return err
+	}
+	defer k.mu.Unlock()
+	d, err := k.findDeployment(namespace, deploymentName)
+	if err != nil {
+		return err
+	}
+	if replicas < 0 {
+		return fmt.Errorf("Deployment.apps %q is invalid: spec.replicas: Invalid value: %d: must be greater than or equal to 0", deploymentName, replicas)
+	}
+
+	d.replicas = replicas
+	pods := k.podsOf(d)
+	now := time.Now()
+	for i := int32(len(pods)); i < replicas; i++ {
+		k.newPod(d, now)
+	}
+	// The newest pods go first, as the ReplicaSet controller does
+	for i := len(pods) - 1; i >= int(replicas); i-- {
+		k.removePod(pods[i])
+	}
+	return nil
+}
+
+// RestartDeployment rolls all pods over to a new template hash. The old
+// pods keep serving until the new ones are ready.
+func (k *demoKubernetes) RestartDeployment(ctx context.Context, namespace, deploymentName string) error {
+	if err := k.lock(); err != nil {
+		return err
+	}
+	defer k.mu.Unlock()
+	d, err := k.findDeployment(namespace, deploymentName)
+	if err != nil {
+		return err
+	}
+
+	old := k.podsOf(d)
+	d.hash = demoSuffix(10)
+	now := time.Now()
+	for range d.replicas {
+		k.newPod(d, now)
+	}
+	for _, p := range old {
+		p.retireAt = now.Add(demoPodStarting)
+	}
+	return nil
+}
+
+// DeletePod deletes the pod; the deployment owning it starts a new one.
+func (k *demoKubernetes) DeletePod(ctx context.Context, namespace, podName string) error {
+	if err := k.lock(); err != nil {
+		return err
+	}
+	defer k.mu.Unlock()
+	p, err := k.findPod(namespace, podName)
+	if err != nil {
+		return err
+	}
+	k.removePod(p)
+	if p.deployment != nil {
+		k.newPod(p.deployment, time.Now())
+	}
+	return nil
+}
+
+func (k *demoKubernetes) GetClusterStats(ctx context.Context, namespace string) (*ClusterStats, error) {
+	if err := k.lock(); err != nil {
+		return nil, err
+	}
+	defer k.mu.Unlock()
+	if namespace == "all" {
+		namespace = ""
+	}
+	inNamespace := func(ns string) bool { return namespace == "" || ns == namespace }
+
+	stats := &ClusterStats{
+		Nodes:          len(demoNodes),
+		NodesReady:     len(demoNodes),
+		CPUCapacity:    fmt.Sprintf("%d Cores", len(demoNodes)*demoHostCores),
+		MemoryCapacity: formatBytes(int64(len(demoNodes)) * demoHostMemory),
+		Version:        "v1.30.2",
+	}
+	now := time.Now()
+	for _, p := range k.pods {
+		if !inNamespace(p.namespace) {
+			continue
+		}
+		stats.Pods++
+		if phase, _, _ := p.state(now); phase == "Running" {
+			stats.PodsRunning++
+		}
+	}
+	for _, d := range k.deployments {
+		if inNamespace(d.namespace) {
+			stats.Deployments++
+		}
+	}
+	for _, s := range k.services {
+		if inNamespace(s.Namespace) {
+			stats.Services++
+		}
+	}
+	return stats, nil
+}
@@ -0,0 +1,164 @@
+package services
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+)
+
+// demoWireGuard keeps the config in memory and pretends to bring the
+// interface up. Traffic flows while it is connected.
+type demoWireGuard struct {
+	mu          sync.Mutex
+	config      string
+	publicKey   string
+	active      bool
+	connectedAt time.Time
+	// Bytes of earlier connections
+	rx, tx uint64
+}
+
+func newDemoWireGuard() *demoWireGuard {
+	return &demoWireGuard{
+		publicKey: demoWireGuardKey(),
+		config: `[Interface]
+PrivateKey = ` + demoWireGuardKey() + `
+Address = 10.8.0.2/24
+DNS = 1.1.1.1
+
+[Peer]
+PublicKey = ` + demoWireGuardKey() + `
+Endpoint = vpn.example.com:51820
+AllowedIPs = 10.8.0.0/24
+PersistentKeepalive = 25
+`,
+	}
+}
+
+func demoWireGuardKey() string {
+	key := make([]byte, 32)
+	rand.Read(key)
+	return base64.StdEncoding.EncodeToString(key)
+}
+
+// configValue returns the first value of key in the config. w.mu must be
+// held.
+func (w *demoWireGuard) configValue(key string) string {
+	for _, line := range strings.Split(w.config, "\n") {
+		name, value, ok := strings.Cut(line, "=")
+		if ok && strings.EqualFold(strings.TrimSpace(name), key) {
+			return strings.TrimSpace(value)
+		}
+	}
+	return ""
+}
+
+// traffic returns the bytes received and sent so far. w.mu must be held.
+func (w *demoWireGuard) traffic(now time.Time) (rx, tx uint64) {
+	rx, tx = w.rx, w.tx
+	if w.active {
+		seconds := now.Sub(w.connectedAt).Seconds()
+		rx += uint64(seconds * 18_000)
+		tx += uint64(seconds * 4_500)
+	}
+	return rx, tx
+}
+
+func (w *demoWireGuard) InterfaceName() string {
+	return "wg0"
+}
+
+func (w *demoWireGuard) Usable() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.config == "" {
+		return errors.New("no WireGuard config saved")
+	}
+	return nil
+}
+
+func (w *demoWireGuard) SaveConfig(content string) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if !strings.Contains(content, "[Interface]") {
+		return fmt.Errorf("invalid config: missing [Interface] section")
+	}
+	w.config = content
+	return nil
+}
+
+func (w *demoWireGuard) GetConfig() (string, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.config, nil
+}
+
+func (w *demoWireGuard) Connect() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.config == "" {
+		return fmt.Errorf("failed to connect: wg-quick: `wg0' does not exist (exit status 1)")
+	}
+	if !w.active {
+		w.active = true
+		w.connectedAt = time.Now()
+	}
+	return nil
+}
+
+func (w *demoWireGuard) Disconnect() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.active {
+		w.rx, w.tx = w.traffic(time.Now())
+		w.active = false
+	}
+	return nil
+}
+
+func (w *demoWireGuard) GetStatus() (*WireGuardStatus, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	status := &WireGuardStatus{Interface: "wg0", IsActive: w.active}
+	if !w.active {
+		return status, nil
+	}
+	now := time.Now()
+	rx, tx := w.traffic(now)
+	status.IP = w.configValue("Address")
+	status.PublicKey = w.publicKey
+	status.Endpoint = w.configValue("Endpoint")
+	// The keepalive renews the handshake every two minutes
+	status.LastHandshake = fmt.Sprintf("%d seconds ago", int(now.Sub(w.connectedAt).Seconds())%120)
+	status.RxBytes = demoWireGuardBytes(rx)
+	status.TxBytes = demoWireGuardBytes(tx)
+	return status, nil
+}
+
+// demoWireGuardBytes formats a byte count the way wg show does.
+func demoWireGuardBytes(n uint64) string {
+	switch {
+	case n >= 1<<30:
+		return fmt.Sprintf("%.2f GiB", float64(n)/(1<<30))
+	case n >= 1<<20:
+		return fmt.Sprintf("%.2f MiB", float64(n)/(1<<20))
+	case n >= 1<<10:
+		return fmt.Sprintf("%.2f KiB", float64(n)/(1<<10))
+	}
+	return fmt.Sprintf("%d B", n)
+}
+
+func (w *demoWireGuard) Transfer() ([]WireGuardPeerTransfer, bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if !w.active {
+		return nil, false
+	}
+	rx, tx := w.traffic(time.Now())
+	return []WireGuardPeerTransfer{{PublicKey: w.configValue("PublicKey"), RxBytes: rx, TxBytes: tx}}, true
+}
@@ -4,16 +4,41 @@ import (
 	"context"
 	"encoding/json"
 	"io"
+	"log/slog"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/docker/docker/api/types"
 	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/filters"
 	"github.com/docker/docker/client"
 	"github.com/docker/go-connections/nat"
 )
 
-type DockerService struct {
+// DockerService manages the containers and images of a Docker daemon, or
+// of the simulated one in demo mode.
+type DockerService interface {
+	IsAvailable(ctx context.Context) bool
+	Ping(ctx context.Context) error
+	ListContainers(ctx context.Context, all bool, labels map[string]string) ([]ContainerInfo, error)
+	GetContainerStats(ctx context.Context, containerID string) (*ContainerStats, error)
+	StartContainer(ctx context.Context, containerID string) error
+	StopContainer(ctx context.Context, containerID string) error
+	RestartContainer(ctx context.Context, containerID string) error
+	RemoveContainer(ctx context.Context, containerID string, force bool) error
+	GetContainerLogs(ctx context.Context, containerID string, tail string) (string, error)
+	ListImages(ctx context.Context) ([]ImageInfo, error)
+	PullImage(ctx context.Context, imageName string) (io.ReadCloser, error)
+	RemoveImage(ctx context.Context, imageID string, force bool) error
+	ContainerLabels(ctx context.Context, containerID string) (map[string]string, error)
+	InspectContainer(ctx context.Context, containerID string) (interface{}, error)
+	CreateContainer(ctx context.Context, req CreateContainerRequest) (string, error)
+	GetSystemUsage(ctx context.Context) (*SystemUsage, error)
+}
+
+// dockerClient talks to the daemon at DockerHost.
+type dockerClient struct {
 	client *client.Client
 }
 
@@ -65,6 +90,8 @@ type CreateContainerRequest struct {
 	Env      []string `json:"env"`
 	MemoryMB int64    `json:"memory_mb"`
 	CPUCores float64  `json:"cpu_cores"`
+
+	Labels map[string]string `json:"labels"`
 }
 
 type SystemUsage struct {
@@ -77,38 +104,74 @@ type SystemUsage struct {
 	Networks       int   `json:"networks"`
 }
 
-var dockerService *DockerService
+var (
+	dockerService   *dockerClient
+	dockerServiceMu sync.Mutex
+)
+
+func GetDockerService() (DockerService, error) {
+	if demo != nil {
+		return demo.docker, nil
+	}
+
+	dockerServiceMu.Lock()
+	defer dockerServiceMu.Unlock()
 
-func GetDockerService() (*DockerService, error) {
 	if dockerService != nil {
 		return dockerService, nil
 	}
 
-	cli, err := client.NewClientWithOpts(client.FromEnv, client.WithAPIVersionNegotiation())
+	opts := []client.Opt{client.FromEnv, client.WithAPIVersionNegotiation()}
+	if host := DockerHost(); host != "" {
+		opts = append(opts, client.WithHost(host))
+	}
+	cli, err := client.NewClientWithOpts(opts...)
 	if err != nil {
 		return nil, err
 	}
 
-	dockerService = &DockerService{client: cli}
+	dockerService = &dockerClient{client: cli}
 	return dockerService, nil
 }
 
-func (d *DockerService) IsAvailable() bool {
-	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+// ResetDockerService drops the client so the next call connects to the
+// currently configured Docker host.
+func ResetDockerService() {
+	dockerServiceMu.Lock()
+	defer dockerServiceMu.Unlock()
+
+	if dockerService != nil {
+		dockerService.client.Close()
+		dockerService = nil
+	}
+}
+
+func (d *dockerClient) IsAvailable(ctx context.Context) bool {
+	ctx, cancel := context.WithTimeout(ctx, 5*time.Second)
 	defer cancel()
 
+	return d.Ping(ctx) == nil
+}
+
+// Ping checks that the daemon answers.
+func (d *dockerClient) Ping(ctx context.Context) error {
 	_, err := d.client.Ping(ctx)
-	return err == nil
+	return err
 }
 
-func (d *DockerService) ListContainers(all bool) ([]ContainerInfo, error) {
-	ctx := context.Background()
-	containers, err := d.client.ContainerList(ctx, types.ContainerListOptions{All: all})
+// ListContainers lists containers carrying all of the given labels; nil
+// labels list every container.
+func (d *dockerClient) ListContainers(ctx context.Context, all bool, labels map[string]string) ([]ContainerInfo, error) {
+	args := filters.NewArgs()
+	for k, v := range labels {
+		args.Add("label", k+"="+v)
+	}
+	containers, err := d.client.ContainerList(ctx, types.ContainerListOptions{All: all, Filters: args})
 	if err != nil {
 		return nil, err
 	}
 
-	var result []ContainerInfo
+	result := make([]ContainerInfo, 0)
 	for _, c := range containers {
 		name := ""
 		if len(c.Names) > 0 {
@@ -168,8 +231,7 @@ func getNetworkNames(settings *types.SummaryNetworkSettings) []string {
 	return networks
 }
 
-func (d *DockerService) GetContainerStats(containerID string) (*ContainerStats, error) {
-	ctx := context.Background()
+func (d *dockerClient) GetContainerStats(ctx context.Context, containerID string) (*ContainerStats, error) {
 	stats, err := d.client.ContainerStats(ctx, containerID, false)
 	if err != nil {
 		return nil, err
@@ -242,30 +304,29 @@ func (d *DockerService) GetContainerStats(containerID string) (*ContainerStats,
 	}, nil
 }
 
-func (d *DockerService) StartContainer(containerID string) error {
-	ctx := context.Background()
+func (d *dockerClient) StartContainer(ctx context.Context, containerID string) error {
+	slog.DebugContext(ctx, "Starting container", "container", containerID)
 	return d.client.ContainerStart(ctx, containerID, types.ContainerStartOptions{})
 }
 
-func (d *DockerService) StopContainer(containerID string) error {
-	ctx := context.Background()
+func (d *dockerClient) StopContainer(ctx context.Context, containerID string) error {
+	slog.DebugContext(ctx, "Stopping container", "container", containerID)
 	timeout := 10
 	return d.client.ContainerStop(ctx, containerID, container.StopOptions{Timeout: &timeout})
 }
 
-func (d *DockerService) RestartContainer(containerID string) error {
-	ctx := context.Background()
+func (d *dockerClient) RestartContainer(ctx context.Context, containerID string) error {
+	slog.DebugContext(ctx, "Restarting container", "container", containerID)
 	timeout := 10
 	return d.client.ContainerRestart(ctx, containerID, container.StopOptions{Timeout: &timeout})
 }
 
-func (d *DockerService) RemoveContainer(containerID string, force bool) error {
-	ctx := context.Background()
+func (d *dockerClient) RemoveContainer(ctx context.Context, containerID string, force bool) error {
+	slog.DebugContext(ctx, "Removing container", "container", containerID, "force", force)
 	return d.client.ContainerRemove(ctx, containerID, types.ContainerRemoveOptions{Force: force})
 }
 
-func (d *DockerService) GetContainerLogs(containerID string, tail string) (string, error) {
-	ctx := context.Background()
+func (d *dockerClient) GetContainerLogs(ctx context.Context, containerID string, tail string) (string, error) {
 	options := types.ContainerLogsOptions{
 		ShowStdout: true,
 		ShowStderr: true,
@@ -287,14 +348,13 @@ func (d *DockerService) GetContainerLogs(containerID string, tail string) (strin
 	return string(content), nil
 }
 
-func (d *DockerService) ListImages() ([]ImageInfo, error) {
-	ctx := context.Background()
+func (d *dockerClient) ListImages(ctx context.Context) ([]ImageInfo, error) {
 	images, err := d.client.ImageList(ctx, types.ImageListOptions{})
 	if err != nil {
 		return nil, err
 	}
 
-	var result []ImageInfo
+	result := make([]ImageInfo, 0)
 	for _, img := range images {
 		result = append(result, ImageInfo{
 			ID:       img.ID[7:19],
@@ -307,24 +367,35 @@ func (d *DockerService) ListImages() ([]ImageInfo, error) {
 	return result, nil
 }
 
-func (d *DockerService) PullImage(imageName string) (io.ReadCloser, error) {
-	ctx := context.Background()
+func (d *dockerClient) PullImage(ctx context.Context, imageName string) (io.ReadCloser, error) {
+	slog.DebugContext(ctx, "Pulling image", "image", imageName)
 	return d.client.ImagePull(ctx, imageName, types.ImagePullOptions{})
 }
 
-func (d *DockerService) RemoveImage(imageID string, force bool) error {
-	ctx := context.Background()
+func (d *dockerClient) RemoveImage(ctx context.Context, imageID string, force bool) error {
+	slog.DebugContext(ctx, "Removing image", "image", imageID, "force", force)
 	_, err := d.client.ImageRemove(ctx, imageID, types.ImageRemoveOptions{Force: force})
 	return err
 }
 
-func (d *DockerService) InspectContainer(containerID string) (interface{}, error) {
-	ctx := context.Background()
+// ContainerLabels returns the labels of a container.
+func (d *dockerClient) ContainerLabels(ctx context.Context, containerID string) (map[string]string, error) {
+	info, err := d.client.ContainerInspect(ctx, containerID)
+	if err != nil {
+		return nil, err
+	}
+	if info.Config == nil {
+		return map[string]string{}, nil
+	}
+	return info.Config.Labels, nil
+}
+
+func (d *dockerClient) InspectContainer(ctx context.Context, containerID string) (interface{}, error) {
 	return d.client.ContainerInspect(ctx, containerID)
 }
 
-func (d *DockerService) CreateContainer(req CreateContainerRequest) (string, error) {
-	ctx := context.Background()
+func (d *dockerClient) CreateContainer(ctx context.Context, req CreateContainerRequest) (string, error) {
+	slog.DebugContext(ctx, "Creating container", "name", req.Name, "image", req.Image)
 
 	// Parse Ports
 	exposedPorts := make(map[string]struct{})                            // nat.PortSet
@@ -345,6 +416,7 @@ func (d *DockerService) CreateContainer(req CreateContainerRequest) (string, err
 	config := &container.Config{
 		Image:        req.Image,
 		Env:          req.Env,
+		Labels:       req.Labels,
 		ExposedPorts: make(nat.PortSet),
 	}
 	for k := range exposedPorts {
@@ -408,8 +480,7 @@ func parsePortSpec(spec string) *PortParts {
 		Protocol:      protocol,
 	}
 }
-func (d *DockerService) GetSystemUsage() (*SystemUsage, error) {
-	ctx := context.Background()
+func (d *dockerClient) GetSystemUsage(ctx context.Context) (*SystemUsage, error) {
 	usage, err := d.client.DiskUsage(ctx, types.DiskUsageOptions{})
 	if err != nil {
 		return nil, err
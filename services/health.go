@@ -0,0 +1,232 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"netcontrol-containers/database"
+)
+
+// Health check states.
+const (
+	HealthUp   = "up"
+	HealthDown = "down"
+	// HealthDisabled means the dependency is not configured on this host.
+	HealthDisabled = "disabled"
+)
+
+// HealthResult is the outcome of one dependency check.
+type HealthResult struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+	// Required checks make the panel unready when they fail.
+	Required   bool      `json:"required"`
+	Error      string    `json:"error,omitempty"`
+	Hint       string    `json:"hint,omitempty"`
+	DurationMS int64     `json:"duration_ms"`
+	CheckedAt  time.Time `json:"checked_at"`
+}
+
+// errNotConfigured marks a dependency that is not set up rather than down.
+type errNotConfigured struct{ reason string }
+
+func (e errNotConfigured) Error() string { return e.reason }
+
+// healthCheck probes one dependency. The result is cached for ttl so load
+// balancers polling /readyz don't hammer the Docker daemon or API server.
+type healthCheck struct {
+	name     string
+	required bool
+	timeout  time.Duration
+	ttl      time.Duration
+	check    func(ctx context.Context) error
+	// hint explains a failure in terms of what to fix.
+	hint func(err error) string
+
+	mu   sync.Mutex
+	last *HealthResult
+}
+
+var healthChecks = []*healthCheck{
+	{name: "database", required: true, timeout: 2 * time.Second, ttl: 5 * time.Second, check: checkDatabase, hint: databaseHint},
+	{name: "docker", timeout: 3 * time.Second, ttl: 15 * time.Second, check: checkDocker, hint: dockerHint},
+	{name: "kubernetes", timeout: 5 * time.Second, ttl: 30 * time.Second, check: checkKubernetes, hint: kubernetesHint},
+	{name: "wireguard", timeout: 3 * time.Second, ttl: 15 * time.Second, check: checkWireGuard, hint: wireGuardHint},
+}
+
+// CheckHealth runs every dependency check in parallel, reusing results
+// younger than their cache time unless refresh is set. ready is false when
+// a required check failed.
+func CheckHealth(ctx context.Context, refresh bool) (ready bool, results []HealthResult) {
+	results = make([]HealthResult, len(healthChecks))
+	var wg sync.WaitGroup
+	for i, hc := range healthChecks {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			results[i] = hc.run(ctx, refresh)
+		}()
+	}
+	wg.Wait()
+
+	ready = true
+	for _, r := range results {
+		if r.Required && r.Status != HealthUp {
+			ready = false
+		}
+	}
+	return ready, results
+}
+
+func (hc *healthCheck) run(ctx context.Context, refresh bool) HealthResult {
+	// Concurrent callers wait for the running check instead of starting
+	// their own
+	hc.mu.Lock()
+	defer hc.mu.Unlock()
+	if !refresh && hc.last != nil && time.Since(hc.last.CheckedAt) < hc.ttl {
+		return *hc.last
+	}
+
+	// The result is shared, so a caller that goes away doesn't cut it short
+	ctx, cancel := context.WithTimeout(context.WithoutCancel(ctx), hc.timeout)
+	defer cancel()
+
+	start := time.Now()
+	// Some probes can't be cancelled, so the timeout is enforced here
+	done := make(chan error, 1)
+	go func() { done <- hc.check(ctx) }()
+	var err error
+	select {
+	case err = <-done:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+
+	result := HealthResult{
+		Name:       hc.name,
+		Status:     HealthUp,
+		Required:   hc.required,
+		DurationMS: time.Since(start).Milliseconds(),
+		CheckedAt:  time.Now(),
+	}
+	var notConfigured errNotConfigured
+	switch {
+	case errors.As(err, &notConfigured):
+		result.Status = HealthDisabled
+		result.Error = err.Error()
+	case errors.Is(err, context.DeadlineExceeded):
+		result.Status = HealthDown
+		result.Error = fmt.Sprintf("no answer within %s", hc.timeout)
+		result.Hint = hc.hint(err)
+	case err != nil:
+		result.Status = HealthDown
+		result.Error = err.Error()
+		result.Hint = hc.hint(err)
+	}
+
+	hc.last = &result
+	return result
+}
+
+func checkDatabase(ctx context.Context) error {
+	if database.DB == nil {
+		return errors.New("database is not open")
+	}
+	return database.DB.WithContext(ctx).Exec("SELECT 1").Error
+}
+
+func databaseHint(err error) string {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return "The database is locked or the disk is too slow; check for long-running writes"
+	}
+	return "The SQLite database could not be queried; check that the file at db_path exists and is readable and writable"
+}
+
+func checkDocker(ctx context.Context) error {
+	docker, err := GetDockerService()
+	if err != nil {
+		return err
+	}
+	return docker.Ping(ctx)
+}
+
+func dockerHint(err error) string {
+	msg := strings.ToLower(err.Error())
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return "The Docker daemon did not answer in time; it may be overloaded or docker.host points to an unreachable address"
+	case strings.Contains(msg, "permission denied"):
+		return "The panel's user may not open the Docker socket; run the panel as root or add its user to the docker group"
+	case strings.Contains(msg, "no such file"), strings.Contains(msg, "connection refused"), strings.Contains(msg, "cannot connect"):
+		return "The Docker daemon is not running or docker.host points to the wrong address; install Docker or start the docker service"
+	case strings.Contains(msg, "certificate"), strings.Contains(msg, "tls"):
+		return "The TLS connection to the Docker daemon failed; check DOCKER_CERT_PATH and DOCKER_TLS_VERIFY"
+	}
+	return "Check docker.host and that the daemon is running"
+}
+
+func checkKubernetes(ctx context.Context) error {
+	k8s, err := GetKubernetesService()
+	if errors.Is(err, ErrKubeconfigNotFound) {
+		return errNotConfigured{"no kubeconfig or in-cluster config"}
+	}
+	if err != nil {
+		return err
+	}
+	if err := k8s.Ping(ctx); err != nil {
+		// An expired client certificate explains a rejected handshake better
+		// than the TLS error does
+		if expiry, ok := k8s.ClientCertExpiry(); ok && time.Now().After(expiry) {
+			return fmt.Errorf("client certificate expired on %s: %w", expiry.Format(time.DateOnly), err)
+		}
+		return err
+	}
+	return nil
+}
+
+func kubernetesHint(err error) string {
+	msg := strings.ToLower(err.Error())
+	switch {
+	case errors.Is(err, context.DeadlineExceeded):
+		return "The API server did not answer in time; check that it is running and reachable from this host"
+	case strings.Contains(msg, "client certificate expired"):
+		return "The client certificate in the kubeconfig has expired; renew it (e.g. kubeadm certs renew) and copy the new kubeconfig"
+	case strings.Contains(msg, "unauthorized"):
+		return "The API server rejected the kubeconfig credentials; the token or certificate may have expired or been revoked"
+	case strings.Contains(msg, "forbidden"):
+		return "The kubeconfig user lacks permission to read the API; grant it a role"
+	case strings.Contains(msg, "x509"), strings.Contains(msg, "certificate"):
+		return "The API server's certificate could not be verified or has expired; check the cluster CA in the kubeconfig"
+	case strings.Contains(msg, "connection refused"), strings.Contains(msg, "no such host"), strings.Contains(msg, "no route"):
+		return "The API server is unreachable at the address in the kubeconfig; check that the cluster is running"
+	case strings.Contains(msg, "kubeconfig"), strings.Contains(msg, "no such file"):
+		return "The kubeconfig could not be loaded; check kubernetes.kubeconfig"
+	}
+	return "Check kubernetes.kubeconfig and that the cluster is running"
+}
+
+func checkWireGuard(ctx context.Context) error {
+	wg := GetWireGuardService()
+	if err := wg.Usable(); err != nil {
+		return errNotConfigured{err.Error()}
+	}
+	status, err := wg.GetStatus()
+	if err != nil {
+		return err
+	}
+	if !status.IsActive {
+		return fmt.Errorf("interface %s is down", wg.InterfaceName())
+	}
+	return nil
+}
+
+func wireGuardHint(err error) string {
+	if errors.Is(err, context.DeadlineExceeded) {
+		return "The wg tool did not answer in time"
+	}
+	return "Connect the VPN on the WireGuard page or run wg-quick up; the panel needs root to manage the interface"
+}
@@ -3,6 +3,7 @@ package services
 import (
 	"bufio"
 	"context"
+	"errors"
 	"fmt"
 	"os"
 	"os/exec"
@@ -12,7 +13,28 @@ import (
 	"time"
 )
 
-type InstallerService struct {
+// InstallerService installs and manages Docker and Kubernetes on the host,
+// or pretends to in demo mode. One job runs at a time; jobs report their
+// progress on the channel when it is not nil.
+type InstallerService interface {
+	GetStatus() InstallStatus
+	Cancel()
+	WaitIdle(ctx context.Context) bool
+	ResetLock()
+	CheckSoftwareStatus() *SoftwareStatus
+	InstallDocker(progressChan chan<- string) error
+	InstallKubernetes(progressChan chan<- string) error
+	UninstallDocker(progressChan chan<- string) error
+	UninstallKubernetes(progressChan chan<- string) error
+	SetupKubernetes(progressChan chan<- string) error
+	RestartService(serviceName string) error
+}
+
+// hostInstaller runs the package managers and tools of this host.
+type hostInstaller struct {
+	// ctx is cancelled to kill running commands on shutdown
+	ctx          context.Context
+	cancel       context.CancelFunc
 	mu           sync.Mutex
 	isInstalling bool
 	currentTask  string
@@ -38,18 +60,24 @@ type SoftwareInfo struct {
 	Running   bool   `json:"running"`
 }
 
-var installerService *InstallerService
+var installerService *hostInstaller
 
-func GetInstallerService() *InstallerService {
+func GetInstallerService() InstallerService {
+	if demo != nil {
+		return demo.installer
+	}
 	if installerService == nil {
-		installerService = &InstallerService{
-			logs: make([]string, 0),
+		ctx, cancel := context.WithCancel(context.Background())
+		installerService = &hostInstaller{
+			ctx:    ctx,
+			cancel: cancel,
+			logs:   make([]string, 0),
 		}
 	}
 	return installerService
 }
 
-func (i *InstallerService) GetStatus() InstallStatus {
+func (i *hostInstaller) GetStatus() InstallStatus {
 	i.mu.Lock()
 	defer i.mu.Unlock()
 
@@ -61,7 +89,7 @@ func (i *InstallerService) GetStatus() InstallStatus {
 	}
 }
 
-func (i *InstallerService) addLog(msg string) {
+func (i *hostInstaller) addLog(msg string) {
 	i.mu.Lock()
 	defer i.mu.Unlock()
 	i.logs = append(i.logs, msg)
@@ -70,21 +98,49 @@ func (i *InstallerService) addLog(msg string) {
 	}
 }
 
-func (i *InstallerService) setProgress(task string, progress int) {
+func (i *hostInstaller) setProgress(task string, progress int) {
 	i.mu.Lock()
 	defer i.mu.Unlock()
 	i.currentTask = task
 	i.progress = progress
 }
 
-func (i *InstallerService) ResetLock() {
+// command prepares a command that is killed when the installer is
+// cancelled.
+func (i *hostInstaller) command(name string, args ...string) *exec.Cmd {
+	return exec.CommandContext(i.ctx, name, args...)
+}
+
+// Cancel kills the commands of the running job, which then fails. Jobs
+// started afterwards fail right away.
+func (i *hostInstaller) Cancel() {
+	i.addLog("Installation cancelled: the server is shutting down.")
+	i.cancel()
+}
+
+// WaitIdle waits for the running job to finish. It returns false if ctx
+// expired first.
+func (i *hostInstaller) WaitIdle(ctx context.Context) bool {
+	ticker := time.NewTicker(200 * time.Millisecond)
+	defer ticker.Stop()
+	for i.GetStatus().IsInstalling {
+		select {
+		case <-ctx.Done():
+			return false
+		case <-ticker.C:
+		}
+	}
+	return true
+}
+
+func (i *hostInstaller) ResetLock() {
 	i.mu.Lock()
 	defer i.mu.Unlock()
 	i.isInstalling = false
 	i.addLog("Installation lock force-cleared by user request.")
 }
 
-func (i *InstallerService) CheckSoftwareStatus() *SoftwareStatus {
+func (i *hostInstaller) CheckSoftwareStatus() *SoftwareStatus {
 	status := &SoftwareStatus{
 		Docker:     i.checkDocker(),
 		Kubernetes: i.checkKubernetes(),
@@ -92,7 +148,7 @@ func (i *InstallerService) CheckSoftwareStatus() *SoftwareStatus {
 	return status
 }
 
-func (i *InstallerService) InstallDocker(progressChan chan<- string) error {
+func (i *hostInstaller) InstallDocker(progressChan chan<- string) error {
 	i.mu.Lock()
 	if i.isInstalling {
 		i.mu.Unlock()
@@ -120,7 +176,7 @@ func (i *InstallerService) InstallDocker(progressChan chan<- string) error {
 	}
 }
 
-func (i *InstallerService) installDockerLinux(progressChan chan<- string) error {
+func (i *hostInstaller) installDockerLinux(progressChan chan<- string) error {
 	distro, err := i.detectLinuxDistro()
 	if err != nil {
 		return fmt.Errorf("failed to detect linux distribution: %v", err)
@@ -142,8 +198,8 @@ func (i *InstallerService) installDockerLinux(progressChan chan<- string) error
 	}
 }
 
-func (i *InstallerService) detectLinuxDistro() (string, error) {
-	out, err := exec.Command("cat", "/etc/os-release").Output()
+func (i *hostInstaller) detectLinuxDistro() (string, error) {
+	out, err := i.command("cat", "/etc/os-release").Output()
 	if err != nil {
 		return "", err
 	}
@@ -161,10 +217,10 @@ func (i *InstallerService) detectLinuxDistro() (string, error) {
 	return "unknown", nil
 }
 
-func (i *InstallerService) installDockerDebian(progressChan chan<- string, distro string) error {
+func (i *hostInstaller) installDockerDebian(progressChan chan<- string, distro string) error {
 	// Clean up potential leftover bad config from previous attempts
-	exec.Command("rm", "-f", "/etc/apt/sources.list.d/docker.list").Run()
-	exec.Command("rm", "-f", "/usr/share/keyrings/docker-archive-keyring.gpg").Run()
+	i.command("rm", "-f", "/etc/apt/sources.list.d/docker.list").Run()
+	i.command("rm", "-f", "/usr/share/keyrings/docker-archive-keyring.gpg").Run()
 
 	// Determine correct repo URL base
 	// Default to ubuntu
@@ -194,7 +250,7 @@ func (i *InstallerService) installDockerDebian(progressChan chan<- string, distr
 	return i.executeSteps(steps, progressChan)
 }
 
-func (i *InstallerService) installDockerRedHat(progressChan chan<- string) error {
+func (i *hostInstaller) installDockerRedHat(progressChan chan<- string) error {
 	// Detect yum or dnf
 	pkgMgr := "yum"
 	if _, err := exec.LookPath("dnf"); err == nil {
@@ -216,7 +272,7 @@ func (i *InstallerService) installDockerRedHat(progressChan chan<- string) error
 	return i.executeSteps(steps, progressChan)
 }
 
-func (i *InstallerService) installDockerAlpine(progressChan chan<- string) error {
+func (i *hostInstaller) installDockerAlpine(progressChan chan<- string) error {
 	steps := []struct {
 		name    string
 		cmd     string
@@ -231,7 +287,7 @@ func (i *InstallerService) installDockerAlpine(progressChan chan<- string) error
 	return i.executeSteps(steps, progressChan)
 }
 
-func (i *InstallerService) installDockerGeneric(progressChan chan<- string) error {
+func (i *hostInstaller) installDockerGeneric(progressChan chan<- string) error {
 	// Use the convenience script
 	steps := []struct {
 		name    string
@@ -245,7 +301,7 @@ func (i *InstallerService) installDockerGeneric(progressChan chan<- string) erro
 	return i.executeSteps(steps, progressChan)
 }
 
-func (i *InstallerService) executeSteps(steps []struct {
+func (i *hostInstaller) executeSteps(steps []struct {
 	name    string
 	cmd     string
 	args    []string
@@ -258,7 +314,7 @@ func (i *InstallerService) executeSteps(steps []struct {
 		}
 		i.addLog(fmt.Sprintf("[%d%%] %s...", step.percent, step.name))
 
-		cmd := exec.Command(step.cmd, step.args...)
+		cmd := i.command(step.cmd, step.args...)
 		stdout, _ := cmd.StdoutPipe()
 		stderr, _ := cmd.StderrPipe()
 
@@ -311,16 +367,16 @@ func (i *InstallerService) executeSteps(steps []struct {
 	return nil
 }
 
-func (i *InstallerService) installDockerWindows(progressChan chan<- string) error {
+func (i *hostInstaller) installDockerWindows(progressChan chan<- string) error {
 	msg := "Docker Desktop for Windows must be installed manually. Please download from https://www.docker.com/products/docker-desktop"
 	i.addLog(msg)
 	if progressChan != nil {
 		progressChan <- msg
 	}
-	return fmt.Errorf(msg)
+	return errors.New(msg)
 }
 
-func (i *InstallerService) InstallKubernetes(progressChan chan<- string) error {
+func (i *hostInstaller) InstallKubernetes(progressChan chan<- string) error {
 	i.mu.Lock()
 	if i.isInstalling {
 		i.mu.Unlock()
@@ -356,7 +412,7 @@ const (
 	ARCH           = "amd64" // Assuming amd64 for now as per build
 )
 
-func (i *InstallerService) installKubernetesLinux(progressChan chan<- string) error {
+func (i *hostInstaller) installKubernetesLinux(progressChan chan<- string) error {
 	distro, err := i.detectLinuxDistro()
 	if err != nil {
 		return fmt.Errorf("failed to detect linux distribution: %v", err)
@@ -379,21 +435,21 @@ func (i *InstallerService) installKubernetesLinux(progressChan chan<- string) er
 	return nil
 }
 
-func (i *InstallerService) installSystemDependencies(distro string, progressChan chan<- string) error {
+func (i *hostInstaller) installSystemDependencies(distro string, progressChan chan<- string) error {
 	i.setProgress("Installing system dependencies", 10)
 	i.addLog("Installing system dependencies via package manager...")
 
 	var cmd *exec.Cmd
 	switch distro {
 	case "ubuntu", "debian", "kali", "raspbian":
-		exec.Command("apt-get", "update").Run()
-		cmd = exec.Command("apt-get", "install", "-y", "conntrack", "socat", "ebtables", "ethtool", "iptables", "curl")
+		i.command("apt-get", "update").Run()
+		cmd = i.command("apt-get", "install", "-y", "conntrack", "socat", "ebtables", "ethtool", "iptables", "curl")
 	case "centos", "rhel", "fedora", "almalinux", "rocky":
 		pkgMgr := "yum"
 		if _, err := exec.LookPath("dnf"); err == nil {
 			pkgMgr = "dnf"
 		}
-		cmd = exec.Command(pkgMgr, "install", "-y", "conntrack", "socat", "ebtables", "ethtool", "iptables", "curl")
+		cmd = i.command(pkgMgr, "install", "-y", "conntrack", "socat", "ebtables", "ethtool", "iptables", "curl")
 	default:
 		return fmt.Errorf("unsupported distro for dependency install: %s", distro)
 	}
@@ -408,7 +464,7 @@ func (i *InstallerService) installSystemDependencies(distro string, progressChan
 	return nil
 }
 
-func (i *InstallerService) downloadK8sBinaries(progressChan chan<- string) error {
+func (i *hostInstaller) downloadK8sBinaries(progressChan chan<- string) error {
 	i.setProgress("Downloading Kubernetes binaries", 30)
 	destDir := "/usr/local/bin"
 
@@ -430,7 +486,7 @@ func (i *InstallerService) downloadK8sBinaries(progressChan chan<- string) error
 			if err := i.downloadFile(bin.url, tmpFile); err != nil {
 				return err
 			}
-			extractCmd := exec.Command("tar", "-xzf", tmpFile, "-C", destDir)
+			extractCmd := i.command("tar", "-xzf", tmpFile, "-C", destDir)
 			if out, err := extractCmd.CombinedOutput(); err != nil {
 				i.addLog(string(out))
 				return fmt.Errorf("failed to extract %s: %v", bin.name, err)
@@ -450,7 +506,7 @@ func (i *InstallerService) downloadK8sBinaries(progressChan chan<- string) error
 	return nil
 }
 
-func (i *InstallerService) configureKubeletService(progressChan chan<- string) error {
+func (i *hostInstaller) configureKubeletService(progressChan chan<- string) error {
 	i.setProgress("Configuring kubelet service", 80)
 	i.addLog("Setting up systemd service for kubelet...")
 
@@ -487,31 +543,31 @@ ExecStart=/usr/local/bin/kubelet $KUBELET_KUBECONFIG_ARGS $KUBELET_CONFIG_ARGS $
 		return fmt.Errorf("failed to write 10-kubeadm.conf: %v", err)
 	}
 
-	exec.Command("systemctl", "daemon-reload").Run()
-	exec.Command("systemctl", "enable", "kubelet").Run()
-	exec.Command("systemctl", "start", "kubelet").Run()
+	i.command("systemctl", "daemon-reload").Run()
+	i.command("systemctl", "enable", "kubelet").Run()
+	i.command("systemctl", "start", "kubelet").Run()
 
 	return nil
 }
 
-func (i *InstallerService) downloadFile(url string, dest string) error {
-	cmd := exec.Command("curl", "-L", "-o", dest, url)
+func (i *hostInstaller) downloadFile(url string, dest string) error {
+	cmd := i.command("curl", "-L", "-o", dest, url)
 	if out, err := cmd.CombinedOutput(); err != nil {
 		return fmt.Errorf("download failed for %s: %s", url, string(out))
 	}
 	return nil
 }
 
-func (i *InstallerService) installKubernetesWindows(progressChan chan<- string) error {
+func (i *hostInstaller) installKubernetesWindows(progressChan chan<- string) error {
 	msg := "Kubernetes for Windows is available through Docker Desktop or WSL2. Please enable Kubernetes in Docker Desktop settings."
 	i.addLog(msg)
 	if progressChan != nil {
 		progressChan <- msg
 	}
-	return fmt.Errorf(msg)
+	return errors.New(msg)
 }
 
-func (i *InstallerService) UninstallDocker(progressChan chan<- string) error {
+func (i *hostInstaller) UninstallDocker(progressChan chan<- string) error {
 	i.mu.Lock()
 	if i.isInstalling {
 		i.mu.Unlock()
@@ -601,7 +657,7 @@ func (i *InstallerService) UninstallDocker(progressChan chan<- string) error {
 	return nil
 }
 
-func (i *InstallerService) UninstallKubernetes(progressChan chan<- string) error {
+func (i *hostInstaller) UninstallKubernetes(progressChan chan<- string) error {
 	i.mu.Lock()
 	if i.isInstalling {
 		i.mu.Unlock()
@@ -630,7 +686,7 @@ func (i *InstallerService) UninstallKubernetes(progressChan chan<- string) error
 
 	// Kubeadm reset is good practice before uninstalling
 	i.addLog("Resetting cluster nodes...")
-	exec.Command("kubeadm", "reset", "-f").Run()
+	i.command("kubeadm", "reset", "-f").Run()
 
 	var steps []struct {
 		name    string
@@ -699,7 +755,7 @@ func (i *InstallerService) UninstallKubernetes(progressChan chan<- string) error
 	}
 	i.addLog("Cleaning up residual binaries...")
 	for _, bin := range binaries {
-		exec.Command("rm", "-f", bin).Run()
+		i.command("rm", "-f", bin).Run()
 	}
 
 	successMsg := "Kubernetes uninstalled successfully!"
@@ -711,7 +767,7 @@ func (i *InstallerService) UninstallKubernetes(progressChan chan<- string) error
 }
 
 // Helper to reduce code duplication in Uninstall
-func (i *InstallerService) executeStep(name, cmdStr string, args []string, percent int, progressChan chan<- string) {
+func (i *hostInstaller) executeStep(name, cmdStr string, args []string, percent int, progressChan chan<- string) {
 	i.setProgress(name, percent)
 	msg := fmt.Sprintf("[%d%%] %s...", percent, name)
 	i.addLog(msg)
@@ -719,7 +775,7 @@ func (i *InstallerService) executeStep(name, cmdStr string, args []string, perce
 		progressChan <- msg
 	}
 
-	cmd := exec.Command(cmdStr, args...)
+	cmd := i.command(cmdStr, args...)
 	output, _ := cmd.CombinedOutput()
 	if len(output) > 0 {
 		i.addLog(string(output))
@@ -727,11 +783,11 @@ func (i *InstallerService) executeStep(name, cmdStr string, args []string, perce
 	}
 }
 
-func (i *InstallerService) RestartService(serviceName string) error {
+func (i *hostInstaller) RestartService(serviceName string) error {
 	if runtime.GOOS != "linux" {
 		return fmt.Errorf("restart only supported on Linux")
 	}
-	cmd := exec.Command("systemctl", "restart", serviceName)
+	cmd := i.command("systemctl", "restart", serviceName)
 	output, err := cmd.CombinedOutput()
 	if err != nil {
 		return fmt.Errorf("failed to restart %s: %s (%v)", serviceName, string(output), err)
@@ -740,7 +796,7 @@ func (i *InstallerService) RestartService(serviceName string) error {
 }
 
 // Improved Check Helpers
-func (i *InstallerService) resolveBinary(name string) string {
+func (i *hostInstaller) resolveBinary(name string) string {
 	path, err := exec.LookPath(name)
 	if err == nil {
 		return path
@@ -759,7 +815,7 @@ func (i *InstallerService) resolveBinary(name string) string {
 	return name // return original name to let standard failure handle it
 }
 
-func (i *InstallerService) checkDocker() *SoftwareInfo {
+func (i *hostInstaller) checkDocker() *SoftwareInfo {
 	info := &SoftwareInfo{Installed: false}
 
 	bin := i.resolveBinary("docker")
@@ -785,7 +841,7 @@ func (i *InstallerService) checkDocker() *SoftwareInfo {
 	return info
 }
 
-func (i *InstallerService) checkKubernetes() *SoftwareInfo {
+func (i *hostInstaller) checkKubernetes() *SoftwareInfo {
 	info := &SoftwareInfo{Installed: false}
 
 	bin := i.resolveBinary("kubectl")
@@ -813,7 +869,7 @@ func (i *InstallerService) checkKubernetes() *SoftwareInfo {
 	return info
 }
 
-func (i *InstallerService) SetupKubernetes(progressChan chan<- string) error {
+func (i *hostInstaller) SetupKubernetes(progressChan chan<- string) error {
 	i.mu.Lock()
 	if i.isInstalling {
 		i.mu.Unlock()
@@ -894,7 +950,7 @@ func (i *InstallerService) SetupKubernetes(progressChan chan<- string) error {
 		}
 		i.addLog(fmt.Sprintf("[%d%%] %s...", step.percent, step.name))
 
-		cmd := exec.Command(step.cmd, step.args...)
+		cmd := i.command(step.cmd, step.args...)
 		// Set environment for root to find kubeadm if needed
 		cmd.Env = append(cmd.Env, "KUBECONFIG=/etc/kubernetes/admin.conf")
 		// Also append PATH to ensure binaries are found
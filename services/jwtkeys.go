@@ -0,0 +1,460 @@
+package services
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"netcontrol-containers/config"
+	"netcontrol-containers/database"
+	"netcontrol-containers/models"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	// SettingJWTKeys holds the signing keys as JSON, newest last.
+	SettingJWTKeys = "jwt.keys"
+	// SettingJWTAlgorithm is the algorithm new keys are generated for.
+	SettingJWTAlgorithm = "jwt.algorithm"
+	// SettingJWTRotationDays is the age after which the signing key is
+	// replaced automatically. Zero or less disables scheduled rotation.
+	SettingJWTRotationDays = "jwt.rotation_days"
+	// SettingJWTGraceHours is how long a replaced key keeps validating
+	// tokens it signed.
+	SettingJWTGraceHours = "jwt.grace_hours"
+
+	JWTAlgorithmHS256 = "HS256"
+	JWTAlgorithmEdDSA = "EdDSA"
+
+	DefaultJWTRotationDays = 30
+	// DefaultJWTGraceHours matches the session lifetime, so no session
+	// is cut short by a rotation.
+	DefaultJWTGraceHours = 24
+)
+
+// ErrJWTKeysStatic is returned when keys are managed through JWT_SECRET and
+// cannot be rotated from the panel.
+var ErrJWTKeysStatic = errors.New("signing key is set by JWT_SECRET and cannot be rotated")
+
+// JWTKey is a signing key. Retired keys only validate, until the grace
+// period after RetiredAt has passed.
+type JWTKey struct {
+	ID        string     `json:"kid"`
+	Algorithm string     `json:"alg"`
+	Secret    string     `json:"secret"` // base64 HMAC secret or Ed25519 seed
+	CreatedAt time.Time  `json:"created_at"`
+	RetiredAt *time.Time `json:"retired_at,omitempty"`
+	// Legacy marks the secret from before key IDs existed. It also
+	// validates tokens without a kid header.
+	Legacy bool `json:"legacy,omitempty"`
+}
+
+// JWTKeyInfo describes a key without its secret.
+type JWTKeyInfo struct {
+	ID        string     `json:"kid"`
+	Algorithm string     `json:"alg"`
+	CreatedAt time.Time  `json:"created_at"`
+	RetiredAt *time.Time `json:"retired_at,omitempty"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	Active    bool       `json:"active"`
+}
+
+// JWTKeyManager signs and validates session tokens with a rotating set of
+// keys stored in the settings table.
+type JWTKeyManager struct {
+	mu     sync.RWMutex
+	keys   []JWTKey
+	static bool
+	stop   chan struct{}
+}
+
+var (
+	jwtKeyManager     *JWTKeyManager
+	jwtKeyManagerOnce sync.Once
+)
+
+func GetJWTKeyManager() *JWTKeyManager {
+	jwtKeyManagerOnce.Do(func() {
+		jwtKeyManager = &JWTKeyManager{stop: make(chan struct{})}
+	})
+	return jwtKeyManager
+}
+
+// Load reads the keys from the database, generating the first one if there
+// is none. A secret from before key rotation is kept as a legacy key so
+// existing sessions stay valid.
+func (m *JWTKeyManager) Load() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if secret := config.Get().JWTSecret; secret != "" {
+		sum := sha256.Sum256([]byte(secret))
+		m.keys = []JWTKey{{
+			ID:        "env-" + hex.EncodeToString(sum[:4]),
+			Algorithm: JWTAlgorithmHS256,
+			Secret:    base64.StdEncoding.EncodeToString([]byte(secret)),
+			Legacy:    true,
+		}}
+		m.static = true
+		return nil
+	}
+	m.static = false
+
+	db := database.Get()
+	var keys []JWTKey
+	if raw := models.GetSetting(db, SettingJWTKeys); raw != "" {
+		if err := json.Unmarshal([]byte(raw), &keys); err != nil {
+			return fmt.Errorf("invalid %s setting: %w", SettingJWTKeys, err)
+		}
+	}
+	m.keys = keys
+
+	if len(m.keys) == 0 {
+		if legacy := models.GetSetting(db, models.SettingJWTSecret); legacy != "" {
+			now := time.Now()
+			m.keys = append(m.keys, JWTKey{
+				ID:        "legacy",
+				Algorithm: JWTAlgorithmHS256,
+				Secret:    base64.StdEncoding.EncodeToString([]byte(legacy)),
+				CreatedAt: now,
+				RetiredAt: &now,
+				Legacy:    true,
+			})
+		}
+		key, err := newJWTKey(JWTAlgorithm())
+		if err != nil {
+			return err
+		}
+		m.keys = append(m.keys, *key)
+		if err := m.save(); err != nil {
+			return err
+		}
+		slog.Info("Generated JWT signing key", "kid", key.ID)
+	}
+	return nil
+}
+
+// Start rotates the signing key whenever it is older than the configured
+// rotation interval, checking once an hour.
+func (m *JWTKeyManager) Start() {
+	go func() {
+		ticker := time.NewTicker(time.Hour)
+		defer ticker.Stop()
+		for {
+			m.rotateIfDue()
+			select {
+			case <-ticker.C:
+			case <-m.stop:
+				return
+			}
+		}
+	}()
+}
+
+// Stop ends scheduled rotation.
+func (m *JWTKeyManager) Stop() {
+	select {
+	case <-m.stop:
+	default:
+		close(m.stop)
+	}
+}
+
+func (m *JWTKeyManager) rotateIfDue() {
+	days := JWTRotationDays()
+	if days <= 0 {
+		return
+	}
+
+	m.mu.RLock()
+	active := m.activeKey()
+	due := !m.static && active != nil && time.Since(active.CreatedAt) >= time.Duration(days)*24*time.Hour
+	m.mu.RUnlock()
+
+	if due {
+		if _, err := m.Rotate(); err != nil {
+			slog.Error("Failed to rotate JWT signing key", "error", err)
+		}
+	}
+}
+
+// Rotate makes a new key the signing key. The previous key keeps
+// validating for the grace period.
+func (m *JWTKeyManager) Rotate() (*JWTKeyInfo, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.static {
+		return nil, ErrJWTKeysStatic
+	}
+
+	key, err := newJWTKey(JWTAlgorithm())
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	for i := range m.keys {
+		if m.keys[i].RetiredAt == nil {
+			m.keys[i].RetiredAt = &now
+		}
+	}
+	m.keys = append(m.pruned(now), *key)
+	if err := m.save(); err != nil {
+		return nil, err
+	}
+
+	slog.Info("Rotated JWT signing key", "kid", key.ID)
+	info := m.info(key, now)
+	return &info, nil
+}
+
+// Reset replaces every key at once, invalidating all issued tokens.
+func (m *JWTKeyManager) Reset() error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.static {
+		return nil
+	}
+	key, err := newJWTKey(JWTAlgorithm())
+	if err != nil {
+		return err
+	}
+	m.keys = []JWTKey{*key}
+	return m.save()
+}
+
+// Sign signs claims with the current key and sets its kid header.
+func (m *JWTKeyManager) Sign(claims jwt.Claims) (string, error) {
+	m.mu.RLock()
+	active := m.activeKey()
+	var key JWTKey
+	if active != nil {
+		key = *active
+	}
+	m.mu.RUnlock()
+	if active == nil {
+		return "", errors.New("no signing key")
+	}
+
+	method, signKey, _, err := key.material()
+	if err != nil {
+		return "", err
+	}
+	token := jwt.NewWithClaims(method, claims)
+	token.Header["kid"] = key.ID
+	return token.SignedString(signKey)
+}
+
+// KeyFunc finds the verification key for a token by its kid header. Tokens
+// must use the algorithm of their key, and retired keys are only accepted
+// during the grace period.
+func (m *JWTKeyManager) KeyFunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	now := time.Now()
+	grace := JWTGracePeriod()
+	for i := range m.keys {
+		key := &m.keys[i]
+		if kid != key.ID && !(kid == "" && key.Legacy) {
+			continue
+		}
+		if key.RetiredAt != nil && now.After(key.RetiredAt.Add(grace)) {
+			return nil, errors.New("signing key has expired")
+		}
+		method, _, verifyKey, err := key.material()
+		if err != nil {
+			return nil, err
+		}
+		if token.Method.Alg() != method.Alg() {
+			return nil, errors.New("unexpected signing method")
+		}
+		return verifyKey, nil
+	}
+	return nil, errors.New("unknown signing key")
+}
+
+// ValidMethods lists the algorithms the panel signs with.
+func (m *JWTKeyManager) ValidMethods() []string {
+	return []string{JWTAlgorithmHS256, JWTAlgorithmEdDSA}
+}
+
+// Keys describes the current and still valid retired keys, newest first.
+func (m *JWTKeyManager) Keys() []JWTKeyInfo {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	now := time.Now()
+	grace := JWTGracePeriod()
+	var infos []JWTKeyInfo
+	for i := len(m.keys) - 1; i >= 0; i-- {
+		key := &m.keys[i]
+		if key.RetiredAt != nil && now.After(key.RetiredAt.Add(grace)) {
+			continue
+		}
+		infos = append(infos, m.info(key, now))
+	}
+	return infos
+}
+
+// Static reports whether the key comes from JWT_SECRET.
+func (m *JWTKeyManager) Static() bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return m.static
+}
+
+// JWKS returns the public keys of Ed25519 keys that still validate tokens,
+// as a JSON Web Key Set. HMAC keys are secret and never published.
+func (m *JWTKeyManager) JWKS() map[string]interface{} {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	now := time.Now()
+	grace := JWTGracePeriod()
+	keys := []map[string]string{}
+	for i := range m.keys {
+		key := &m.keys[i]
+		if key.Algorithm != JWTAlgorithmEdDSA {
+			continue
+		}
+		if key.RetiredAt != nil && now.After(key.RetiredAt.Add(grace)) {
+			continue
+		}
+		_, _, public, err := key.material()
+		if err != nil {
+			continue
+		}
+		keys = append(keys, map[string]string{
+			"kty": "OKP",
+			"crv": "Ed25519",
+			"use": "sig",
+			"alg": JWTAlgorithmEdDSA,
+			"kid": key.ID,
+			"x":   base64.RawURLEncoding.EncodeToString(public.(ed25519.PublicKey)),
+		})
+	}
+	return map[string]interface{}{"keys": keys}
+}
+
+func (m *JWTKeyManager) activeKey() *JWTKey {
+	for i := len(m.keys) - 1; i >= 0; i-- {
+		if m.keys[i].RetiredAt == nil {
+			return &m.keys[i]
+		}
+	}
+	return nil
+}
+
+// pruned drops keys whose grace period is over.
+func (m *JWTKeyManager) pruned(now time.Time) []JWTKey {
+	grace := JWTGracePeriod()
+	keys := make([]JWTKey, 0, len(m.keys))
+	for _, key := range m.keys {
+		if key.RetiredAt != nil && now.After(key.RetiredAt.Add(grace)) {
+			continue
+		}
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+func (m *JWTKeyManager) info(key *JWTKey, now time.Time) JWTKeyInfo {
+	info := JWTKeyInfo{
+		ID:        key.ID,
+		Algorithm: key.Algorithm,
+		CreatedAt: key.CreatedAt,
+		RetiredAt: key.RetiredAt,
+		Active:    key.RetiredAt == nil,
+	}
+	if key.RetiredAt != nil {
+		expires := key.RetiredAt.Add(JWTGracePeriod())
+		info.ExpiresAt = &expires
+	}
+	return info
+}
+
+func (m *JWTKeyManager) save() error {
+	raw, err := json.Marshal(m.keys)
+	if err != nil {
+		return err
+	}
+	return models.SetSetting(database.Get(), SettingJWTKeys, string(raw))
+}
+
+// material returns the signing method and the keys to sign and verify with.
+func (k *JWTKey) material() (jwt.SigningMethod, interface{}, interface{}, error) {
+	secret, err := base64.StdEncoding.DecodeString(k.Secret)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("invalid key %s: %w", k.ID, err)
+	}
+	switch k.Algorithm {
+	case JWTAlgorithmHS256:
+		return jwt.SigningMethodHS256, secret, secret, nil
+	case JWTAlgorithmEdDSA:
+		if len(secret) != ed25519.SeedSize {
+			return nil, nil, nil, fmt.Errorf("invalid key %s: bad seed length", k.ID)
+		}
+		private := ed25519.NewKeyFromSeed(secret)
+		return jwt.SigningMethodEdDSA, private, private.Public(), nil
+	}
+	return nil, nil, nil, fmt.Errorf("invalid key %s: unsupported algorithm %q", k.ID, k.Algorithm)
+}
+
+func newJWTKey(algorithm string) (*JWTKey, error) {
+	secret := make([]byte, 32) // also ed25519.SeedSize
+	if _, err := rand.Read(secret); err != nil {
+		return nil, err
+	}
+	id := make([]byte, 8)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+	return &JWTKey{
+		ID:        hex.EncodeToString(id),
+		Algorithm: algorithm,
+		Secret:    base64.StdEncoding.EncodeToString(secret),
+		CreatedAt: time.Now(),
+	}, nil
+}
+
+// ValidJWTAlgorithm reports whether keys can be generated for algorithm.
+func ValidJWTAlgorithm(algorithm string) bool {
+	return algorithm == JWTAlgorithmHS256 || algorithm == JWTAlgorithmEdDSA
+}
+
+// JWTAlgorithm returns the algorithm new signing keys use.
+func JWTAlgorithm() string {
+	algorithm := Setting(SettingJWTAlgorithm)
+	if !ValidJWTAlgorithm(algorithm) {
+		return JWTAlgorithmHS256
+	}
+	return algorithm
+}
+
+// JWTRotationDays returns the scheduled rotation interval in days.
+func JWTRotationDays() int {
+	return SettingInt(SettingJWTRotationDays)
+}
+
+// JWTGracePeriod returns how long retired keys keep validating.
+func JWTGracePeriod() time.Duration {
+	hours := SettingInt(SettingJWTGraceHours)
+	if hours < 0 {
+		hours = 0
+	}
+	return time.Duration(hours) * time.Hour
+}
@@ -0,0 +1,213 @@
+package services
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"os"
+	"testing"
+	"time"
+
+	"netcontrol-containers/config"
+	"netcontrol-containers/database"
+	"netcontrol-containers/models"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// newTestKeyManager loads a key manager from an empty key set, so every
+// test starts with a single fresh signing key.
+func newTestKeyManager(t *testing.T) *JWTKeyManager {
+	t.Helper()
+	db := database.Get()
+	for _, key := range []string{SettingJWTKeys, SettingJWTAlgorithm, SettingJWTGraceHours} {
+		if err := db.Unscoped().Where("key = ?", key).Delete(&models.Settings{}).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+	m := &JWTKeyManager{stop: make(chan struct{})}
+	if err := m.Load(); err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func signTestToken(t *testing.T, m *JWTKeyManager) string {
+	t.Helper()
+	signed, err := m.Sign(jwt.RegisteredClaims{
+		Subject:   "1",
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return signed
+}
+
+// parse validates a token the way the auth middleware does.
+func parse(m *JWTKeyManager, signed string) error {
+	_, err := jwt.ParseWithClaims(signed, &jwt.RegisteredClaims{}, m.KeyFunc, jwt.WithValidMethods(m.ValidMethods()))
+	return err
+}
+
+func TestJWTRotationKeepsOldKeyForGracePeriod(t *testing.T) {
+	m := newTestKeyManager(t)
+	old := signTestToken(t, m)
+
+	rotated, err := m.Rotate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	current := signTestToken(t, m)
+	if token, _, _ := jwt.NewParser().ParseUnverified(current, &jwt.RegisteredClaims{}); token.Header["kid"] != rotated.ID {
+		t.Fatalf("new token signed with kid %v, want %s", token.Header["kid"], rotated.ID)
+	}
+	if err := parse(m, old); err != nil {
+		t.Fatalf("token of the replaced key rejected during the grace period: %v", err)
+	}
+	if err := parse(m, current); err != nil {
+		t.Fatalf("token of the new key rejected: %v", err)
+	}
+	if keys := m.Keys(); len(keys) != 2 || !keys[0].Active || keys[1].Active || keys[1].ExpiresAt == nil {
+		t.Fatalf("keys = %+v, want the new active key and the retired one", keys)
+	}
+
+	// Once the grace period is over the old key stops validating and the
+	// next rotation drops it
+	retired := time.Now().Add(-JWTGracePeriod() - time.Minute)
+	m.keys[0].RetiredAt = &retired
+	if err := parse(m, old); err == nil {
+		t.Fatal("token of an expired key accepted")
+	}
+	if err := parse(m, current); err != nil {
+		t.Fatalf("token of the active key rejected: %v", err)
+	}
+	if keys := m.Keys(); len(keys) != 1 || keys[0].ID != rotated.ID {
+		t.Fatalf("keys = %+v, want only %s", keys, rotated.ID)
+	}
+	if _, err := m.Rotate(); err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range m.keys {
+		if key.RetiredAt != nil && key.RetiredAt.Equal(retired) {
+			t.Fatalf("expired key %s kept after rotation", key.ID)
+		}
+	}
+}
+
+func TestJWTRotationIsPersisted(t *testing.T) {
+	m := newTestKeyManager(t)
+	old := signTestToken(t, m)
+	if _, err := m.Rotate(); err != nil {
+		t.Fatal(err)
+	}
+	current := signTestToken(t, m)
+
+	// A restart loads the same keys
+	reloaded := &JWTKeyManager{stop: make(chan struct{})}
+	if err := reloaded.Load(); err != nil {
+		t.Fatal(err)
+	}
+	for _, signed := range []string{old, current} {
+		if err := parse(reloaded, signed); err != nil {
+			t.Fatalf("token rejected after reload: %v", err)
+		}
+	}
+}
+
+func TestJWTRejectsUnknownKeyAndForeignAlgorithm(t *testing.T) {
+	m := newTestKeyManager(t)
+	if err := models.SetSetting(database.Get(), SettingJWTAlgorithm, JWTAlgorithmEdDSA); err != nil {
+		t.Fatal(err)
+	}
+	rotated, err := m.Rotate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rotated.Algorithm != JWTAlgorithmEdDSA {
+		t.Fatalf("rotated to %s, want %s", rotated.Algorithm, JWTAlgorithmEdDSA)
+	}
+	if err := parse(m, signTestToken(t, m)); err != nil {
+		t.Fatalf("EdDSA token rejected: %v", err)
+	}
+	if jwks := m.JWKS()["keys"].([]map[string]string); len(jwks) != 1 || jwks[0]["kid"] != rotated.ID {
+		t.Fatalf("JWKS = %+v, want the public key of %s", jwks, rotated.ID)
+	}
+
+	claims := jwt.RegisteredClaims{Subject: "1", ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour))}
+	forge := func(method jwt.SigningMethod, kid string, key interface{}) string {
+		token := jwt.NewWithClaims(method, claims)
+		if kid != "" {
+			token.Header["kid"] = kid
+		}
+		signed, err := token.SignedString(key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return signed
+	}
+	// The Ed25519 public key is published, so an HMAC token keyed with it
+	// must not pass for one of ours
+	_, _, public, err := m.activeKey().material()
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, foreign, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hmacKey := m.keys[0]
+	for name, signed := range map[string]string{
+		"unknown kid":          forge(jwt.SigningMethodHS256, "not-a-key", []byte("secret")),
+		"no kid":               forge(jwt.SigningMethodHS256, "", []byte("secret")),
+		"HS256 with EdDSA kid": forge(jwt.SigningMethodHS256, rotated.ID, []byte(public.(ed25519.PublicKey))),
+		"EdDSA with HS256 kid": forge(jwt.SigningMethodEdDSA, hmacKey.ID, foreign),
+		"none":                 forge(jwt.SigningMethodNone, rotated.ID, jwt.UnsafeAllowNoneSignatureType),
+	} {
+		if err := parse(m, signed); err == nil {
+			t.Errorf("%s: token accepted", name)
+		}
+	}
+}
+
+func TestJWTStaticSecret(t *testing.T) {
+	m := newTestKeyManager(t)
+	stored := signTestToken(t, m)
+
+	os.Setenv("JWT_SECRET", "static-test-secret")
+	t.Cleanup(func() {
+		os.Unsetenv("JWT_SECRET")
+		if err := config.Init(); err != nil {
+			t.Error(err)
+		}
+	})
+	if err := config.Init(); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Load(); err != nil {
+		t.Fatal(err)
+	}
+
+	if !m.Static() {
+		t.Fatal("keys from JWT_SECRET not reported as static")
+	}
+	if _, err := m.Rotate(); err != ErrJWTKeysStatic {
+		t.Fatalf("Rotate() error = %v, want %v", err, ErrJWTKeysStatic)
+	}
+	if err := parse(m, signTestToken(t, m)); err != nil {
+		t.Fatalf("token of the static key rejected: %v", err)
+	}
+	// Tokens signed before the secret was set are not honoured, and
+	// neither are tokens made with the plain secret but another kid
+	if err := parse(m, stored); err == nil {
+		t.Fatal("token of a stored key accepted in static mode")
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.RegisteredClaims{Subject: "1"})
+	token.Header["kid"] = "other"
+	signed, err := token.SignedString([]byte("static-test-secret"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := parse(m, signed); err == nil {
+		t.Fatal("token with a foreign kid accepted in static mode")
+	}
+}
@@ -2,9 +2,16 @@ package services
 
 import (
 	"context"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
 	"fmt"
 	"io"
+	"io/fs"
+	"log/slog"
+	"os"
 	"strings"
+	"sync"
 	"time"
 
 	"path/filepath"
@@ -17,10 +24,33 @@ import (
 	"k8s.io/client-go/util/homedir"
 )
 
-type KubernetesService struct {
+// KubernetesService reads and manages the workloads of a cluster, or of the
+// simulated one in demo mode.
+type KubernetesService interface {
+	IsAvailable() bool
+	Ping(ctx context.Context) error
+	ClientCertExpiry() (expiry time.Time, ok bool)
+	ListNamespaces(ctx context.Context) ([]NamespaceInfo, error)
+	ListPods(ctx context.Context, namespace string) ([]PodInfo, error)
+	ListDeployments(ctx context.Context, namespace string) ([]DeploymentInfo, error)
+	ListServices(ctx context.Context, namespace string) ([]ServiceInfo, error)
+	GetPodLogs(ctx context.Context, namespace, podName, container string, tailLines int64) (string, error)
+	ScaleDeployment(ctx context.Context, namespace, deploymentName string, replicas int32) error
+	RestartDeployment(ctx context.Context, namespace, deploymentName string) error
+	DeletePod(ctx context.Context, namespace, podName string) error
+	GetClusterStats(ctx context.Context, namespace string) (*ClusterStats, error)
+}
+
+// kubeClient talks to the API server of the configured kubeconfig.
+type kubeClient struct {
 	clientset *kubernetes.Clientset
+	config    *rest.Config
 }
 
+// ErrKubeconfigNotFound means no cluster is configured: no kubeconfig is
+// set, the panel is not running in a cluster and ~/.kube/config is missing.
+var ErrKubeconfigNotFound = errors.New("no kubeconfig found")
+
 type PodInfo struct {
 	Name      string            `json:"name"`
 	Namespace string            `json:"namespace"`
@@ -73,9 +103,19 @@ type ClusterStats struct {
 	Version        string `json:"version"`
 }
 
-var k8sService *KubernetesService
+var (
+	k8sService   *kubeClient
+	k8sServiceMu sync.Mutex
+)
+
+func GetKubernetesService() (KubernetesService, error) {
+	if demo != nil {
+		return demo.kubernetes, nil
+	}
+
+	k8sServiceMu.Lock()
+	defer k8sServiceMu.Unlock()
 
-func GetKubernetesService() (*KubernetesService, error) {
 	if k8sService != nil {
 		return k8sService, nil
 	}
@@ -90,11 +130,25 @@ func GetKubernetesService() (*KubernetesService, error) {
 		return nil, err
 	}
 
-	k8sService = &KubernetesService{clientset: clientset}
+	k8sService = &kubeClient{clientset: clientset, config: config}
 	return k8sService, nil
 }
 
+// ResetKubernetesService drops the client so the next call loads the
+// currently configured kubeconfig.
+func ResetKubernetesService() {
+	k8sServiceMu.Lock()
+	defer k8sServiceMu.Unlock()
+	k8sService = nil
+}
+
 func getKubeConfig() (*rest.Config, error) {
+	// An explicitly configured kubeconfig wins
+	if path := Kubeconfig(); path != "" {
+		rules := &clientcmd.ClientConfigLoadingRules{Precedence: filepath.SplitList(path)}
+		return clientcmd.NewNonInteractiveDeferredLoadingClientConfig(rules, &clientcmd.ConfigOverrides{}).ClientConfig()
+	}
+
 	// Try in-cluster config first
 	config, err := rest.InClusterConfig()
 	if err == nil {
@@ -103,6 +157,9 @@ func getKubeConfig() (*rest.Config, error) {
 
 	// Fall back to kubeconfig file
 	kubeconfig := filepath.Join(homedir.HomeDir(), ".kube", "config")
+	if _, err := os.Stat(kubeconfig); errors.Is(err, fs.ErrNotExist) {
+		return nil, ErrKubeconfigNotFound
+	}
 	config, err = clientcmd.BuildConfigFromFlags("", kubeconfig)
 	if err != nil {
 		return nil, err
@@ -111,19 +168,44 @@ func getKubeConfig() (*rest.Config, error) {
 	return config, nil
 }
 
-func (k *KubernetesService) IsAvailable() bool {
-	_, err := k.clientset.Discovery().ServerVersion()
-	return err == nil
+func (k *kubeClient) IsAvailable() bool {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	return k.Ping(ctx) == nil
+}
+
+// Ping asks the API server for its version, which any valid credentials
+// may read.
+func (k *kubeClient) Ping(ctx context.Context) error {
+	return k.clientset.Discovery().RESTClient().Get().AbsPath("/version").Do(ctx).Error()
+}
+
+// ClientCertExpiry returns when the client certificate of the kubeconfig
+// expires. ok is false when the credentials are not a certificate.
+func (k *kubeClient) ClientCertExpiry() (expiry time.Time, ok bool) {
+	data := k.config.TLSClientConfig.CertData
+	if len(data) == 0 && k.config.TLSClientConfig.CertFile != "" {
+		data, _ = os.ReadFile(k.config.TLSClientConfig.CertFile)
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return time.Time{}, false
+	}
+	cert, err := x509.ParseCertificate(block.Bytes)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return cert.NotAfter, true
 }
 
-func (k *KubernetesService) ListNamespaces() ([]NamespaceInfo, error) {
-	ctx := context.Background()
+func (k *kubeClient) ListNamespaces(ctx context.Context) ([]NamespaceInfo, error) {
 	namespaces, err := k.clientset.CoreV1().Namespaces().List(ctx, metav1.ListOptions{})
 	if err != nil {
 		return nil, err
 	}
 
-	var result []NamespaceInfo
+	result := make([]NamespaceInfo, 0)
 	for _, ns := range namespaces.Items {
 		result = append(result, NamespaceInfo{
 			Name:   ns.Name,
@@ -135,8 +217,7 @@ func (k *KubernetesService) ListNamespaces() ([]NamespaceInfo, error) {
 	return result, nil
 }
 
-func (k *KubernetesService) ListPods(namespace string) ([]PodInfo, error) {
-	ctx := context.Background()
+func (k *kubeClient) ListPods(ctx context.Context, namespace string) ([]PodInfo, error) {
 
 	if namespace == "" {
 		namespace = "default"
@@ -147,7 +228,7 @@ func (k *KubernetesService) ListPods(namespace string) ([]PodInfo, error) {
 		return nil, err
 	}
 
-	var result []PodInfo
+	result := make([]PodInfo, 0)
 	for _, pod := range pods.Items {
 		ready := 0
 		total := len(pod.Status.ContainerStatuses)
@@ -190,8 +271,7 @@ func getPodPorts(pod *corev1.Pod) string {
 	return strings.Join(ports, ", ")
 }
 
-func (k *KubernetesService) ListDeployments(namespace string) ([]DeploymentInfo, error) {
-	ctx := context.Background()
+func (k *kubeClient) ListDeployments(ctx context.Context, namespace string) ([]DeploymentInfo, error) {
 
 	if namespace == "" {
 		namespace = "default"
@@ -202,7 +282,7 @@ func (k *KubernetesService) ListDeployments(namespace string) ([]DeploymentInfo,
 		return nil, err
 	}
 
-	var result []DeploymentInfo
+	result := make([]DeploymentInfo, 0)
 	for _, dep := range deployments.Items {
 		result = append(result, DeploymentInfo{
 			Name:      dep.Name,
@@ -218,8 +298,7 @@ func (k *KubernetesService) ListDeployments(namespace string) ([]DeploymentInfo,
 	return result, nil
 }
 
-func (k *KubernetesService) ListServices(namespace string) ([]ServiceInfo, error) {
-	ctx := context.Background()
+func (k *kubeClient) ListServices(ctx context.Context, namespace string) ([]ServiceInfo, error) {
 
 	if namespace == "" {
 		namespace = "default"
@@ -230,7 +309,7 @@ func (k *KubernetesService) ListServices(namespace string) ([]ServiceInfo, error
 		return nil, err
 	}
 
-	var result []ServiceInfo
+	result := make([]ServiceInfo, 0)
 	for _, svc := range services.Items {
 		var ports []string
 		for _, p := range svc.Spec.Ports {
@@ -263,8 +342,7 @@ func (k *KubernetesService) ListServices(namespace string) ([]ServiceInfo, error
 	return result, nil
 }
 
-func (k *KubernetesService) GetPodLogs(namespace, podName, container string, tailLines int64) (string, error) {
-	ctx := context.Background()
+func (k *kubeClient) GetPodLogs(ctx context.Context, namespace, podName, container string, tailLines int64) (string, error) {
 
 	options := &corev1.PodLogOptions{
 		TailLines: &tailLines,
@@ -289,8 +367,8 @@ func (k *KubernetesService) GetPodLogs(namespace, podName, container string, tai
 	return string(content), nil
 }
 
-func (k *KubernetesService) ScaleDeployment(namespace, deploymentName string, replicas int32) error {
-	ctx := context.Background()
+func (k *kubeClient) ScaleDeployment(ctx context.Context, namespace, deploymentName string, replicas int32) error {
+	slog.DebugContext(ctx, "Scaling deployment", "namespace", namespace, "deployment", deploymentName, "replicas", replicas)
 
 	deployment, err := k.clientset.AppsV1().Deployments(namespace).Get(ctx, deploymentName, metav1.GetOptions{})
 	if err != nil {
@@ -303,8 +381,8 @@ func (k *KubernetesService) ScaleDeployment(namespace, deploymentName string, re
 	return err
 }
 
-func (k *KubernetesService) RestartDeployment(namespace, deploymentName string) error {
-	ctx := context.Background()
+func (k *kubeClient) RestartDeployment(ctx context.Context, namespace, deploymentName string) error {
+	slog.DebugContext(ctx, "Restarting deployment", "namespace", namespace, "deployment", deploymentName)
 
 	deployment, err := k.clientset.AppsV1().Deployments(namespace).Get(ctx, deploymentName, metav1.GetOptions{})
 	if err != nil {
@@ -320,13 +398,12 @@ func (k *KubernetesService) RestartDeployment(namespace, deploymentName string)
 	return err
 }
 
-func (k *KubernetesService) DeletePod(namespace, podName string) error {
-	ctx := context.Background()
+func (k *kubeClient) DeletePod(ctx context.Context, namespace, podName string) error {
+	slog.DebugContext(ctx, "Deleting pod", "namespace", namespace, "pod", podName)
 	return k.clientset.CoreV1().Pods(namespace).Delete(ctx, podName, metav1.DeleteOptions{})
 }
 
-func (k *KubernetesService) GetClusterStats(namespace string) (*ClusterStats, error) {
-	ctx := context.Background()
+func (k *kubeClient) GetClusterStats(ctx context.Context, namespace string) (*ClusterStats, error) {
 
 	// 1. Get Nodes (Cluster-wide)
 	nodes, err := k.clientset.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
@@ -0,0 +1,792 @@
+package services
+
+import (
+	"bufio"
+	"crypto/tls"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	"netcontrol-containers/models"
+
+	"gorm.io/gorm"
+)
+
+// Settings keys for the LDAP / Active Directory backend.
+const (
+	SettingLDAPEnabled            = "ldap.enabled"
+	SettingLDAPURL                = "ldap.url"
+	SettingLDAPStartTLS           = "ldap.start_tls"
+	SettingLDAPInsecureSkipVerify = "ldap.insecure_skip_verify"
+	SettingLDAPBindDN             = "ldap.bind_dn"
+	SettingLDAPBindPassword       = "ldap.bind_password"
+	SettingLDAPSearchBase         = "ldap.search_base"
+	SettingLDAPUserFilter         = "ldap.user_filter"
+	SettingLDAPGroupAttribute     = "ldap.group_attribute"
+	SettingLDAPRoleMapping        = "ldap.role_mapping"
+	SettingLDAPDefaultRole        = "ldap.default_role"
+)
+
+const ldapTimeout = 10 * time.Second
+
+// ErrLDAPInvalidCredentials is returned when the directory rejects the
+// user's password or does not know the user.
+var ErrLDAPInvalidCredentials = errors.New("invalid credentials")
+
+// LDAPConfig is the directory configuration read from the settings store.
+type LDAPConfig struct {
+	Enabled bool `json:"enabled"`
+	// URL is ldap://host[:389] or ldaps://host[:636].
+	URL                string `json:"url"`
+	StartTLS           bool   `json:"start_tls"`
+	InsecureSkipVerify bool   `json:"insecure_skip_verify"`
+	BindDN             string `json:"bind_dn"`
+	BindPassword       string `json:"bind_password,omitempty"`
+	SearchBase         string `json:"search_base"`
+	// UserFilter locates the account; {username} is replaced by the escaped
+	// login name, e.g. "(sAMAccountName={username})" for Active Directory.
+	UserFilter     string `json:"user_filter"`
+	GroupAttribute string `json:"group_attribute"`
+	// RoleMapping maps group common names to panel roles, e.g.
+	// "panel-admins=admin,panel-ops=operator".
+	RoleMapping string `json:"role_mapping"`
+	DefaultRole string `json:"default_role"`
+}
+
+// LDAPIdentity is the directory entry of an authenticated user.
+type LDAPIdentity struct {
+	DN     string
+	Groups []string
+}
+
+func LoadLDAPConfig(db *gorm.DB) *LDAPConfig {
+	return ldapConfigFrom(func(key string) string { return models.GetSetting(db, key) })
+}
+
+// ldapConfigFrom builds the configuration from a settings lookup.
+func ldapConfigFrom(setting func(key string) string) *LDAPConfig {
+	cfg := &LDAPConfig{
+		Enabled:            setting(SettingLDAPEnabled) == "true",
+		URL:                setting(SettingLDAPURL),
+		StartTLS:           setting(SettingLDAPStartTLS) == "true",
+		InsecureSkipVerify: setting(SettingLDAPInsecureSkipVerify) == "true",
+		BindDN:             setting(SettingLDAPBindDN),
+		BindPassword:       setting(SettingLDAPBindPassword),
+		SearchBase:         setting(SettingLDAPSearchBase),
+		UserFilter:         setting(SettingLDAPUserFilter),
+		GroupAttribute:     setting(SettingLDAPGroupAttribute),
+		RoleMapping:        setting(SettingLDAPRoleMapping),
+		DefaultRole:        setting(SettingLDAPDefaultRole),
+	}
+	if cfg.UserFilter == "" {
+		cfg.UserFilter = "(uid={username})"
+	}
+	if cfg.GroupAttribute == "" {
+		cfg.GroupAttribute = "memberOf"
+	}
+	return cfg
+}
+
+func SaveLDAPConfig(db *gorm.DB, cfg *LDAPConfig) error {
+	values := map[string]*string{
+		SettingLDAPEnabled:            ptr(fmt.Sprintf("%t", cfg.Enabled)),
+		SettingLDAPURL:                &cfg.URL,
+		SettingLDAPStartTLS:           ptr(fmt.Sprintf("%t", cfg.StartTLS)),
+		SettingLDAPInsecureSkipVerify: ptr(fmt.Sprintf("%t", cfg.InsecureSkipVerify)),
+		SettingLDAPBindDN:             &cfg.BindDN,
+		SettingLDAPSearchBase:         &cfg.SearchBase,
+		SettingLDAPUserFilter:         &cfg.UserFilter,
+		SettingLDAPGroupAttribute:     &cfg.GroupAttribute,
+		SettingLDAPRoleMapping:        &cfg.RoleMapping,
+		SettingLDAPDefaultRole:        &cfg.DefaultRole,
+	}
+	// An empty password keeps the stored one
+	if cfg.BindPassword != "" {
+		values[SettingLDAPBindPassword] = &cfg.BindPassword
+	}
+	return saveSettings(db, values)
+}
+
+// Validate checks the settings needed to reach the directory.
+func (cfg *LDAPConfig) Validate() error {
+	u, err := url.Parse(cfg.URL)
+	if err != nil || (u.Scheme != "ldap" && u.Scheme != "ldaps") || u.Host == "" {
+		return errors.New("url must be ldap://host[:port] or ldaps://host[:port]")
+	}
+	if u.Scheme == "ldaps" && cfg.StartTLS {
+		return errors.New("start_tls cannot be combined with ldaps://")
+	}
+	if cfg.SearchBase == "" {
+		return errors.New("search_base is required")
+	}
+	if !strings.Contains(cfg.UserFilter, "{username}") {
+		return errors.New("user_filter must contain {username}")
+	}
+	if _, err := parseLDAPFilter(strings.ReplaceAll(cfg.UserFilter, "{username}", "x")); err != nil {
+		return fmt.Errorf("invalid user_filter: %v", err)
+	}
+	if cfg.DefaultRole != "" && !models.ValidRole(cfg.DefaultRole) {
+		return errors.New("invalid default_role")
+	}
+	return nil
+}
+
+// MapRole returns the most privileged role granted by the user's groups.
+func (cfg *LDAPConfig) MapRole(groups []string) string {
+	return mapGroupsToRole(cfg.RoleMapping, cfg.DefaultRole, groups)
+}
+
+// Authenticate looks the user up with the service account and verifies the
+// password by binding as the user's DN.
+func (cfg *LDAPConfig) Authenticate(username, password string) (*LDAPIdentity, error) {
+	// A simple bind with an empty password is an anonymous bind and would
+	// always succeed.
+	if username == "" || password == "" {
+		return nil, ErrLDAPInvalidCredentials
+	}
+
+	conn, err := cfg.dial()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	entry, err := cfg.findUser(conn, username)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := conn.bind(entry.dn, password); err != nil {
+		var lerr *ldapResultError
+		if errors.As(err, &lerr) && lerr.code == ldapResultInvalidCredentials {
+			return nil, ErrLDAPInvalidCredentials
+		}
+		return nil, err
+	}
+
+	return cfg.identity(entry), nil
+}
+
+// Test connects and binds with the service account and, when username is
+// set, looks that user up without checking a password.
+func (cfg *LDAPConfig) Test(username string) (*LDAPIdentity, error) {
+	conn, err := cfg.dial()
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	if username == "" {
+		if cfg.BindDN != "" {
+			if err := conn.bind(cfg.BindDN, cfg.BindPassword); err != nil {
+				return nil, fmt.Errorf("service account bind failed: %v", err)
+			}
+		}
+		return nil, nil
+	}
+
+	entry, err := cfg.findUser(conn, username)
+	if err != nil {
+		return nil, err
+	}
+	return cfg.identity(entry), nil
+}
+
+func (cfg *LDAPConfig) identity(entry *ldapEntry) *LDAPIdentity {
+	identity := &LDAPIdentity{DN: entry.dn}
+	for _, value := range entry.attrs[strings.ToLower(cfg.GroupAttribute)] {
+		identity.Groups = append(identity.Groups, ldapGroupName(value))
+	}
+	return identity
+}
+
+func (cfg *LDAPConfig) findUser(conn *ldapConn, username string) (*ldapEntry, error) {
+	if cfg.BindDN != "" {
+		if err := conn.bind(cfg.BindDN, cfg.BindPassword); err != nil {
+			return nil, fmt.Errorf("service account bind failed: %v", err)
+		}
+	}
+
+	filter := strings.ReplaceAll(cfg.UserFilter, "{username}", escapeLDAPFilter(username))
+	entries, err := conn.search(cfg.SearchBase, filter, []string{cfg.GroupAttribute})
+	if err != nil {
+		return nil, err
+	}
+	switch len(entries) {
+	case 0:
+		return nil, ErrLDAPInvalidCredentials
+	case 1:
+		return entries[0], nil
+	default:
+		return nil, fmt.Errorf("user filter matched %d entries", len(entries))
+	}
+}
+
+func (cfg *LDAPConfig) dial() (*ldapConn, error) {
+	u, err := url.Parse(cfg.URL)
+	if err != nil {
+		return nil, err
+	}
+
+	host := u.Host
+	if u.Port() == "" {
+		if u.Scheme == "ldaps" {
+			host = net.JoinHostPort(u.Hostname(), "636")
+		} else {
+			host = net.JoinHostPort(u.Hostname(), "389")
+		}
+	}
+	tlsConfig := &tls.Config{
+		ServerName:         u.Hostname(),
+		InsecureSkipVerify: cfg.InsecureSkipVerify,
+		MinVersion:         tls.VersionTLS12,
+	}
+
+	dialer := &net.Dialer{Timeout: ldapTimeout}
+	var raw net.Conn
+	if u.Scheme == "ldaps" {
+		raw, err = tls.DialWithDialer(dialer, "tcp", host, tlsConfig)
+	} else {
+		raw, err = dialer.Dial("tcp", host)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to directory: %v", err)
+	}
+
+	conn := newLDAPConn(raw)
+	if cfg.StartTLS {
+		if err := conn.startTLS(tlsConfig); err != nil {
+			conn.Close()
+			return nil, fmt.Errorf("StartTLS failed: %v", err)
+		}
+	}
+	return conn, nil
+}
+
+// ldapGroupName reduces a group DN such as "cn=panel-admins,ou=groups,..."
+// to its common name; other values are returned unchanged.
+func ldapGroupName(value string) string {
+	first, _, _ := strings.Cut(value, ",")
+	if attr, name, ok := strings.Cut(first, "="); ok && strings.EqualFold(strings.TrimSpace(attr), "cn") {
+		return strings.TrimSpace(name)
+	}
+	return value
+}
+
+// escapeLDAPFilter escapes a value for use inside a search filter
+// (RFC 4515).
+func escapeLDAPFilter(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; c {
+		case '\\', '*', '(', ')', 0:
+			fmt.Fprintf(&b, "\\%02x", c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// Minimal LDAPv3 client: simple bind, StartTLS and subtree search, which
+// is all the login flow needs.
+
+const (
+	ldapResultSuccess            = 0
+	ldapResultSizeLimitExceeded  = 4
+	ldapResultInvalidCredentials = 49
+
+	ldapStartTLSOID = "1.3.6.1.4.1.1466.20037"
+
+	berTagInteger     = 0x02
+	berTagOctetString = 0x04
+	berTagBoolean     = 0x01
+	berTagEnumerated  = 0x0a
+	berTagSequence    = 0x30
+	berTagSet         = 0x31
+
+	ldapTagBindRequest       = 0x60
+	ldapTagBindResponse      = 0x61
+	ldapTagUnbindRequest     = 0x42
+	ldapTagSearchRequest     = 0x63
+	ldapTagSearchEntry       = 0x64
+	ldapTagSearchDone        = 0x65
+	ldapTagSearchReference   = 0x73
+	ldapTagExtendedRequest   = 0x77
+	ldapTagExtendedResponse  = 0x78
+	ldapTagSimpleAuth        = 0x80
+	ldapTagExtendedRequestID = 0x80
+
+	ldapMaxMessageSize = 16 << 20
+)
+
+type ldapResultError struct {
+	code    int
+	message string
+}
+
+func (e *ldapResultError) Error() string {
+	if e.message != "" {
+		return fmt.Sprintf("LDAP result %d: %s", e.code, e.message)
+	}
+	return fmt.Sprintf("LDAP result %d", e.code)
+}
+
+type ldapEntry struct {
+	dn    string
+	attrs map[string][]string // keyed by lower-case attribute name
+}
+
+type ldapConn struct {
+	conn   net.Conn
+	reader *bufio.Reader
+	nextID int
+}
+
+func newLDAPConn(conn net.Conn) *ldapConn {
+	return &ldapConn{conn: conn, reader: bufio.NewReader(conn), nextID: 1}
+}
+
+func (l *ldapConn) Close() error {
+	l.send(berElement(ldapTagUnbindRequest))
+	return l.conn.Close()
+}
+
+func (l *ldapConn) bind(dn, password string) error {
+	op := berElement(ldapTagBindRequest,
+		berInteger(berTagInteger, 3),
+		berString(berTagOctetString, dn),
+		berString(ldapTagSimpleAuth, password),
+	)
+	id, err := l.send(op)
+	if err != nil {
+		return err
+	}
+	tag, content, err := l.receive(id)
+	if err != nil {
+		return err
+	}
+	if tag != ldapTagBindResponse {
+		return fmt.Errorf("unexpected response 0x%02x to bind", tag)
+	}
+	return parseLDAPResult(content)
+}
+
+func (l *ldapConn) startTLS(config *tls.Config) error {
+	op := berElement(ldapTagExtendedRequest, berString(ldapTagExtendedRequestID, ldapStartTLSOID))
+	id, err := l.send(op)
+	if err != nil {
+		return err
+	}
+	tag, content, err := l.receive(id)
+	if err != nil {
+		return err
+	}
+	if tag != ldapTagExtendedResponse {
+		return fmt.Errorf("unexpected response 0x%02x to StartTLS", tag)
+	}
+	if err := parseLDAPResult(content); err != nil {
+		return err
+	}
+
+	tlsConn := tls.Client(l.conn, config)
+	tlsConn.SetDeadline(time.Now().Add(ldapTimeout))
+	if err := tlsConn.Handshake(); err != nil {
+		return err
+	}
+	l.conn = tlsConn
+	l.reader = bufio.NewReader(tlsConn)
+	return nil
+}
+
+func (l *ldapConn) search(base, filter string, attributes []string) ([]*ldapEntry, error) {
+	encodedFilter, err := parseLDAPFilter(filter)
+	if err != nil {
+		return nil, err
+	}
+
+	var attrs [][]byte
+	for _, a := range attributes {
+		attrs = append(attrs, berString(berTagOctetString, a))
+	}
+
+	op := berElement(ldapTagSearchRequest,
+		berString(berTagOctetString, base),
+		berInteger(berTagEnumerated, 2), // wholeSubtree
+		berInteger(berTagEnumerated, 0), // neverDerefAliases
+		berInteger(berTagInteger, 2),    // size limit: one match is all we want
+		berInteger(berTagInteger, int(ldapTimeout.Seconds())),
+		berElement(berTagBoolean, []byte{0}),
+		encodedFilter,
+		berElement(berTagSequence, attrs...),
+	)
+	id, err := l.send(op)
+	if err != nil {
+		return nil, err
+	}
+
+	var entries []*ldapEntry
+	for {
+		tag, content, err := l.receive(id)
+		if err != nil {
+			return nil, err
+		}
+		switch tag {
+		case ldapTagSearchEntry:
+			entry, err := parseLDAPEntry(content)
+			if err != nil {
+				return nil, err
+			}
+			entries = append(entries, entry)
+		case ldapTagSearchReference:
+			// Referrals are not followed
+		case ldapTagSearchDone:
+			if err := parseLDAPResult(content); err != nil {
+				var lerr *ldapResultError
+				if errors.As(err, &lerr) && lerr.code == ldapResultSizeLimitExceeded {
+					return nil, errors.New("user filter matched more than one entry")
+				}
+				return nil, err
+			}
+			return entries, nil
+		default:
+			return nil, fmt.Errorf("unexpected response 0x%02x to search", tag)
+		}
+	}
+}
+
+func (l *ldapConn) send(op []byte) (int, error) {
+	id := l.nextID
+	l.nextID++
+	msg := berElement(berTagSequence, berInteger(berTagInteger, id), op)
+	l.conn.SetDeadline(time.Now().Add(ldapTimeout))
+	_, err := l.conn.Write(msg)
+	return id, err
+}
+
+// receive reads the next message for id and returns its protocol op.
+func (l *ldapConn) receive(id int) (byte, []byte, error) {
+	for {
+		tag, content, err := readBER(l.reader)
+		if err != nil {
+			return 0, nil, err
+		}
+		if tag != berTagSequence {
+			return 0, nil, errors.New("malformed LDAP message")
+		}
+
+		_, idBytes, rest, err := splitBER(content)
+		if err != nil {
+			return 0, nil, err
+		}
+		opTag, opContent, _, err := splitBER(rest)
+		if err != nil {
+			return 0, nil, err
+		}
+
+		msgID := berToInt(idBytes)
+		if msgID == 0 {
+			// Unsolicited notification, e.g. notice of disconnection
+			return 0, nil, fmt.Errorf("directory closed the connection: %v", parseLDAPResult(opContent))
+		}
+		if msgID == id {
+			return opTag, opContent, nil
+		}
+	}
+}
+
+func parseLDAPResult(content []byte) error {
+	_, code, rest, err := splitBER(content)
+	if err != nil {
+		return err
+	}
+	_, _, rest, err = splitBER(rest) // matchedDN
+	if err != nil {
+		return err
+	}
+	_, message, _, err := splitBER(rest)
+	if err != nil {
+		return err
+	}
+	if c := berToInt(code); c != ldapResultSuccess {
+		return &ldapResultError{code: c, message: string(message)}
+	}
+	return nil
+}
+
+func parseLDAPEntry(content []byte) (*ldapEntry, error) {
+	_, dn, rest, err := splitBER(content)
+	if err != nil {
+		return nil, err
+	}
+	_, attrList, _, err := splitBER(rest)
+	if err != nil {
+		return nil, err
+	}
+
+	entry := &ldapEntry{dn: string(dn), attrs: make(map[string][]string)}
+	for len(attrList) > 0 {
+		var attr []byte
+		_, attr, attrList, err = splitBER(attrList)
+		if err != nil {
+			return nil, err
+		}
+		_, name, vals, err := splitBER(attr)
+		if err != nil {
+			return nil, err
+		}
+		_, valSet, _, err := splitBER(vals)
+		if err != nil {
+			return nil, err
+		}
+		key := strings.ToLower(string(name))
+		for len(valSet) > 0 {
+			var val []byte
+			_, val, valSet, err = splitBER(valSet)
+			if err != nil {
+				return nil, err
+			}
+			entry.attrs[key] = append(entry.attrs[key], string(val))
+		}
+	}
+	return entry, nil
+}
+
+// parseLDAPFilter encodes a string filter (RFC 4515) as BER. Extensible
+// matches are not supported.
+func parseLDAPFilter(filter string) ([]byte, error) {
+	encoded, rest, err := parseLDAPFilterItem(strings.TrimSpace(filter))
+	if err != nil {
+		return nil, err
+	}
+	if rest != "" {
+		return nil, fmt.Errorf("unexpected %q after filter", rest)
+	}
+	return encoded, nil
+}
+
+func parseLDAPFilterItem(s string) ([]byte, string, error) {
+	if !strings.HasPrefix(s, "(") {
+		return nil, "", errors.New("filter must start with '('")
+	}
+	s = s[1:]
+	if s == "" {
+		return nil, "", errors.New("unterminated filter")
+	}
+
+	switch s[0] {
+	case '&', '|':
+		tag := byte(0xa0)
+		if s[0] == '|' {
+			tag = 0xa1
+		}
+		s = s[1:]
+		var items [][]byte
+		for strings.HasPrefix(s, "(") {
+			item, rest, err := parseLDAPFilterItem(s)
+			if err != nil {
+				return nil, "", err
+			}
+			items = append(items, item)
+			s = rest
+		}
+		if !strings.HasPrefix(s, ")") {
+			return nil, "", errors.New("unterminated filter")
+		}
+		return berElement(tag, items...), s[1:], nil
+	case '!':
+		item, rest, err := parseLDAPFilterItem(s[1:])
+		if err != nil {
+			return nil, "", err
+		}
+		if !strings.HasPrefix(rest, ")") {
+			return nil, "", errors.New("unterminated filter")
+		}
+		return berElement(0xa2, item), rest[1:], nil
+	}
+
+	end := strings.IndexByte(s, ')')
+	if end < 0 {
+		return nil, "", errors.New("unterminated filter")
+	}
+	item, rest := s[:end], s[end+1:]
+
+	eq := strings.IndexByte(item, '=')
+	if eq <= 0 {
+		return nil, "", fmt.Errorf("invalid filter item %q", item)
+	}
+	attr, op, value := item[:eq], "=", item[eq+1:]
+	if c := attr[len(attr)-1]; c == '>' || c == '<' || c == '~' {
+		attr, op = attr[:len(attr)-1], string(c)+"="
+	}
+	if attr == "" {
+		return nil, "", fmt.Errorf("invalid filter item %q", item)
+	}
+
+	attrBER := berString(berTagOctetString, attr)
+	switch op {
+	case ">=", "<=", "~=":
+		v, err := unescapeLDAPFilter(value)
+		if err != nil {
+			return nil, "", err
+		}
+		tag := map[string]byte{">=": 0xa5, "<=": 0xa6, "~=": 0xa8}[op]
+		return berElement(tag, attrBER, berString(berTagOctetString, v)), rest, nil
+	}
+
+	if value == "*" {
+		return berString(0x87, attr), rest, nil
+	}
+	if !strings.Contains(value, "*") {
+		v, err := unescapeLDAPFilter(value)
+		if err != nil {
+			return nil, "", err
+		}
+		return berElement(0xa3, attrBER, berString(berTagOctetString, v)), rest, nil
+	}
+
+	parts := strings.Split(value, "*")
+	var subs [][]byte
+	for i, part := range parts {
+		if part == "" {
+			continue
+		}
+		v, err := unescapeLDAPFilter(part)
+		if err != nil {
+			return nil, "", err
+		}
+		tag := byte(0x81) // any
+		if i == 0 {
+			tag = 0x80 // initial
+		} else if i == len(parts)-1 {
+			tag = 0x82 // final
+		}
+		subs = append(subs, berString(tag, v))
+	}
+	return berElement(0xa4, attrBER, berElement(berTagSequence, subs...)), rest, nil
+}
+
+func unescapeLDAPFilter(s string) (string, error) {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' {
+			b.WriteByte(s[i])
+			continue
+		}
+		if i+3 > len(s) {
+			return "", errors.New("invalid escape in filter")
+		}
+		c, err := hex.DecodeString(s[i+1 : i+3])
+		if err != nil {
+			return "", errors.New("invalid escape in filter")
+		}
+		b.Write(c)
+		i += 2
+	}
+	return b.String(), nil
+}
+
+// BER encoding helpers
+
+func berElement(tag byte, children ...[]byte) []byte {
+	var content []byte
+	for _, c := range children {
+		content = append(content, c...)
+	}
+	return append(append([]byte{tag}, berLength(len(content))...), content...)
+}
+
+func berString(tag byte, s string) []byte {
+	return berElement(tag, []byte(s))
+}
+
+func berInteger(tag byte, v int) []byte {
+	var b []byte
+	for {
+		b = append([]byte{byte(v)}, b...)
+		v >>= 8
+		if v == 0 {
+			break
+		}
+	}
+	if b[0]&0x80 != 0 {
+		b = append([]byte{0}, b...)
+	}
+	return berElement(tag, b)
+}
+
+func berLength(n int) []byte {
+	if n < 0x80 {
+		return []byte{byte(n)}
+	}
+	var b []byte
+	for ; n > 0; n >>= 8 {
+		b = append([]byte{byte(n)}, b...)
+	}
+	return append([]byte{0x80 | byte(len(b))}, b...)
+}
+
+func berToInt(b []byte) int {
+	v := 0
+	for _, c := range b {
+		v = v<<8 | int(c)
+	}
+	return v
+}
+
+// splitBER splits the first element off data.
+func splitBER(data []byte) (byte, []byte, []byte, error) {
+	if len(data) < 2 {
+		return 0, nil, nil, errors.New("truncated BER element")
+	}
+	tag := data[0]
+	length, n := int(data[1]), 2
+	if length&0x80 != 0 {
+		size := length & 0x7f
+		if size == 0 || size > 4 || len(data) < 2+size {
+			return 0, nil, nil, errors.New("invalid BER length")
+		}
+		length = berToInt(data[2 : 2+size])
+		n += size
+	}
+	if length < 0 || len(data) < n+length {
+		return 0, nil, nil, errors.New("truncated BER element")
+	}
+	return tag, data[n : n+length], data[n+length:], nil
+}
+
+func readBER(r *bufio.Reader) (byte, []byte, error) {
+	tag, err := r.ReadByte()
+	if err != nil {
+		return 0, nil, err
+	}
+	first, err := r.ReadByte()
+	if err != nil {
+		return 0, nil, err
+	}
+	length := int(first)
+	if first&0x80 != 0 {
+		size := int(first & 0x7f)
+		if size == 0 || size > 4 {
+			return 0, nil, errors.New("invalid BER length")
+		}
+		buf := make([]byte, size)
+		if _, err := io.ReadFull(r, buf); err != nil {
+			return 0, nil, err
+		}
+		length = berToInt(buf)
+	}
+	if length > ldapMaxMessageSize {
+		return 0, nil, errors.New("LDAP message too large")
+	}
+	content := make([]byte, length)
+	if _, err := io.ReadFull(r, content); err != nil {
+		return 0, nil, err
+	}
+	return tag, content, nil
+}
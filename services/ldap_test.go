@@ -0,0 +1,524 @@
+package services
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/tls"
+	"errors"
+	"io"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+)
+
+const (
+	testLDAPServiceDN       = "cn=panel,ou=services,dc=example,dc=org"
+	testLDAPServicePassword = "service-secret"
+)
+
+// testDirectory is an in-process LDAP server speaking just enough LDAPv3
+// for the login flow: simple bind, StartTLS and subtree search.
+type testDirectory struct {
+	t  *testing.T
+	ln net.Listener
+	// tlsConfig answers StartTLS; the extended operation is refused when nil.
+	tlsConfig *tls.Config
+	// searchReply, when set, is written raw in reply to a search, after
+	// which the connection is closed.
+	searchReply []byte
+
+	mu    sync.Mutex
+	binds []string
+}
+
+type testLDAPEntry struct {
+	dn       string
+	password string
+	attrs    map[string][]string
+}
+
+var testLDAPEntries = []testLDAPEntry{
+	{dn: testLDAPServiceDN, password: testLDAPServicePassword, attrs: map[string][]string{
+		"objectClass": {"applicationProcess"},
+		"cn":          {"panel"},
+	}},
+	{dn: "uid=alice,ou=people,dc=example,dc=org", password: "alice-secret", attrs: map[string][]string{
+		"objectClass": {"person"},
+		"uid":         {"alice"},
+		"memberOf":    {"cn=Panel-Ops,ou=groups,dc=example,dc=org", "cn=staff,ou=groups,dc=example,dc=org"},
+	}},
+	{dn: "uid=bob,ou=people,dc=example,dc=org", password: "bob-secret", attrs: map[string][]string{
+		"objectClass": {"person"},
+		"uid":         {"bob"},
+		"memberOf":    {"cn=panel-ops,ou=groups,dc=example,dc=org", "cn=panel-admins,ou=groups,dc=example,dc=org"},
+	}},
+	{dn: "uid=carol,ou=people,dc=example,dc=org", password: "carol-secret", attrs: map[string][]string{
+		"objectClass": {"person"},
+		"uid":         {"carol"},
+	}},
+}
+
+func newTestDirectory(t *testing.T) *testDirectory {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	d := &testDirectory{t: t, ln: ln}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go d.serve(conn)
+		}
+	}()
+	return d
+}
+
+// config returns a configuration pointing at the directory.
+func (d *testDirectory) config() *LDAPConfig {
+	return &LDAPConfig{
+		Enabled:        true,
+		URL:            "ldap://" + d.ln.Addr().String(),
+		BindDN:         testLDAPServiceDN,
+		BindPassword:   testLDAPServicePassword,
+		SearchBase:     "dc=example,dc=org",
+		UserFilter:     "(&(objectClass=person)(uid={username}))",
+		GroupAttribute: "memberOf",
+		RoleMapping:    "panel-admins=admin,panel-ops=operator",
+	}
+}
+
+// boundAs lists the DNs of all successful binds with a password.
+func (d *testDirectory) boundAs() []string {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return append([]string{}, d.binds...)
+}
+
+func (d *testDirectory) serve(raw net.Conn) {
+	conn := raw
+	defer func() { conn.Close() }()
+	reader := bufio.NewReader(conn)
+	bound := false
+
+	write := func(id int, op []byte) {
+		conn.Write(berElement(berTagSequence, berInteger(berTagInteger, id), op))
+	}
+	result := func(tag byte, code int) []byte {
+		return berElement(tag, berInteger(berTagEnumerated, code), berString(berTagOctetString, ""), berString(berTagOctetString, ""))
+	}
+
+	for {
+		tag, content, err := readBER(reader)
+		if err != nil || tag != berTagSequence {
+			return
+		}
+		_, idBytes, rest, err := splitBER(content)
+		if err != nil {
+			return
+		}
+		id := berToInt(idBytes)
+		opTag, op, _, err := splitBER(rest)
+		if err != nil {
+			return
+		}
+
+		switch opTag {
+		case ldapTagBindRequest:
+			_, _, rest, _ := splitBER(op)
+			_, dn, rest, _ := splitBER(rest)
+			_, password, _, _ := splitBER(rest)
+			code := d.bind(string(dn), string(password))
+			bound = code == ldapResultSuccess && len(password) > 0
+			write(id, result(ldapTagBindResponse, code))
+
+		case ldapTagExtendedRequest:
+			if d.tlsConfig == nil {
+				write(id, result(ldapTagExtendedResponse, 2)) // protocolError
+				continue
+			}
+			write(id, result(ldapTagExtendedResponse, ldapResultSuccess))
+			tlsConn := tls.Server(raw, d.tlsConfig)
+			if err := tlsConn.Handshake(); err != nil {
+				return
+			}
+			conn, reader = tlsConn, bufio.NewReader(tlsConn)
+
+		case ldapTagSearchRequest:
+			if d.searchReply != nil {
+				conn.Write(d.searchReply)
+				return
+			}
+			if !bound {
+				write(id, result(ldapTagSearchDone, 50)) // insufficientAccessRights
+				continue
+			}
+			// baseObject, scope, derefAliases, sizeLimit, timeLimit and
+			// typesOnly precede the filter
+			rest := op
+			for range 6 {
+				_, _, rest, _ = splitBER(rest)
+			}
+			filterTag, filter, _, err := splitBER(rest)
+			if err != nil {
+				return
+			}
+			for _, entry := range testLDAPEntries {
+				if matchTestLDAPFilter(filterTag, filter, entry) {
+					write(id, encodeTestLDAPEntry(entry))
+				}
+			}
+			write(id, result(ldapTagSearchDone, ldapResultSuccess))
+
+		case ldapTagUnbindRequest:
+			return
+		}
+	}
+}
+
+// bind verifies a simple bind. Like most directories it accepts an empty
+// password as an unauthenticated bind, whatever the DN.
+func (d *testDirectory) bind(dn, password string) int {
+	if password == "" {
+		return ldapResultSuccess
+	}
+	for _, entry := range testLDAPEntries {
+		if strings.EqualFold(entry.dn, dn) && entry.password == password {
+			d.mu.Lock()
+			d.binds = append(d.binds, entry.dn)
+			d.mu.Unlock()
+			return ldapResultSuccess
+		}
+	}
+	return ldapResultInvalidCredentials
+}
+
+func encodeTestLDAPEntry(entry testLDAPEntry) []byte {
+	var attrs [][]byte
+	for name, values := range entry.attrs {
+		var vals [][]byte
+		for _, v := range values {
+			vals = append(vals, berString(berTagOctetString, v))
+		}
+		attrs = append(attrs, berElement(berTagSequence, berString(berTagOctetString, name), berElement(berTagSet, vals...)))
+	}
+	return berElement(ldapTagSearchEntry, berString(berTagOctetString, entry.dn), berElement(berTagSequence, attrs...))
+}
+
+// matchTestLDAPFilter evaluates the and, or, not, equality, presence and
+// substring filters parseLDAPFilter produces.
+func matchTestLDAPFilter(tag byte, content []byte, entry testLDAPEntry) bool {
+	values := func(attr string) []string {
+		for name, v := range entry.attrs {
+			if strings.EqualFold(name, attr) {
+				return v
+			}
+		}
+		return nil
+	}
+
+	switch tag {
+	case 0xa0, 0xa1:
+		for len(content) > 0 {
+			childTag, child, rest, err := splitBER(content)
+			if err != nil {
+				return false
+			}
+			if matchTestLDAPFilter(childTag, child, entry) != (tag == 0xa0) {
+				return tag != 0xa0
+			}
+			content = rest
+		}
+		return tag == 0xa0
+	case 0xa2:
+		childTag, child, _, err := splitBER(content)
+		return err == nil && !matchTestLDAPFilter(childTag, child, entry)
+	case 0x87:
+		return len(values(string(content))) > 0
+	case 0xa3:
+		_, attr, rest, _ := splitBER(content)
+		_, value, _, _ := splitBER(rest)
+		for _, v := range values(string(attr)) {
+			if strings.EqualFold(v, string(value)) {
+				return true
+			}
+		}
+	case 0xa4:
+		_, attr, rest, _ := splitBER(content)
+		_, allSubs, _, _ := splitBER(rest)
+		for _, v := range values(string(attr)) {
+			v, subs, ok := strings.ToLower(v), allSubs, true
+			for len(subs) > 0 && ok {
+				var subTag byte
+				var sub []byte
+				subTag, sub, subs, _ = splitBER(subs)
+				s := strings.ToLower(string(sub))
+				switch subTag {
+				case 0x80:
+					ok = strings.HasPrefix(v, s)
+					v = strings.TrimPrefix(v, s)
+				case 0x81:
+					i := strings.Index(v, s)
+					ok = i >= 0
+					v = v[max(i, 0)+len(s):]
+				case 0x82:
+					ok = strings.HasSuffix(v, s)
+				}
+			}
+			if ok {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func testTLSConfig(t *testing.T) *tls.Config {
+	t.Helper()
+	certPEM, keyPEM, err := generateSelfSignedCert([]string{"127.0.0.1"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := tls.X509KeyPair(certPEM, keyPEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return &tls.Config{Certificates: []tls.Certificate{cert}}
+}
+
+func TestLDAPAuthenticateMapsGroupsToRoles(t *testing.T) {
+	d := newTestDirectory(t)
+	cfg := d.config()
+
+	tests := []struct {
+		username, password string
+		defaultRole        string
+		role               string
+	}{
+		// Group DNs are reduced to their common name and compared
+		// case-insensitively
+		{username: "alice", password: "alice-secret", role: "operator"},
+		// The most privileged matching group wins
+		{username: "bob", password: "bob-secret", role: "admin"},
+		// No matching group denies the login unless a default role is set
+		{username: "carol", password: "carol-secret", role: ""},
+		{username: "carol", password: "carol-secret", defaultRole: "viewer", role: "viewer"},
+	}
+	for _, tt := range tests {
+		identity, err := cfg.Authenticate(tt.username, tt.password)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.username, err)
+		}
+		if want := "uid=" + tt.username + ",ou=people,dc=example,dc=org"; identity.DN != want {
+			t.Errorf("%s: DN = %q, want %q", tt.username, identity.DN, want)
+		}
+		cfg.DefaultRole = tt.defaultRole
+		if role := cfg.MapRole(identity.Groups); role != tt.role {
+			t.Errorf("%s with default %q: role = %q, want %q (groups %v)", tt.username, tt.defaultRole, role, tt.role, identity.Groups)
+		}
+	}
+}
+
+func TestLDAPAuthenticateRejectsBadCredentials(t *testing.T) {
+	d := newTestDirectory(t)
+	cfg := d.config()
+
+	for _, tt := range []struct{ username, password string }{
+		{"alice", "wrong"},
+		{"nobody", "alice-secret"},
+	} {
+		if _, err := cfg.Authenticate(tt.username, tt.password); !errors.Is(err, ErrLDAPInvalidCredentials) {
+			t.Errorf("%s/%s: err = %v, want ErrLDAPInvalidCredentials", tt.username, tt.password, err)
+		}
+	}
+
+	// The directory accepts an empty password as an anonymous bind, so it
+	// must never get that far
+	before := len(d.boundAs())
+	if _, err := cfg.Authenticate("alice", ""); !errors.Is(err, ErrLDAPInvalidCredentials) {
+		t.Fatalf("empty password: err = %v, want ErrLDAPInvalidCredentials", err)
+	}
+	if after := d.boundAs(); len(after) != before {
+		t.Fatalf("empty password reached the directory: binds %v", after[before:])
+	}
+}
+
+func TestLDAPAuthenticateEscapesUsername(t *testing.T) {
+	d := newTestDirectory(t)
+	cfg := d.config()
+
+	// Unescaped, each of these would match alice or every account
+	for _, username := range []string{"*", "al*", "alice)(uid=*", "*)(|(uid=*"} {
+		if _, err := cfg.Authenticate(username, "alice-secret"); !errors.Is(err, ErrLDAPInvalidCredentials) {
+			t.Errorf("%q: err = %v, want ErrLDAPInvalidCredentials", username, err)
+		}
+	}
+	for _, dn := range d.boundAs() {
+		if strings.Contains(dn, "alice") {
+			t.Fatalf("a crafted username logged in as %s", dn)
+		}
+	}
+}
+
+func TestEscapeLDAPFilter(t *testing.T) {
+	tests := map[string]string{
+		"alice":         "alice",
+		"*":             `\2a`,
+		"a(b)c":         `a\28b\29c`,
+		`back\slash`:    `back\5cslash`,
+		"nul\x00byte":   `nul\00byte`,
+		"jürgen":        "jürgen",
+		"alice)(uid=*)": `alice\29\28uid=\2a\29`,
+	}
+	for in, want := range tests {
+		escaped := escapeLDAPFilter(in)
+		if escaped != want {
+			t.Errorf("escapeLDAPFilter(%q) = %q, want %q", in, escaped, want)
+			continue
+		}
+
+		// The escaped value parses back to a single equality match on in
+		encoded, err := parseLDAPFilter("(uid=" + escaped + ")")
+		if err != nil {
+			t.Errorf("%q: %v", in, err)
+			continue
+		}
+		if want := berElement(0xa3, berString(berTagOctetString, "uid"), berString(berTagOctetString, in)); !bytes.Equal(encoded, want) {
+			t.Errorf("%q: filter encodes as %x, want %x", in, encoded, want)
+		}
+	}
+}
+
+func TestParseLDAPFilterRejectsMalformed(t *testing.T) {
+	for _, filter := range []string{
+		"",
+		"uid=alice",
+		"(uid=alice",
+		"(uid=alice))",
+		"(=alice)",
+		"(&(uid=a)",
+		"(!(uid=a)",
+		`(uid=\4)`,
+		`(uid=\zz)`,
+	} {
+		if _, err := parseLDAPFilter(filter); err == nil {
+			t.Errorf("parseLDAPFilter(%q) succeeded", filter)
+		}
+	}
+}
+
+func TestLDAPStartTLS(t *testing.T) {
+	t.Run("refused", func(t *testing.T) {
+		d := newTestDirectory(t)
+		cfg := d.config()
+		cfg.StartTLS = true
+		_, err := cfg.Authenticate("alice", "alice-secret")
+		if err == nil || !strings.Contains(err.Error(), "StartTLS failed") {
+			t.Fatalf("err = %v, want StartTLS failure", err)
+		}
+		if len(d.boundAs()) != 0 {
+			t.Fatal("credentials were sent after StartTLS failed")
+		}
+	})
+
+	t.Run("untrusted certificate", func(t *testing.T) {
+		d := newTestDirectory(t)
+		d.tlsConfig = testTLSConfig(t)
+		cfg := d.config()
+		cfg.StartTLS = true
+		_, err := cfg.Authenticate("alice", "alice-secret")
+		if err == nil || !strings.Contains(err.Error(), "StartTLS failed") {
+			t.Fatalf("err = %v, want StartTLS failure", err)
+		}
+		if len(d.boundAs()) != 0 {
+			t.Fatal("credentials were sent after StartTLS failed")
+		}
+	})
+
+	t.Run("upgraded", func(t *testing.T) {
+		d := newTestDirectory(t)
+		d.tlsConfig = testTLSConfig(t)
+		cfg := d.config()
+		cfg.StartTLS = true
+		cfg.InsecureSkipVerify = true
+		if _, err := cfg.Authenticate("alice", "alice-secret"); err != nil {
+			t.Fatal(err)
+		}
+	})
+}
+
+// The replies are checked by looking the user up, which is the part of a
+// login that reads search results.
+func TestLDAPSearchRejectsMalformedResponses(t *testing.T) {
+	entry := berElement(berTagSequence, berInteger(berTagInteger, 2), encodeTestLDAPEntry(testLDAPEntries[1]))
+	done := berElement(berTagSequence, berInteger(berTagInteger, 2),
+		berElement(ldapTagSearchDone, berInteger(berTagEnumerated, 0), berString(berTagOctetString, ""), berString(berTagOctetString, "")))
+
+	tests := map[string][]byte{
+		"truncated message":   entry[:len(entry)/2],
+		"truncated length":    {berTagSequence, 0x84, 0x00},
+		"indefinite length":   {berTagSequence, 0x80, 0x00, 0x00},
+		"oversized message":   {berTagSequence, 0x84, 0x7f, 0xff, 0xff, 0xff},
+		"not a sequence":      append([]byte{berTagSet}, entry[1:]...),
+		"truncated entry":     berElement(berTagSequence, berInteger(berTagInteger, 2), berElement(ldapTagSearchEntry, berString(berTagOctetString, "uid=alice"), []byte{berTagSequence, 0x10, berTagSequence})),
+		"empty result":        berElement(berTagSequence, berInteger(berTagInteger, 2), berElement(ldapTagSearchDone)),
+		"unexpected response": berElement(berTagSequence, berInteger(berTagInteger, 2), berElement(ldapTagBindResponse, berInteger(berTagEnumerated, 0))),
+		"closed before done":  entry,
+		"notice of disconnection": berElement(berTagSequence, berInteger(berTagInteger, 0),
+			berElement(ldapTagExtendedResponse, berInteger(berTagEnumerated, 52), berString(berTagOctetString, ""), berString(berTagOctetString, "shutting down"))),
+	}
+	for name, reply := range tests {
+		t.Run(name, func(t *testing.T) {
+			d := newTestDirectory(t)
+			d.searchReply = reply
+			_, err := d.config().Test("alice")
+			if err == nil || errors.Is(err, ErrLDAPInvalidCredentials) {
+				t.Fatalf("err = %v, want a protocol error", err)
+			}
+		})
+	}
+
+	// The well-formed reply still works, so the cases above fail for the
+	// right reason
+	d := newTestDirectory(t)
+	d.searchReply = append(append([]byte{}, entry...), done...)
+	if identity, err := d.config().Test("alice"); err != nil || identity.DN != testLDAPEntries[1].dn {
+		t.Fatalf("well-formed reply: %v, %v", identity, err)
+	}
+}
+
+func TestReadBERRejectsEveryTruncation(t *testing.T) {
+	msg := berElement(berTagSequence, berInteger(berTagInteger, 300), encodeTestLDAPEntry(testLDAPEntries[2]))
+	for n := range len(msg) {
+		_, _, err := readBER(bufio.NewReader(bytes.NewReader(msg[:n])))
+		if err == nil {
+			t.Fatalf("readBER accepted %d of %d bytes", n, len(msg))
+		}
+		if n > 0 && !errors.Is(err, io.ErrUnexpectedEOF) && !errors.Is(err, io.EOF) {
+			t.Fatalf("readBER with %d of %d bytes: %v", n, len(msg), err)
+		}
+	}
+
+	tag, content, err := readBER(bufio.NewReader(bytes.NewReader(msg)))
+	if err != nil || tag != berTagSequence {
+		t.Fatalf("full message: tag 0x%02x, err %v", tag, err)
+	}
+	// Every element inside is bounds checked as well
+	for n := range len(content) {
+		_, idBytes, rest, err := splitBER(content[:n])
+		if err != nil {
+			continue
+		}
+		if berToInt(idBytes) != 300 {
+			t.Fatalf("message ID from %d bytes = %d", n, berToInt(idBytes))
+		}
+		if _, op, _, err := splitBER(rest); err == nil {
+			parseLDAPEntry(op)
+		}
+	}
+}
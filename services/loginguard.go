@@ -0,0 +1,102 @@
+package services
+
+import (
+	"math"
+	"sync"
+	"time"
+)
+
+// LoginGuard throttles login attempts per key (client IP, username) with
+// exponential backoff once a key exceeds a few free failures.
+type LoginGuard struct {
+	mu      sync.Mutex
+	entries map[string]*backoffEntry
+}
+
+type backoffEntry struct {
+	failures     int
+	blockedUntil time.Time
+	lastFailure  time.Time
+}
+
+const (
+	loginFreeFailures = 3
+	loginBaseDelay    = time.Second
+	loginMaxDelay     = 15 * time.Minute
+	loginForgetAfter  = time.Hour
+)
+
+var (
+	loginGuard     *LoginGuard
+	loginGuardOnce sync.Once
+)
+
+func GetLoginGuard() *LoginGuard {
+	loginGuardOnce.Do(func() {
+		loginGuard = &LoginGuard{entries: make(map[string]*backoffEntry)}
+	})
+	return loginGuard
+}
+
+// RetryAfter returns how long the caller must wait before another attempt
+// is allowed for any of keys. Zero means the attempt may proceed.
+func (g *LoginGuard) RetryAfter(keys ...string) time.Duration {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	now := time.Now()
+	var wait time.Duration
+	for _, key := range keys {
+		if e, ok := g.entries[key]; ok && now.Before(e.blockedUntil) {
+			if d := e.blockedUntil.Sub(now); d > wait {
+				wait = d
+			}
+		}
+	}
+	return wait
+}
+
+// Failure records a failed attempt for every key and extends its backoff.
+func (g *LoginGuard) Failure(keys ...string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	now := time.Now()
+	g.prune(now)
+
+	for _, key := range keys {
+		e, ok := g.entries[key]
+		if !ok {
+			e = &backoffEntry{}
+			g.entries[key] = e
+		}
+		e.failures++
+		e.lastFailure = now
+
+		if over := e.failures - loginFreeFailures; over > 0 {
+			delay := time.Duration(float64(loginBaseDelay) * math.Pow(2, float64(over-1)))
+			if delay > loginMaxDelay || delay <= 0 {
+				delay = loginMaxDelay
+			}
+			e.blockedUntil = now.Add(delay)
+		}
+	}
+}
+
+// Success clears the backoff state of every key.
+func (g *LoginGuard) Success(keys ...string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	for _, key := range keys {
+		delete(g.entries, key)
+	}
+}
+
+func (g *LoginGuard) prune(now time.Time) {
+	for key, e := range g.entries {
+		if now.Sub(e.lastFailure) > loginForgetAfter && now.After(e.blockedUntil) {
+			delete(g.entries, key)
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package services
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLoginGuardBacksOffExponentially(t *testing.T) {
+	g := &LoginGuard{entries: make(map[string]*backoffEntry)}
+
+	for i := 0; i < loginFreeFailures; i++ {
+		g.Failure("ip:192.0.2.1")
+		if wait := g.RetryAfter("ip:192.0.2.1"); wait != 0 {
+			t.Fatalf("failure %d: wait %s, want none", i+1, wait)
+		}
+	}
+
+	for _, want := range []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 8 * time.Second} {
+		g.Failure("ip:192.0.2.1")
+		if wait := g.RetryAfter("ip:192.0.2.1"); wait > want || wait < want-100*time.Millisecond {
+			t.Fatalf("wait %s, want %s", wait, want)
+		}
+	}
+
+	for i := 0; i < 40; i++ {
+		g.Failure("ip:192.0.2.1")
+	}
+	if wait := g.RetryAfter("ip:192.0.2.1"); wait > loginMaxDelay || wait < loginMaxDelay-time.Second {
+		t.Fatalf("wait %s, want the cap of %s", wait, loginMaxDelay)
+	}
+}
+
+func TestLoginGuardKeysAreIndependent(t *testing.T) {
+	g := &LoginGuard{entries: make(map[string]*backoffEntry)}
+	for i := 0; i <= loginFreeFailures; i++ {
+		g.Failure("ip:192.0.2.1", "user:alice")
+	}
+
+	if g.RetryAfter("ip:192.0.2.2", "user:bob") != 0 {
+		t.Fatal("unrelated keys are blocked")
+	}
+	// Any blocked key blocks the attempt
+	if g.RetryAfter("ip:192.0.2.2", "user:alice") == 0 {
+		t.Fatal("blocked user not reported")
+	}
+
+	g.Success("user:alice")
+	if g.RetryAfter("user:alice") != 0 {
+		t.Fatal("user still blocked after success")
+	}
+	if g.RetryAfter("ip:192.0.2.1") == 0 {
+		t.Fatal("success of one key cleared another")
+	}
+}
+
+func TestLoginGuardForgetsOldFailures(t *testing.T) {
+	g := &LoginGuard{entries: make(map[string]*backoffEntry)}
+	g.Failure("ip:192.0.2.1")
+	g.entries["ip:192.0.2.1"].lastFailure = time.Now().Add(-loginForgetAfter - time.Minute)
+
+	g.Failure("ip:192.0.2.2")
+	if _, ok := g.entries["ip:192.0.2.1"]; ok {
+		t.Fatal("failure older than an hour kept")
+	}
+}
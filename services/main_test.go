@@ -0,0 +1,41 @@
+package services
+
+import (
+	"fmt"
+	"os"
+	"testing"
+
+	"netcontrol-containers/config"
+	"netcontrol-containers/database"
+)
+
+// TestMain gives the services that keep their state in the settings table
+// a throwaway database.
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp("", "netcontrol-services-test")
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	os.Setenv("DATA_DIR", dir)
+	os.Setenv("LOG_LEVEL", "error")
+
+	code, err := runTests(m)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		code = 1
+	}
+	database.Close()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+func runTests(m *testing.M) (int, error) {
+	if err := config.Init(); err != nil {
+		return 0, err
+	}
+	if err := database.Init(); err != nil {
+		return 0, err
+	}
+	return m.Run(), nil
+}
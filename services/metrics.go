@@ -0,0 +1,312 @@
+package services
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SettingMetricsToken is the settings key holding the bearer token that
+// Prometheus must send to scrape /metrics. Metrics are off while it is unset.
+const SettingMetricsToken = "metrics.token"
+
+// httpBuckets are the upper bounds in seconds of the request latency
+// histogram.
+var httpBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+type httpSeries struct {
+	method, route, code string
+}
+
+type histogram struct {
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+var (
+	httpMetricsMu sync.Mutex
+	httpMetrics   = map[httpSeries]*histogram{}
+)
+
+// httpMethods are the methods recorded under their own name. Anything else
+// a client sends is counted as OTHER.
+var httpMethods = map[string]bool{
+	http.MethodGet: true, http.MethodHead: true, http.MethodPost: true,
+	http.MethodPut: true, http.MethodPatch: true, http.MethodDelete: true,
+	http.MethodOptions: true,
+}
+
+// ObserveHTTPRequest records the latency of a request. route is the route
+// pattern rather than the path, and unknown methods are folded into OTHER,
+// so the number of series stays bounded.
+func ObserveHTTPRequest(method, route string, status int, d time.Duration) {
+	if !httpMethods[method] {
+		method = "OTHER"
+	}
+	key := httpSeries{method: method, route: route, code: strconv.Itoa(status)}
+	seconds := d.Seconds()
+
+	httpMetricsMu.Lock()
+	defer httpMetricsMu.Unlock()
+	h := httpMetrics[key]
+	if h == nil {
+		h = &histogram{counts: make([]uint64, len(httpBuckets))}
+		httpMetrics[key] = h
+	}
+	for i, bound := range httpBuckets {
+		if seconds <= bound {
+			h.counts[i]++
+		}
+	}
+	h.count++
+	h.sum += seconds
+}
+
+// containerSample is the stats of one running container.
+type containerSample struct {
+	info  ContainerInfo
+	stats *ContainerStats
+}
+
+// WriteMetrics collects the host, container, cluster, VPN, terminal and
+// HTTP metrics and writes them in the Prometheus text format. Sources that
+// are unavailable report 0 in their *_up gauge.
+func WriteMetrics(ctx context.Context, w io.Writer) {
+	var (
+		wg         sync.WaitGroup
+		system     *SystemInfo
+		dockerUp   bool
+		containers []containerSample
+		k8sUp      bool
+		cluster    *ClusterStats
+		peers      []WireGuardPeerTransfer
+		wgUp       bool
+	)
+
+	wg.Add(4)
+	go func() {
+		defer wg.Done()
+		info, err := GetSystemInfo()
+		if err != nil {
+			slog.WarnContext(ctx, "Failed to collect host metrics", "error", err)
+			return
+		}
+		system = info
+	}()
+	go func() {
+		defer wg.Done()
+		dockerUp, containers = collectContainers(ctx)
+	}()
+	go func() {
+		defer wg.Done()
+		k8s, err := GetKubernetesService()
+		if err != nil || !k8s.IsAvailable() {
+			return
+		}
+		stats, err := k8s.GetClusterStats(ctx, "")
+		if err != nil {
+			slog.WarnContext(ctx, "Failed to collect cluster metrics", "error", err)
+			return
+		}
+		k8sUp, cluster = true, stats
+	}()
+	go func() {
+		defer wg.Done()
+		peers, wgUp = GetWireGuardService().Transfer()
+	}()
+	wg.Wait()
+
+	m := &metricWriter{w: w}
+
+	if system != nil {
+		m.help("netcontrol_host_info", "gauge", "Host information, always 1.")
+		m.sample("netcontrol_host_info", 1, "hostname", system.Hostname, "platform", system.Platform, "os", system.OS, "arch", system.Arch)
+		m.gauge("netcontrol_host_uptime_seconds", "Seconds since the host booted.", float64(system.Uptime))
+		m.gauge("netcontrol_host_cpu_cores", "Logical CPUs of the host.", float64(system.CPUInfo.Cores))
+		m.gauge("netcontrol_host_cpu_usage_percent", "CPU usage of the host over all cores.", system.CPUInfo.TotalUsage)
+		m.gauge("netcontrol_host_memory_total_bytes", "Total memory of the host.", float64(system.MemoryInfo.Total))
+		m.gauge("netcontrol_host_memory_used_bytes", "Used memory of the host.", float64(system.MemoryInfo.Used))
+		m.gauge("netcontrol_host_memory_available_bytes", "Memory available for new processes.", float64(system.MemoryInfo.Available))
+
+		m.help("netcontrol_host_disk_total_bytes", "gauge", "Size of the file system.")
+		for _, d := range system.DiskInfo {
+			m.sample("netcontrol_host_disk_total_bytes", float64(d.Total), "device", d.Device, "mountpoint", d.Mountpoint, "fstype", d.Fstype)
+		}
+		m.help("netcontrol_host_disk_used_bytes", "gauge", "Used space of the file system.")
+		for _, d := range system.DiskInfo {
+			m.sample("netcontrol_host_disk_used_bytes", float64(d.Used), "device", d.Device, "mountpoint", d.Mountpoint, "fstype", d.Fstype)
+		}
+	}
+
+	m.gauge("netcontrol_docker_up", "Whether the Docker daemon is reachable.", boolValue(dockerUp))
+	if len(containers) > 0 {
+		m.containerMetric(containers, "netcontrol_container_cpu_usage_percent", "gauge", "CPU usage of the container, 100 per core.", func(s *ContainerStats) float64 { return s.CPUPercent })
+		m.containerMetric(containers, "netcontrol_container_memory_usage_bytes", "gauge", "Memory used by the container.", func(s *ContainerStats) float64 { return float64(s.MemoryUsage) })
+		m.containerMetric(containers, "netcontrol_container_memory_limit_bytes", "gauge", "Memory limit of the container.", func(s *ContainerStats) float64 { return float64(s.MemoryLimit) })
+		m.containerMetric(containers, "netcontrol_container_network_receive_bytes_total", "counter", "Bytes received by the container.", func(s *ContainerStats) float64 { return float64(s.NetworkRx) })
+		m.containerMetric(containers, "netcontrol_container_network_transmit_bytes_total", "counter", "Bytes sent by the container.", func(s *ContainerStats) float64 { return float64(s.NetworkTx) })
+	}
+
+	m.gauge("netcontrol_kubernetes_up", "Whether the Kubernetes API is reachable.", boolValue(k8sUp))
+	if cluster != nil {
+		m.gauge("netcontrol_kubernetes_nodes", "Nodes in the cluster.", float64(cluster.Nodes))
+		m.gauge("netcontrol_kubernetes_nodes_ready", "Nodes that are ready.", float64(cluster.NodesReady))
+		m.gauge("netcontrol_kubernetes_pods", "Pods in all namespaces.", float64(cluster.Pods))
+		m.gauge("netcontrol_kubernetes_pods_running", "Pods in the running phase.", float64(cluster.PodsRunning))
+		m.gauge("netcontrol_kubernetes_deployments", "Deployments in all namespaces.", float64(cluster.Deployments))
+		m.gauge("netcontrol_kubernetes_services", "Services in all namespaces.", float64(cluster.Services))
+	}
+
+	iface := GetWireGuardService().InterfaceName()
+	m.gauge("netcontrol_wireguard_up", "Whether the WireGuard interface is up.", boolValue(wgUp))
+	if len(peers) > 0 {
+		m.help("netcontrol_wireguard_peer_receive_bytes_total", "counter", "Bytes received from the peer.")
+		for _, p := range peers {
+			m.sample("netcontrol_wireguard_peer_receive_bytes_total", float64(p.RxBytes), "interface", iface, "peer", p.PublicKey)
+		}
+		m.help("netcontrol_wireguard_peer_transmit_bytes_total", "counter", "Bytes sent to the peer.")
+		for _, p := range peers {
+			m.sample("netcontrol_wireguard_peer_transmit_bytes_total", float64(p.TxBytes), "interface", iface, "peer", p.PublicKey)
+		}
+	}
+
+	m.gauge("netcontrol_terminal_sessions", "Open web terminal sessions.", float64(GetPTYManager().Count()))
+
+	m.writeHTTPMetrics()
+}
+
+// collectContainers reads the stats of every running container, a few at a
+// time since each call waits for a CPU sample.
+func collectContainers(ctx context.Context) (bool, []containerSample) {
+	docker, err := GetDockerService()
+	if err != nil || !docker.IsAvailable(ctx) {
+		return false, nil
+	}
+	list, err := docker.ListContainers(ctx, false, nil)
+	if err != nil {
+		slog.WarnContext(ctx, "Failed to list containers for metrics", "error", err)
+		return true, nil
+	}
+
+	samples := make([]containerSample, len(list))
+	sem := make(chan struct{}, 8)
+	var wg sync.WaitGroup
+	for i, info := range list {
+		samples[i].info = info
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+			stats, err := docker.GetContainerStats(ctx, info.ID)
+			if err != nil {
+				slog.DebugContext(ctx, "Failed to read container stats", "container", info.ID, "error", err)
+				return
+			}
+			samples[i].stats = stats
+		}()
+	}
+	wg.Wait()
+	return true, samples
+}
+
+func boolValue(b bool) float64 {
+	if b {
+		return 1
+	}
+	return 0
+}
+
+// metricWriter writes the Prometheus text exposition format.
+type metricWriter struct {
+	w io.Writer
+}
+
+func (m *metricWriter) help(name, kind, help string) {
+	fmt.Fprintf(m.w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+// sample writes one value; labels are name, value pairs.
+func (m *metricWriter) sample(name string, value float64, labels ...string) {
+	var b strings.Builder
+	b.WriteString(name)
+	if len(labels) > 0 {
+		b.WriteByte('{')
+		for i := 0; i+1 < len(labels); i += 2 {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			b.WriteString(labels[i])
+			b.WriteString(`="`)
+			b.WriteString(escapeLabel(labels[i+1]))
+			b.WriteByte('"')
+		}
+		b.WriteByte('}')
+	}
+	fmt.Fprintf(m.w, "%s %s\n", b.String(), formatMetricValue(value))
+}
+
+func (m *metricWriter) gauge(name, help string, value float64) {
+	m.help(name, "gauge", help)
+	m.sample(name, value)
+}
+
+func (m *metricWriter) containerMetric(samples []containerSample, name, kind, help string, value func(*ContainerStats) float64) {
+	m.help(name, kind, help)
+	for _, s := range samples {
+		if s.stats == nil {
+			continue
+		}
+		m.sample(name, value(s.stats), "id", s.info.ID, "name", s.info.Name, "image", s.info.Image)
+	}
+}
+
+func (m *metricWriter) writeHTTPMetrics() {
+	httpMetricsMu.Lock()
+	defer httpMetricsMu.Unlock()
+
+	keys := make([]httpSeries, 0, len(httpMetrics))
+	for k := range httpMetrics {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		a, b := keys[i], keys[j]
+		if a.route != b.route {
+			return a.route < b.route
+		}
+		if a.method != b.method {
+			return a.method < b.method
+		}
+		return a.code < b.code
+	})
+
+	const name = "netcontrol_http_request_duration_seconds"
+	m.help(name, "histogram", "Latency of HTTP requests by route and status code.")
+	for _, k := range keys {
+		h := httpMetrics[k]
+		for i, bound := range httpBuckets {
+			m.sample(name+"_bucket", float64(h.counts[i]), "method", k.method, "route", k.route, "code", k.code, "le", formatMetricValue(bound))
+		}
+		m.sample(name+"_bucket", float64(h.count), "method", k.method, "route", k.route, "code", k.code, "le", "+Inf")
+		m.sample(name+"_sum", h.sum, "method", k.method, "route", k.route, "code", k.code)
+		m.sample(name+"_count", float64(h.count), "method", k.method, "route", k.route, "code", k.code)
+	}
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabel(value string) string {
+	return labelEscaper.Replace(value)
+}
+
+func formatMetricValue(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
@@ -0,0 +1,26 @@
+package services
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestObserveHTTPRequestFoldsUnknownMethods(t *testing.T) {
+	httpMetricsMu.Lock()
+	httpMetrics = map[httpSeries]*histogram{}
+	httpMetricsMu.Unlock()
+
+	for _, method := range []string{"PROPFIND", "FOO1", "FOO2", "get", http.MethodGet} {
+		ObserveHTTPRequest(method, "unmatched", http.StatusNotFound, time.Millisecond)
+	}
+
+	httpMetricsMu.Lock()
+	defer httpMetricsMu.Unlock()
+	if len(httpMetrics) != 2 {
+		t.Fatalf("got %d series, want GET and OTHER: %v", len(httpMetrics), httpMetrics)
+	}
+	if h := httpMetrics[httpSeries{method: "OTHER", route: "unmatched", code: "404"}]; h == nil || h.count != 4 {
+		t.Fatalf("OTHER series = %+v, want 4 requests", h)
+	}
+}
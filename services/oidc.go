@@ -0,0 +1,410 @@
+package services
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"netcontrol-containers/models"
+
+	"github.com/golang-jwt/jwt/v5"
+	"golang.org/x/oauth2"
+	"gorm.io/gorm"
+)
+
+// Settings keys for OpenID Connect single sign-on.
+const (
+	SettingOIDCEnabled       = "oidc.enabled"
+	SettingOIDCIssuer        = "oidc.issuer"
+	SettingOIDCClientID      = "oidc.client_id"
+	SettingOIDCClientSecret  = "oidc.client_secret"
+	SettingOIDCRedirectURL   = "oidc.redirect_url"
+	SettingOIDCScopes        = "oidc.scopes"
+	SettingOIDCUsernameClaim = "oidc.username_claim"
+	SettingOIDCGroupsClaim   = "oidc.groups_claim"
+	SettingOIDCRoleMapping   = "oidc.role_mapping"
+	SettingOIDCDefaultRole   = "oidc.default_role"
+)
+
+// OIDCConfig is the single sign-on configuration read from the settings
+// store.
+type OIDCConfig struct {
+	Enabled       bool   `json:"enabled"`
+	Issuer        string `json:"issuer"`
+	ClientID      string `json:"client_id"`
+	ClientSecret  string `json:"client_secret,omitempty"`
+	RedirectURL   string `json:"redirect_url"`
+	Scopes        string `json:"scopes"`
+	UsernameClaim string `json:"username_claim"`
+	GroupsClaim   string `json:"groups_claim"`
+	// RoleMapping maps IdP groups to panel roles, e.g.
+	// "panel-admins=admin,panel-ops=operator". The highest matching role wins.
+	RoleMapping string `json:"role_mapping"`
+	// DefaultRole applies when no group matches. Empty denies the login.
+	DefaultRole string `json:"default_role"`
+}
+
+func LoadOIDCConfig(db *gorm.DB) *OIDCConfig {
+	return oidcConfigFrom(func(key string) string { return models.GetSetting(db, key) })
+}
+
+// oidcConfigFrom builds the configuration from a settings lookup.
+func oidcConfigFrom(setting func(key string) string) *OIDCConfig {
+	cfg := &OIDCConfig{
+		Enabled:       setting(SettingOIDCEnabled) == "true",
+		Issuer:        strings.TrimSuffix(setting(SettingOIDCIssuer), "/"),
+		ClientID:      setting(SettingOIDCClientID),
+		ClientSecret:  setting(SettingOIDCClientSecret),
+		RedirectURL:   setting(SettingOIDCRedirectURL),
+		Scopes:        setting(SettingOIDCScopes),
+		UsernameClaim: setting(SettingOIDCUsernameClaim),
+		GroupsClaim:   setting(SettingOIDCGroupsClaim),
+		RoleMapping:   setting(SettingOIDCRoleMapping),
+		DefaultRole:   setting(SettingOIDCDefaultRole),
+	}
+	if cfg.Scopes == "" {
+		cfg.Scopes = "openid profile email groups"
+	}
+	if cfg.UsernameClaim == "" {
+		cfg.UsernameClaim = "preferred_username"
+	}
+	if cfg.GroupsClaim == "" {
+		cfg.GroupsClaim = "groups"
+	}
+	return cfg
+}
+
+func SaveOIDCConfig(db *gorm.DB, cfg *OIDCConfig) error {
+	values := map[string]*string{
+		SettingOIDCEnabled:       ptr(fmt.Sprintf("%t", cfg.Enabled)),
+		SettingOIDCIssuer:        ptr(strings.TrimSuffix(cfg.Issuer, "/")),
+		SettingOIDCClientID:      &cfg.ClientID,
+		SettingOIDCRedirectURL:   &cfg.RedirectURL,
+		SettingOIDCScopes:        &cfg.Scopes,
+		SettingOIDCUsernameClaim: &cfg.UsernameClaim,
+		SettingOIDCGroupsClaim:   &cfg.GroupsClaim,
+		SettingOIDCRoleMapping:   &cfg.RoleMapping,
+		SettingOIDCDefaultRole:   &cfg.DefaultRole,
+	}
+	// An empty secret keeps the stored one, so it never has to be echoed back
+	if cfg.ClientSecret != "" {
+		values[SettingOIDCClientSecret] = &cfg.ClientSecret
+	}
+	// Listeners reset the cached provider
+	return saveSettings(db, values)
+}
+
+// Validate checks the settings needed to offer single sign-on.
+func (cfg *OIDCConfig) Validate() error {
+	if cfg.Issuer == "" || cfg.ClientID == "" {
+		return errors.New("issuer and client_id are required")
+	}
+	if !strings.HasPrefix(cfg.Issuer, "https://") && !strings.HasPrefix(cfg.Issuer, "http://") {
+		return errors.New("issuer must be an http(s) URL")
+	}
+	if cfg.DefaultRole != "" && !models.ValidRole(cfg.DefaultRole) {
+		return errors.New("invalid default_role")
+	}
+	return nil
+}
+
+// MapRole returns the most privileged panel role granted by groups, or
+// DefaultRole when none matches.
+func (cfg *OIDCConfig) MapRole(groups []string) string {
+	return mapGroupsToRole(cfg.RoleMapping, cfg.DefaultRole, groups)
+}
+
+// mapGroupsToRole applies a "group=role,group=role" mapping. Group names
+// are compared case-insensitively.
+func mapGroupsToRole(mapping, defaultRole string, groups []string) string {
+	best := ""
+	for _, pair := range strings.Split(mapping, ",") {
+		group, role, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok || !models.ValidRole(strings.TrimSpace(role)) {
+			continue
+		}
+		group, role = strings.TrimSpace(group), strings.TrimSpace(role)
+		for _, g := range groups {
+			if strings.EqualFold(g, group) && (best == "" || models.RoleAtLeast(role, best)) {
+				best = role
+			}
+		}
+	}
+	if best == "" && models.ValidRole(defaultRole) {
+		return defaultRole
+	}
+	return best
+}
+
+// OIDCProvider holds the discovered endpoints and signing keys of the
+// configured issuer.
+type OIDCProvider struct {
+	Config *OIDCConfig
+
+	authURL  string
+	tokenURL string
+	jwksURL  string
+
+	mu          sync.Mutex
+	keys        map[string]interface{}
+	keysFetched time.Time
+}
+
+// OIDCIdentity is what the panel takes from a verified ID token.
+type OIDCIdentity struct {
+	Subject  string
+	Username string
+	Email    string
+	Groups   []string
+}
+
+var (
+	oidcProvider   *OIDCProvider
+	oidcProviderMu sync.Mutex
+	oidcHTTPClient = &http.Client{Timeout: 10 * time.Second}
+)
+
+func resetOIDCProvider() {
+	oidcProviderMu.Lock()
+	oidcProvider = nil
+	oidcProviderMu.Unlock()
+}
+
+// GetOIDCProvider returns the provider for the stored configuration,
+// running discovery on first use.
+func GetOIDCProvider(db *gorm.DB) (*OIDCProvider, error) {
+	oidcProviderMu.Lock()
+	defer oidcProviderMu.Unlock()
+
+	if oidcProvider != nil {
+		return oidcProvider, nil
+	}
+
+	cfg := LoadOIDCConfig(db)
+	if !cfg.Enabled {
+		return nil, errors.New("single sign-on is not enabled")
+	}
+	if cfg.Issuer == "" || cfg.ClientID == "" {
+		return nil, errors.New("single sign-on is not configured")
+	}
+
+	var discovery struct {
+		Issuer                string `json:"issuer"`
+		AuthorizationEndpoint string `json:"authorization_endpoint"`
+		TokenEndpoint         string `json:"token_endpoint"`
+		JWKSURI               string `json:"jwks_uri"`
+	}
+	if err := getJSON(cfg.Issuer+"/.well-known/openid-configuration", &discovery); err != nil {
+		return nil, fmt.Errorf("oidc discovery failed: %v", err)
+	}
+	if strings.TrimSuffix(discovery.Issuer, "/") != cfg.Issuer {
+		return nil, fmt.Errorf("oidc discovery returned issuer %q, expected %q", discovery.Issuer, cfg.Issuer)
+	}
+
+	oidcProvider = &OIDCProvider{
+		Config:   cfg,
+		authURL:  discovery.AuthorizationEndpoint,
+		tokenURL: discovery.TokenEndpoint,
+		jwksURL:  discovery.JWKSURI,
+	}
+	return oidcProvider, nil
+}
+
+// OAuth2Config returns the client configuration for the authorization code
+// flow. redirectURL is used when none is configured.
+func (p *OIDCProvider) OAuth2Config(redirectURL string) *oauth2.Config {
+	if p.Config.RedirectURL != "" {
+		redirectURL = p.Config.RedirectURL
+	}
+	return &oauth2.Config{
+		ClientID:     p.Config.ClientID,
+		ClientSecret: p.Config.ClientSecret,
+		RedirectURL:  redirectURL,
+		Scopes:       strings.Fields(p.Config.Scopes),
+		Endpoint: oauth2.Endpoint{
+			AuthURL:  p.authURL,
+			TokenURL: p.tokenURL,
+		},
+	}
+}
+
+// Exchange redeems an authorization code and its PKCE verifier for tokens.
+// The request uses the same client, and timeout, as discovery.
+func (p *OIDCProvider) Exchange(ctx context.Context, redirectURL, code, verifier string) (*oauth2.Token, error) {
+	ctx = context.WithValue(ctx, oauth2.HTTPClient, oidcHTTPClient)
+	return p.OAuth2Config(redirectURL).Exchange(ctx, code, oauth2.VerifierOption(verifier))
+}
+
+// VerifyIDToken checks the signature, issuer, audience, expiry and nonce of
+// an ID token and extracts the identity.
+func (p *OIDCProvider) VerifyIDToken(rawIDToken, nonce string) (*OIDCIdentity, error) {
+	claims := jwt.MapClaims{}
+	_, err := jwt.ParseWithClaims(rawIDToken, claims, p.keyFunc,
+		jwt.WithValidMethods([]string{"RS256", "RS384", "RS512", "ES256", "ES384", "ES512"}),
+		jwt.WithIssuer(p.Config.Issuer),
+		jwt.WithAudience(p.Config.ClientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(time.Minute),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("invalid id token: %v", err)
+	}
+
+	if got, _ := claims["nonce"].(string); got != nonce {
+		return nil, errors.New("invalid id token: nonce mismatch")
+	}
+
+	identity := &OIDCIdentity{}
+	identity.Subject, _ = claims["sub"].(string)
+	identity.Username, _ = claims[p.Config.UsernameClaim].(string)
+	identity.Email, _ = claims["email"].(string)
+	if identity.Subject == "" {
+		return nil, errors.New("invalid id token: missing subject")
+	}
+	if identity.Username == "" {
+		identity.Username = identity.Email
+	}
+	if identity.Username == "" {
+		identity.Username = identity.Subject
+	}
+
+	switch groups := claims[p.Config.GroupsClaim].(type) {
+	case []interface{}:
+		for _, g := range groups {
+			if s, ok := g.(string); ok {
+				identity.Groups = append(identity.Groups, strings.TrimPrefix(s, "/"))
+			}
+		}
+	case string:
+		identity.Groups = strings.Fields(strings.ReplaceAll(groups, ",", " "))
+	}
+
+	return identity, nil
+}
+
+func (p *OIDCProvider) keyFunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if key, ok := p.lookupKey(kid); ok {
+		return key, nil
+	}
+
+	// Unknown kid: the issuer may have rotated keys. Refetch, but not more
+	// than once every few seconds.
+	if time.Since(p.keysFetched) > 5*time.Second {
+		if err := p.fetchKeys(); err != nil {
+			return nil, err
+		}
+		if key, ok := p.lookupKey(kid); ok {
+			return key, nil
+		}
+	}
+	return nil, fmt.Errorf("unknown signing key %q", kid)
+}
+
+func (p *OIDCProvider) lookupKey(kid string) (interface{}, bool) {
+	if kid == "" && len(p.keys) == 1 {
+		for _, key := range p.keys {
+			return key, true
+		}
+	}
+	key, ok := p.keys[kid]
+	return key, ok
+}
+
+func (p *OIDCProvider) fetchKeys() error {
+	var set struct {
+		Keys []struct {
+			Kid string `json:"kid"`
+			Kty string `json:"kty"`
+			Use string `json:"use"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+			Crv string `json:"crv"`
+			X   string `json:"x"`
+			Y   string `json:"y"`
+		} `json:"keys"`
+	}
+	if err := getJSON(p.jwksURL, &set); err != nil {
+		return fmt.Errorf("failed to fetch signing keys: %v", err)
+	}
+
+	keys := make(map[string]interface{})
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		switch k.Kty {
+		case "RSA":
+			n, errN := decodeBase64URLInt(k.N)
+			e, errE := decodeBase64URLInt(k.E)
+			if errN != nil || errE != nil {
+				continue
+			}
+			keys[k.Kid] = &rsa.PublicKey{N: n, E: int(e.Int64())}
+		case "EC":
+			var curve elliptic.Curve
+			switch k.Crv {
+			case "P-256":
+				curve = elliptic.P256()
+			case "P-384":
+				curve = elliptic.P384()
+			case "P-521":
+				curve = elliptic.P521()
+			default:
+				continue
+			}
+			x, errX := decodeBase64URLInt(k.X)
+			y, errY := decodeBase64URLInt(k.Y)
+			if errX != nil || errY != nil {
+				continue
+			}
+			keys[k.Kid] = &ecdsa.PublicKey{Curve: curve, X: x, Y: y}
+		}
+	}
+
+	p.keys = keys
+	p.keysFetched = time.Now()
+	return nil
+}
+
+func decodeBase64URLInt(s string) (*big.Int, error) {
+	data, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+	if err != nil {
+		return nil, err
+	}
+	return new(big.Int).SetBytes(data), nil
+}
+
+func getJSON(url string, v interface{}) error {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := oidcHTTPClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%s returned %s", url, resp.Status)
+	}
+	return json.NewDecoder(resp.Body).Decode(v)
+}
@@ -0,0 +1,45 @@
+package services
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+type roundTripFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func TestOIDCExchangeUsesPanelClient(t *testing.T) {
+	var form string
+	saved := oidcHTTPClient
+	oidcHTTPClient = &http.Client{Timeout: time.Second, Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		body, _ := io.ReadAll(req.Body)
+		form = req.URL.String() + "?" + string(body)
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Header:     http.Header{"Content-Type": {"application/json"}},
+			Body:       io.NopCloser(strings.NewReader(`{"access_token": "at", "token_type": "Bearer", "id_token": "idt"}`)),
+			Request:    req,
+		}, nil
+	})}
+	t.Cleanup(func() { oidcHTTPClient = saved })
+
+	p := &OIDCProvider{Config: &OIDCConfig{ClientID: "panel"}, tokenURL: "https://idp.test/token"}
+	token, err := p.Exchange(context.Background(), "https://panel.test/auth/oidc/callback", "the-code", "the-verifier")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if token.Extra("id_token") != "idt" {
+		t.Fatalf("id token = %v", token.Extra("id_token"))
+	}
+	// Served by the panel's client, not http.DefaultClient without a timeout
+	if !strings.HasPrefix(form, "https://idp.test/token?") || !strings.Contains(form, "code=the-code") || !strings.Contains(form, "code_verifier=the-verifier") {
+		t.Fatalf("token request = %q", form)
+	}
+}
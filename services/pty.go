@@ -1,23 +1,31 @@
 package services
 
 import (
+	"context"
+	"errors"
 	"io"
 	"os"
 	"os/exec"
 	"runtime"
 	"sync"
+	"syscall"
+	"time"
 
 	"github.com/creack/pty"
 )
 
 type PTYSession struct {
-	ID   string
-	Cmd  *exec.Cmd
-	PTY  *os.File
-	Rows uint16
-	Cols uint16
-	Done chan struct{}
-	mu   sync.Mutex
+	ID string
+	// UserID and Username identify the panel user that opened the session.
+	// Only that user may attach to, resize or close it.
+	UserID   uint
+	Username string
+	Cmd      *exec.Cmd
+	PTY      *os.File
+	Rows     uint16
+	Cols     uint16
+	Done     chan struct{}
+	mu       sync.Mutex
 }
 
 type PTYManager struct {
@@ -36,12 +44,17 @@ func GetPTYManager() *PTYManager {
 	return ptyManager
 }
 
-func (m *PTYManager) CreateSession(sessionID string, rows, cols uint16) (*PTYSession, error) {
+var ErrSessionNotOwned = errors.New("terminal session belongs to another user")
+
+func (m *PTYManager) CreateSession(sessionID string, userID uint, username string, rows, cols uint16) (*PTYSession, error) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
 	// Check if session already exists
 	if session, exists := m.sessions[sessionID]; exists {
+		if session.UserID != userID {
+			return nil, ErrSessionNotOwned
+		}
 		return session, nil
 	}
 
@@ -65,12 +78,14 @@ func (m *PTYManager) CreateSession(sessionID string, rows, cols uint16) (*PTYSes
 	}
 
 	session := &PTYSession{
-		ID:   sessionID,
-		Cmd:  cmd,
-		PTY:  ptmx,
-		Rows: rows,
-		Cols: cols,
-		Done: make(chan struct{}),
+		ID:       sessionID,
+		UserID:   userID,
+		Username: username,
+		Cmd:      cmd,
+		PTY:      ptmx,
+		Rows:     rows,
+		Cols:     cols,
+		Done:     make(chan struct{}),
 	}
 
 	m.sessions[sessionID] = session
@@ -112,13 +127,50 @@ func (m *PTYManager) CloseSession(sessionID string) error {
 	return nil
 }
 
-func (m *PTYManager) ListSessions() []string {
+// CloseAll ends every session for shutdown. Shells get a hangup signal,
+// as when a terminal is closed, and are killed if they are still running
+// after grace.
+func (m *PTYManager) CloseAll(grace time.Duration) {
+	m.mu.RLock()
+	sessions := make([]*PTYSession, 0, len(m.sessions))
+	for _, session := range m.sessions {
+		sessions = append(sessions, session)
+	}
+	m.mu.RUnlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), grace)
+	defer cancel()
+	for _, session := range sessions {
+		if session.Cmd.Process != nil {
+			session.Cmd.Process.Signal(syscall.SIGHUP)
+		}
+	}
+	for _, session := range sessions {
+		select {
+		case <-session.Done:
+		case <-ctx.Done():
+		}
+		m.CloseSession(session.ID)
+	}
+}
+
+// Count returns the number of open sessions.
+func (m *PTYManager) Count() int {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+	return len(m.sessions)
+}
+
+// ListSessions returns the IDs of the sessions owned by userID.
+func (m *PTYManager) ListSessions(userID uint) []string {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
 
 	var sessions []string
-	for id := range m.sessions {
-		sessions = append(sessions, id)
+	for id, session := range m.sessions {
+		if session.UserID == userID {
+			sessions = append(sessions, id)
+		}
 	}
 	return sessions
 }
@@ -0,0 +1,461 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"netcontrol-containers/config"
+	"netcontrol-containers/database"
+	"netcontrol-containers/models"
+
+	"gorm.io/gorm"
+)
+
+// Settings keys for the services that can be reconfigured at runtime. When
+// unset, the value from the config file applies.
+const (
+	SettingDockerHost = "docker.host"
+	SettingKubeconfig = "kubernetes.kubeconfig"
+	SettingFileRoots  = "files.roots"
+)
+
+// Setting value types.
+const (
+	SettingTypeString = "string"
+	SettingTypeInt    = "int"
+	SettingTypeBool   = "bool"
+	SettingTypeEnum   = "enum"
+	// SettingTypeList is a comma separated list.
+	SettingTypeList = "list"
+)
+
+// SettingDef declares a key of the settings store: its type, default and
+// constraints. Keys that are not declared, such as the signing keys, can
+// not be read or written through the settings API.
+type SettingDef struct {
+	Key         string   `json:"key"`
+	Type        string   `json:"type"`
+	Description string   `json:"description"`
+	Default     string   `json:"default"`
+	Options     []string `json:"options,omitempty"`
+	Min         *int     `json:"min,omitempty"`
+	Max         *int     `json:"max,omitempty"`
+	// Secret values are write-only.
+	Secret bool `json:"secret,omitempty"`
+	// Validate checks a normalized value beyond the type constraints.
+	Validate func(value string) error `json:"-"`
+	// Check validates the key together with the settings it depends on.
+	// It runs whenever an update touches a key of the same group, the part
+	// before the first dot, and sees the values the update would leave.
+	Check func(value string, setting func(key string) string) error `json:"-"`
+}
+
+// SettingValue is a declared setting with its current value.
+type SettingValue struct {
+	*SettingDef
+	Value string `json:"value"`
+	// IsSet reports whether a value is stored rather than the default.
+	IsSet bool `json:"is_set"`
+}
+
+var (
+	settingDefs = map[string]*SettingDef{}
+
+	settingListenersMu sync.RWMutex
+	settingListeners   = map[string][]func(key, value string){}
+)
+
+func intPtr(n int) *int { return &n }
+
+func ptr(s string) *string { return &s }
+
+func init() {
+	roles := []string{"", models.RoleViewer, models.RoleOperator, models.RoleAdmin}
+
+	for _, def := range []*SettingDef{
+		{Key: models.SettingPanelHostname, Type: SettingTypeString, Description: "Public host name of the panel, optionally with a port", Validate: validateHostname},
+		{Key: SettingDockerHost, Type: SettingTypeString, Description: "Docker daemon address, e.g. unix:///var/run/docker.sock or tcp://host:2376. Empty uses the config file or DOCKER_HOST", Validate: validateDockerHost},
+		{Key: SettingKubeconfig, Type: SettingTypeString, Description: "Kubeconfig file. Empty uses the config file, in-cluster config or ~/.kube/config", Validate: validateAbsPaths},
+		{Key: SettingFileRoots, Type: SettingTypeList, Description: "Directories the file manager is confined to. Empty uses the config file, or allows the whole file system", Validate: validateAbsPaths},
+		{Key: SettingAuditRetentionDays, Type: SettingTypeInt, Description: "Days audit entries are kept, 0 keeps everything", Default: strconv.Itoa(DefaultAuditRetentionDays), Min: intPtr(0), Max: intPtr(3650)},
+		{Key: SettingJWTAlgorithm, Type: SettingTypeEnum, Description: "Algorithm of new signing keys. Changing it rotates the key", Default: JWTAlgorithmHS256, Options: []string{JWTAlgorithmHS256, JWTAlgorithmEdDSA}},
+		{Key: SettingJWTRotationDays, Type: SettingTypeInt, Description: "Days between signing key rotations, 0 disables rotation", Default: strconv.Itoa(DefaultJWTRotationDays), Min: intPtr(0), Max: intPtr(3650)},
+		{Key: SettingJWTGraceHours, Type: SettingTypeInt, Description: "Hours a replaced signing key keeps validating tokens", Default: strconv.Itoa(DefaultJWTGraceHours), Min: intPtr(0), Max: intPtr(24 * 365)},
+		{Key: SettingMetricsToken, Type: SettingTypeString, Description: "Bearer token Prometheus sends to scrape /metrics. Empty disables the endpoint", Secret: true, Validate: validateMetricsToken},
+
+		{Key: SettingOIDCEnabled, Type: SettingTypeBool, Description: "Offer single sign-on through OpenID Connect", Default: "false", Check: checkOIDCEnabled},
+		{Key: SettingOIDCIssuer, Type: SettingTypeString, Description: "OpenID Connect issuer URL", Validate: validateURL("http", "https")},
+		{Key: SettingOIDCClientID, Type: SettingTypeString, Description: "OpenID Connect client ID"},
+		{Key: SettingOIDCClientSecret, Type: SettingTypeString, Description: "OpenID Connect client secret", Secret: true},
+		{Key: SettingOIDCRedirectURL, Type: SettingTypeString, Description: "Callback URL registered with the provider. Empty derives it from the request", Validate: validateURL("http", "https")},
+		{Key: SettingOIDCScopes, Type: SettingTypeString, Description: "Space separated scopes to request", Default: "openid profile email groups"},
+		{Key: SettingOIDCUsernameClaim, Type: SettingTypeString, Description: "ID token claim holding the username", Default: "preferred_username"},
+		{Key: SettingOIDCGroupsClaim, Type: SettingTypeString, Description: "ID token claim holding the groups", Default: "groups"},
+		{Key: SettingOIDCRoleMapping, Type: SettingTypeString, Description: "Group to role mapping, e.g. panel-admins=admin,panel-ops=operator", Validate: validateRoleMapping},
+		{Key: SettingOIDCDefaultRole, Type: SettingTypeEnum, Description: "Role when no group matches. Empty denies the login", Options: roles},
+
+		{Key: SettingLDAPEnabled, Type: SettingTypeBool, Description: "Check passwords against an LDAP directory", Default: "false", Check: checkLDAPEnabled},
+		{Key: SettingLDAPURL, Type: SettingTypeString, Description: "Directory URL, ldap://host[:port] or ldaps://host[:port]", Validate: validateURL("ldap", "ldaps")},
+		{Key: SettingLDAPStartTLS, Type: SettingTypeBool, Description: "Upgrade ldap:// connections with StartTLS", Default: "false"},
+		{Key: SettingLDAPInsecureSkipVerify, Type: SettingTypeBool, Description: "Skip verifying the directory's certificate", Default: "false"},
+		{Key: SettingLDAPBindDN, Type: SettingTypeString, Description: "Service account used to search for users"},
+		{Key: SettingLDAPBindPassword, Type: SettingTypeString, Description: "Password of the service account", Secret: true},
+		{Key: SettingLDAPSearchBase, Type: SettingTypeString, Description: "Base DN to search for users"},
+		{Key: SettingLDAPUserFilter, Type: SettingTypeString, Description: "Filter locating the account, {username} is replaced by the login name", Default: "(uid={username})"},
+		{Key: SettingLDAPGroupAttribute, Type: SettingTypeString, Description: "User attribute listing the groups", Default: "memberOf"},
+		{Key: SettingLDAPRoleMapping, Type: SettingTypeString, Description: "Group CN to role mapping, e.g. panel-admins=admin", Validate: validateRoleMapping},
+		{Key: SettingLDAPDefaultRole, Type: SettingTypeEnum, Description: "Role when no group matches. Empty denies the login", Options: roles},
+	} {
+		settingDefs[def.Key] = def
+	}
+
+	// Services that cache clients pick up changes right away
+	OnSettingChange(SettingDockerHost, func(string, string) { ResetDockerService() })
+	OnSettingChange(SettingKubeconfig, func(string, string) { ResetKubernetesService() })
+	OnSettingChange("oidc.", func(string, string) { resetOIDCProvider() })
+	OnSettingChange(SettingAuditRetentionDays, func(string, string) { GetAuditLogger().Prune() })
+	OnSettingChange(SettingJWTAlgorithm, func(string, string) {
+		if _, err := GetJWTKeyManager().Rotate(); err != nil && !errors.Is(err, ErrJWTKeysStatic) {
+			slog.Error("Failed to rotate the signing key after the algorithm changed", "error", err)
+		}
+	})
+}
+
+// SettingDefs returns the declared settings sorted by key.
+func SettingDefs() []*SettingDef {
+	defs := make([]*SettingDef, 0, len(settingDefs))
+	for _, def := range settingDefs {
+		defs = append(defs, def)
+	}
+	sort.Slice(defs, func(i, j int) bool { return defs[i].Key < defs[j].Key })
+	return defs
+}
+
+// ListSettings returns every declared setting with its value. Secret values
+// are left out.
+func ListSettings() []SettingValue {
+	stored := map[string]string{}
+	var rows []models.Settings
+	database.Get().Find(&rows)
+	for _, row := range rows {
+		stored[row.Key] = row.Value
+	}
+
+	var values []SettingValue
+	for _, def := range SettingDefs() {
+		value, ok := stored[def.Key]
+		if !ok {
+			value = def.Default
+		}
+		if def.Secret {
+			value = ""
+		}
+		values = append(values, SettingValue{SettingDef: def, Value: value, IsSet: ok && stored[def.Key] != ""})
+	}
+	return values
+}
+
+// Setting returns the stored value of a declared key, or its default.
+func Setting(key string) string {
+	var setting models.Settings
+	if err := database.Get().Where("key = ?", key).First(&setting).Error; err != nil {
+		if def, ok := settingDefs[key]; ok {
+			return def.Default
+		}
+		return ""
+	}
+	return setting.Value
+}
+
+// SettingInt returns an int setting, falling back to the default when the
+// stored value is invalid.
+func SettingInt(key string) int {
+	n, err := strconv.Atoi(Setting(key))
+	if err != nil && settingDefs[key] != nil {
+		n, _ = strconv.Atoi(settingDefs[key].Default)
+	}
+	return n
+}
+
+func SettingBool(key string) bool {
+	return Setting(key) == "true"
+}
+
+// NormalizeSetting checks value against the declaration of key and returns
+// it in its stored form.
+func NormalizeSetting(key, value string) (string, error) {
+	def, ok := settingDefs[key]
+	if !ok {
+		return "", fmt.Errorf("%s: unknown setting", key)
+	}
+	value = strings.TrimSpace(value)
+
+	switch def.Type {
+	case SettingTypeInt:
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return "", fmt.Errorf("%s: must be a whole number", key)
+		}
+		if (def.Min != nil && n < *def.Min) || (def.Max != nil && n > *def.Max) {
+			return "", fmt.Errorf("%s: must be between %d and %d", key, *def.Min, *def.Max)
+		}
+		value = strconv.Itoa(n)
+	case SettingTypeBool:
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return "", fmt.Errorf("%s: must be true or false", key)
+		}
+		value = strconv.FormatBool(b)
+	case SettingTypeEnum:
+		if !slices.Contains(def.Options, value) {
+			return "", fmt.Errorf("%s: must be one of %s", key, strings.Join(def.Options, ", "))
+		}
+	case SettingTypeList:
+		var items []string
+		for _, item := range strings.Split(value, ",") {
+			if item = strings.TrimSpace(item); item != "" {
+				items = append(items, item)
+			}
+		}
+		value = strings.Join(items, ",")
+	}
+
+	if def.Validate != nil && value != "" {
+		if err := def.Validate(value); err != nil {
+			return "", fmt.Errorf("%s: %w", key, err)
+		}
+	}
+	return value, nil
+}
+
+// UpdateSettings validates every value, stores them all or none, and
+// notifies listeners of the keys that changed. A nil value resets the key
+// to its default.
+func UpdateSettings(values map[string]*string) error {
+	var errs []error
+	normalized := map[string]*string{}
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	slices.Sort(keys)
+	for _, key := range keys {
+		value := values[key]
+		if value == nil {
+			if _, ok := settingDefs[key]; !ok {
+				errs = append(errs, fmt.Errorf("%s: unknown setting", key))
+			}
+			normalized[key] = nil
+			continue
+		}
+		v, err := NormalizeSetting(key, *value)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		normalized[key] = &v
+	}
+	if err := errors.Join(errs...); err != nil {
+		return err
+	}
+
+	// The value of each key once the update is applied
+	setting := func(key string) string {
+		value, ok := normalized[key]
+		if !ok {
+			return Setting(key)
+		}
+		if value == nil {
+			return settingDefs[key].Default
+		}
+		return *value
+	}
+	for _, def := range SettingDefs() {
+		if def.Check == nil || !touchesGroup(keys, def.Key) {
+			continue
+		}
+		if err := def.Check(setting(def.Key), setting); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", def.Key, err))
+		}
+	}
+	if err := errors.Join(errs...); err != nil {
+		return err
+	}
+
+	return saveSettings(database.Get(), normalized)
+}
+
+// touchesGroup reports whether any of keys is in the group of key, e.g.
+// ldap.url for ldap.enabled.
+func touchesGroup(keys []string, key string) bool {
+	group, _, _ := strings.Cut(key, ".")
+	for _, k := range keys {
+		if strings.HasPrefix(k, group+".") {
+			return true
+		}
+	}
+	return false
+}
+
+// saveSettings writes values in one transaction and notifies listeners of
+// the keys that changed.
+func saveSettings(db *gorm.DB, values map[string]*string) error {
+	// Compare effective values so storing the default is not a change
+	old := map[string]string{}
+	for key := range values {
+		old[key] = Setting(key)
+	}
+
+	err := db.Transaction(func(tx *gorm.DB) error {
+		for key, value := range values {
+			if value == nil {
+				if err := tx.Unscoped().Where("key = ?", key).Delete(&models.Settings{}).Error; err != nil {
+					return err
+				}
+				continue
+			}
+			if err := models.SetSetting(tx, key, *value); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for key := range values {
+		if value := Setting(key); value != old[key] {
+			notifySettingChange(key, value)
+		}
+	}
+	return nil
+}
+
+// OnSettingChange registers fn to run after key changes. A key ending in
+// "." matches every key with that prefix.
+func OnSettingChange(key string, fn func(key, value string)) {
+	settingListenersMu.Lock()
+	defer settingListenersMu.Unlock()
+	settingListeners[key] = append(settingListeners[key], fn)
+}
+
+func notifySettingChange(key, value string) {
+	settingListenersMu.RLock()
+	var fns []func(key, value string)
+	for pattern, listeners := range settingListeners {
+		if pattern == key || (strings.HasSuffix(pattern, ".") && strings.HasPrefix(key, pattern)) {
+			fns = append(fns, listeners...)
+		}
+	}
+	settingListenersMu.RUnlock()
+
+	for _, fn := range fns {
+		fn(key, value)
+	}
+}
+
+// DockerHost returns the Docker daemon address from the settings, or else
+// the config file.
+func DockerHost() string {
+	if host := Setting(SettingDockerHost); host != "" {
+		return host
+	}
+	return config.Get().DockerHost
+}
+
+// Kubeconfig returns the kubeconfig path from the settings, or else the
+// config file.
+func Kubeconfig() string {
+	if path := Setting(SettingKubeconfig); path != "" {
+		return path
+	}
+	return config.Get().Kubeconfig
+}
+
+// FileRoots returns the directories the file manager is confined to from
+// the settings, or else the config file.
+func FileRoots() []string {
+	if roots := Setting(SettingFileRoots); roots != "" {
+		return strings.Split(roots, ",")
+	}
+	return config.Get().FileRoots
+}
+
+func validateHostname(value string) error {
+	if !models.ValidPanelHostname(value) {
+		return errors.New("must be a host name or address, optionally with a port")
+	}
+	return nil
+}
+
+func validateDockerHost(value string) error {
+	u, err := url.Parse(value)
+	if err != nil || !slices.Contains([]string{"unix", "tcp", "npipe", "ssh", "http", "https"}, u.Scheme) {
+		return errors.New("must be a URL such as unix:///var/run/docker.sock or tcp://host:2376")
+	}
+	return nil
+}
+
+func validateAbsPaths(value string) error {
+	for _, path := range strings.Split(value, ",") {
+		for _, p := range filepath.SplitList(path) {
+			if !filepath.IsAbs(p) {
+				return fmt.Errorf("%q is not an absolute path", p)
+			}
+		}
+	}
+	return nil
+}
+
+func validateURL(schemes ...string) func(string) error {
+	return func(value string) error {
+		u, err := url.Parse(value)
+		if err != nil || !slices.Contains(schemes, u.Scheme) || u.Host == "" {
+			return fmt.Errorf("must be a %s:// URL", strings.Join(schemes, ":// or "))
+		}
+		return nil
+	}
+}
+
+func validateMetricsToken(value string) error {
+	if len(value) < 16 || strings.ContainsAny(value, " \t\r\n") {
+		return errors.New("must be at least 16 characters without spaces")
+	}
+	return nil
+}
+
+// checkOIDCEnabled refuses to enable single sign-on, or to leave it
+// enabled, without the settings needed to reach the provider.
+func checkOIDCEnabled(value string, setting func(key string) string) error {
+	if value != "true" {
+		return nil
+	}
+	return oidcConfigFrom(setting).Validate()
+}
+
+// checkLDAPEnabled is checkOIDCEnabled for the directory.
+func checkLDAPEnabled(value string, setting func(key string) string) error {
+	if value != "true" {
+		return nil
+	}
+	return ldapConfigFrom(setting).Validate()
+}
+
+func validateRoleMapping(value string) error {
+	for _, pair := range strings.Split(value, ",") {
+		group, role, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok || strings.TrimSpace(group) == "" || !models.ValidRole(strings.TrimSpace(role)) {
+			return fmt.Errorf("%q must be group=role with role viewer, operator or admin", pair)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,62 @@
+package services
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"sync"
+
+	"netcontrol-containers/database"
+	"netcontrol-containers/models"
+)
+
+var (
+	setupComplete   bool
+	setupCompleteMu sync.Mutex
+	setupToken      string
+)
+
+// SetupRequired reports whether the first-run setup still has to create the
+// initial admin. Once setup is complete the answer is cached.
+func SetupRequired() bool {
+	setupCompleteMu.Lock()
+	defer setupCompleteMu.Unlock()
+
+	if !setupComplete {
+		setupComplete = models.GetSetting(database.Get(), models.SettingSetupCompleted) == "true"
+	}
+	return !setupComplete
+}
+
+// MarkSetupComplete locks the setup flow for good.
+func MarkSetupComplete() error {
+	setupCompleteMu.Lock()
+	defer setupCompleteMu.Unlock()
+
+	if err := models.SetSetting(database.Get(), models.SettingSetupCompleted, "true"); err != nil {
+		return err
+	}
+	setupComplete = true
+	return nil
+}
+
+// SetupToken returns the one-time code that has to accompany the setup
+// request. It is only shown in the server log, so whoever first reaches a
+// freshly installed panel over the network cannot claim it.
+func SetupToken() string {
+	setupCompleteMu.Lock()
+	defer setupCompleteMu.Unlock()
+
+	if setupToken == "" {
+		b := make([]byte, 8)
+		rand.Read(b)
+		setupToken = hex.EncodeToString(b)
+	}
+	return setupToken
+}
+
+// CheckSetupToken reports whether token matches the current setup code.
+func CheckSetupToken(token string) bool {
+	expected := SetupToken()
+	return subtle.ConstantTimeCompare([]byte(token), []byte(expected)) == 1
+}
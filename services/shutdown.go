@@ -0,0 +1,83 @@
+package services
+
+import (
+	"context"
+	"sync"
+)
+
+// ShutdownManager coordinates a graceful shutdown. Long-lived connections
+// such as WebSockets and event streams register with it, watch Context to
+// say goodbye to their clients, and are waited for before the process
+// exits.
+type ShutdownManager struct {
+	ctx     context.Context
+	cancel  context.CancelFunc
+	mu      sync.Mutex
+	closing bool
+	active  sync.WaitGroup
+}
+
+var (
+	shutdownManager     *ShutdownManager
+	shutdownManagerOnce sync.Once
+)
+
+func GetShutdownManager() *ShutdownManager {
+	shutdownManagerOnce.Do(func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		shutdownManager = &ShutdownManager{ctx: ctx, cancel: cancel}
+	})
+	return shutdownManager
+}
+
+// Context is cancelled when the shutdown begins.
+func (m *ShutdownManager) Context() context.Context {
+	return m.ctx
+}
+
+// ShuttingDown reports whether the shutdown has begun.
+func (m *ShutdownManager) ShuttingDown() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.closing
+}
+
+// Acquire registers a long-lived connection. It returns false once the
+// shutdown has begun; otherwise Release must be called when it ends.
+func (m *ShutdownManager) Acquire() bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.closing {
+		return false
+	}
+	m.active.Add(1)
+	return true
+}
+
+func (m *ShutdownManager) Release() {
+	m.active.Done()
+}
+
+// Begin refuses new connections and tells the registered ones to finish.
+func (m *ShutdownManager) Begin() {
+	m.mu.Lock()
+	m.closing = true
+	m.mu.Unlock()
+	m.cancel()
+}
+
+// Wait waits for the registered connections to end. It returns false if
+// ctx expired first.
+func (m *ShutdownManager) Wait(ctx context.Context) bool {
+	done := make(chan struct{})
+	go func() {
+		m.active.Wait()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
@@ -49,23 +49,63 @@ type DiskInfo struct {
 	UsedPercent float64 `json:"used_percent"`
 }
 
+// SystemStats reads the hardware and resource usage of the host, or
+// simulated figures in demo mode.
+type SystemStats interface {
+	Host() (*SystemInfo, error)
+	CPU() (*CPUInfo, error)
+	Memory() (*MemoryInfo, error)
+	Disks() ([]DiskInfo, error)
+	QuickStats() (map[string]interface{}, error)
+}
+
+func GetSystemStats() SystemStats {
+	if demo != nil {
+		return demo.system
+	}
+	return hostStats{}
+}
+
 func GetSystemInfo() (*SystemInfo, error) {
+	return GetSystemStats().Host()
+}
+
+func GetCPUInfo() (*CPUInfo, error) {
+	return GetSystemStats().CPU()
+}
+
+func GetMemoryInfo() (*MemoryInfo, error) {
+	return GetSystemStats().Memory()
+}
+
+func GetDiskInfo() ([]DiskInfo, error) {
+	return GetSystemStats().Disks()
+}
+
+func GetQuickStats() (map[string]interface{}, error) {
+	return GetSystemStats().QuickStats()
+}
+
+// hostStats reads this machine.
+type hostStats struct{}
+
+func (h hostStats) Host() (*SystemInfo, error) {
 	hostInfo, err := host.Info()
 	if err != nil {
 		return nil, err
 	}
 
-	cpuInfo, err := GetCPUInfo()
+	cpuInfo, err := h.CPU()
 	if err != nil {
 		return nil, err
 	}
 
-	memInfo, err := GetMemoryInfo()
+	memInfo, err := h.Memory()
 	if err != nil {
 		return nil, err
 	}
 
-	diskInfo, err := GetDiskInfo()
+	diskInfo, err := h.Disks()
 	if err != nil {
 		return nil, err
 	}
@@ -83,7 +123,7 @@ func GetSystemInfo() (*SystemInfo, error) {
 	}, nil
 }
 
-func GetCPUInfo() (*CPUInfo, error) {
+func (hostStats) CPU() (*CPUInfo, error) {
 	cpuInfos, err := cpu.Info()
 	if err != nil {
 		return nil, err
@@ -116,7 +156,7 @@ func GetCPUInfo() (*CPUInfo, error) {
 	}, nil
 }
 
-func GetMemoryInfo() (*MemoryInfo, error) {
+func (hostStats) Memory() (*MemoryInfo, error) {
 	memInfo, err := mem.VirtualMemory()
 	if err != nil {
 		return nil, err
@@ -131,7 +171,7 @@ func GetMemoryInfo() (*MemoryInfo, error) {
 	}, nil
 }
 
-func GetDiskInfo() ([]DiskInfo, error) {
+func (hostStats) Disks() ([]DiskInfo, error) {
 	partitions, err := disk.Partitions(false)
 	if err != nil {
 		return nil, err
@@ -158,7 +198,7 @@ func GetDiskInfo() ([]DiskInfo, error) {
 	return disks, nil
 }
 
-func GetQuickStats() (map[string]interface{}, error) {
+func (hostStats) QuickStats() (map[string]interface{}, error) {
 	cpuPercent, err := cpu.Percent(time.Millisecond*500, false)
 	if err != nil {
 		return nil, err
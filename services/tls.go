@@ -0,0 +1,279 @@
+package services
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"log/slog"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"netcontrol-containers/config"
+	"netcontrol-containers/database"
+	"netcontrol-containers/models"
+)
+
+const (
+	selfSignedCertName = "selfsigned.crt"
+	selfSignedKeyName  = "selfsigned.key"
+	selfSignedValidity = 365 * 24 * time.Hour
+	// selfSignedRenewBefore regenerates the certificate this long before it
+	// expires.
+	selfSignedRenewBefore = 30 * 24 * time.Hour
+
+	// certCheckInterval limits how often the certificate files are checked
+	// for changes.
+	certCheckInterval = 10 * time.Second
+)
+
+// CertReloader serves the configured certificate and picks up changes to
+// the files, or to which files are configured, without a restart.
+type CertReloader struct {
+	mu       sync.Mutex
+	certFile string
+	keyFile  string
+	modTime  time.Time
+	checked  time.Time
+	cert     *tls.Certificate
+	// selfSigned is set while serving the generated certificate
+	selfSigned bool
+}
+
+var (
+	certReloader     *CertReloader
+	certReloaderOnce sync.Once
+)
+
+func GetCertReloader() *CertReloader {
+	certReloaderOnce.Do(func() {
+		certReloader = &CertReloader{}
+	})
+	return certReloader
+}
+
+// ServerTLSConfig returns the TLS settings for the HTTPS listener.
+func ServerTLSConfig() *tls.Config {
+	return &tls.Config{
+		MinVersion:     config.Get().TLS.TLSMinVersion(),
+		GetCertificate: GetCertReloader().GetCertificate,
+		NextProtos:     []string{"h2", "http/1.1"},
+	}
+}
+
+// Load loads the certificate now, generating the self-signed one if no
+// files are configured. It reports errors that would otherwise only show
+// up in handshakes.
+func (r *CertReloader) Load() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.refresh(true)
+}
+
+// GetCertificate implements tls.Config.GetCertificate.
+func (r *CertReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if time.Since(r.checked) >= certCheckInterval {
+		if err := r.refresh(false); err != nil {
+			// Keep serving the previous certificate
+			slog.Error("Failed to reload TLS certificate", "error", err)
+		}
+	}
+	if r.cert == nil {
+		return nil, errors.New("no TLS certificate loaded")
+	}
+	return r.cert, nil
+}
+
+// Files returns the certificate and key currently served.
+func (r *CertReloader) Files() (string, string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.certFile, r.keyFile
+}
+
+func (r *CertReloader) refresh(force bool) error {
+	r.checked = time.Now()
+
+	certFile, keyFile := certFiles()
+	selfSigned := certFile == ""
+	if selfSigned {
+		if !force && r.selfSigned && r.cert.Leaf != nil && time.Until(r.cert.Leaf.NotAfter) > selfSignedRenewBefore {
+			return nil
+		}
+		var err error
+		if certFile, keyFile, err = EnsureSelfSignedCert(selfSignedDir(), certHosts()); err != nil {
+			return err
+		}
+	}
+
+	info, err := os.Stat(certFile)
+	if err != nil {
+		return err
+	}
+	if !force && certFile == r.certFile && keyFile == r.keyFile && info.ModTime().Equal(r.modTime) {
+		return nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+	if err != nil {
+		return err
+	}
+	if r.cert != nil {
+		slog.Info("Loaded TLS certificate", "file", certFile)
+	}
+	r.cert = &cert
+	r.certFile, r.keyFile = certFile, keyFile
+	r.selfSigned = selfSigned
+	r.modTime = info.ModTime()
+	return nil
+}
+
+// certFiles returns the configured certificate, falling back to the one
+// chosen during first-run setup.
+func certFiles() (string, string) {
+	cfg := config.Get()
+	if cfg.TLS.CertFile != "" {
+		return cfg.TLS.CertFile, cfg.TLS.KeyFile
+	}
+	if db := database.Get(); db != nil {
+		certFile := models.GetSetting(db, models.SettingTLSCertFile)
+		keyFile := models.GetSetting(db, models.SettingTLSKeyFile)
+		if certFile != "" && keyFile != "" {
+			return certFile, keyFile
+		}
+	}
+	return "", ""
+}
+
+// selfSignedDir keeps the generated certificate next to the database.
+func selfSignedDir() string {
+	return filepath.Join(filepath.Dir(config.Get().DBPath), "tls")
+}
+
+// certHosts lists the names and addresses the self-signed certificate is
+// issued for: localhost, the host name, the panel hostname and every
+// address of the host.
+func certHosts() []string {
+	hosts := []string{"localhost"}
+	if name, err := os.Hostname(); err == nil && name != "" {
+		hosts = append(hosts, name)
+	}
+	if db := database.Get(); db != nil {
+		if name := models.GetSetting(db, models.SettingPanelHostname); name != "" {
+			if host, _, err := net.SplitHostPort(name); err == nil {
+				name = host
+			}
+			hosts = append(hosts, name)
+		}
+	}
+	if addrs, err := net.InterfaceAddrs(); err == nil {
+		for _, addr := range addrs {
+			if ipNet, ok := addr.(*net.IPNet); ok && !ipNet.IP.IsLinkLocalUnicast() {
+				hosts = append(hosts, ipNet.IP.String())
+			}
+		}
+	}
+	return hosts
+}
+
+// EnsureSelfSignedCert returns a self-signed certificate in dir covering
+// hosts, generating a new one if there is none, it expires soon or it does
+// not cover every host.
+func EnsureSelfSignedCert(dir string, hosts []string) (string, string, error) {
+	certFile := filepath.Join(dir, selfSignedCertName)
+	keyFile := filepath.Join(dir, selfSignedKeyName)
+
+	if cert, err := tls.LoadX509KeyPair(certFile, keyFile); err == nil {
+		if leaf, err := x509.ParseCertificate(cert.Certificate[0]); err == nil &&
+			time.Until(leaf.NotAfter) > selfSignedRenewBefore && coversHosts(leaf, hosts) {
+			return certFile, keyFile, nil
+		}
+	}
+
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", "", err
+	}
+	certPEM, keyPEM, err := generateSelfSignedCert(hosts)
+	if err != nil {
+		return "", "", err
+	}
+	if err := os.WriteFile(keyFile, keyPEM, 0600); err != nil {
+		return "", "", err
+	}
+	if err := os.WriteFile(certFile, certPEM, 0644); err != nil {
+		return "", "", err
+	}
+	slog.Info("Generated a self-signed TLS certificate", "hosts", hosts, "file", certFile)
+	return certFile, keyFile, nil
+}
+
+func coversHosts(cert *x509.Certificate, hosts []string) bool {
+	for _, host := range hosts {
+		found := false
+		if ip := net.ParseIP(host); ip != nil {
+			for _, certIP := range cert.IPAddresses {
+				found = found || certIP.Equal(ip)
+			}
+		} else {
+			for _, name := range cert.DNSNames {
+				found = found || name == host
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+func generateSelfSignedCert(hosts []string) ([]byte, []byte, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, nil, err
+	}
+	serial, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return nil, nil, err
+	}
+
+	now := time.Now()
+	template := x509.Certificate{
+		SerialNumber:          serial,
+		Subject:               pkix.Name{CommonName: hosts[0], Organization: []string{"NetControl Containers"}},
+		NotBefore:             now.Add(-time.Hour),
+		NotAfter:              now.Add(selfSignedValidity),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	for _, host := range hosts {
+		if ip := net.ParseIP(host); ip != nil {
+			template.IPAddresses = append(template.IPAddresses, ip)
+		} else {
+			template.DNSNames = append(template.DNSNames, host)
+		}
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	if err != nil {
+		return nil, nil, err
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		return nil, nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}),
+		pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), nil
+}
@@ -1,23 +1,43 @@
 package services
 
 import (
+	"errors"
 	"fmt"
+	"log/slog"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"runtime"
+	"strconv"
 	"strings"
 	"sync"
+
+	"netcontrol-containers/config"
 )
 
-type WireGuardService struct {
+// WireGuardService manages the VPN interface of the host, or a simulated
+// one in demo mode.
+type WireGuardService interface {
+	InterfaceName() string
+	SaveConfig(content string) error
+	GetConfig() (string, error)
+	Connect() error
+	Disconnect() error
+	GetStatus() (*WireGuardStatus, error)
+	Transfer() ([]WireGuardPeerTransfer, bool)
+	// Usable returns why the VPN cannot be brought up here, or nil.
+	Usable() error
+}
+
+// wgQuick drives the interface with wg-quick and reads it with wg.
+type wgQuick struct {
 	ConfigPath string
 	Interface  string
 	mu         sync.Mutex
 }
 
 var (
-	wgService *WireGuardService
+	wgService *wgQuick
 	wgOnce    sync.Once
 )
 
@@ -32,10 +52,14 @@ type WireGuardStatus struct {
 	TxBytes       string `json:"tx_bytes"`
 }
 
-func GetWireGuardService() *WireGuardService {
+func GetWireGuardService() WireGuardService {
+	if demo != nil {
+		return demo.wireguard
+	}
 	wgOnce.Do(func() {
 		// Determine best path for config
-		configDir := "./data/wireguard"
+		localDir := filepath.Join(config.Get().DataDir, "wireguard")
+		configDir := localDir
 		if runtime.GOOS == "linux" {
 			// On Linux, prefer standard location if writable, otherwise fallback
 			// But for wg-quick, /etc/wireguard is standard.
@@ -47,11 +71,11 @@ func GetWireGuardService() *WireGuardService {
 		}
 
 		// Ensure directory exists if it's our local one
-		if configDir == "./data/wireguard" {
+		if configDir == localDir {
 			os.MkdirAll(configDir, 0755)
 		}
 
-		wgService = &WireGuardService{
+		wgService = &wgQuick{
 			ConfigPath: configDir,
 			Interface:  "wg0",
 		}
@@ -59,11 +83,25 @@ func GetWireGuardService() *WireGuardService {
 	return wgService
 }
 
-func (s *WireGuardService) GetConfigPath() string {
+func (s *wgQuick) InterfaceName() string {
+	return s.Interface
+}
+
+func (s *wgQuick) Usable() error {
+	if runtime.GOOS != "linux" {
+		return errors.New("WireGuard is only supported on Linux")
+	}
+	if _, err := os.Stat(s.GetConfigPath()); err != nil {
+		return errors.New("no WireGuard config saved")
+	}
+	return nil
+}
+
+func (s *wgQuick) GetConfigPath() string {
 	return filepath.Join(s.ConfigPath, s.Interface+".conf")
 }
 
-func (s *WireGuardService) SaveConfig(content string) error {
+func (s *wgQuick) SaveConfig(content string) error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
@@ -76,7 +114,7 @@ func (s *WireGuardService) SaveConfig(content string) error {
 	return os.WriteFile(path, []byte(content), 0600)
 }
 
-func (s *WireGuardService) GetConfig() (string, error) {
+func (s *wgQuick) GetConfig() (string, error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
@@ -92,7 +130,7 @@ func (s *WireGuardService) GetConfig() (string, error) {
 	return string(content), nil
 }
 
-func (s *WireGuardService) Connect() error {
+func (s *wgQuick) Connect() error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
@@ -118,14 +156,14 @@ func (s *WireGuardService) Connect() error {
 	return nil
 }
 
-func (s *WireGuardService) checkAndInstall() error {
+func (s *wgQuick) checkAndInstall() error {
 	// Check if wg-quick exists
 	_, err := exec.LookPath("wg-quick")
 	if err == nil {
 		return nil // Already installed
 	}
 
-	fmt.Println("WireGuard tools not found. Attempting automatic installation...")
+	slog.Info("WireGuard tools not found, attempting automatic installation")
 
 	// Detect package manager
 	if _, err := exec.LookPath("apt-get"); err == nil {
@@ -158,7 +196,7 @@ func (s *WireGuardService) checkAndInstall() error {
 	return nil
 }
 
-func (s *WireGuardService) Disconnect() error {
+func (s *wgQuick) Disconnect() error {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
@@ -179,7 +217,7 @@ func (s *WireGuardService) Disconnect() error {
 	return nil
 }
 
-func (s *WireGuardService) GetStatus() (*WireGuardStatus, error) {
+func (s *wgQuick) GetStatus() (*WireGuardStatus, error) {
 	// Check if we have a config
 	configExists := false
 	if _, err := os.Stat(s.GetConfigPath()); err == nil {
@@ -256,3 +294,39 @@ func (s *WireGuardService) GetStatus() (*WireGuardStatus, error) {
 
 	return status, nil
 }
+
+// WireGuardPeerTransfer holds the bytes exchanged with one peer.
+type WireGuardPeerTransfer struct {
+	PublicKey string
+	RxBytes   uint64
+	TxBytes   uint64
+}
+
+// Transfer returns the byte counters of every peer of the interface and
+// whether the interface is up.
+func (s *wgQuick) Transfer() ([]WireGuardPeerTransfer, bool) {
+	if runtime.GOOS != "linux" {
+		return nil, false
+	}
+
+	// Prints "<public key>\t<rx bytes>\t<tx bytes>" per peer
+	output, err := exec.Command("wg", "show", s.Interface, "transfer").Output()
+	if err != nil {
+		return nil, false
+	}
+
+	var peers []WireGuardPeerTransfer
+	for _, line := range strings.Split(strings.TrimSpace(string(output)), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) != 3 {
+			continue
+		}
+		rx, errRx := strconv.ParseUint(fields[1], 10, 64)
+		tx, errTx := strconv.ParseUint(fields[2], 10, 64)
+		if errRx != nil || errTx != nil {
+			continue
+		}
+		peers = append(peers, WireGuardPeerTransfer{PublicKey: fields[0], RxBytes: rx, TxBytes: tx})
+	}
+	return peers, true
+}
@@ -23,12 +23,40 @@ function formatDate(timestamp) {
     return new Date(timestamp * 1000).toLocaleString();
 }
 
+// URL prefix when served below a sub-path by a reverse proxy, e.g. /panel
+const BASE_PATH = document.querySelector('meta[name="base-path"]')?.content || '';
+
+function getCookie(name) {
+    const match = document.cookie.split('; ').find(c => c.startsWith(name + '='));
+    return match ? decodeURIComponent(match.slice(name.length + 1)) : '';
+}
+
+// Root-relative URLs such as /api/... get the base path prepended. Mutating
+// requests to the panel echo the csrf_token cookie in the X-CSRF-Token header
+// for CSRF protection.
+const nativeFetch = window.fetch.bind(window);
+window.fetch = (input, init = {}) => {
+    if (typeof input === 'string' && input.startsWith('/') && !input.startsWith('//') && !input.startsWith(BASE_PATH + '/')) {
+        input = BASE_PATH + input;
+    }
+    const method = (init.method || (input instanceof Request ? input.method : 'GET')).toUpperCase();
+    const url = new URL(input instanceof Request ? input.url : input, window.location.href);
+    if (!['GET', 'HEAD', 'OPTIONS'].includes(method) && url.origin === window.location.origin) {
+        const token = getCookie('csrf_token');
+        if (token) {
+            init = { ...init, headers: new Headers(init.headers || (input instanceof Request ? input.headers : undefined)) };
+            init.headers.set('X-CSRF-Token', token);
+        }
+    }
+    return nativeFetch(input, init);
+};
+
 // API client
 const api = {
     async get(url) {
         const response = await fetch(url);
         if (response.status === 401) {
-            window.location.href = '/login';
+            window.location.href = BASE_PATH + '/login';
             return null;
         }
         return response.json();
@@ -41,7 +69,7 @@ const api = {
             body: JSON.stringify(data)
         });
         if (response.status === 401) {
-            window.location.href = '/login';
+            window.location.href = BASE_PATH + '/login';
             return null;
         }
         return response.json();
@@ -50,7 +78,7 @@ const api = {
     async delete(url) {
         const response = await fetch(url, { method: 'DELETE' });
         if (response.status === 401) {
-            window.location.href = '/login';
+            window.location.href = BASE_PATH + '/login';
             return null;
         }
         return response.json();
@@ -60,7 +88,7 @@ const api = {
 // Logout function
 async function logout() {
     await api.post('/api/logout');
-    window.location.href = '/login';
+    window.location.href = BASE_PATH + '/login';
 }
 
 // Toast notifications
@@ -121,7 +149,7 @@ class WebSocketManager {
     
     connect() {
         const protocol = window.location.protocol === 'https:' ? 'wss:' : 'ws:';
-        this.ws = new WebSocket(`${protocol}//${window.location.host}${this.url}`);
+        this.ws = new WebSocket(`${protocol}//${window.location.host}${BASE_PATH}${this.url}`);
         
         this.ws.onopen = () => {
             this.reconnectAttempts = 0;